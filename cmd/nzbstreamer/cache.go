@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache/evictionpolicy"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/diskcache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/memorycache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/tieredcache"
+)
+
+var (
+	ErrUnknownCacheBackend = errors.New("unknown cache backend")
+	ErrUnknownEviction     = errors.New("unknown eviction policy")
+)
+
+func setupCache(c CacheConfig) (cache.ExpiringCache, error) {
+	switch c.Backend {
+	case "disk":
+		return setupDiskCache(c)
+	case "memory":
+		return setupMemoryCache(c)
+	case "tiered":
+		memoryCache, err := setupMemoryCache(c)
+		if err != nil {
+			return nil, err
+		}
+		diskCache, err := setupDiskCache(c)
+		if err != nil {
+			return nil, err
+		}
+		return tieredcache.NewCache(memoryCache, diskCache), nil
+	default:
+		return nil, fmt.Errorf("%w '%s', expected one of {disk, memory, tiered}", ErrUnknownCacheBackend, c.Backend)
+	}
+}
+
+// DecodedCacheDir is the dir inside the cache-path, decoded archive-content is stored in
+const DecodedCacheDir = "decoded"
+
+// setupDecodedCache creates the cache for decoded archive-content, nil when disabled
+// Its separate from the segment-cache, so decoded blocks and segments dont evict each other
+func setupDecodedCache(c CacheConfig) (cache.ExpiringCache, error) {
+	if c.DecodedMaxSize == 0 {
+		return nil, nil
+	}
+
+	decoded := c
+	decoded.Path = filepath.Join(c.Path, DecodedCacheDir)
+	decoded.MaxSize = c.DecodedMaxSize
+	decoded.MemoryMaxSize = c.DecodedMaxSize
+	decoded.NzbQuota = 0
+
+	if c.Backend == "memory" {
+		return setupMemoryCache(decoded)
+	}
+	return setupDiskCache(decoded)
+}
+
+// newEvictionPolicy creates a new policy-instance, as each cache has to track its own items
+func newEvictionPolicy(name string) (evictionpolicy.Policy, error) {
+	switch name {
+	case "lru":
+		return evictionpolicy.NewLRU(), nil
+	case "fifo":
+		return evictionpolicy.NewFIFO(), nil
+	case "lfu":
+		return evictionpolicy.NewLFU(), nil
+	case "arc":
+		return evictionpolicy.NewARC(), nil
+	default:
+		return nil, fmt.Errorf("%w '%s', expected one of {lru, fifo, lfu, arc}", ErrUnknownEviction, name)
+	}
+}
+
+func setupDiskCache(c CacheConfig) (*diskcache.Cache, error) {
+	policy, err := newEvictionPolicy(c.EvictionPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	diskCache, err := diskcache.NewCache(&diskcache.CacheOptions{
+		CacheDir:             c.Path,
+		MaxSize:              c.MaxSize,
+		MaxSizeEvictBlocking: false,
+		TTL:                  c.TTL,
+		EvictionPolicy:       policy,
+		Journal:              c.Journal,
+		OwnerQuota:           c.NzbQuota,
+		PinnedMaxSize:        c.PinnedMaxSize,
+		MinFreeSpace:         c.MinFreeSpace,
+		Compression:          c.Compression,
+		EncryptionSecret:     c.EncryptionSecret,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed creating disk-cache: %w", err)
+	}
+	return diskCache, nil
+}
+
+func setupMemoryCache(c CacheConfig) (*memorycache.Cache, error) {
+	policy, err := newEvictionPolicy(c.EvictionPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	memoryCache, err := memorycache.NewCache(&memorycache.CacheOptions{
+		MaxSize:        c.MemoryMaxSize,
+		TTL:            c.TTL,
+		EvictionPolicy: policy,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed creating memory-cache: %w", err)
+	}
+	return memoryCache, nil
+}
@@ -21,14 +21,34 @@ type WebdavConfig struct {
 	Password string `env:"WEBDAV_PASSWORD"`               // Password for WebDAV basic auth
 }
 
+type ApiConfig struct {
+	Address  string `env:"API_ADDRESS"`  // Address for management API; Disabled when unset
+	Username string `env:"API_USERNAME"` // Username for API basic auth; Authentication disabled when unset
+	Password string `env:"API_PASSWORD"` // Password for API basic auth
+}
+
 type MountConfig struct {
 	Path    string   `env:"MOUNT_PATH"`    // Path for FUSE mount; Disabled when unset
 	Options []string `env:"MOUNT_OPTIONS"` // Additional Options for FUSE mount; See mount.fuse3 Manpage for more information
 }
 
 type CacheConfig struct {
-	Path    string `env:"CACHE_PATH, default=.cache"` // Path for segment-cache
-	MaxSize int64  `env:"CACHE_MAX_SIZE, default=0"`  // Maximum cache size in bytes, if unset allows unlimited size (not recommended)
+	Backend          string        `env:"CACHE_BACKEND, default=disk"`               // Segment-cache backend, one of {disk, memory, tiered}; tiered keeps recently read segments in memory over disk
+	Path             string        `env:"CACHE_PATH, default=.cache"`                // Path for segment-cache
+	MaxSize          int64         `env:"CACHE_MAX_SIZE, default=0"`                 // Maximum cache size in bytes, if unset allows unlimited size (not recommended)
+	MinFreeSpace     int64         `env:"CACHE_MIN_FREE_SPACE, default=1073741824"`  // Minimum free disk space in bytes, segments are evicted when below and passed through uncached when that isnt enough; Disabled when 0
+	Compression      string        `env:"CACHE_COMPRESSION"`                         // Compress cached segments on disk, one of {zstd, lz4}; segments not compressing well are stored as is; Disabled when unset
+	EncryptionSecret string        `env:"CACHE_ENCRYPTION_SECRET"`                   // Encrypt cached segments on disk with a key derived from this secret, use a long random one; Segments cached without or with another secret are dropped; Disabled when unset
+	Journal          bool          `env:"CACHE_JOURNAL, default=false"`              // Keep an index-journal of cached segments, so startup doesnt need to read every segment; recommended for large caches
+	NzbQuota         int64         `env:"CACHE_NZB_QUOTA, default=0"`                // Maximum cache size in bytes a single nzb can use, its own segments are evicted first when exceeded; Unlimited when 0
+	PinnedSegments   int           `env:"CACHE_PINNED_SEGMENTS, default=0"`          // Segments at start and end of each file which are never evicted while the nzb exists; Disabled when 0
+	PinnedMaxSize    int64         `env:"CACHE_PINNED_MAX_SIZE, default=0"`          // Maximum size of pinned segments in bytes, further segments arent pinned; Half of CACHE_MAX_SIZE when 0
+	EvictionPolicy   string        `env:"CACHE_EVICTION_POLICY, default=lru"`        // Which segments are evicted first when space is needed, one of {lru, fifo, lfu, arc}
+	DecodedMaxSize   int64         `env:"CACHE_DECODED_MAX_SIZE, default=0"`         // Maximum size in bytes of the cache for decoded content of compressed archives, so seeking back doesnt decode again; stored in CACHE_PATH/decoded or memory for the memory backend; Disabled when 0
+	DecodedBlockSize int64         `env:"CACHE_DECODED_BLOCK_SIZE, default=1048576"` // Size of the blocks decoded content is cached in
+	MemoryMaxSize    int64         `env:"CACHE_MEMORY_MAX_SIZE, default=268435456"`  // Maximum memory-cache size in bytes, used by memory and tiered backend
+	TTL              time.Duration `env:"CACHE_TTL, default=0"`                      // Time after which cached segments expire; Disabled when 0
+	JanitorInterval  time.Duration `env:"CACHE_JANITOR_INTERVAL, default=1m"`        // Interval in which expired segments are removed; When 0, expired segments are only removed when accessed
 }
 
 type ReadaheadCacheConfig struct {
@@ -39,6 +59,11 @@ type ReadaheadCacheConfig struct {
 	MaxSize      int           `env:"READAHEAD_CACHE_MAX_SIZE, default=16777216"`   // Maximum readahead amount in bytes; Disables readahead-cache when 0
 }
 
+type PrefetchConfig struct {
+	Concurrency            int `env:"PREFETCH_CONCURRENCY, default=4"`             // Segments fetched at the same time over all prefetch-jobs
+	InteractiveConcurrency int `env:"PREFETCH_INTERACTIVE_CONCURRENCY, default=1"` // Segments fetched at the same time by prefetch-jobs while files are read; Pauses prefetching meanwhile when 0
+}
+
 type FolderWatcherConfig struct {
 	Path string `env:"FOLDER_WATCHER_PATH, default=.watch"` // Watch folder for adding nzbs (blackhole folder)
 }
@@ -48,6 +73,12 @@ type NzbConfig struct {
 	TryReadBytes          int64           `env:"NZB_TRY_READ_BYTES, default=1"`            // Bytes to try to read when scanning files
 	TryReadPercentage     float32         `env:"NZB_TRY_READ_PERCENTAGE, default=0"`       // Percentage of file to try to read when scanning files
 	FilesHealthyThreshold float32         `env:"NZB_FILES_HEALTHY_THRESHOLD, default=1.0"` // Above this percentage-threshold, try-read errors are allowed
+	NestedArchiveMaxDepth int             `env:"NZB_NESTED_ARCHIVE_MAX_DEPTH, default=1"`  // How many levels of archives inside archives are expanded; Disabled when 0
+	Passwords             []string        `env:"NZB_PASSWORDS"`                            // Comma-separated passwords tried on encrypted archives, after the ones found in the nzb
+}
+
+type StoreConfig struct {
+	Path string `env:"NZB_STORE_PATH"` // Folder to persist added nzbs in, including cached archive-listings; Disabled when unset
 }
 
 type FilesystemConfig struct {
@@ -64,9 +95,12 @@ type Config struct {
 	Usenet         UsenetConfig
 	Mount          MountConfig
 	Webdav         WebdavConfig
+	Api            ApiConfig
 	Cache          CacheConfig
 	ReadaheadCache ReadaheadCacheConfig
+	Prefetch       PrefetchConfig
 	NzbConfig      NzbConfig
+	Store          StoreConfig
 	Filesystem     FilesystemConfig
 	FolderWatcher  FolderWatcherConfig
 	Logging        LoggingConfig
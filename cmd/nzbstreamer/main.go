@@ -8,9 +8,12 @@ import (
 	"syscall"
 	"time"
 
+	"git.ruekov.eu/ruakij/nzbStreamer/internal/api"
 	"git.ruekov.eu/ruakij/nzbStreamer/internal/filehealth"
 	nntp "git.ruekov.eu/ruakij/nzbStreamer/internal/nntpclient"
 	"git.ruekov.eu/ruakij/nzbStreamer/internal/nzbrecordfactory"
+	"git.ruekov.eu/ruakij/nzbStreamer/internal/nzbstore"
+	"git.ruekov.eu/ruakij/nzbStreamer/internal/nzbstore/folderstore"
 	"git.ruekov.eu/ruakij/nzbStreamer/internal/nzbstore/stubstore"
 	"git.ruekov.eu/ruakij/nzbStreamer/internal/presentation"
 	"git.ruekov.eu/ruakij/nzbStreamer/internal/presentation/fusemount"
@@ -20,7 +23,8 @@ import (
 	"git.ruekov.eu/ruakij/nzbStreamer/internal/trigger/folderwatcher"
 	shutdownmanager "git.ruekov.eu/ruakij/nzbStreamer/pkg/ShutdownManager"
 	timeoutaction "git.ruekov.eu/ruakij/nzbStreamer/pkg/ShutdownManager/timeoutAction"
-	"git.ruekov.eu/ruakij/nzbStreamer/pkg/diskcache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/prefetch"
 	gowebdav "github.com/emersion/go-webdav"
 	"github.com/sethvargo/go-envconfig"
 )
@@ -28,6 +32,11 @@ import (
 const ShutdownTimeout time.Duration = 3 * time.Second
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "prefetch" {
+		os.Exit(runPrefetchCommand(os.Args[2:]))
+	}
+
+	initProfiling()
 	sm, ctx := shutdownmanager.NewShutdownManager(ShutdownTimeout, timeoutaction.Exit1)
 
 	start(ctx, sm)
@@ -68,15 +77,29 @@ func start(ctx context.Context, sm *shutdownmanager.ShutdownManager) {
 	}
 
 	// Setup cache
-	segmentCache, err := diskcache.NewCache(&diskcache.CacheOptions{
-		CacheDir:             c.Cache.Path,
-		MaxSize:              c.Cache.MaxSize,
-		MaxSizeEvictBlocking: false,
-	})
+	segmentCache, err := setupCache(c.Cache)
 	if err != nil {
 		slog.Error("Cache creation failed", "error", err)
 		os.Exit(1)
 	}
+	decodedCache, err := setupDecodedCache(c.Cache)
+	if err != nil {
+		slog.Error("Decoded-cache creation failed", "error", err)
+		os.Exit(1)
+	}
+	if c.Cache.TTL > 0 && c.Cache.JanitorInterval > 0 {
+		for _, expiringCache := range []cache.ExpiringCache{segmentCache, decodedCache} {
+			if expiringCache == nil {
+				continue
+			}
+			sm.AddService()
+			go func() {
+				defer sm.ServiceDone()
+				cache.RunJanitor(ctx, expiringCache, c.Cache.JanitorInterval)
+				slog.Info("Cache janitor exited")
+			}()
+		}
+	}
 
 	// Setup Presenters
 	var presenters []presentation.Presenter
@@ -96,9 +119,26 @@ func start(ctx context.Context, sm *shutdownmanager.ShutdownManager) {
 	// Setup services
 	factory := nzbrecordfactory.NewNzbFileFactory(segmentCache, nntpClient)
 	factory.SetAdaptiveReadaheadCacheSettings(c.ReadaheadCache.AvgSpeedTime, c.ReadaheadCache.Time, c.ReadaheadCache.MinSize, c.ReadaheadCache.LowBuffer, c.ReadaheadCache.MaxSize)
+	factory.SetNestedArchiveMaxDepth(c.NzbConfig.NestedArchiveMaxDepth)
+	factory.SetPasswords(c.NzbConfig.Passwords)
+	factory.SetPinnedSegments(c.Cache.PinnedSegments)
+	prefetchManager := prefetch.NewManager(ctx, &prefetch.ManagerOptions{
+		Concurrency:            c.Prefetch.Concurrency,
+		InteractiveConcurrency: c.Prefetch.InteractiveConcurrency,
+	})
+	factory.SetPrefetchManager(prefetchManager)
+	if decodedCache != nil {
+		factory.SetDecodedCache(decodedCache, c.Cache.DecodedBlockSize)
+	}
 
-	// store := folderStore.NewFolderStore()
-	store := stubstore.NewStubStore()
+	var store nzbstore.NzbStore = stubstore.NewStubStore()
+	if c.Store.Path != "" {
+		if err := os.MkdirAll(c.Store.Path, 0o755); err != nil {
+			slog.Error("Failed creating nzb-store folder", "error", err)
+			os.Exit(1)
+		}
+		store = folderstore.NewFolderStore(c.Store.Path)
+	}
 
 	folderTrigger := folderwatcher.NewFolderWatcher(c.FolderWatcher.Path)
 
@@ -114,6 +154,8 @@ func start(ctx context.Context, sm *shutdownmanager.ShutdownManager) {
 	service.SetPathFlatteningDepth(c.Filesystem.FlattenMaxDepth)
 	service.SetFilenameReplacementBelowLevensteinRatio(c.Filesystem.FixFilenameThreshold)
 	service.SetFilesHealthyThreshold(c.NzbConfig.FilesHealthyThreshold)
+	service.SetPrefetchManager(prefetchManager)
+	factory.SetChecksumListener(service.ReportChecksum)
 
 	// Start services
 	if err = service.Init(); err != nil {
@@ -160,4 +202,35 @@ func start(ctx context.Context, sm *shutdownmanager.ShutdownManager) {
 			slog.Info("Mount exited")
 		}()
 	}
+
+	// Api
+	if c.Api.Address != "" {
+		sm.AddService()
+		go func() {
+			defer sm.ServiceDone()
+
+			var authConfig *api.BasicAuthConfig
+			if c.Api.Username != "" {
+				authConfig = &api.BasicAuthConfig{
+					Username: c.Api.Username,
+					Password: c.Api.Password,
+				}
+			}
+
+			apiHandler := api.NewApi(service, prefetchManager)
+			apiHandler.SetSegmentStats(factory.SegmentStats())
+			for name, statsCache := range map[string]cache.ExpiringCache{"segments": segmentCache, "decoded": decodedCache} {
+				if statsCache, ok := statsCache.(cache.StatsCache); ok {
+					apiHandler.AddCacheStats(name, statsCache)
+				}
+			}
+
+			err := api.Listen(ctx, c.Api.Address, apiHandler, authConfig)
+			if err != nil {
+				slog.Error("Error in api", "error", err)
+				os.Exit(1)
+			}
+			slog.Info("Api exited")
+		}()
+	}
 }
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/internal/api"
+	"github.com/sethvargo/go-envconfig"
+)
+
+const prefetchPollInterval = time.Second
+
+var errPrefetchUsage = errors.New("usage: nzbstreamer prefetch [-range offset:length]... [-detach] <nzb> [file]\n" +
+	"       nzbstreamer prefetch -list\n" +
+	"       nzbstreamer prefetch -cancel <id>")
+
+// rangeFlags collects repeated -range flags
+type rangeFlags []api.PrefetchRange
+
+func (f *rangeFlags) String() string {
+	return fmt.Sprint(*f)
+}
+
+func (f *rangeFlags) Set(value string) error {
+	offset, length, _ := strings.Cut(value, ":")
+	var prefetchRange api.PrefetchRange
+	var err error
+	if prefetchRange.Offset, err = strconv.ParseInt(offset, 10, 64); err != nil {
+		return fmt.Errorf("invalid offset: %w", err)
+	}
+	if length != "" {
+		if prefetchRange.Length, err = strconv.ParseInt(length, 10, 64); err != nil {
+			return fmt.Errorf("invalid length: %w", err)
+		}
+	}
+	*f = append(*f, prefetchRange)
+	return nil
+}
+
+// runPrefetchCommand talks to the api of the running service, configured by the same env-variables; Returns the exit-code
+// Without -detach, the progress is followed until the job finished and interrupting cancels it
+func runPrefetchCommand(args []string) int {
+	flags := flag.NewFlagSet("prefetch", flag.ContinueOnError)
+	var ranges rangeFlags
+	flags.Var(&ranges, "range", "Byte-range offset:length of the file to prefetch, length can be omitted to reach to the end; Repeatable")
+	detach := flags.Bool("detach", false, "Only start the job, dont follow its progress")
+	list := flags.Bool("list", false, "List prefetch-jobs")
+	cancel := flags.String("cancel", "", "Cancel the prefetch-job with this id")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if !*list && *cancel == "" && (flags.NArg() < 1 || flags.NArg() > 2) {
+		fmt.Fprintln(os.Stderr, errPrefetchUsage)
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	var c ApiConfig
+	if err := envconfig.Process(ctx, &c); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed reading Env-variables for config:", err)
+		return 1
+	}
+	client, err := newApiClient(&c)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	switch {
+	case *list:
+		err = client.listPrefetchJobs(ctx)
+	case *cancel != "":
+		err = client.cancelPrefetchJob(ctx, *cancel)
+	default:
+		request := api.PrefetchRequest{
+			Nzb:    flags.Arg(0),
+			File:   flags.Arg(1),
+			Ranges: ranges,
+		}
+		err = client.prefetch(ctx, &request, !*detach)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+type apiClient struct {
+	baseURL string
+	config  *ApiConfig
+	client  *http.Client
+}
+
+func newApiClient(config *ApiConfig) (*apiClient, error) {
+	if config.Address == "" {
+		return nil, errors.New("API_ADDRESS is unset, the api is required for prefetching")
+	}
+	address := config.Address
+	// Listening on all interfaces, reachable locally
+	if strings.HasPrefix(address, ":") {
+		address = "localhost" + address
+	}
+
+	return &apiClient{
+		baseURL: "http://" + address,
+		config:  config,
+		client:  &http.Client{Timeout: api.ReadTimeout},
+	}, nil
+}
+
+// do sends the request and decodes the json-response into response
+func (c *apiClient) do(ctx context.Context, method, path string, body, response any) error {
+	var requestBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed encoding request: %w", err)
+		}
+		requestBody = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, requestBody)
+	if err != nil {
+		return fmt.Errorf("failed creating request: %w", err)
+	}
+	if c.config.Username != "" {
+		request.SetBasicAuth(c.config.Username, c.config.Password)
+	}
+
+	res, err := c.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed requesting api: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		message, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("api responded %s: %s", res.Status, strings.TrimSpace(string(message)))
+	}
+	if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+		return fmt.Errorf("failed decoding response: %w", err)
+	}
+	return nil
+}
+
+func (c *apiClient) prefetch(ctx context.Context, request *api.PrefetchRequest, follow bool) error {
+	var job api.PrefetchJobResponse
+	if err := c.do(ctx, http.MethodPost, "/api/prefetch", request, &job); err != nil {
+		return err
+	}
+	fmt.Printf("Started prefetch-job %s for %s with %d segments\n", job.ID, job.Name, job.Total)
+	if !follow {
+		return nil
+	}
+
+	ticker := time.NewTicker(prefetchPollInterval)
+	defer ticker.Stop()
+	for job.State == "running" {
+		select {
+		case <-ctx.Done():
+			// Context is already done, so the cancel-request needs its own
+			return c.cancelPrefetchJob(context.Background(), job.ID)
+		case <-ticker.C:
+		}
+
+		if err := c.do(ctx, http.MethodGet, "/api/prefetch/"+url.PathEscape(job.ID), nil, &job); err != nil {
+			// Interrupted, cancelled on the next iteration
+			if ctx.Err() != nil {
+				continue
+			}
+			return err
+		}
+		printPrefetchJob(&job)
+	}
+
+	if job.State != "done" {
+		return fmt.Errorf("prefetch-job %s %s", job.ID, job.State)
+	}
+	return nil
+}
+
+func (c *apiClient) listPrefetchJobs(ctx context.Context) error {
+	var jobs []api.PrefetchJobResponse
+	if err := c.do(ctx, http.MethodGet, "/api/prefetch", nil, &jobs); err != nil {
+		return err
+	}
+	for i := range jobs {
+		printPrefetchJob(&jobs[i])
+	}
+	return nil
+}
+
+func (c *apiClient) cancelPrefetchJob(ctx context.Context, id string) error {
+	var job api.PrefetchJobResponse
+	if err := c.do(ctx, http.MethodDelete, "/api/prefetch/"+url.PathEscape(id), nil, &job); err != nil {
+		return err
+	}
+	fmt.Printf("Cancelled prefetch-job %s\n", job.ID)
+	return nil
+}
+
+func printPrefetchJob(job *api.PrefetchJobResponse) {
+	progress := 100.0
+	if job.Total > 0 {
+		progress = float64(job.Done+job.Failed) / float64(job.Total) * 100
+	}
+	fmt.Printf("%s\t%s\t%s\t%5.1f%%\t%d/%d segments, %d failed\t%s\n", job.ID, job.Name, job.State, progress, job.Done, job.Total, job.Failed, job.Error)
+}
@@ -8,7 +8,8 @@ import (
 	"github.com/arl/statsviz"
 )
 
-func init() {
+// initProfiling starts the profiling-servers, only for the service itself as they would clash with a running one
+func initProfiling() {
 	initPprof()
 	initStatsviz()
 }
@@ -17,9 +17,6 @@ require (
 	github.com/hashicorp/errwrap v1.1.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
 	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
-	github.com/klauspost/compress v1.17.11 // indirect
-	github.com/pierrec/lz4/v4 v4.1.22 // indirect
-	github.com/ulikunitz/xz v0.5.12 // indirect
 	go4.org v0.0.0-20200411211856-f5505b9728dd // indirect
 	golang.org/x/sys v0.29.0 // indirect
 	golang.org/x/text v0.21.0 // indirect
@@ -32,5 +29,8 @@ require (
 	github.com/emersion/go-webdav v0.6.0
 	github.com/fsnotify/fsnotify v1.8.0
 	github.com/hanwen/go-fuse/v2 v2.7.2
+	github.com/klauspost/compress v1.17.11
+	github.com/pierrec/lz4/v4 v4.1.22
 	github.com/sethvargo/go-envconfig v1.1.0
+	github.com/ulikunitz/xz v0.5.12
 )
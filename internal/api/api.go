@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/fullcacheresource"
+)
+
+var logger = slog.With("Module", "Api")
+
+const (
+	ReadTimeout       = 30 * time.Second
+	WriteTimeout      = 5 * time.Minute // Supplying a password rebuilds the nzb, which reads archive-headers
+	IdleTimeout       = 60 * time.Second
+	ReadHeaderTimeout = 10 * time.Second
+)
+
+type BasicAuthConfig struct {
+	Username string
+	Password string
+}
+
+// Api serves endpoints for managing the running service
+type Api struct {
+	mux        *http.ServeMux
+	nzbService NzbService
+	prefetcher Prefetcher
+	// For stats and metrics, by name
+	caches       map[string]cache.StatsCache
+	segmentStats *fullcacheresource.Stats
+}
+
+func NewApi(nzbService NzbService, prefetcher Prefetcher) *Api {
+	a := &Api{
+		mux:        http.NewServeMux(),
+		nzbService: nzbService,
+		prefetcher: prefetcher,
+		caches:     make(map[string]cache.StatsCache),
+	}
+
+	a.mux.HandleFunc("GET /api/nzbs/needs-password", a.handleListNzbsNeedingPassword)
+	a.mux.HandleFunc("PUT /api/nzbs/{name}/password", a.handleSetNzbPassword)
+	a.mux.HandleFunc("GET /api/nzbs/{name}/health", a.handleGetNzbHealth)
+	a.mux.HandleFunc("POST /api/prefetch", a.handleStartPrefetch)
+	a.mux.HandleFunc("GET /api/prefetch", a.handleListPrefetchJobs)
+	a.mux.HandleFunc("GET /api/prefetch/{id}", a.handleGetPrefetchJob)
+	a.mux.HandleFunc("DELETE /api/prefetch/{id}", a.handleCancelPrefetchJob)
+	a.mux.HandleFunc("GET /api/stats", a.handleGetStats)
+	a.mux.HandleFunc("GET /metrics", a.handleGetMetrics)
+
+	return a
+}
+
+func (a *Api) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mux.ServeHTTP(w, r)
+}
+
+func basicAuth(handler http.Handler, config *BasicAuthConfig) http.Handler {
+	if config == nil || config.Username == "" {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		// Both compared in constant time, so timing doesnt reveal how much matched
+		userMatches := subtle.ConstantTimeCompare([]byte(user), []byte(config.Username)) == 1
+		passMatches := subtle.ConstantTimeCompare([]byte(pass), []byte(config.Password)) == 1
+		if !ok || !userMatches || !passMatches {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		logger.Error("Failed writing response", "error", err)
+	}
+}
+
+func Listen(ctx context.Context, listenAddress string, handler http.Handler, authConfig *BasicAuthConfig) error {
+	srv := &http.Server{
+		Addr:              listenAddress,
+		Handler:           basicAuth(handler, authConfig),
+		ReadTimeout:       ReadTimeout,
+		WriteTimeout:      WriteTimeout,
+		IdleTimeout:       IdleTimeout,
+		ReadHeaderTimeout: ReadHeaderTimeout,
+	}
+
+	go func() {
+		<-ctx.Done()
+		logger.Debug("Shutting down server")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Error("Server shutdown error", "error", err)
+		}
+	}()
+
+	logger.Info("Server starting", "Address", listenAddress)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed listening: %w", err)
+	}
+	return nil
+}
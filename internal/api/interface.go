@@ -0,0 +1,19 @@
+package api
+
+import (
+	"git.ruekov.eu/ruakij/nzbStreamer/internal/service/nzbservice"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/prefetch"
+)
+
+type NzbService interface {
+	ListNzbsNeedingPassword() []string
+	SetNzbPassword(metaName, password string) error
+	GetNzbHealth(metaName string) (nzbservice.NzbHealth, error)
+	Prefetch(metaName, file string, ranges []prefetch.Range) (prefetch.JobStatus, error)
+}
+
+type Prefetcher interface {
+	Jobs() []prefetch.JobStatus
+	Job(id string) (prefetch.JobStatus, error)
+	Cancel(id string) (prefetch.JobStatus, error)
+}
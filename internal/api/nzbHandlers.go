@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/internal/nzbrecordfactory"
+	"git.ruekov.eu/ruakij/nzbStreamer/internal/service/nzbservice"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/nzbparser"
+)
+
+func (a *Api) handleListNzbsNeedingPassword(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, a.nzbService.ListNzbsNeedingPassword())
+}
+
+type setPasswordRequest struct {
+	Password string `json:"password"`
+}
+
+func (a *Api) handleSetNzbPassword(w http.ResponseWriter, r *http.Request) {
+	var request setPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Password == "" {
+		http.Error(w, "body must be json with non-empty password", http.StatusBadRequest)
+		return
+	}
+
+	err := a.nzbService.SetNzbPassword(r.PathValue("name"), request.Password)
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, nzbservice.ErrNzbNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, nzbrecordfactory.ErrPasswordRequired):
+		http.Error(w, "password didnt work", http.StatusUnprocessableEntity)
+	default:
+		logger.Error("Failed setting nzb password", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+type nzbHealthResponse struct {
+	Name string `json:"name"`
+	// Files were removed as too many are unhealthy
+	Broken  bool                 `json:"broken"`
+	Entries []archiveEntryHealth `json:"entries"`
+}
+
+type archiveEntryHealth struct {
+	Archive string `json:"archive"`
+	Entry   string `json:"entry"`
+	Path    string `json:"path,omitempty"`
+	// valid, invalid or unverified
+	Checksum string `json:"checksum"`
+}
+
+func (a *Api) handleGetNzbHealth(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	health, err := a.nzbService.GetNzbHealth(name)
+	if errors.Is(err, nzbservice.ErrNzbNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed getting nzb health", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := nzbHealthResponse{
+		Name:    name,
+		Broken:  health.Broken,
+		Entries: make([]archiveEntryHealth, 0, len(health.Entries)),
+	}
+	for _, entry := range health.Entries {
+		checksum := string(entry.Checksum)
+		if entry.Checksum == nzbparser.ChecksumUnverified {
+			checksum = "unverified"
+		}
+		response.Entries = append(response.Entries, archiveEntryHealth{
+			Archive:  entry.Group,
+			Entry:    entry.Entry,
+			Path:     entry.Path,
+			Checksum: checksum,
+		})
+	}
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/internal/service/nzbservice"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/prefetch"
+)
+
+// PrefetchRequest starts prefetching a file of an nzb, or all of its files when File is empty
+type PrefetchRequest struct {
+	Nzb string `json:"nzb"`
+	// Path as presented below the nzb-folder
+	File   string          `json:"file,omitempty"`
+	Ranges []PrefetchRange `json:"ranges,omitempty"`
+}
+
+// PrefetchRange in bytes of the file, Length 0 reaches to the end
+type PrefetchRange struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length,omitempty"`
+}
+
+type PrefetchJobResponse struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	State string `json:"state"`
+	// Count of segments, of the ones in cache and of the ones failed
+	Total    int        `json:"total"`
+	Done     int        `json:"done"`
+	Failed   int        `json:"failed"`
+	Error    string     `json:"error,omitempty"`
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+}
+
+func prefetchJobResponse(status prefetch.JobStatus) PrefetchJobResponse {
+	response := PrefetchJobResponse{
+		ID:      status.ID,
+		Name:    status.Name,
+		State:   string(status.State),
+		Total:   status.Total,
+		Done:    status.Done,
+		Failed:  status.Failed,
+		Error:   status.Error,
+		Started: status.Started,
+	}
+	if !status.Finished.IsZero() {
+		response.Finished = &status.Finished
+	}
+	return response
+}
+
+func (a *Api) handleStartPrefetch(w http.ResponseWriter, r *http.Request) {
+	var request PrefetchRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Nzb == "" {
+		http.Error(w, "body must be json with non-empty nzb", http.StatusBadRequest)
+		return
+	}
+
+	ranges := make([]prefetch.Range, 0, len(request.Ranges))
+	for _, requestRange := range request.Ranges {
+		if requestRange.Offset < 0 || requestRange.Length < 0 {
+			http.Error(w, "ranges must not be negative", http.StatusBadRequest)
+			return
+		}
+		ranges = append(ranges, prefetch.Range{Offset: requestRange.Offset, Length: requestRange.Length})
+	}
+
+	status, err := a.nzbService.Prefetch(request.Nzb, request.File, ranges)
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusAccepted, prefetchJobResponse(status))
+	case errors.Is(err, nzbservice.ErrNzbNotFound), errors.Is(err, nzbservice.ErrFileNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, nzbservice.ErrPrefetchRangesUnsupported):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		logger.Error("Failed starting prefetch", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (a *Api) handleListPrefetchJobs(w http.ResponseWriter, _ *http.Request) {
+	jobs := a.prefetcher.Jobs()
+	response := make([]PrefetchJobResponse, 0, len(jobs))
+	for _, status := range jobs {
+		response = append(response, prefetchJobResponse(status))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (a *Api) handleGetPrefetchJob(w http.ResponseWriter, r *http.Request) {
+	status, err := a.prefetcher.Job(r.PathValue("id"))
+	if errors.Is(err, prefetch.ErrJobNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed getting prefetch-job", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, prefetchJobResponse(status))
+}
+
+func (a *Api) handleCancelPrefetchJob(w http.ResponseWriter, r *http.Request) {
+	status, err := a.prefetcher.Cancel(r.PathValue("id"))
+	if errors.Is(err, prefetch.ErrJobNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed cancelling prefetch-job", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, prefetchJobResponse(status))
+}
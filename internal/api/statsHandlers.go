@@ -0,0 +1,139 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/fullcacheresource"
+)
+
+// AddCacheStats adds the cache under name to the stats and metrics
+func (a *Api) AddCacheStats(name string, statsCache cache.StatsCache) {
+	a.caches[name] = statsCache
+}
+
+// SetSegmentStats sets how segments were served, for the stats and metrics
+func (a *Api) SetSegmentStats(segmentStats *fullcacheresource.Stats) {
+	a.segmentStats = segmentStats
+}
+
+type statsResponse struct {
+	Caches   map[string]cacheStats `json:"caches"`
+	Segments *segmentStats         `json:"segments,omitempty"`
+}
+
+type cacheStats struct {
+	Hits         int64            `json:"hits"`
+	Misses       int64            `json:"misses"`
+	BytesWritten int64            `json:"bytesWritten"`
+	Evictions    map[string]int64 `json:"evictions"`
+	Items        int              `json:"items"`
+	Size         int64            `json:"size"`
+	// Size per nzb
+	Owners map[string]int64 `json:"owners"`
+}
+
+type segmentStats struct {
+	Hits             int64 `json:"hits"`
+	Misses           int64 `json:"misses"`
+	BytesFromCache   int64 `json:"bytesFromCache"`
+	BytesFromNetwork int64 `json:"bytesFromNetwork"`
+	Passthroughs     int64 `json:"passthroughs"`
+}
+
+func (a *Api) collectStats() statsResponse {
+	response := statsResponse{
+		Caches: make(map[string]cacheStats, len(a.caches)),
+	}
+	for name, statsCache := range a.caches {
+		stats := statsCache.Stats()
+		evictions := make(map[string]int64, len(stats.Evictions))
+		for reason, count := range stats.Evictions {
+			evictions[string(reason)] = count
+		}
+		response.Caches[name] = cacheStats{
+			Hits:         stats.Hits,
+			Misses:       stats.Misses,
+			BytesWritten: stats.BytesWritten,
+			Evictions:    evictions,
+			Items:        stats.Items,
+			Size:         stats.Size,
+			Owners:       stats.OwnerSizes,
+		}
+	}
+
+	if a.segmentStats != nil {
+		response.Segments = &segmentStats{
+			Hits:             a.segmentStats.Hits.Load(),
+			Misses:           a.segmentStats.Misses.Load(),
+			BytesFromCache:   a.segmentStats.BytesFromCache.Load(),
+			BytesFromNetwork: a.segmentStats.BytesFromUnderlying.Load(),
+			Passthroughs:     a.segmentStats.Passthroughs.Load(),
+		}
+	}
+	return response
+}
+
+func (a *Api) handleGetStats(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, a.collectStats())
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricsWriter writes metrics in the prometheus text-format, each metric with its header once
+type metricsWriter struct {
+	out     io.Writer
+	written map[string]bool
+}
+
+func (m *metricsWriter) write(name, metricType, help string, value int64, labels ...string) {
+	if !m.written[name] {
+		m.written[name] = true
+		fmt.Fprintf(m.out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+	}
+
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1])))
+	}
+	if len(pairs) == 0 {
+		fmt.Fprintf(m.out, "%s %d\n", name, value)
+		return
+	}
+	fmt.Fprintf(m.out, "%s{%s} %d\n", name, strings.Join(pairs, ","), value)
+}
+
+func (a *Api) handleGetMetrics(w http.ResponseWriter, _ *http.Request) {
+	stats := a.collectStats()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	m := &metricsWriter{out: w, written: make(map[string]bool)}
+	// Sorted, so the output is stable
+	for _, name := range slices.Sorted(maps.Keys(stats.Caches)) {
+		c := stats.Caches[name]
+		m.write("nzbstreamer_cache_hits_total", "counter", "Items read from cache", c.Hits, "cache", name)
+		m.write("nzbstreamer_cache_misses_total", "counter", "Items not found in cache", c.Misses, "cache", name)
+		m.write("nzbstreamer_cache_written_bytes_total", "counter", "Bytes of content stored in cache", c.BytesWritten, "cache", name)
+		for _, reason := range slices.Sorted(maps.Keys(c.Evictions)) {
+			m.write("nzbstreamer_cache_evictions_total", "counter", "Items removed by the cache, by reason", c.Evictions[reason], "cache", name, "reason", reason)
+		}
+		m.write("nzbstreamer_cache_items", "gauge", "Items in cache", int64(c.Items), "cache", name)
+		m.write("nzbstreamer_cache_size_bytes", "gauge", "Size of the items in cache", c.Size, "cache", name)
+		for _, owner := range slices.Sorted(maps.Keys(c.Owners)) {
+			m.write("nzbstreamer_cache_owner_size_bytes", "gauge", "Size of the items of an nzb in cache", c.Owners[owner], "cache", name, "nzb", owner)
+		}
+	}
+
+	if stats.Segments != nil {
+		m.write("nzbstreamer_segment_reads_total", "counter", "Segments read, from cache or fetched", stats.Segments.Hits, "result", "hit")
+		m.write("nzbstreamer_segment_reads_total", "counter", "Segments read, from cache or fetched", stats.Segments.Misses, "result", "miss")
+		m.write("nzbstreamer_segment_bytes_total", "counter", "Bytes of segments, read from cache or fetched from network", stats.Segments.BytesFromCache, "source", "cache")
+		m.write("nzbstreamer_segment_bytes_total", "counter", "Bytes of segments, read from cache or fetched from network", stats.Segments.BytesFromNetwork, "source", "network")
+		m.write("nzbstreamer_segment_passthroughs_total", "counter", "Segments passed through uncached, as the cache had no space", stats.Segments.Passthroughs)
+	}
+}
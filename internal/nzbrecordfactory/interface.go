@@ -3,8 +3,13 @@ package nzbrecordfactory
 import (
 	"git.ruekov.eu/ruakij/nzbStreamer/internal/presentation"
 	"git.ruekov.eu/ruakij/nzbStreamer/pkg/nzbparser"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/prefetch"
 )
 
 type Factory interface {
 	BuildSegmentStackFromNzbData(nzbData *nzbparser.NzbData) (map[string]presentation.Openable, error)
+	// ReleaseNzbData frees what was kept for the nzb e.g. pinned cache-items, after its removed
+	ReleaseNzbData(nzbData *nzbparser.NzbData) error
+	// BuildPrefetchTasks returns the tasks fetching the nzb-file into cache, only the parts overlapping ranges when given
+	BuildPrefetchTasks(nzbFile *nzbparser.File, owner string, ranges []prefetch.Range) ([]prefetch.Task, error)
 }
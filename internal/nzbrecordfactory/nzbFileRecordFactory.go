@@ -1,29 +1,49 @@
 package nzbrecordfactory
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"path"
+	"regexp"
 	"slices"
+	"strings"
 	"time"
 
 	"astuart.co/nntp"
 	"git.ruekov.eu/ruakij/nzbStreamer/internal/nzbfileanalyzer"
 	"git.ruekov.eu/ruakij/nzbStreamer/internal/presentation"
-	"git.ruekov.eu/ruakij/nzbStreamer/pkg/diskcache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache"
 	"git.ruekov.eu/ruakij/nzbStreamer/pkg/filenameops"
 	"git.ruekov.eu/ruakij/nzbStreamer/pkg/nzbparser"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/prefetch"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/rardecode"
 	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
-	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/adaptiveparallelmergerresource"
 	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/adaptivereadaheadcache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/automergerresource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/blockcacheresource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/compressedfileresource"
 	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/fullcacheresource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/isofileresource"
 	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/nzbpostresource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/offsetresource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/parallelmergerresource"
 	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/rarfileresource"
 	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/sevenzipfileresource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/tarfileresource"
+	"github.com/bodgit/sevenzip"
+	"golang.org/x/sync/errgroup"
 )
 
 type NzbFileFactory struct {
-	cache      *diskcache.Cache
+	cache      cache.Cache
 	nntpClient *nntp.Client
+	// Counts how segments were served over all built files
+	segmentStats *fullcacheresource.Stats
 
 	// Over how much time average speed is calculated
 	adaptiveReadaheadCacheAvgSpeedTime time.Duration
@@ -35,15 +55,43 @@ type NzbFileFactory struct {
 	adaptiveReadaheadCacheLowBuffer int
 	// Max expected speed + Low-Buffer			Max speed per iteration
 	adaptiveReadaheadCacheMaxSize int
+
+	// How many levels of archives inside archives are expanded, 0 disables nested archives
+	nestedArchiveMaxDepth int
+	// Passwords tried on encrypted archives, after the ones found in the nzb
+	passwords []string
+	// Informed when an archive-entry was read to its end and its checksum compared
+	checksumListener ChecksumListener
+	// How many segments at the start and end of each file are pinned in cache, 0 disables pinning
+	pinnedSegments int
+	// Caches the decoded content of archive-entries in blocks, nil disables it
+	decodedCache     cache.Cache
+	decodedBlockSize int64
+	// Informed about reads of built files, so prefetching backs off; nil disables it
+	prefetchManager *prefetch.Manager
 }
 
-func NewNzbFileFactory(cache *diskcache.Cache, nntpClient *nntp.Client) *NzbFileFactory {
+// ChecksumListener receives the result of an archive-entry being verified, err is nil when the checksum matched
+// group and entry are the ones of the archive-listing in nzbData
+type ChecksumListener func(nzbData *nzbparser.NzbData, group, entry string, err error)
+
+var logger = slog.With("Module", "NzbFileFactory")
+
+var ErrPasswordRequired = errors.New("archive is encrypted and no working password is known")
+
+func NewNzbFileFactory(segmentCache cache.Cache, nntpClient *nntp.Client) *NzbFileFactory {
 	return &NzbFileFactory{
-		cache:      cache,
-		nntpClient: nntpClient,
+		cache:        segmentCache,
+		nntpClient:   nntpClient,
+		segmentStats: &fullcacheresource.Stats{},
 	}
 }
 
+// SegmentStats counts how segments of all built files were served, from cache or network
+func (f *NzbFileFactory) SegmentStats() *fullcacheresource.Stats {
+	return f.segmentStats
+}
+
 func (f *NzbFileFactory) SetAdaptiveReadaheadCacheSettings(adaptiveReadaheadCacheAvgSpeedTime, adaptiveReadaheadCacheTime time.Duration, adaptiveReadaheadCacheMinSize, adaptiveReadaheadCacheLowBuffer, adaptiveReadaheadCacheMaxSize int) {
 	f.adaptiveReadaheadCacheAvgSpeedTime = adaptiveReadaheadCacheAvgSpeedTime
 	f.adaptiveReadaheadCacheTime = adaptiveReadaheadCacheTime
@@ -52,17 +100,42 @@ func (f *NzbFileFactory) SetAdaptiveReadaheadCacheSettings(adaptiveReadaheadCach
 	f.adaptiveReadaheadCacheMaxSize = adaptiveReadaheadCacheMaxSize
 }
 
+func (f *NzbFileFactory) SetNestedArchiveMaxDepth(nestedArchiveMaxDepth int) {
+	f.nestedArchiveMaxDepth = nestedArchiveMaxDepth
+}
+
+func (f *NzbFileFactory) SetPasswords(passwords []string) {
+	f.passwords = passwords
+}
+
+func (f *NzbFileFactory) SetPinnedSegments(pinnedSegments int) {
+	f.pinnedSegments = pinnedSegments
+}
+
+func (f *NzbFileFactory) SetDecodedCache(decodedCache cache.Cache, blockSize int64) {
+	f.decodedCache = decodedCache
+	f.decodedBlockSize = blockSize
+}
+
+func (f *NzbFileFactory) SetPrefetchManager(prefetchManager *prefetch.Manager) {
+	f.prefetchManager = prefetchManager
+}
+
+func (f *NzbFileFactory) SetChecksumListener(listener ChecksumListener) {
+	f.checksumListener = listener
+}
+
 func (f *NzbFileFactory) BuildSegmentStackFromNzbData(nzbData *nzbparser.NzbData) (map[string]presentation.Openable, error) {
 	rawFiles := f.buildRawFiles(nzbData)
 	groupedFilenames := f.groupFiles(rawFiles)
 
 	files := make(map[string]presentation.Openable, len(rawFiles))
-	err := f.processFileGroups(groupedFilenames, rawFiles, nzbData.Meta["Password"], files)
+	err := f.processFileGroups(groupedFilenames, rawFiles, nzbData, files, 0)
 	if err != nil {
 		return files, err
 	}
 
-	return f.wrapWithCache(files), nil
+	return f.wrapAsInteractive(f.wrapWithCache(files)), nil
 }
 
 // buildRawFiles creates the initial map of raw file resources
@@ -70,11 +143,22 @@ func (f *NzbFileFactory) buildRawFiles(nzbData *nzbparser.NzbData) map[string]re
 	rawFiles := make(map[string]resource.ReadSeekCloseableResource, len(nzbData.Files))
 	for i := range nzbData.Files {
 		file := &nzbData.Files[i]
-		rawFiles[file.Filename] = f.BuildFileResourceFromNzbFile(file)
+		rawFiles[file.Filename] = f.BuildFileResourceFromNzbFile(file, nzbData.MetaName)
 	}
 	return rawFiles
 }
 
+func (f *NzbFileFactory) ReleaseNzbData(nzbData *nzbparser.NzbData) error {
+	pinningCache, ok := f.cache.(cache.PinningCache)
+	if !ok || f.pinnedSegments == 0 {
+		return nil
+	}
+	if err := pinningCache.UnpinOwner(nzbData.MetaName); err != nil {
+		return fmt.Errorf("failed unpinning cached segments: %w", err)
+	}
+	return nil
+}
+
 // groupFiles extracts and groups filenames from raw files
 func (f *NzbFileFactory) groupFiles(rawFiles map[string]resource.ReadSeekCloseableResource) map[string][]string {
 	filenames := make([]string, 0, len(rawFiles))
@@ -88,10 +172,19 @@ func (f *NzbFileFactory) groupFiles(rawFiles map[string]resource.ReadSeekCloseab
 }
 
 // processFileGroups handles processing of file groups and their special cases
-func (f *NzbFileFactory) processFileGroups(groupedFilenames map[string][]string, rawFiles map[string]resource.ReadSeekCloseableResource, password string, files map[string]presentation.Openable) error {
+// depth is the nesting-level of the given files, 0 being the files of the nzb itself
+func (f *NzbFileFactory) processFileGroups(groupedFilenames map[string][]string, rawFiles map[string]resource.ReadSeekCloseableResource, nzbData *nzbparser.NzbData, files map[string]presentation.Openable, depth int) error {
 	for groupFilename, filenames := range groupedFilenames {
 		groupedFiles := f.prepareGroupedFiles(filenames, rawFiles, files)
-		if err := f.processSpecialFiles(groupFilename, groupedFiles, password, files); err != nil {
+
+		if splitFilename, ok := f.getSplitFilename(filenames); ok {
+			if err := f.processSplitFiles(splitFilename, filenames, groupedFiles, nzbData, files, depth); err != nil {
+				return fmt.Errorf("build split-file %s failed: %w", splitFilename, err)
+			}
+			continue
+		}
+
+		if err := f.processSpecialFiles(groupFilename, path.Ext(groupFilename), groupedFiles, nzbData, files, depth); err != nil {
 			return fmt.Errorf("build special-file %s failed: %w", groupFilename, err)
 		}
 	}
@@ -110,29 +203,516 @@ func (f *NzbFileFactory) prepareGroupedFiles(filenames []string, rawFiles map[st
 }
 
 // processSpecialFiles handles special file types like RAR and 7z
-func (f *NzbFileFactory) processSpecialFiles(groupFilename string, groupedFiles []resource.ReadSeekCloseableResource, password string, files map[string]presentation.Openable) error {
-	extension := path.Ext(groupFilename)
-	var specialFiles map[string]presentation.Openable
-	var err error
+// Archive listings are taken from and stored in the nzbData, so archive-headers only have to be read once
+// Archives found inside are expanded again until nestedArchiveMaxDepth is reached
+func (f *NzbFileFactory) processSpecialFiles(groupFilename, extension string, groupedFiles []resource.ReadSeekCloseableResource, nzbData *nzbparser.NzbData, files map[string]presentation.Openable, depth int) error {
+	build := f.getArchiveBuilder(groupFilename, extension)
+	if build == nil {
+		return nil
+	}
+
+	password := nzbData.Meta[nzbparser.MetaKeyPassword]
+	var cachedListing []nzbparser.ArchiveFile
+
+	if archiveListing := nzbData.GetArchiveListing(groupFilename); archiveListing != nil {
+		cachedListing = archiveListing.Files
+		if archiveListing.Password != "" {
+			password = archiveListing.Password
+		}
+	}
+
+	specialFiles, listing, err := build(groupedFiles, password, cachedListing)
+	if err != nil && isPasswordError(err, password) {
+		logger.Debug("Archive needs password, trying candidates", "group", groupFilename)
+		specialFiles, listing, password, err = f.buildWithPasswordCandidates(build, groupedFiles, nzbData, password)
+	}
+
+	if err == nil && listing != nil && cachedListing == nil {
+		nzbData.SetArchiveListing(groupFilename, listing, password)
+		if password != "" && nzbData.Meta[nzbparser.MetaKeyPassword] == "" {
+			nzbData.SetMeta(nzbparser.MetaKeyPassword, password)
+		}
+	}
+
+	if err != nil || len(specialFiles) == 0 {
+		return err
+	}
+
+	f.listenForChecksums(specialFiles, groupFilename, nzbData)
+	f.cacheDecoded(specialFiles, listing, extension, groupFilename, nzbData)
+
+	innerFiles := make(map[string]resource.ReadSeekCloseableResource, len(specialFiles))
+	for filepath, resource := range specialFiles {
+		innerFiles[path.Join(groupFilename, filepath)] = resource
+	}
+
+	if depth >= f.nestedArchiveMaxDepth {
+		for filepath, resource := range innerFiles {
+			files[filepath] = resource
+		}
+		return nil
+	}
+
+	// Group with same logic as top-level, so multi-part archives inside are joined too
+	return f.processFileGroups(f.groupFiles(innerFiles), innerFiles, nzbData, files, depth+1)
+}
+
+// listenForChecksums forwards checksum-results of the archive-entries to the checksumListener
+func (f *NzbFileFactory) listenForChecksums(specialFiles map[string]presentation.Openable, groupFilename string, nzbData *nzbparser.NzbData) {
+	if f.checksumListener == nil {
+		return
+	}
+
+	for entry, file := range specialFiles {
+		if verifying, ok := file.(resource.ChecksumVerifyingResource); ok {
+			verifying.SetChecksumListener(func(err error) {
+				f.checksumListener(nzbData, groupFilename, entry, err)
+			})
+		}
+	}
+}
+
+// cacheDecoded wraps the archive-entries with a block-cache, if they have to be decoded when read
+// Entries are keyed by nzb, archive and entry, so they stay valid across restarts; The content of the nzb and the entry-size are part of it,
+// as blocks arent removed with their nzb and another nzb added under the same name mustnt get them
+func (f *NzbFileFactory) cacheDecoded(specialFiles map[string]presentation.Openable, listing []nzbparser.ArchiveFile, extension, groupFilename string, nzbData *nzbparser.NzbData) {
+	if f.decodedCache == nil {
+		return
+	}
+	contentID := nzbContentID(nzbData)
+
+	for _, archiveFile := range listing {
+		entry := archiveFile.Name
+		file, ok := specialFiles[entry]
+		if !ok || !decodesContent(extension, archiveFile) {
+			continue
+		}
+		// Blocks are laid out by size, so entries whose size is only known after reading them arent cached
+		if sizeAccurate, ok := file.(resource.SizeAccurateResource); ok && !sizeAccurate.IsSizeAccurate() {
+			continue
+		}
+		specialFiles[entry] = blockcacheresource.NewBlockCacheResource(
+			file,
+			f.decodedCache,
+			fmt.Sprintf("%s#%s-%d", path.Join(nzbData.MetaName, groupFilename, entry), contentID, archiveFile.Size),
+			&blockcacheresource.BlockCacheResourceOptions{
+				BlockSize:       f.decodedBlockSize,
+				CacheSetOptions: []cache.SetOption{cache.WithOwner(nzbData.MetaName)},
+			},
+		)
+	}
+}
+
+// nzbContentID identifies the content of the nzb by the message-id of its first segment
+func nzbContentID(nzbData *nzbparser.NzbData) string {
+	for _, file := range nzbData.Files {
+		if len(file.Segments) > 0 {
+			sum := sha256.Sum256([]byte(file.Segments[0].ID))
+			return hex.EncodeToString(sum[:8])
+		}
+	}
+	return ""
+}
+
+// decodesContent checks if the archive-entry is decoded when read, instead of being a view into the archive
+// The 7z-reader doesnt tell the method of its entries, so 7z and zip entries are all taken as compressed
+func decodesContent(extension string, file nzbparser.ArchiveFile) bool {
+	switch strings.ToLower(extension) {
+	case ".rar", ".r", ".7z", ".z", ".zip":
+		return !file.Stored
+	case ".gz", ".tgz", ".xz", ".txz", ".zst", ".tzst", ".bz2", ".tbz2", ".tbz":
+		return true
+	}
+	return false
+}
+
+// BuildTarFileFromFileResource builds resources for all files stored in the tar, as offset-views into it.
+// When listing is nil, the tar-headers are read to get it; The used listing is returned.
+func (f *NzbFileFactory) BuildTarFileFromFileResource(underlyingResources []resource.ReadSeekCloseableResource, _ string, listing []nzbparser.ArchiveFile) (map[string]presentation.Openable, []nzbparser.ArchiveFile, error) {
+	mergedResource := automergerresource.NewAutoMergerResource(underlyingResources)
+	return buildTarFiles(mergedResource, listing)
+}
+
+// BuildCompressedFileFromFileResource builds the resource for the decompressed content of a gzip, xz, zstd or bzip2 file.
+// Compressed tars are listed as well, their files are offset-views into the decompressed stream.
+// When listing is nil, the stream is read to get it; The used listing is returned, nil when the size isnt known yet.
+func (f *NzbFileFactory) BuildCompressedFileFromFileResource(underlyingResources []resource.ReadSeekCloseableResource, filename string, listing []nzbparser.ArchiveFile) (map[string]presentation.Openable, []nzbparser.ArchiveFile, error) {
+	extension := path.Ext(filename)
+	format, err := compressedfileresource.FormatFromExtension(extension)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mergedResource := automergerresource.NewAutoMergerResource(underlyingResources)
+
+	// e.g. movie.mkv.xz -> movie.mkv; archive.tgz -> archive.tar
+	decompressedFilename := strings.TrimSuffix(filename, extension)
+	if strings.HasPrefix(strings.ToLower(extension), ".t") {
+		decompressedFilename += ".tar"
+	}
+
+	if path.Ext(decompressedFilename) == ".tar" {
+		return buildTarFiles(compressedfileresource.NewCompressedFileResource(mergedResource, format), listing)
+	}
+
+	if listing == nil {
+		decompressed := compressedfileresource.NewCompressedFileResource(mergedResource, format)
+		size, err := decompressed.Size()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed getting decompressed size: %w", err)
+		}
+		// Size isnt stored in the stream, its only known once read to the end; Nothing is listed until then
+		if !decompressed.IsSizeAccurate() {
+			return map[string]presentation.Openable{decompressedFilename: decompressed}, nil, nil
+		}
+		listing = []nzbparser.ArchiveFile{{
+			Name: decompressedFilename,
+			Size: size,
+		}}
+	}
+
+	resources := make(map[string]presentation.Openable, len(listing))
+	for _, file := range listing {
+		resources[file.Name] = compressedfileresource.NewCompressedFileResourceWithSize(mergedResource, format, file.Size)
+	}
+
+	return resources, listing, nil
+}
+
+func buildTarFiles(tarResource resource.ReadSeekCloseableResource, listing []nzbparser.ArchiveFile) (map[string]presentation.Openable, []nzbparser.ArchiveFile, error) {
+	if listing == nil {
+		files, err := tarfileresource.NewTarFileResource(tarResource).GetFiles()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed listing tar: %w", err)
+		}
+
+		listing = make([]nzbparser.ArchiveFile, 0, len(files))
+		for _, file := range files {
+			listing = append(listing, nzbparser.ArchiveFile{
+				Name:   file.Name,
+				Size:   file.Size,
+				Offset: file.Offset,
+			})
+		}
+	}
+
+	resources := make(map[string]presentation.Openable, len(listing))
+	for _, file := range listing {
+		resources[file.Name] = offsetresource.NewOffsetResource(tarResource, file.Offset, file.Size)
+	}
+
+	return resources, listing, nil
+}
+
+// BuildIsoFileFromFileResource builds the resources for the files in an ISO9660 or UDF image, they are offset-views into the image.
+// When listing is nil, the filesystem is read to get it; The used listing is returned.
+func (f *NzbFileFactory) BuildIsoFileFromFileResource(underlyingResources []resource.ReadSeekCloseableResource, _ string, listing []nzbparser.ArchiveFile) (map[string]presentation.Openable, []nzbparser.ArchiveFile, error) {
+	mergedResource := automergerresource.NewAutoMergerResource(underlyingResources)
+	isoResource := isofileresource.NewIsoFileResource(mergedResource)
+
+	if listing == nil {
+		files, err := isoResource.GetFiles()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed listing iso: %w", err)
+		}
+
+		listing = make([]nzbparser.ArchiveFile, 0, len(files))
+		for _, file := range files {
+			archiveFile := nzbparser.ArchiveFile{
+				Name: file.Name,
+				Size: file.Size,
+			}
+			if len(file.Extents) == 1 {
+				archiveFile.Offset = file.Extents[0].Offset
+			} else {
+				for _, extent := range file.Extents {
+					archiveFile.Extents = append(archiveFile.Extents, nzbparser.ArchiveExtent{Offset: extent.Offset, Size: extent.Size})
+				}
+			}
+			listing = append(listing, archiveFile)
+		}
+	}
+
+	resources := make(map[string]presentation.Openable, len(listing))
+	for _, file := range listing {
+		isoFile := isofileresource.IsoFile{
+			Name: file.Name,
+			Size: file.Size,
+		}
+		if len(file.Extents) == 0 {
+			isoFile.Extents = []isofileresource.IsoExtent{{Offset: file.Offset, Size: file.Size}}
+		} else {
+			for _, extent := range file.Extents {
+				isoFile.Extents = append(isoFile.Extents, isofileresource.IsoExtent{Offset: extent.Offset, Size: extent.Size})
+			}
+		}
+		resources[file.Name] = isoResource.GetFileResource(isoFile)
+	}
+
+	return resources, listing, nil
+}
+
+type archiveBuilder func(underlyingResources []resource.ReadSeekCloseableResource, password string, listing []nzbparser.ArchiveFile) (map[string]presentation.Openable, []nzbparser.ArchiveFile, error)
+
+// buildWithPasswordCandidates builds the archive with each password candidate until one can read the archive-headers
+// Candidates are the ones of the nzb followed by the configured passwords; failedPassword was already tried and is skipped
+// Returns ErrPasswordRequired when none worked, other errors than a wrong password stop trying
+func (f *NzbFileFactory) buildWithPasswordCandidates(build archiveBuilder, groupedFiles []resource.ReadSeekCloseableResource, nzbData *nzbparser.NzbData, failedPassword string) (map[string]presentation.Openable, []nzbparser.ArchiveFile, string, error) {
+	candidates := append(nzbData.PasswordCandidates(), f.passwords...)
+	for _, password := range candidates {
+		if password == failedPassword || password == "" {
+			continue
+		}
+
+		specialFiles, listing, err := build(groupedFiles, password, nil)
+		if err != nil {
+			// Other failures, e.g. fetching the articles, arent fixed by another password
+			if !isPasswordError(err, password) {
+				return nil, nil, "", fmt.Errorf("failed building with password candidate: %w", err)
+			}
+			logger.Debug("Password candidate didnt work", "error", err)
+			continue
+		}
+		return specialFiles, listing, password, nil
+	}
+	return nil, nil, "", ErrPasswordRequired
+}
 
-	switch extension {
+// isPasswordError checks if the error was caused by a missing or wrong password
+func isPasswordError(err error, password string) bool {
+	if errors.Is(err, rardecode.ErrArchiveEncrypted) || errors.Is(err, rardecode.ErrArchivedFileEncrypted) || errors.Is(err, rardecode.ErrBadPassword) {
+		return true
+	}
+	// Rar without password-check only fails on the decrypted header
+	if password != "" && (errors.Is(err, rardecode.ErrBadHeaderCRC) || errors.Is(err, rardecode.ErrCorruptBlockHeader)) {
+		return true
+	}
+
+	var sevenzipErr *sevenzip.ReadError
+	return errors.As(err, &sevenzipErr) && sevenzipErr.Encrypted
+}
+
+// getArchiveBuilder returns the builder for the archive-type of the extension, or nil if it isnt one
+func (f *NzbFileFactory) getArchiveBuilder(groupFilename, extension string) archiveBuilder {
+	switch strings.ToLower(extension) {
 	case ".rar", ".r":
-		specialFiles, err = f.BuildRarFileFromFileResource(groupedFiles, password)
+		return f.BuildRarFileFromFileResource
 	case ".7z", ".z", ".zip":
-		specialFiles, err = f.Build7zFileFromFileResource(groupedFiles, password)
-		if err != nil && extension == ".z" {
-			// Handle potential zip fallback
+		// TODO: Handle potential zip fallback for .z
+		return f.Build7zFileFromFileResource
+	case ".tar":
+		return f.BuildTarFileFromFileResource
+	case ".iso", ".udf":
+		return f.BuildIsoFileFromFileResource
+	case ".gz", ".tgz", ".xz", ".txz", ".zst", ".tzst", ".bz2", ".tbz2", ".tbz":
+		return func(underlyingResources []resource.ReadSeekCloseableResource, _ string, listing []nzbparser.ArchiveFile) (map[string]presentation.Openable, []nzbparser.ArchiveFile, error) {
+			filename := path.Base(groupFilename)
+			// Extension can come from magic-bytes, when the filename doesnt tell
+			if path.Ext(filename) != extension {
+				filename += extension
+			}
+			return f.BuildCompressedFileFromFileResource(underlyingResources, filename, listing)
 		}
 	}
+	return nil
+}
+
+var splitPartRegexp = regexp.MustCompile(`^(.+)\.\d{3}$`)
 
-	if len(specialFiles) > 0 {
-		for filepath, resource := range specialFiles {
-			files[path.Join(groupFilename, filepath)] = resource
+// getSplitFilename checks if the files are parts of a raw split file (e.g. HJSplit movie.mkv.001, .002, ..) and returns the name of the joined file
+// Splits of known archive-types are left to their archive-handling
+func (f *NzbFileFactory) getSplitFilename(filenames []string) (string, bool) {
+	if len(filenames) < 2 {
+		return "", false
+	}
+
+	var splitFilename string
+	for _, filename := range filenames {
+		match := splitPartRegexp.FindStringSubmatch(filename)
+		if match == nil || (splitFilename != "" && match[1] != splitFilename) {
+			return "", false
 		}
+		splitFilename = match[1]
 	}
+
+	if f.getArchiveBuilder(splitFilename, path.Ext(splitFilename)) != nil {
+		return "", false
+	}
+	return splitFilename, true
+}
+
+// processSplitFiles joins the parts of a raw split file into one file
+// Exact part-sizes are required for random access; They are stored in the nzbData so they only have to be gathered once
+// Parts which turn out to be an archive by their magic-bytes are handed to processSpecialFiles instead
+func (f *NzbFileFactory) processSplitFiles(splitFilename string, filenames []string, groupedFiles []resource.ReadSeekCloseableResource, nzbData *nzbparser.NzbData, files map[string]presentation.Openable, depth int) error {
+	listing := nzbData.GetArchiveListing(splitFilename)
+	if listing != nil && listing.Extension != "" {
+		return f.processSpecialFiles(splitFilename, listing.Extension, groupedFiles, nzbData, files, depth)
+	}
+	if listing == nil || !listing.Split {
+		extension, err := detectExtensionByMagic(groupedFiles[0])
+		if err != nil {
+			return err
+		}
+		if extension != "" {
+			logger.Debug("Split-file is an archive", "file", splitFilename, "extension", extension)
+			err := f.processSpecialFiles(splitFilename, extension, groupedFiles, nzbData, files, depth)
+			// Kept with the listing, so the magic-bytes dont have to be read again
+			if listing := nzbData.GetArchiveListing(splitFilename); listing != nil {
+				listing.Extension = extension
+			}
+			return err
+		}
+
+		parts, err := f.getExactPartSizes(filenames, groupedFiles, nzbData)
+		if err != nil {
+			return err
+		}
+		nzbData.SetSplitListing(splitFilename, parts)
+		listing = nzbData.GetArchiveListing(splitFilename)
+	}
+
+	partSizes := make(map[string]int64, len(listing.Files))
+	for _, part := range listing.Files {
+		partSizes[part.Name] = part.Size
+	}
+
+	parts := make([]resource.ReadSeekCloseableResource, len(groupedFiles))
+	for i, filename := range filenames {
+		size, ok := partSizes[filename]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrSplitPartMissing, filename)
+		}
+		// Fix size to the exact one, so the merger can calculate positions
+		parts[i] = offsetresource.NewOffsetResource(groupedFiles[i], 0, size)
+	}
+	files[splitFilename] = parallelmergerresource.NewParallelMergerResource(parts)
+
+	return nil
+}
+
+var ErrSplitPartMissing = errors.New("split-part missing in listing")
+
+// getExactPartSizes gets the exact size of each part
+// Parts straight from the nzb only have estimated sizes, here the last segment is loaded as its yEnc-header tells the file-size
+func (f *NzbFileFactory) getExactPartSizes(filenames []string, groupedFiles []resource.ReadSeekCloseableResource, nzbData *nzbparser.NzbData) ([]nzbparser.ArchiveFile, error) {
+	nzbFiles := make(map[string]*nzbparser.File, len(nzbData.Files))
+	for i := range nzbData.Files {
+		nzbFiles[nzbData.Files[i].Filename] = &nzbData.Files[i]
+	}
+
+	parts := make([]nzbparser.ArchiveFile, len(filenames))
+	group := errgroup.Group{}
+	group.SetLimit(splitPartSizeConcurrency)
+	for i, filename := range filenames {
+		group.Go(func() error {
+			var size int64
+			var err error
+
+			nzbFile, fromNzb := nzbFiles[filename]
+			sizeAccurate, ok := groupedFiles[i].(resource.SizeAccurateResource)
+			if fromNzb && (!ok || !sizeAccurate.IsSizeAccurate()) {
+				size, err = f.getFileSizeFromLastSegment(nzbFile, nzbData.MetaName)
+			} else {
+				size, err = groupedFiles[i].Size()
+			}
+			if err != nil {
+				return fmt.Errorf("failed getting size of part %s: %w", filename, err)
+			}
+
+			parts[i] = nzbparser.ArchiveFile{
+				Name: filename,
+				Size: size,
+			}
+			return nil
+		})
+	}
+
+	return parts, group.Wait()
+}
+
+const splitPartSizeConcurrency = 8
+
+// getFileSizeFromLastSegment loads the last segment through the cache, so its not downloaded again when read
+// Cached segments dont keep their yEnc-header, so the post is only loaded directly when it was cached already
+func (f *NzbFileFactory) getFileSizeFromLastSegment(nzbFile *nzbparser.File, owner string) (int64, error) {
+	if len(nzbFile.Segments) == 0 {
+		return 0, nil
+	}
+	lastSegment := slices.MaxFunc(nzbFile.Segments, func(a, b nzbparser.Segment) int {
+		return a.Index - b.Index
+	})
+
+	postResource := f.BuildResourceFromNzbSegment(&lastSegment, nzbFile.Groups[0])
+	cachedResource := f.buildCachedSegmentResource(postResource, lastSegment.ID, owner, f.pinnedSegments > 0)
+	if err := loadFirstByte(cachedResource.Open()); err != nil {
+		return 0, fmt.Errorf("failed loading last segment: %w", err)
+	}
+	if postResource.FileEnd > 0 {
+		return postResource.FileEnd, nil
+	}
+
+	if err := loadFirstByte(postResource.Open()); err != nil {
+		return 0, fmt.Errorf("failed loading last segment: %w", err)
+	}
+	return postResource.FileEnd, nil
+}
+
+// loadFirstByte reads from the opened resource, which loads it
+func loadFirstByte(reader io.ReadCloser, err error) error {
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	_, err = reader.Read(make([]byte, 1))
 	return err
 }
 
+var (
+	magicRar   = []byte("Rar!\x1a\x07")
+	magic7z    = []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}
+	magicZip   = []byte("PK\x03\x04")
+	magicGzip  = []byte{0x1f, 0x8b}
+	magicXz    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	magicZstd  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	magicBzip2 = []byte("BZh")
+)
+
+// detectExtensionByMagic returns the extension of the archive-type the content starts with, or "" if its none
+func detectExtensionByMagic(file resource.ReadSeekCloseableResource) (string, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed opening: %w", err)
+	}
+	defer reader.Close()
+
+	header := make([]byte, 8)
+	n, err := io.ReadFull(reader, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", fmt.Errorf("failed reading magic-bytes: %w", err)
+	}
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, magicRar):
+		return ".rar", nil
+	case bytes.HasPrefix(header, magic7z):
+		return ".7z", nil
+	case bytes.HasPrefix(header, magicZip):
+		return ".zip", nil
+	case bytes.HasPrefix(header, magicGzip):
+		return ".gz", nil
+	case bytes.HasPrefix(header, magicXz):
+		return ".xz", nil
+	case bytes.HasPrefix(header, magicZstd):
+		return ".zst", nil
+	case bytes.HasPrefix(header, magicBzip2):
+		return ".bz2", nil
+	}
+	return "", nil
+}
+
 // wrapWithCache wraps files with adaptive readahead cache if enabled
 func (f *NzbFileFactory) wrapWithCache(files map[string]presentation.Openable) map[string]presentation.Openable {
 	if f.adaptiveReadaheadCacheMaxSize <= 1 {
@@ -153,20 +733,46 @@ func (f *NzbFileFactory) wrapWithCache(files map[string]presentation.Openable) m
 	return wrappedFiles
 }
 
+// wrapAsInteractive wraps files so reading them counts as interactive at the prefetch-manager, if set
+func (f *NzbFileFactory) wrapAsInteractive(files map[string]presentation.Openable) map[string]presentation.Openable {
+	if f.prefetchManager == nil {
+		return files
+	}
+
+	wrappedFiles := make(map[string]presentation.Openable, len(files))
+	for path, file := range files {
+		wrappedFiles[path] = prefetch.NewInteractiveResource(file, f.prefetchManager)
+	}
+	return wrappedFiles
+}
+
 func (f *NzbFileFactory) BuildNamedFileResourcesFromNzb(nzbData *nzbparser.NzbData) map[string]resource.ReadSeekCloseableResource {
 	fileResources := make(map[string]resource.ReadSeekCloseableResource, len(nzbData.Files))
 
 	for i := range nzbData.Files {
 		file := &nzbData.Files[i]
-		fileResources[file.Filename] = f.BuildFileResourceFromNzbFile(file)
+		fileResources[file.Filename] = f.BuildFileResourceFromNzbFile(file, nzbData.MetaName)
 	}
 
 	return fileResources
 }
 
-func (f *NzbFileFactory) BuildFileResourceFromNzbFile(nzbFiles *nzbparser.File) *adaptiveparallelmergerresource.AdaptiveParallelMergerResource {
+// BuildFileResourceFromNzbFile builds the file from its cached segments, owner is the nzb the segments are accounted to in cache
+func (f *NzbFileFactory) BuildFileResourceFromNzbFile(nzbFiles *nzbparser.File, owner string) *automergerresource.AutoMergerResource {
+	segmentResources := f.buildCachedSegmentResources(nzbFiles, owner)
+
+	cachedSegmentResources := make([]resource.ReadSeekCloseableResource, 0, len(segmentResources))
+	for _, segmentResource := range segmentResources {
+		cachedSegmentResources = append(cachedSegmentResources, segmentResource)
+	}
+
+	return automergerresource.NewAutoMergerResource(cachedSegmentResources)
+}
+
+// buildCachedSegmentResources builds the segments of the file in order, each fully cached
+func (f *NzbFileFactory) buildCachedSegmentResources(nzbFiles *nzbparser.File, owner string) []*fullcacheresource.FullCacheResource {
 	totalSegments := len(nzbFiles.Segments)
-	cachedSegmentResources := make([]resource.ReadSeekCloseableResource, 0, totalSegments)
+	cachedSegmentResources := make([]*fullcacheresource.FullCacheResource, 0, totalSegments)
 
 	// Sort so append-order is correct
 	slices.SortFunc(nzbFiles.Segments, func(a, b nzbparser.Segment) int {
@@ -176,18 +782,57 @@ func (f *NzbFileFactory) BuildFileResourceFromNzbFile(nzbFiles *nzbparser.File)
 	for i := range nzbFiles.Segments {
 		nzbSegment := &nzbFiles.Segments[i]
 		segmentResource := f.BuildResourceFromNzbSegment(nzbSegment, nzbFiles.Groups[0])
-		cachedSegmentResource := fullcacheresource.NewFullCacheResource(
-			segmentResource,
-			nzbSegment.ID,
-			f.cache,
-			&fullcacheresource.FullCacheResourceOptions{
-				SizeAlwaysFromResource: false,
+		// Start and end are read often e.g. for headers and indexes of media-files
+		pinned := i < f.pinnedSegments || i >= totalSegments-f.pinnedSegments
+		cachedSegmentResources = append(cachedSegmentResources, f.buildCachedSegmentResource(segmentResource, nzbSegment.ID, owner, pinned))
+	}
+
+	return cachedSegmentResources
+}
+
+func (f *NzbFileFactory) buildCachedSegmentResource(segmentResource *nzbpostresource.NzbPostResource, id, owner string, pinned bool) *fullcacheresource.FullCacheResource {
+	return fullcacheresource.NewFullCacheResource(
+		segmentResource,
+		id,
+		f.cache,
+		&fullcacheresource.FullCacheResourceOptions{
+			SizeAlwaysFromResource: false,
+			CacheSetOptions: []cache.SetOption{
+				cache.WithOwner(owner),
+				cache.WithPinned(pinned),
 			},
-		)
-		cachedSegmentResources = append(cachedSegmentResources, cachedSegmentResource)
+			Stats: f.segmentStats,
+		},
+	)
+}
+
+// BuildPrefetchTasks returns the segments of the file to fetch into cache, limited to the ones overlapping ranges when given
+func (f *NzbFileFactory) BuildPrefetchTasks(nzbFile *nzbparser.File, owner string, ranges []prefetch.Range) ([]prefetch.Task, error) {
+	segmentResources := f.buildCachedSegmentResources(nzbFile, owner)
+
+	indexes := make([]int, 0, len(segmentResources))
+	if len(ranges) == 0 {
+		for i := range segmentResources {
+			indexes = append(indexes, i)
+		}
+	} else {
+		sizes := make([]int64, len(segmentResources))
+		for i, segmentResource := range segmentResources {
+			size, err := segmentResource.Size()
+			if err != nil {
+				return nil, fmt.Errorf("failed getting size of segment %d: %w", i, err)
+			}
+			sizes[i] = size
+		}
+		// Segment-sizes are mostly estimated, so one more is fetched on each side
+		indexes = prefetch.SelectInRanges(sizes, ranges, 1)
 	}
 
-	return adaptiveparallelmergerresource.NewAdaptiveParallelMergerResource(cachedSegmentResources)
+	tasks := make([]prefetch.Task, 0, len(indexes))
+	for _, i := range indexes {
+		tasks = append(tasks, segmentResources[i])
+	}
+	return tasks, nil
 }
 
 func (f *NzbFileFactory) BuildResourceFromNzbSegment(nzbSegment *nzbparser.Segment, groups string) *nzbpostresource.NzbPostResource {
@@ -209,34 +854,68 @@ func (f *NzbFileFactory) BuildResourceFromNzbSegment(nzbSegment *nzbparser.Segme
 
 // -- Special files --
 
-func (f *NzbFileFactory) BuildRarFileFromFileResource(underlyingResources []resource.ReadSeekCloseableResource, password string) (map[string]presentation.Openable, error) {
-	resources := make(map[string]presentation.Openable, 1)
+// BuildRarFileFromFileResource builds resources for all files inside the rar-archive.
+// When listing is nil, the archive-headers are read to get it; The used listing is returned.
+func (f *NzbFileFactory) BuildRarFileFromFileResource(underlyingResources []resource.ReadSeekCloseableResource, password string, listing []nzbparser.ArchiveFile) (map[string]presentation.Openable, []nzbparser.ArchiveFile, error) {
+	if listing == nil {
+		fileheaders, err := rarfileresource.NewRarFileResource(underlyingResources, password, "").GetRarFiles()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed creating Rar resource: %w", err)
+		}
 
-	fileheaders, err := rarfileresource.NewRarFileResource(underlyingResources, password, "").GetRarFiles(1)
-	if err != nil {
-		return nil, fmt.Errorf("failed creating Rar resource: %w", err)
+		listing = make([]nzbparser.ArchiveFile, 0, len(fileheaders))
+		var encryptedFile string
+		for _, fileheader := range fileheaders {
+			listing = append(listing, nzbparser.ArchiveFile{
+				Name:   fileheader.Name,
+				Size:   fileheader.UnPackedSize,
+				Stored: fileheader.Stored && !fileheader.Encrypted,
+			})
+			if fileheader.Encrypted && encryptedFile == "" {
+				encryptedFile = fileheader.Name
+			}
+		}
+
+		// Headers can be readable while the files are encrypted, so the password is checked on the data too
+		if encryptedFile != "" {
+			if err := rarfileresource.NewRarFileResource(underlyingResources, password, encryptedFile).CheckPassword(); err != nil {
+				return nil, nil, fmt.Errorf("failed checking password on %s: %w", encryptedFile, err)
+			}
+		}
 	}
 
-	for _, fileheader := range fileheaders {
-		resources[fileheader.Name] = rarfileresource.NewRarFileResource(underlyingResources, password, fileheader.Name)
+	resources := make(map[string]presentation.Openable, len(listing))
+	for _, file := range listing {
+		resources[file.Name] = rarfileresource.NewRarFileResourceWithSize(underlyingResources, password, file.Name, file.Size)
 	}
 
-	return resources, nil
+	return resources, listing, nil
 }
 
-func (f *NzbFileFactory) Build7zFileFromFileResource(underlyingResources []resource.ReadSeekCloseableResource, password string) (map[string]presentation.Openable, error) {
-	resources := make(map[string]presentation.Openable, 1)
+// Build7zFileFromFileResource builds resources for all files inside the 7z-archive.
+// When listing is nil, the archive-headers are read to get it; The used listing is returned.
+func (f *NzbFileFactory) Build7zFileFromFileResource(underlyingResources []resource.ReadSeekCloseableResource, password string, listing []nzbparser.ArchiveFile) (map[string]presentation.Openable, []nzbparser.ArchiveFile, error) {
+	mergedResource := automergerresource.NewAutoMergerResource(underlyingResources)
 
-	mergedResource := adaptiveparallelmergerresource.NewAdaptiveParallelMergerResource(underlyingResources)
+	if listing == nil {
+		files, err := sevenzipfileresource.NewSevenzipFileResource(mergedResource, password, "").GetFiles()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed creating 7z resource: %w", err)
+		}
 
-	files, err := sevenzipfileresource.NewSevenzipFileResource(mergedResource, password, "").GetFiles()
-	if err != nil {
-		return nil, fmt.Errorf("failed creating 7z resource: %w", err)
+		listing = make([]nzbparser.ArchiveFile, 0, len(files))
+		for filepath, fileinfo := range files {
+			listing = append(listing, nzbparser.ArchiveFile{
+				Name: filepath,
+				Size: fileinfo.Size(),
+			})
+		}
 	}
 
-	for filepath, fileinfo := range files {
-		resources[path.Join(filepath, fileinfo.Name())] = sevenzipfileresource.NewSevenzipFileResource(mergedResource, password, "")
+	resources := make(map[string]presentation.Openable, len(listing))
+	for _, file := range listing {
+		resources[file.Name] = sevenzipfileresource.NewSevenzipFileResourceWithSize(mergedResource, password, file.Name, file.Size)
 	}
 
-	return resources, nil
+	return resources, listing, nil
 }
@@ -0,0 +1,245 @@
+package nzbrecordfactory
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/internal/presentation"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/memorycache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/nzbparser"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/rardecode"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/bytesresource"
+)
+
+// openCountingResource counts how often its opened
+type openCountingResource struct {
+	bytesresource.BytesResource
+	opens atomic.Int64
+}
+
+func (r *openCountingResource) Open() (io.ReadSeekCloser, error) {
+	r.opens.Add(1)
+	return r.BytesResource.Open()
+}
+
+func splitParts(content []byte, partSize int) []*openCountingResource {
+	var parts []*openCountingResource
+	for start := 0; start < len(content); start += partSize {
+		parts = append(parts, &openCountingResource{
+			BytesResource: bytesresource.BytesResource{Content: content[start:min(start+partSize, len(content))]},
+		})
+	}
+	return parts
+}
+
+func readFile(t *testing.T, file presentation.Openable) []byte {
+	t.Helper()
+
+	reader, err := file.Open()
+	if err != nil {
+		t.Fatalf("failed opening: %v", err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed reading: %v", err)
+	}
+	return content
+}
+
+func TestGetSplitFilename(t *testing.T) {
+	t.Parallel()
+
+	factory := NewNzbFileFactory(nil, nil)
+
+	tests := []struct {
+		filenames []string
+		expected  string
+		ok        bool
+	}{
+		{[]string{"movie.mkv.001", "movie.mkv.002"}, "movie.mkv", true},
+		{[]string{"movie.mkv.001"}, "", false},
+		{[]string{"movie.mkv.001", "other.mkv.002"}, "", false},
+		{[]string{"movie.mkv.001", "movie.mkv"}, "", false},
+		// Splits of archives are handled by their archive-type
+		{[]string{"archive.7z.001", "archive.7z.002"}, "", false},
+		{[]string{"archive.tar.001", "archive.tar.002"}, "", false},
+	}
+	for _, test := range tests {
+		splitFilename, ok := factory.getSplitFilename(test.filenames)
+		if splitFilename != test.expected || ok != test.ok {
+			t.Errorf("getSplitFilename(%v): expected %q, %v, got %q, %v", test.filenames, test.expected, test.ok, splitFilename, ok)
+		}
+	}
+}
+
+func TestDecodesContent(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		extension string
+		file      nzbparser.ArchiveFile
+		expected  bool
+	}{
+		{".rar", nzbparser.ArchiveFile{Name: "movie.mkv"}, true},
+		// Stored entries are views into the archive, caching them only duplicates the archive-cache
+		{".rar", nzbparser.ArchiveFile{Name: "movie.mkv", Stored: true}, false},
+		{".7z", nzbparser.ArchiveFile{Name: "movie.mkv"}, true},
+		{".xz", nzbparser.ArchiveFile{Name: "movie.mkv"}, true},
+		{".tar", nzbparser.ArchiveFile{Name: "movie.mkv"}, false},
+		{".iso", nzbparser.ArchiveFile{Name: "movie.mkv"}, false},
+	}
+	for _, test := range tests {
+		if decodes := decodesContent(test.extension, test.file); decodes != test.expected {
+			t.Errorf("decodesContent(%q, %+v): expected %v, got %v", test.extension, test.file, test.expected, decodes)
+		}
+	}
+}
+
+func TestProcessSplitFilesJoinsParts(t *testing.T) {
+	t.Parallel()
+
+	factory := NewNzbFileFactory(nil, nil)
+	content := []byte("Hello World, split into parts")
+	parts := splitParts(content, 8)
+
+	filenames := []string{"movie.mkv.001", "movie.mkv.002", "movie.mkv.003", "movie.mkv.004"}
+	groupedFiles := make([]resource.ReadSeekCloseableResource, len(parts))
+	for i, part := range parts {
+		groupedFiles[i] = part
+	}
+
+	nzbData := &nzbparser.NzbData{MetaName: "Movie"}
+	files := make(map[string]presentation.Openable)
+	if err := factory.processSplitFiles("movie.mkv", filenames, groupedFiles, nzbData, files, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if joined := readFile(t, files["movie.mkv"]); !bytes.Equal(joined, content) {
+		t.Errorf("expected joined content %q, got %q", content, joined)
+	}
+
+	listing := nzbData.GetArchiveListing("movie.mkv")
+	if listing == nil || !listing.Split || len(listing.Files) != 4 || listing.Files[3].Size != 5 {
+		t.Errorf("expected split listing with exact part-sizes, got %+v", listing)
+	}
+}
+
+func TestProcessSplitFilesDetectsArchive(t *testing.T) {
+	t.Parallel()
+
+	factory := NewNzbFileFactory(nil, nil)
+	content := bytes.Repeat([]byte("Hello World "), 100)
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write(content)
+	writer.Close()
+	parts := splitParts(compressed.Bytes(), compressed.Len()/2+1)
+
+	filenames := []string{"movie.mkv.001", "movie.mkv.002"}
+	groupedFiles := []resource.ReadSeekCloseableResource{parts[0], parts[1]}
+	nzbData := &nzbparser.NzbData{MetaName: "Movie"}
+
+	files := make(map[string]presentation.Openable)
+	if err := factory.processSplitFiles("movie.mkv", filenames, groupedFiles, nzbData, files, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decompressed := readFile(t, files["movie.mkv/movie.mkv"]); !bytes.Equal(decompressed, content) {
+		t.Errorf("expected decompressed content of gzip split")
+	}
+
+	listing := nzbData.GetArchiveListing("movie.mkv")
+	if listing == nil || listing.Split || listing.Extension != ".gz" {
+		t.Fatalf("expected archive listing with detected extension, got %+v", listing)
+	}
+
+	// Built again, the listing tells its an archive without reading the magic-bytes
+	parts[0].opens.Store(0)
+	files = make(map[string]presentation.Openable)
+	if err := factory.processSplitFiles("movie.mkv", filenames, groupedFiles, nzbData, files, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opens := parts[0].opens.Load(); opens != 0 {
+		t.Errorf("expected first part not to be opened again, got %d opens", opens)
+	}
+	if _, ok := files["movie.mkv/movie.mkv"]; !ok {
+		t.Errorf("expected decompressed file, got %v", files)
+	}
+}
+
+func TestBuildWithPasswordCandidates(t *testing.T) {
+	t.Parallel()
+
+	factory := NewNzbFileFactory(nil, nil)
+	factory.SetPasswords([]string{"first", "second", "third"})
+	nzbData := &nzbparser.NzbData{}
+	failure := errors.New("article not found")
+
+	tests := []struct {
+		name string
+		// Error building with the password
+		errors   map[string]error
+		password string
+		err      error
+		tried    []string
+	}{
+		{"WrongPasswords", map[string]error{"first": rardecode.ErrBadPassword, "second": rardecode.ErrBadHeaderCRC}, "third", nil, []string{"first", "second", "third"}},
+		{"NoneWorks", map[string]error{"first": rardecode.ErrBadPassword, "second": rardecode.ErrBadPassword, "third": rardecode.ErrBadPassword}, "", ErrPasswordRequired, []string{"first", "second", "third"}},
+		// Failures not caused by the password stop trying and arent hidden
+		{"OtherFailure", map[string]error{"first": rardecode.ErrBadPassword, "second": failure}, "", failure, []string{"first", "second"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var tried []string
+			build := func(_ []resource.ReadSeekCloseableResource, password string, _ []nzbparser.ArchiveFile) (map[string]presentation.Openable, []nzbparser.ArchiveFile, error) {
+				tried = append(tried, password)
+				return nil, nil, test.errors[password]
+			}
+
+			_, _, password, err := factory.buildWithPasswordCandidates(build, nil, nzbData, "")
+			if password != test.password || !errors.Is(err, test.err) || (test.err == nil && err != nil) {
+				t.Errorf("expected password %q and %v, got %q and %v", test.password, test.err, password, err)
+			}
+			if !slices.Equal(tried, test.tried) {
+				t.Errorf("expected candidates %v to be tried, got %v", test.tried, tried)
+			}
+		})
+	}
+}
+
+func TestCacheDecodedKeyedByContent(t *testing.T) {
+	t.Parallel()
+
+	decodedCache, err := memorycache.NewCache(&memorycache.CacheOptions{MaxSize: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	factory := NewNzbFileFactory(nil, nil)
+	factory.SetDecodedCache(decodedCache, 4)
+
+	listing := []nzbparser.ArchiveFile{{Name: "movie.mkv", Size: 10}}
+	read := func(segmentID, content string) []byte {
+		// Same name, but another upload
+		nzbData := &nzbparser.NzbData{MetaName: "Movie", Files: []nzbparser.File{{Segments: []nzbparser.Segment{{ID: segmentID}}}}}
+		specialFiles := map[string]presentation.Openable{"movie.mkv": &bytesresource.BytesResource{Content: []byte(content)}}
+		factory.cacheDecoded(specialFiles, listing, ".xz", "movie.mkv.xz", nzbData)
+		return readFile(t, specialFiles["movie.mkv"])
+	}
+
+	if content := read("first@test", "first nzb!"); string(content) != "first nzb!" {
+		t.Fatalf("expected content of first nzb, got %q", content)
+	}
+	if content := read("second@test", "other nzb!"); string(content) != "other nzb!" {
+		t.Errorf("expected decoded blocks of the removed nzb not to be served, got %q", content)
+	}
+}
@@ -47,14 +47,13 @@ func (s *FolderStore) List() ([]nzbparser.NzbData, error) {
 			}
 			defer file.Close()
 
-			var data nzbparser.NzbData
-			decoder := xml.NewDecoder(file)
-			if err := decoder.Decode(&data); err != nil {
-				return fmt.Errorf("failed to decode XML from %s: %w", entryName, err)
+			data, err := nzbparser.ParseNzb(file)
+			if err != nil {
+				return fmt.Errorf("failed to parse nzb from %s: %w", entryName, err)
 			}
 
 			mu.Lock()
-			list = append(list, data)
+			list = append(list, *data)
 			mu.Unlock()
 
 			return nil
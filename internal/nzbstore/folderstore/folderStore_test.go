@@ -0,0 +1,65 @@
+package folderstore_test
+
+import (
+	"strings"
+	"testing"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/internal/nzbstore/folderstore"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/nzbparser"
+)
+
+const testNzb = `<?xml version="1.0" encoding="UTF-8"?>
+<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <head>
+    <meta type="name">Movie</meta>
+  </head>
+  <file poster="poster" date="1700000000" subject="&quot;movie.rar&quot; yEnc (1/1)">
+    <groups><group>alt.binaries.test</group></groups>
+    <segments><segment bytes="100" number="1">id@test</segment></segments>
+  </file>
+</nzb>`
+
+func TestFolderStoreArchiveListingRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	nzb, err := nzbparser.ParseNzb(strings.NewReader(testNzb))
+	if err != nil {
+		t.Fatalf("failed parsing nzb: %v", err)
+	}
+	nzb.SetArchiveListing("movie.rar", []nzbparser.ArchiveFile{
+		{Name: "movie.mkv", Size: 1000, Checksum: nzbparser.ChecksumValid},
+		{Name: "disc.iso", Size: 300, Extents: []nzbparser.ArchiveExtent{{Offset: 0, Size: 100}, {Offset: 200, Size: 200}}},
+	}, "secret")
+	nzb.SetSplitListing("movie.mkv", []nzbparser.ArchiveFile{{Name: "movie.mkv.001", Size: 500}})
+	nzb.Filename = "Movie{{secret}}.nzb"
+
+	store := folderstore.NewFolderStore(t.TempDir())
+	if err := store.Set(nzb); err != nil {
+		t.Fatalf("failed storing nzb: %v", err)
+	}
+
+	list, err := store.List()
+	if err != nil {
+		t.Fatalf("failed listing store: %v", err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("expected 1 nzb, got %d", len(list))
+	}
+
+	loaded := list[0]
+	if loaded.MetaName != nzb.MetaName {
+		t.Errorf("expected MetaName %q, got %q", nzb.MetaName, loaded.MetaName)
+	}
+	if !nzbparser.ArchiveListingsEqual(nzb.ArchiveListings, loaded.ArchiveListings) {
+		t.Errorf("expected listings %+v, got %+v", nzb.ArchiveListings, loaded.ArchiveListings)
+	}
+	if loaded.Filename != nzb.Filename {
+		t.Errorf("expected Filename %q, got %q", nzb.Filename, loaded.Filename)
+	}
+	if candidates := loaded.PasswordCandidates(); len(candidates) != 1 || candidates[0] != "secret" {
+		t.Errorf("expected password from filename to be a candidate, got %v", candidates)
+	}
+	if len(loaded.Files) != 1 || len(loaded.Files[0].Segments) != 1 {
+		t.Errorf("expected files to be kept, got %+v", loaded.Files)
+	}
+}
@@ -11,6 +11,7 @@ import (
 
 	"git.ruekov.eu/ruakij/nzbStreamer/internal/presentation"
 	"git.ruekov.eu/ruakij/nzbStreamer/pkg/readeratwrapper"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
 	"github.com/hanwen/go-fuse/v2/fs"
 	"github.com/hanwen/go-fuse/v2/fuse"
 )
@@ -24,7 +25,7 @@ type fileNode struct {
 }
 
 type file struct {
-	reader io.ReaderAt
+	reader *readeratwrapper.ReadSeekerAt
 }
 
 // dirNode represents a directory in the filesystem.
@@ -136,12 +137,18 @@ func convertTimeToFuseAttr(t time.Time) (time uint64, timeNs uint32, err error)
 var _ = fs.NodeOpener((*fileNode)(nil))
 
 func (n *fileNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
-	reader, err := n.openable.Open()
+	// ctx only covers opening, reads get their own with each request
+	reader, err := resource.OpenContext(ctx, n.openable)
+	if err != nil && ctx.Err() != nil {
+		logger.Debug("Open interrupted", "error", err)
+		return nil, 0, syscall.EINTR
+	}
 	if err != nil {
 		logger.Error("Error opening file", "error", err)
 		return nil, 0, syscall.EIO
 	}
 
+	// Reads of the kernel run in parallel, when the reader supports ReadAt natively
 	fh := file{
 		reader: readeratwrapper.NewReadSeekerAt(reader),
 	}
@@ -182,7 +189,12 @@ func (n *fileNode) Read(ctx context.Context, f fs.FileHandle, dest []byte, off i
 var _ = fs.FileReader((*file)(nil))
 
 func (f *file) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
-	n, err := f.reader.ReadAt(dest, off)
+	// ctx is cancelled when the read is interrupted
+	n, err := f.reader.ReadAtContext(ctx, dest, off)
+	if err != nil && ctx.Err() != nil {
+		logger.Debug("Read interrupted", "handle", f, "len", len(dest), "offset", off, "error", err)
+		return nil, syscall.EINTR
+	}
 	if err != nil && !errors.Is(err, io.EOF) {
 		logger.Error("Error reading", "handle", f, "len", len(dest), "offset", off, "error", err)
 		return nil, syscall.EIO
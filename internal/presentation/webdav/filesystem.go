@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"git.ruekov.eu/ruakij/nzbStreamer/internal/presentation"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
 	"github.com/emersion/go-webdav"
 )
 
@@ -189,11 +190,12 @@ func (fs *FS) Open(ctx context.Context, name string) (io.ReadCloser, error) {
 	}
 
 	if !node.File.isDir {
-		reader, err := node.File.openable.Open()
+		// Reads are aborted when the client disconnects
+		reader, err := resource.OpenContext(ctx, node.File.openable)
 		if err != nil {
 			return nil, err
 		}
-		fileReader.reader = reader
+		fileReader.reader = resource.BindContext(ctx, reader)
 	}
 
 	logger.Debug("Open", "reader", fmt.Sprintf("%p", fileReader.reader), "name", name)
@@ -0,0 +1,156 @@
+package nzbservice
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/internal/filehealth"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/nzbparser"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
+)
+
+// ReportChecksum records the checksum-result of an archive-entry which was read to its end, and persists it
+// A bad checksum counts the file as unhealthy; When the nzb falls below the healthy-threshold, its files are removed from the presenters
+// Its called from within the read of the entry, so the result is recorded in the background
+func (s *Service) ReportChecksum(nzbData *nzbparser.NzbData, group, entry string, checksumErr error) {
+	go s.recordChecksum(nzbData, group, entry, checksumErr)
+}
+
+func (s *Service) recordChecksum(nzbData *nzbparser.NzbData, group, entry string, checksumErr error) {
+	state := nzbparser.ChecksumValid
+	if checksumErr != nil {
+		state = nzbparser.ChecksumInvalid
+	}
+	filePath := path.Join(group, entry)
+
+	s.mutex.Lock()
+	// Files are built from a view of the nzb, the state is kept in the one tracked; It might have been removed while the file was read
+	nzbData, exists := s.nzbFiledata[nzbData.MetaName]
+	if !exists || !nzbData.SetArchiveFileChecksum(group, entry, state) {
+		s.mutex.Unlock()
+		return
+	}
+	if err := s.store.Set(nzbData); err != nil {
+		logger.Error("Failed storing nzb", "nzb", nzbData.MetaName, "error", err)
+	}
+
+	if checksumErr == nil {
+		s.mutex.Unlock()
+		logger.Debug("Verified checksum", "nzb", nzbData.MetaName, "file", filePath)
+		return
+	}
+	logger.Error("Bad checksum", "nzb", nzbData.MetaName, "file", filePath, "error", checksumErr)
+
+	// Files arent presented yet while the nzb is built, the health check there includes the checksums
+	files := s.nzbFiles[nzbData.MetaName]
+	if len(files) == 0 {
+		s.mutex.Unlock()
+		return
+	}
+
+	unhealthyCount := len(invalidChecksumPaths(nzbData, files))
+	healthyRatio := float32(len(files)-unhealthyCount) / float32(len(files))
+	if healthyRatio >= s.filesHealthyThreshold {
+		s.mutex.Unlock()
+		logger.Warn("Some files are unhealthy but within threshold",
+			"nzb", nzbData.MetaName,
+			"healthyRatio", healthyRatio,
+			"unhealthyCount", unhealthyCount)
+		return
+	}
+
+	s.nzbBroken[nzbData.MetaName] = struct{}{}
+	delete(s.nzbFiles, nzbData.MetaName)
+	s.mutex.Unlock()
+
+	logger.Error("Removing files of nzb, too many are unhealthy",
+		"nzb", nzbData.MetaName,
+		"healthyRatio", healthyRatio,
+		"threshold", s.filesHealthyThreshold)
+	s.removeFromPresenters(nzbData.MetaName, files)
+}
+
+// invalidChecksumPaths returns the paths of the files whose archive-entry has a bad checksum
+func invalidChecksumPaths[V any](nzbData *nzbparser.NzbData, files map[string]V) []string {
+	var paths []string
+	for _, listing := range nzbData.ArchiveListings {
+		for _, file := range listing.Files {
+			if file.Checksum != nzbparser.ChecksumInvalid {
+				continue
+			}
+			filePath := path.Join(listing.Group, file.Name)
+			if _, ok := files[filePath]; ok {
+				paths = append(paths, filePath)
+			}
+		}
+	}
+	return paths
+}
+
+// appendChecksumHealthErrors adds files with a bad checksum known from before to the health errors, unless the health check already failed them
+func appendChecksumHealthErrors[V any](healthErrors []error, nzbData *nzbparser.NzbData, files map[string]V) []error {
+	failedPaths := make([]string, 0, len(healthErrors))
+	for _, err := range healthErrors {
+		var healthErr *filehealth.FileHealthError
+		if errors.As(err, &healthErr) {
+			failedPaths = append(failedPaths, healthErr.Path)
+		}
+	}
+
+	for _, filePath := range invalidChecksumPaths(nzbData, files) {
+		if slices.Contains(failedPaths, filePath) {
+			continue
+		}
+		healthErrors = append(healthErrors, &filehealth.FileHealthError{
+			Path: filePath,
+			Err:  fmt.Errorf("%w from previous read", resource.ErrBadChecksum),
+		})
+	}
+	return healthErrors
+}
+
+// NzbHealth is the health-state of an nzb and the checksum-state of its archive-entries
+type NzbHealth struct {
+	// Files were removed from presenters as too many were unhealthy
+	Broken  bool
+	Entries []ArchiveEntryHealth
+}
+
+type ArchiveEntryHealth struct {
+	// Archive-group and entry in it, as in the archive-listing
+	Group string
+	Entry string
+	// Path the file is presented at, empty if it isnt
+	Path     string
+	Checksum nzbparser.ChecksumState
+}
+
+// GetNzbHealth returns the health-state of the nzb
+func (s *Service) GetNzbHealth(metaName string) (NzbHealth, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	nzbData, exists := s.nzbFiledata[metaName]
+	if !exists {
+		return NzbHealth{}, fmt.Errorf("%w: %s", ErrNzbNotFound, metaName)
+	}
+
+	_, broken := s.nzbBroken[metaName]
+	health := NzbHealth{Broken: broken}
+	for _, listing := range nzbData.ArchiveListings {
+		if listing.Split {
+			continue
+		}
+		for _, file := range listing.Files {
+			health.Entries = append(health.Entries, ArchiveEntryHealth{
+				Group:    listing.Group,
+				Entry:    file.Name,
+				Path:     s.nzbFiles[metaName][path.Join(listing.Group, file.Name)],
+				Checksum: file.Checksum,
+			})
+		}
+	}
+	return health, nil
+}
@@ -4,8 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"path"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
 
@@ -16,6 +18,7 @@ import (
 	"git.ruekov.eu/ruakij/nzbStreamer/internal/trigger"
 	"git.ruekov.eu/ruakij/nzbStreamer/pkg/filenameops"
 	"git.ruekov.eu/ruakij/nzbStreamer/pkg/nzbparser"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/prefetch"
 	"github.com/agnivade/levenshtein"
 )
 
@@ -33,7 +36,11 @@ type Service struct {
 	presenters  []presentation.Presenter
 	triggers    []TriggerListener
 	nzbFiledata map[string]*nzbparser.NzbData
-	nzbFiles    map[string][]string // Maps NZB MetaName to its file paths
+	nzbFiles    map[string]map[string]string // Maps NZB MetaName to its files, from the path the factory built to the presented path
+	// MetaNames of nzbs with encrypted archives and no working password
+	nzbNeedsPassword map[string]struct{}
+	// MetaNames of nzbs whose files were removed from the presenters as too many had bad checksums
+	nzbBroken map[string]struct{}
 
 	// Options
 	fileBlacklist                           []regexp.Regexp
@@ -42,6 +49,7 @@ type Service struct {
 	filenameReplacementBelowLevensteinRatio float32
 	healthChecker                           filehealth.Checker
 	filesHealthyThreshold                   float32
+	prefetchManager                         *prefetch.Manager
 }
 
 func NewService(store nzbstore.NzbStore, factory nzbrecordfactory.Factory, presenters []presentation.Presenter, triggers []trigger.Trigger, healthChecker filehealth.Checker) *Service {
@@ -61,7 +69,9 @@ func NewService(store nzbstore.NzbStore, factory nzbrecordfactory.Factory, prese
 		fileBlacklist:         []regexp.Regexp{},
 		nzbFileBlacklist:      []regexp.Regexp{},
 		nzbFiledata:           make(map[string]*nzbparser.NzbData),
-		nzbFiles:              make(map[string][]string),
+		nzbFiles:              make(map[string]map[string]string),
+		nzbNeedsPassword:      make(map[string]struct{}),
+		nzbBroken:             make(map[string]struct{}),
 		healthChecker:         healthChecker,
 		filesHealthyThreshold: 1.0, // Default to requiring all files
 	}
@@ -144,18 +154,86 @@ func (s *Service) AddNzb(nzbData *nzbparser.NzbData) error {
 	s.nzbFiledata[nzbData.MetaName] = nzbData
 	s.mutex.Unlock()
 
-	// Nzb-file blacklist
-	for i := len(nzbData.Files) - 1; i >= 0; i-- {
-		if s.isBlacklistedNzbFile(nzbData.Files[i].Filename) {
-			nzbData.Files = append(nzbData.Files[:i], nzbData.Files[i+1:]...)
+	err := s.buildNzb(nzbData)
+	if errors.Is(err, nzbrecordfactory.ErrPasswordRequired) {
+		s.parkNzb(nzbData)
+		return nil
+	}
+	return err
+}
+
+// parkNzb keeps an nzb which couldnt be built with the known passwords, until one is supplied via SetNzbPassword
+func (s *Service) parkNzb(nzbData *nzbparser.NzbData) {
+	s.mutex.Lock()
+	s.nzbNeedsPassword[nzbData.MetaName] = struct{}{}
+	s.mutex.Unlock()
+
+	if err := s.store.Set(nzbData); err != nil {
+		logger.Error("Failed storing nzb", "nzb", nzbData.MetaName, "error", err)
+	}
+
+	logger.Warn("Nzb needs password, waiting for one to be supplied", "MetaName", nzbData.MetaName)
+}
+
+// ListNzbsNeedingPassword returns the MetaNames of nzbs waiting for a password
+func (s *Service) ListNzbsNeedingPassword() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	names := make([]string, 0, len(s.nzbNeedsPassword))
+	for name := range s.nzbNeedsPassword {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// SetNzbPassword supplies the password for an nzb waiting for one and builds it
+// When the password doesnt work either, the nzb keeps waiting and ErrPasswordRequired is returned; Other failures dont park it again
+func (s *Service) SetNzbPassword(metaName, password string) error {
+	s.mutex.Lock()
+	if _, waiting := s.nzbNeedsPassword[metaName]; !waiting {
+		s.mutex.Unlock()
+		return fmt.Errorf("%w: %s is not waiting for a password", ErrNzbNotFound, metaName)
+	}
+	nzbData := s.nzbFiledata[metaName]
+	delete(s.nzbNeedsPassword, metaName)
+	s.mutex.Unlock()
+
+	previousPassword, hadPassword := nzbData.Meta[nzbparser.MetaKeyPassword]
+	nzbData.SetMeta(nzbparser.MetaKeyPassword, password)
+
+	err := s.buildNzb(nzbData)
+	if err != nil {
+		if hadPassword {
+			nzbData.SetMeta(nzbparser.MetaKeyPassword, previousPassword)
+		} else {
+			nzbData.DeleteMeta(nzbparser.MetaKeyPassword)
 		}
 	}
-	if len(nzbData.Files) == 0 {
+	if errors.Is(err, nzbrecordfactory.ErrPasswordRequired) {
+		// Keep it parked, so another password can be supplied
+		s.parkNzb(nzbData)
+	}
+	return err
+}
+
+// buildNzb builds the files of the nzb, adds them to the presenters and persists the nzb when building changed it
+func (s *Service) buildNzb(nzbData *nzbparser.NzbData) error {
+	// Nzb-file blacklist only applies to what is built, the stored nzb keeps all files
+	view := s.withoutBlacklistedNzbFiles(nzbData)
+	if len(view.Files) == 0 {
 		logger.Warn("After blacklist, no nzb-files left", "MetaName", nzbData.MetaName)
 		return nil
 	}
 
-	files, err := s.factory.BuildSegmentStackFromNzbData(nzbData)
+	listingsBefore := nzbData.CloneArchiveListings()
+	metaBefore := maps.Clone(nzbData.Meta)
+
+	files, err := s.factory.BuildSegmentStackFromNzbData(view)
+	// Listings and meta gathered while building belong to the nzb
+	nzbData.ArchiveListings = view.ArchiveListings
+	nzbData.RawMeta = view.RawMeta
 	if err != nil {
 		return fmt.Errorf("failed building segment-stack for %s: %w", nzbData.MetaName, err)
 	}
@@ -174,6 +252,7 @@ func (s *Service) AddNzb(nzbData *nzbparser.NzbData) error {
 	// Perform health check on files
 	// TODO: Only run health check on nzbFiles, not special files; From here its not possible to distinguish between them; This would require a change in the factory i.e. to return 2 lists, nzbFiles and special files
 	healthErrors := s.healthChecker.CheckFiles(files)
+	healthErrors = appendChecksumHealthErrors(healthErrors, nzbData, files)
 	if len(healthErrors) > 0 {
 		// Log unhealthy files
 		for _, err := range healthErrors {
@@ -200,19 +279,20 @@ func (s *Service) AddNzb(nzbData *nzbparser.NzbData) error {
 
 	// Track files for this NZB
 	s.mutex.Lock()
-	s.nzbFiles[nzbData.MetaName] = make([]string, 0, len(files))
+	s.nzbFiles[nzbData.MetaName] = make(map[string]string, len(files))
+	delete(s.nzbBroken, nzbData.MetaName)
 
-	for filepath, file := range files {
-		filepath = s.deobfuscateFilename(filepath, paths, nzbData)
+	for builtPath, file := range files {
+		filepath := s.deobfuscateFilename(builtPath, paths, nzbData)
 		filepath = s.flattenPath(filepath, paths)
 		fullPath := path.Join(nzbData.MetaName, filepath)
 
 		// Track the full path
-		s.nzbFiles[nzbData.MetaName] = append(s.nzbFiles[nzbData.MetaName], fullPath)
+		s.nzbFiles[nzbData.MetaName][builtPath] = fullPath
 
 		// Add to presenters
 		for _, presenter := range s.presenters {
-			err = presenter.AddFile(fullPath, nzbData.Files[0].ParsedDate, file)
+			err = presenter.AddFile(fullPath, view.Files[0].ParsedDate, file)
 			if err != nil {
 				logger.Error("Failed adding segment-stack as file", "nzb", nzbData.MetaName, "error", err)
 			}
@@ -220,6 +300,13 @@ func (s *Service) AddNzb(nzbData *nzbparser.NzbData) error {
 	}
 	s.mutex.Unlock()
 
+	// Persist nzb, when archive-listings or meta were gathered while building
+	if !nzbparser.ArchiveListingsEqual(listingsBefore, nzbData.ArchiveListings) || !maps.Equal(metaBefore, nzbData.Meta) {
+		if err := s.store.Set(nzbData); err != nil {
+			logger.Error("Failed storing nzb", "nzb", nzbData.MetaName, "error", err)
+		}
+	}
+
 	logger.Info("Added nzb", "MetaName", nzbData.MetaName)
 
 	return nil
@@ -234,6 +321,15 @@ func (s *Service) isBlacklistedFilename(filename string) bool {
 	return false
 }
 
+// withoutBlacklistedNzbFiles returns a copy of the nzb without the blacklisted nzb-files
+func (s *Service) withoutBlacklistedNzbFiles(nzbData *nzbparser.NzbData) *nzbparser.NzbData {
+	view := *nzbData
+	view.Files = slices.DeleteFunc(slices.Clone(nzbData.Files), func(file nzbparser.File) bool {
+		return s.isBlacklistedNzbFile(file.Filename)
+	})
+	return &view
+}
+
 func (s *Service) isBlacklistedNzbFile(filename string) bool {
 	for i := range s.nzbFileBlacklist {
 		if s.nzbFileBlacklist[i].MatchString(filename) {
@@ -338,25 +434,35 @@ func (s *Service) RemoveNzb(nzbData *nzbparser.NzbData) error {
 
 	logger.Debug("Removing nzb", "MetaName", nzbData.MetaName)
 
-	// Get tracked files
-	files := s.nzbFiles[nzbData.MetaName]
+	// Remove tracked files from all presenters
+	s.removeFromPresenters(nzbData.MetaName, s.nzbFiles[nzbData.MetaName])
+
+	if err := s.store.Delete(nzbData); err != nil {
+		logger.Error("Failed deleting nzb from store", "nzb", nzbData.MetaName, "error", err)
+	}
+	if err := s.factory.ReleaseNzbData(nzbData); err != nil {
+		logger.Error("Failed releasing nzb", "nzb", nzbData.MetaName, "error", err)
+	}
+
+	// Clean up tracking data
+	delete(s.nzbFiledata, nzbData.MetaName)
+	delete(s.nzbFiles, nzbData.MetaName)
+	delete(s.nzbNeedsPassword, nzbData.MetaName)
+	delete(s.nzbBroken, nzbData.MetaName)
+
+	logger.Info("Removed nzb", "MetaName", nzbData.MetaName)
+	return nil
+}
 
-	// Remove from all presenters
+func (s *Service) removeFromPresenters(metaName string, files map[string]string) {
 	for _, filepath := range files {
 		for _, presenter := range s.presenters {
 			if err := presenter.RemoveFile(filepath); err != nil {
 				logger.Error("Failed removing file from presenter",
-					"nzb", nzbData.MetaName,
+					"nzb", metaName,
 					"file", filepath,
 					"error", err)
 			}
 		}
 	}
-
-	// Clean up tracking data
-	delete(s.nzbFiledata, nzbData.MetaName)
-	delete(s.nzbFiles, nzbData.MetaName)
-
-	logger.Info("Removed nzb", "MetaName", nzbData.MetaName)
-	return nil
 }
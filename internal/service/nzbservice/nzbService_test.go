@@ -0,0 +1,352 @@
+package nzbservice_test
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/internal/nzbrecordfactory"
+	"git.ruekov.eu/ruakij/nzbStreamer/internal/presentation"
+	"git.ruekov.eu/ruakij/nzbStreamer/internal/service/nzbservice"
+	"git.ruekov.eu/ruakij/nzbStreamer/internal/trigger"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/nzbparser"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/prefetch"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/bytesresource"
+)
+
+type testStore struct {
+	mutex sync.Mutex
+	sets  []nzbparser.NzbData
+	// Set waits to receive from it, when its not nil
+	release chan struct{}
+}
+
+func (s *testStore) List() ([]nzbparser.NzbData, error) {
+	return nil, nil
+}
+
+func (s *testStore) Set(data *nzbparser.NzbData) error {
+	if s.release != nil {
+		<-s.release
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sets = append(s.sets, *data)
+	return nil
+}
+
+func (s *testStore) Delete(*nzbparser.NzbData) error {
+	return nil
+}
+
+func (s *testStore) setCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.sets)
+}
+
+// testFactory builds a file per nzb-file and lists the archive "archive.rar" when its not cached yet
+// With password set, building fails with ErrPasswordRequired unless the nzb has it as Password meta
+// With entries set, the entries of the archive are built instead of the nzb-files
+type testFactory struct {
+	password string
+	entries  bool
+	err      error
+	built    [][]string
+}
+
+func (f *testFactory) BuildSegmentStackFromNzbData(nzbData *nzbparser.NzbData) (map[string]presentation.Openable, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.password != "" && nzbData.Meta[nzbparser.MetaKeyPassword] != f.password {
+		return nil, nzbrecordfactory.ErrPasswordRequired
+	}
+
+	files := make(map[string]presentation.Openable, len(nzbData.Files))
+	filenames := make([]string, 0, len(nzbData.Files))
+	for _, file := range nzbData.Files {
+		files[file.Filename] = &bytesresource.BytesResource{Content: []byte(file.Filename)}
+		filenames = append(filenames, file.Filename)
+	}
+	f.built = append(f.built, filenames)
+
+	if nzbData.GetArchiveListing("archive.rar") == nil {
+		nzbData.SetArchiveListing("archive.rar", []nzbparser.ArchiveFile{{Name: "movie.mkv", Size: 10}}, f.password)
+	}
+	if f.entries {
+		files = map[string]presentation.Openable{
+			"archive.rar/movie.mkv": &bytesresource.BytesResource{Content: []byte("movie.mkv")},
+		}
+	}
+	return files, nil
+}
+
+func (f *testFactory) ReleaseNzbData(*nzbparser.NzbData) error {
+	return nil
+}
+
+func (f *testFactory) BuildPrefetchTasks(*nzbparser.File, string, []prefetch.Range) ([]prefetch.Task, error) {
+	return nil, nil
+}
+
+type testPresenter struct {
+	mutex sync.Mutex
+	files map[string]presentation.Openable
+}
+
+func (p *testPresenter) AddFile(fullpath string, _ time.Time, openable presentation.Openable) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.files[fullpath] = openable
+	return nil
+}
+
+func (p *testPresenter) RemoveFile(fullpath string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.files, fullpath)
+	return nil
+}
+
+func (p *testPresenter) count() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return len(p.files)
+}
+
+type healthyChecker struct{}
+
+func (healthyChecker) CheckFiles(map[string]presentation.Openable) []error {
+	return nil
+}
+
+func newTestService(store *testStore, factory *testFactory) (*nzbservice.Service, *testPresenter) {
+	presenter := &testPresenter{files: make(map[string]presentation.Openable)}
+	return nzbservice.NewService(store, factory, []presentation.Presenter{presenter}, []trigger.Trigger{}, healthyChecker{}), presenter
+}
+
+func parseTestNzb(t *testing.T, name string, filenames ...string) *nzbparser.NzbData {
+	t.Helper()
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, `<nzb><head><meta type="name">%s</meta></head>`, name)
+	for i, filename := range filenames {
+		fmt.Fprintf(&builder, `<file poster="poster" date="1700000000" subject="&quot;%s&quot; yEnc (1/1)"><groups><group>alt.binaries.test</group></groups><segments><segment bytes="100" number="1">%d@test</segment></segments></file>`, filename, i)
+	}
+	builder.WriteString(`</nzb>`)
+
+	nzb, err := nzbparser.ParseNzb(strings.NewReader(builder.String()))
+	if err != nil {
+		t.Fatalf("failed parsing nzb: %v", err)
+	}
+	return nzb
+}
+
+func TestAddNzbPersistsOnlyChangedListings(t *testing.T) {
+	t.Parallel()
+
+	store := &testStore{}
+	service, _ := newTestService(store, &testFactory{})
+
+	nzb := parseTestNzb(t, "Movie", "archive.rar")
+	if err := service.AddNzb(nzb); err != nil {
+		t.Fatalf("failed adding nzb: %v", err)
+	}
+	if store.setCount() != 1 {
+		t.Fatalf("expected nzb with new listing to be stored once, got %d", store.setCount())
+	}
+
+	// As after a restart, the listing is cached now
+	reloaded := store.sets[0]
+	service, _ = newTestService(store, &testFactory{})
+	if err := service.AddNzb(&reloaded); err != nil {
+		t.Fatalf("failed adding reloaded nzb: %v", err)
+	}
+	if store.setCount() != 1 {
+		t.Errorf("expected unchanged nzb not to be stored again, got %d sets", store.setCount())
+	}
+}
+
+func TestAddNzbBlacklistKeepsStoredFiles(t *testing.T) {
+	t.Parallel()
+
+	store := &testStore{}
+	factory := &testFactory{}
+	service, presenter := newTestService(store, factory)
+	service.SetNzbFileBlacklist([]regexp.Regexp{*regexp.MustCompile(`\.par2$`)})
+
+	nzb := parseTestNzb(t, "Movie", "archive.rar", "archive.par2")
+	if err := service.AddNzb(nzb); err != nil {
+		t.Fatalf("failed adding nzb: %v", err)
+	}
+
+	if len(factory.built) != 1 || len(factory.built[0]) != 1 || factory.built[0][0] != "archive.rar" {
+		t.Errorf("expected only archive.rar to be built, got %v", factory.built)
+	}
+	if presenter.count() != 1 {
+		t.Errorf("expected 1 presented file, got %d", presenter.count())
+	}
+	if len(nzb.Files) != 2 {
+		t.Errorf("expected nzb to keep blacklisted files, got %d files", len(nzb.Files))
+	}
+	if store.setCount() != 1 || len(store.sets[0].Files) != 2 {
+		t.Errorf("expected stored nzb to keep blacklisted files")
+	}
+	if nzb.GetArchiveListing("archive.rar") == nil {
+		t.Errorf("expected listing gathered while building to be kept in the nzb")
+	}
+}
+
+func TestSetNzbPasswordParking(t *testing.T) {
+	t.Parallel()
+
+	store := &testStore{}
+	factory := &testFactory{password: "secret"}
+	service, presenter := newTestService(store, factory)
+
+	nzb := parseTestNzb(t, "Movie", "archive.rar")
+	if err := service.AddNzb(nzb); err != nil {
+		t.Fatalf("expected nzb needing password to be parked without error, got %v", err)
+	}
+	if parked := service.ListNzbsNeedingPassword(); len(parked) != 1 || parked[0] != "Movie" {
+		t.Fatalf("expected Movie to wait for a password, got %v", parked)
+	}
+
+	err := service.SetNzbPassword("Movie", "wrong")
+	if !errors.Is(err, nzbrecordfactory.ErrPasswordRequired) {
+		t.Errorf("expected ErrPasswordRequired with wrong password, got %v", err)
+	}
+	if len(service.ListNzbsNeedingPassword()) != 1 {
+		t.Errorf("expected nzb to stay parked after wrong password")
+	}
+	if _, exists := nzb.Meta[nzbparser.MetaKeyPassword]; exists {
+		t.Errorf("expected wrong password not to be kept, got %q", nzb.Meta[nzbparser.MetaKeyPassword])
+	}
+	for _, meta := range nzb.RawMeta {
+		if meta.Type == "password" {
+			t.Errorf("expected no password meta to be stored, got %+v", nzb.RawMeta)
+		}
+	}
+
+	if err := service.SetNzbPassword("Movie", "secret"); err != nil {
+		t.Fatalf("unexpected error with right password: %v", err)
+	}
+	if parked := service.ListNzbsNeedingPassword(); len(parked) != 0 {
+		t.Errorf("expected no nzb waiting for a password, got %v", parked)
+	}
+	if presenter.count() != 1 {
+		t.Errorf("expected 1 presented file, got %d", presenter.count())
+	}
+	if nzb.Meta[nzbparser.MetaKeyPassword] != "secret" {
+		t.Errorf("expected working password to be kept, got %q", nzb.Meta[nzbparser.MetaKeyPassword])
+	}
+
+	if err := service.SetNzbPassword("Movie", "secret"); !errors.Is(err, nzbservice.ErrNzbNotFound) {
+		t.Errorf("expected ErrNzbNotFound for nzb not waiting for a password, got %v", err)
+	}
+}
+
+func TestSetNzbPasswordOtherFailure(t *testing.T) {
+	t.Parallel()
+
+	factory := &testFactory{password: "secret"}
+	service, _ := newTestService(&testStore{}, factory)
+
+	if err := service.AddNzb(parseTestNzb(t, "Movie", "archive.rar")); err != nil {
+		t.Fatalf("expected nzb needing password to be parked without error, got %v", err)
+	}
+
+	// Failing for another reason than the password isnt fixed by another one
+	factory.err = errors.New("download failed")
+	err := service.SetNzbPassword("Movie", "secret")
+	if err == nil || errors.Is(err, nzbrecordfactory.ErrPasswordRequired) {
+		t.Errorf("expected the build-error, got %v", err)
+	}
+	if parked := service.ListNzbsNeedingPassword(); len(parked) != 0 {
+		t.Errorf("expected nzb not to be parked after failed build, got %v", parked)
+	}
+}
+
+// waitFor polls until condition is met, as checksum-reports are recorded in the background
+func waitFor(t *testing.T, description string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", description)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func entryChecksum(t *testing.T, service *nzbservice.Service) nzbparser.ChecksumState {
+	t.Helper()
+
+	health, err := service.GetNzbHealth("Movie")
+	if err != nil {
+		t.Fatalf("failed getting health: %v", err)
+	}
+	if len(health.Entries) != 1 {
+		t.Fatalf("expected 1 archive-entry, got %v", health.Entries)
+	}
+	return health.Entries[0].Checksum
+}
+
+func TestReportChecksum(t *testing.T) {
+	t.Parallel()
+
+	store := &testStore{}
+	service, presenter := newTestService(store, &testFactory{entries: true})
+
+	nzb := parseTestNzb(t, "Movie", "archive.rar")
+	if err := service.AddNzb(nzb); err != nil {
+		t.Fatalf("failed adding nzb: %v", err)
+	}
+	if presenter.count() != 1 {
+		t.Fatalf("expected 1 presented file, got %d", presenter.count())
+	}
+
+	// Reporting doesnt wait for the result to be stored, as its called from within reads
+	store.release = make(chan struct{})
+	reported := make(chan struct{})
+	go func() {
+		service.ReportChecksum(nzb, "archive.rar", "movie.mkv", nil)
+		close(reported)
+	}()
+	select {
+	case <-reported:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected report to return while the store is busy")
+	}
+	close(store.release)
+
+	waitFor(t, "valid checksum to be stored", func() bool {
+		return store.setCount() == 2
+	})
+	if state := entryChecksum(t, service); state != nzbparser.ChecksumValid {
+		t.Errorf("expected valid checksum-state, got %v", state)
+	}
+
+	// The only file being unhealthy falls below the threshold
+	service.ReportChecksum(nzb, "archive.rar", "movie.mkv", resource.ErrBadChecksum)
+	waitFor(t, "files to be removed", func() bool {
+		return presenter.count() == 0
+	})
+	if state := entryChecksum(t, service); state != nzbparser.ChecksumInvalid {
+		t.Errorf("expected invalid checksum-state, got %v", state)
+	}
+	health, _ := service.GetNzbHealth("Movie")
+	if !health.Broken {
+		t.Errorf("expected nzb to be marked broken")
+	}
+	if store.setCount() != 3 {
+		t.Errorf("expected invalid checksum to be stored, got %d sets", store.setCount())
+	}
+}
@@ -0,0 +1,102 @@
+package nzbservice
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/filenameops"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/nzbparser"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/prefetch"
+)
+
+var (
+	ErrFileNotFound              = errors.New("file not found")
+	ErrPrefetchDisabled          = errors.New("prefetching is disabled")
+	ErrPrefetchRangesUnsupported = errors.New("ranges are only supported for files straight from the nzb, not from archives")
+)
+
+func (s *Service) SetPrefetchManager(prefetchManager *prefetch.Manager) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.prefetchManager = prefetchManager
+}
+
+// Prefetch starts a job fetching the segments of the file into cache, all files of the nzb when file is empty
+// file is the path as presented below the nzb-folder; Files from archives fetch the whole archive, as its content cant be mapped to segments
+func (s *Service) Prefetch(metaName, file string, ranges []prefetch.Range) (prefetch.JobStatus, error) {
+	s.mutex.RLock()
+	nzbData, exists := s.nzbFiledata[metaName]
+	files := s.nzbFiles[metaName]
+	prefetchManager := s.prefetchManager
+	s.mutex.RUnlock()
+
+	if prefetchManager == nil {
+		return prefetch.JobStatus{}, ErrPrefetchDisabled
+	}
+	if !exists {
+		return prefetch.JobStatus{}, fmt.Errorf("%w: %s", ErrNzbNotFound, metaName)
+	}
+
+	nzbFiles := nzbData.Files
+	if file != "" {
+		builtPath, found := builtPathOf(metaName, file, files)
+		if !found {
+			return prefetch.JobStatus{}, fmt.Errorf("%w: %s in %s", ErrFileNotFound, file, metaName)
+		}
+		nzbFiles = nzbFilesOf(nzbData, builtPath)
+		if len(ranges) > 0 && (len(nzbFiles) != 1 || nzbFiles[0].Filename != builtPath) {
+			return prefetch.JobStatus{}, fmt.Errorf("%w: %s", ErrPrefetchRangesUnsupported, file)
+		}
+	} else if len(ranges) > 0 {
+		return prefetch.JobStatus{}, fmt.Errorf("%w: no file given", ErrPrefetchRangesUnsupported)
+	}
+
+	tasks := make([]prefetch.Task, 0)
+	for i := range nzbFiles {
+		fileTasks, err := s.factory.BuildPrefetchTasks(&nzbFiles[i], metaName, ranges)
+		if err != nil {
+			return prefetch.JobStatus{}, fmt.Errorf("failed building prefetch-tasks for %s: %w", nzbFiles[i].Filename, err)
+		}
+		tasks = append(tasks, fileTasks...)
+	}
+
+	return prefetchManager.Start(path.Join(metaName, file), tasks), nil
+}
+
+// builtPathOf finds the path the factory built for the presented file
+func builtPathOf(metaName, file string, files map[string]string) (string, bool) {
+	fullPath := path.Join(metaName, file)
+	for builtPath, presentedPath := range files {
+		if presentedPath == fullPath || builtPath == file {
+			return builtPath, true
+		}
+	}
+	return "", false
+}
+
+// nzbFilesOf returns the nzb-files the built path is read from
+func nzbFilesOf(nzbData *nzbparser.NzbData, builtPath string) []nzbparser.File {
+	filenames := make([]string, 0, len(nzbData.Files))
+	for _, nzbFile := range nzbData.Files {
+		if nzbFile.Filename == builtPath {
+			return []nzbparser.File{nzbFile}
+		}
+		filenames = append(filenames, nzbFile.Filename)
+	}
+
+	// Files from archives are below the archive-group
+	group, _, _ := strings.Cut(builtPath, "/")
+	groupFilenames := filenameops.GroupPartFilenames(filenames)[group]
+
+	nzbFiles := make([]nzbparser.File, 0, len(groupFilenames))
+	for _, nzbFile := range nzbData.Files {
+		// Split-files are named without their part-number
+		if slices.Contains(groupFilenames, nzbFile.Filename) || strings.HasPrefix(nzbFile.Filename, builtPath+".") {
+			nzbFiles = append(nzbFiles, nzbFile)
+		}
+	}
+	return nzbFiles
+}
@@ -135,6 +135,7 @@ func (fw *folderWatcher) processFile(filename string) {
 		logger.Error("Failed to parse nzb", "filename", filename, "err", err)
 		return
 	}
+	nzbData.Filename = filename
 
 	warnings, errors := nzbData.CheckPlausability()
 	if len(warnings) > 0 {
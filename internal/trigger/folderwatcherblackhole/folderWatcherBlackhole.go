@@ -84,6 +84,7 @@ func (fw *folderWatcherBlackhole) processFile(filename string) {
 		logger.Error("Failed to parse nzb", "filename", filename, "err", err)
 		return
 	}
+	nzbData.Filename = filename
 
 	fw.wg.Add(1)
 	defer fw.wg.Done()
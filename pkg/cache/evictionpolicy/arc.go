@@ -0,0 +1,130 @@
+package evictionpolicy
+
+import "container/list"
+
+var _ Policy = (*ARC)(nil)
+
+// ARC is an adaptive replacement policy balancing between recency and frequency
+// It keeps items seen once (t1) and seen multiple times (t2), plus ghost-lists of keys recently evicted from either (b1, b2)
+// Hits on ghosts shift the target size of t1, so the policy adapts to the access-pattern
+// As caches are bounded by bytes, not item count, the capacity is the current item count
+type ARC struct {
+	t1, t2, b1, b2 *list.List
+	entries        map[string]*list.Element
+	// Target size of t1
+	target int
+	// Last returned victim, only evicted items are remembered in ghost-lists
+	victim string
+	// If the last added item was a ghost-hit in b2, which prefers evicting from t1
+	lastHitB2 bool
+}
+
+type arcEntry struct {
+	key  string
+	list *list.List
+}
+
+func NewARC() *ARC {
+	return &ARC{
+		t1:      list.New(),
+		t2:      list.New(),
+		b1:      list.New(),
+		b2:      list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (p *ARC) capacity() int {
+	return max(p.t1.Len()+p.t2.Len(), 1)
+}
+
+func (p *ARC) moveToFront(element *list.Element, to *list.List) {
+	entry := element.Value.(*arcEntry)
+	entry.list.Remove(element)
+	entry.list = to
+	p.entries[entry.key] = to.PushFront(entry)
+}
+
+func (p *ARC) Added(key string) {
+	p.lastHitB2 = false
+
+	element, exists := p.entries[key]
+	if !exists {
+		p.entries[key] = p.t1.PushFront(&arcEntry{key: key, list: p.t1})
+		return
+	}
+
+	switch element.Value.(*arcEntry).list {
+	case p.b1:
+		// Recently evicted from t1, t1 should be larger
+		p.target = min(p.target+max(p.b2.Len()/p.b1.Len(), 1), p.capacity())
+	case p.b2:
+		// Recently evicted from t2, t2 should be larger
+		p.target = max(p.target-max(p.b1.Len()/p.b2.Len(), 1), 0)
+		p.lastHitB2 = true
+	}
+	p.moveToFront(element, p.t2)
+}
+
+func (p *ARC) Accessed(key string) {
+	element, exists := p.entries[key]
+	if !exists {
+		return
+	}
+	if entry := element.Value.(*arcEntry); entry.list == p.t1 || entry.list == p.t2 {
+		p.moveToFront(element, p.t2)
+	}
+}
+
+func (p *ARC) Removed(key string) {
+	element, exists := p.entries[key]
+	if !exists {
+		return
+	}
+	entry := element.Value.(*arcEntry)
+
+	switch {
+	case key == p.victim && entry.list == p.t1:
+		p.moveToFront(element, p.b1)
+	case key == p.victim && entry.list == p.t2:
+		p.moveToFront(element, p.b2)
+	default:
+		entry.list.Remove(element)
+		delete(p.entries, key)
+	}
+	p.victim = ""
+
+	p.trimGhosts()
+}
+
+// trimGhosts keeps the ghost-lists bounded by the capacity
+func (p *ARC) trimGhosts() {
+	capacity := p.capacity()
+	for p.b1.Len() > 0 && p.t1.Len()+p.b1.Len() > capacity {
+		p.removeBack(p.b1)
+	}
+	for p.b2.Len() > 0 && p.t1.Len()+p.t2.Len()+p.b1.Len()+p.b2.Len() > 2*capacity {
+		p.removeBack(p.b2)
+	}
+}
+
+func (p *ARC) removeBack(l *list.List) {
+	back := l.Back()
+	l.Remove(back)
+	delete(p.entries, back.Value.(*arcEntry).key)
+}
+
+func (p *ARC) Victim() string {
+	var from *list.List
+	switch {
+	case p.t1.Len() > 0 && (p.t1.Len() > p.target || p.t2.Len() == 0 || (p.lastHitB2 && p.t1.Len() == p.target)):
+		from = p.t1
+	case p.t2.Len() > 0:
+		from = p.t2
+	default:
+		return ""
+	}
+
+	p.victim = from.Back().Value.(*arcEntry).key
+	return p.victim
+}
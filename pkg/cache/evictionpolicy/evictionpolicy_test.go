@@ -0,0 +1,206 @@
+package evictionpolicy_test
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache/evictionpolicy"
+)
+
+var policies = []struct {
+	name string
+	new  func() evictionpolicy.Policy
+}{
+	{"LRU", func() evictionpolicy.Policy { return evictionpolicy.NewLRU() }},
+	{"FIFO", func() evictionpolicy.Policy { return evictionpolicy.NewFIFO() }},
+	{"LFU", func() evictionpolicy.Policy { return evictionpolicy.NewLFU() }},
+	{"ARC", func() evictionpolicy.Policy { return evictionpolicy.NewARC() }},
+}
+
+// evict removes the victim like a cache would
+func evict(t *testing.T, policy evictionpolicy.Policy) string {
+	t.Helper()
+	victim := policy.Victim()
+	if victim == "" {
+		t.Fatal("expected a victim")
+	}
+	policy.Removed(victim)
+	return victim
+}
+
+func TestLRU(t *testing.T) {
+	t.Parallel()
+
+	policy := evictionpolicy.NewLRU()
+	policy.Added("a")
+	policy.Added("b")
+	policy.Added("c")
+	policy.Accessed("a")
+
+	for _, expected := range []string{"b", "c", "a"} {
+		if victim := evict(t, policy); victim != expected {
+			t.Errorf("expected %s to be evicted, got %s", expected, victim)
+		}
+	}
+	if victim := policy.Victim(); victim != "" {
+		t.Errorf("expected no victim when empty, got %s", victim)
+	}
+}
+
+func TestFIFO(t *testing.T) {
+	t.Parallel()
+
+	policy := evictionpolicy.NewFIFO()
+	policy.Added("a")
+	policy.Added("b")
+	policy.Added("c")
+	// Accesses dont change the order
+	policy.Accessed("a")
+	policy.Accessed("a")
+
+	for _, expected := range []string{"a", "b", "c"} {
+		if victim := evict(t, policy); victim != expected {
+			t.Errorf("expected %s to be evicted, got %s", expected, victim)
+		}
+	}
+}
+
+func TestLFU(t *testing.T) {
+	t.Parallel()
+
+	policy := evictionpolicy.NewLFU()
+	policy.Added("a")
+	policy.Added("b")
+	policy.Added("c")
+	policy.Accessed("a")
+	policy.Accessed("a")
+	policy.Accessed("c")
+	// b and d used once, b longer ago
+	policy.Added("d")
+
+	for _, expected := range []string{"b", "d", "c", "a"} {
+		if victim := evict(t, policy); victim != expected {
+			t.Errorf("expected %s to be evicted, got %s", expected, victim)
+		}
+	}
+}
+
+func TestARCResistsScans(t *testing.T) {
+	t.Parallel()
+
+	policy := evictionpolicy.NewARC()
+	hot := []string{"hot1", "hot2", "hot3"}
+	for _, key := range hot {
+		policy.Added(key)
+		policy.Accessed(key)
+	}
+
+	// Scan through many keys used once, keeping the item count constant
+	policy.Added("cold")
+	for i := range 100 {
+		if victim := evict(t, policy); victim[:3] == "hot" {
+			t.Fatalf("expected scan not to evict frequently used %s", victim)
+		}
+		policy.Added("cold" + strconv.Itoa(i))
+	}
+}
+
+func TestARCAdaptsToGhostHits(t *testing.T) {
+	t.Parallel()
+
+	policy := evictionpolicy.NewARC()
+	policy.Added("frequent")
+	policy.Accessed("frequent")
+	policy.Added("a")
+
+	// a is evicted from the recent-list and remembered as ghost
+	if victim := evict(t, policy); victim != "a" {
+		t.Fatalf("expected a to be evicted, got %s", victim)
+	}
+	// Ghost-hit promotes a to frequent-list and grows the room for recent items
+	policy.Added("a")
+	policy.Added("b")
+
+	// Without the ghost-hit, b would be evicted first
+	for _, expected := range []string{"frequent", "a", "b"} {
+		if victim := evict(t, policy); victim != expected {
+			t.Errorf("expected %s to be evicted, got %s", expected, victim)
+		}
+	}
+}
+
+// TestPoliciesConsistent checks with random operations, that victims are always items present
+func TestPoliciesConsistent(t *testing.T) {
+	t.Parallel()
+
+	for _, p := range policies {
+		t.Run(p.name, func(t *testing.T) {
+			t.Parallel()
+
+			policy := p.new()
+			present := make(map[string]bool)
+			random := rand.New(rand.NewSource(1))
+
+			for range 10_000 {
+				key := strconv.Itoa(random.Intn(200))
+				switch random.Intn(4) {
+				case 0:
+					if !present[key] {
+						policy.Added(key)
+						present[key] = true
+					}
+				case 1:
+					if present[key] {
+						policy.Accessed(key)
+					}
+				case 2:
+					if present[key] {
+						policy.Removed(key)
+						delete(present, key)
+					}
+				case 3:
+					victim := policy.Victim()
+					if victim == "" {
+						if len(present) > 0 {
+							t.Fatalf("expected a victim with %d items present", len(present))
+						}
+						continue
+					}
+					if !present[victim] {
+						t.Fatalf("victim %s isnt present", victim)
+					}
+					policy.Removed(victim)
+					delete(present, victim)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkEviction measures evicting one item and adding another, with 10^6 items present
+func BenchmarkEviction(b *testing.B) {
+	const items = 1_000_000
+
+	keys := make([]string, items*2)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+
+	for _, p := range policies {
+		b.Run(p.name, func(b *testing.B) {
+			policy := p.new()
+			for _, key := range keys[:items] {
+				policy.Added(key)
+			}
+			b.ResetTimer()
+
+			for i := range b.N {
+				policy.Removed(policy.Victim())
+				key := keys[items+i%items]
+				policy.Added(key)
+				policy.Accessed(key)
+			}
+		})
+	}
+}
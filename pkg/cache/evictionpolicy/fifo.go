@@ -0,0 +1,41 @@
+package evictionpolicy
+
+import "container/list"
+
+var _ Policy = (*FIFO)(nil)
+
+// FIFO evicts the item added first, regardless of accesses
+type FIFO struct {
+	order    *list.List
+	elements map[string]*list.Element
+}
+
+func NewFIFO() *FIFO {
+	return &FIFO{
+		order:    list.New(),
+		elements: make(map[string]*list.Element),
+	}
+}
+
+func (p *FIFO) Added(key string) {
+	if _, exists := p.elements[key]; exists {
+		return
+	}
+	p.elements[key] = p.order.PushFront(key)
+}
+
+func (p *FIFO) Accessed(string) {}
+
+func (p *FIFO) Removed(key string) {
+	if element, exists := p.elements[key]; exists {
+		p.order.Remove(element)
+		delete(p.elements, key)
+	}
+}
+
+func (p *FIFO) Victim() string {
+	if back := p.order.Back(); back != nil {
+		return back.Value.(string)
+	}
+	return ""
+}
@@ -0,0 +1,102 @@
+package evictionpolicy
+
+import "container/heap"
+
+var _ Policy = (*LFU)(nil)
+
+// LFU evicts the least frequently used item, ties are broken by least recent use
+type LFU struct {
+	entries lfuHeap
+	byKey   map[string]*lfuEntry
+	// Increasing counter for recency, cheaper and more precise than timestamps
+	tick uint64
+}
+
+type lfuEntry struct {
+	key        string
+	count      uint64
+	lastAccess uint64
+	index      int
+}
+
+func NewLFU() *LFU {
+	return &LFU{
+		byKey: make(map[string]*lfuEntry),
+	}
+}
+
+func (p *LFU) Added(key string) {
+	if _, exists := p.byKey[key]; exists {
+		p.Accessed(key)
+		return
+	}
+
+	p.tick++
+	entry := &lfuEntry{
+		key:        key,
+		count:      1,
+		lastAccess: p.tick,
+	}
+	p.byKey[key] = entry
+	heap.Push(&p.entries, entry)
+}
+
+func (p *LFU) Accessed(key string) {
+	entry, exists := p.byKey[key]
+	if !exists {
+		return
+	}
+
+	p.tick++
+	entry.count++
+	entry.lastAccess = p.tick
+	heap.Fix(&p.entries, entry.index)
+}
+
+func (p *LFU) Removed(key string) {
+	entry, exists := p.byKey[key]
+	if !exists {
+		return
+	}
+	heap.Remove(&p.entries, entry.index)
+	delete(p.byKey, key)
+}
+
+func (p *LFU) Victim() string {
+	if len(p.entries) == 0 {
+		return ""
+	}
+	return p.entries[0].key
+}
+
+// lfuHeap implements heap.Interface with the least used entry on top
+type lfuHeap []*lfuEntry
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].count != h[j].count {
+		return h[i].count < h[j].count
+	}
+	return h[i].lastAccess < h[j].lastAccess
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x any) {
+	entry := x.(*lfuEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *lfuHeap) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return entry
+}
@@ -0,0 +1,46 @@
+package evictionpolicy
+
+import "container/list"
+
+var _ Policy = (*LRU)(nil)
+
+// LRU evicts the least recently used item
+type LRU struct {
+	order    *list.List
+	elements map[string]*list.Element
+}
+
+func NewLRU() *LRU {
+	return &LRU{
+		order:    list.New(),
+		elements: make(map[string]*list.Element),
+	}
+}
+
+func (p *LRU) Added(key string) {
+	if element, exists := p.elements[key]; exists {
+		p.order.MoveToFront(element)
+		return
+	}
+	p.elements[key] = p.order.PushFront(key)
+}
+
+func (p *LRU) Accessed(key string) {
+	if element, exists := p.elements[key]; exists {
+		p.order.MoveToFront(element)
+	}
+}
+
+func (p *LRU) Removed(key string) {
+	if element, exists := p.elements[key]; exists {
+		p.order.Remove(element)
+		delete(p.elements, key)
+	}
+}
+
+func (p *LRU) Victim() string {
+	if back := p.order.Back(); back != nil {
+		return back.Value.(string)
+	}
+	return ""
+}
@@ -0,0 +1,15 @@
+// Package evictionpolicy tracks cache items to choose which one to evict next, without scanning all items
+package evictionpolicy
+
+// Policy is notified about changes to the cache-items and chooses the next item to evict
+// Implementations arent safe for concurrent use, the cache has to hold its lock when calling them
+type Policy interface {
+	// Added is called when a new item was stored
+	Added(key string)
+	// Accessed is called when an item was read or overwritten
+	Accessed(key string)
+	// Removed is called when an item was removed, either evicted or otherwise
+	Removed(key string)
+	// Victim returns the item to evict next without removing it; empty when there are no items
+	Victim() string
+}
@@ -0,0 +1,30 @@
+package cache
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+var logger = slog.With("Module", "CacheJanitor")
+
+// RunJanitor removes expired items every interval until ctx is done
+func RunJanitor(ctx context.Context, c ExpiringCache, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := c.RemoveExpired()
+			if err != nil {
+				logger.Error("Failed removing expired items", "error", err)
+			}
+			if removed > 0 {
+				logger.Debug("Removed expired items", "count", removed)
+			}
+		}
+	}
+}
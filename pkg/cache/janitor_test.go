@@ -0,0 +1,45 @@
+package cache_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/memorycache"
+)
+
+func TestRunJanitor(t *testing.T) {
+	t.Parallel()
+
+	c, err := memorycache.NewCache(&memorycache.CacheOptions{MaxSize: 100, TTL: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SetWithReader("a", bytes.NewReader([]byte("Hello"))); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		cache.RunJanitor(ctx, c, 5*time.Millisecond)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for c.CurrentSize() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected janitor to remove expired item")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected janitor to stop when context is done")
+	}
+}
@@ -0,0 +1,54 @@
+package cache
+
+import "time"
+
+type SetOptions struct {
+	// Time after which the item expires; 0 never expires
+	TTL time.Duration
+	// Who the item belongs to e.g. an nzb, used for quotas and unpinning; empty when unknown
+	Owner string
+	// Never evict the item, until its owner is unpinned
+	Pinned bool
+}
+
+type SetOption func(*SetOptions)
+
+// WithTTL overwrites the caches default TTL for this item
+func WithTTL(ttl time.Duration) SetOption {
+	return func(o *SetOptions) {
+		o.TTL = ttl
+	}
+}
+
+// WithOwner assigns the item to owner
+func WithOwner(owner string) SetOption {
+	return func(o *SetOptions) {
+		o.Owner = owner
+	}
+}
+
+// WithPinned protects the item from eviction, caches not supporting it ignore this
+func WithPinned(pinned bool) SetOption {
+	return func(o *SetOptions) {
+		o.Pinned = pinned
+	}
+}
+
+// NewSetOptions applies options over the caches defaults
+func NewSetOptions(defaultTTL time.Duration, options []SetOption) SetOptions {
+	setOptions := SetOptions{
+		TTL: defaultTTL,
+	}
+	for _, option := range options {
+		option(&setOptions)
+	}
+	return setOptions
+}
+
+// ExpiresAt returns the expiry-time for an item set at now; zero when it doesnt expire
+func (o SetOptions) ExpiresAt(now time.Time) time.Time {
+	if o.TTL <= 0 {
+		return time.Time{}
+	}
+	return now.Add(o.TTL)
+}
@@ -0,0 +1,80 @@
+// Package cache defines the interface shared by the cache-backends e.g. diskcache, memorycache and tieredcache
+package cache
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	ErrItemNotFound = errors.New("item not found")
+	// Returned when the backend cant store the item right now e.g. disk is full, callers can pass content through uncached
+	ErrInsufficientSpace = errors.New("insufficient space for item")
+)
+
+type ItemHeader struct {
+	ModTime time.Time
+	Size    int64
+	// When the item expires; zero when it doesnt
+	ExpiresAt time.Time
+}
+
+// Expired checks if the item expired at the given time
+func (h ItemHeader) Expired(now time.Time) bool {
+	return !h.ExpiresAt.IsZero() && !now.Before(h.ExpiresAt)
+}
+
+type Cache interface {
+	// GetWithReader opens the item for reading, the reader has to be closed after use
+	GetWithReader(key string) (io.ReadSeekCloser, *ItemHeader, error)
+	// SetWithReader reads reader until EOF and stores the content as item
+	SetWithReader(key string, reader io.Reader, options ...SetOption) (int64, error)
+	Exists(key string) (bool, ItemHeader)
+	Remove(key string) error
+}
+
+// ExpiringCache is a Cache which can remove its expired items in bulk, see RunJanitor
+type ExpiringCache interface {
+	Cache
+	// RemoveExpired removes all expired items and returns how many were removed
+	RemoveExpired() (int, error)
+}
+
+// PinningCache can protect items from eviction, see WithPinned
+type PinningCache interface {
+	Cache
+	// UnpinOwner allows evicting all items of owner again
+	UnpinOwner(owner string) error
+}
+
+// EvictionReason tells why the cache removed an item on its own
+type EvictionReason string
+
+const (
+	EvictedMaxSize   EvictionReason = "max-size"
+	EvictedQuota     EvictionReason = "quota"
+	EvictedFreeSpace EvictionReason = "free-space"
+	EvictedExpired   EvictionReason = "expired"
+	EvictedCorrupt   EvictionReason = "corrupt"
+)
+
+// Stats of a cache; Counters are since it was created, sizes are current
+type Stats struct {
+	Hits   int64
+	Misses int64
+	// Bytes of content stored
+	BytesWritten int64
+	Evictions    map[EvictionReason]int64
+	Items        int
+	// Size of all items as counted against the max-size e.g. on disk
+	Size int64
+	// Size of the items of each owner
+	OwnerSizes map[string]int64
+}
+
+// StatsCache keeps counters about its use
+type StatsCache interface {
+	Cache
+	Stats() Stats
+}
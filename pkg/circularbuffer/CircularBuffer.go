@@ -3,6 +3,7 @@
 package circularbuffer
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -111,10 +112,12 @@ func (cb *CircularBuffer[T]) SetWriteBlocking(blocking bool) {
 }
 
 // SetReadBlocking configures whether read operations should be blocking when the buffer is empty.
+// Disabling it wakes up reads waiting with the configured behavior e.g. when no more data will be written.
 func (cb *CircularBuffer[T]) SetReadBlocking(blocking bool) {
 	cb.mu.Lock()
 	defer cb.mu.Unlock()
 	cb.blockRead = blocking
+	cb.canRead.Broadcast()
 }
 
 // Write writes data to the buffer with the currently configured blocking behavior.
@@ -187,7 +190,7 @@ func (cb *CircularBuffer[T]) write(data []T, blocking bool) (int, error) {
 
 // Read reads data from the buffer with the currently configured blocking behavior.
 func (cb *CircularBuffer[T]) Read(p []T) (int, error) {
-	return cb.read(p, cb.blockRead)
+	return cb.readContext(context.Background(), p, nil)
 }
 
 // ReadBlocking reads data from the buffer in a blocking manner, waiting if the buffer is empty.
@@ -200,18 +203,43 @@ func (cb *CircularBuffer[T]) ReadNonBlocking(p []T) (int, error) {
 	return cb.read(p, false)
 }
 
+// ReadContext reads data from the buffer with the currently configured blocking behavior, waiting is aborted when ctx is done
+func (cb *CircularBuffer[T]) ReadContext(ctx context.Context, p []T) (int, error) {
+	// Wake up waiting reads, so they see ctx is done
+	stop := context.AfterFunc(ctx, func() {
+		cb.mu.Lock()
+		defer cb.mu.Unlock()
+		cb.canRead.Broadcast()
+	})
+	defer stop()
+
+	return cb.readContext(ctx, p, nil)
+}
+
 func (cb *CircularBuffer[T]) read(p []T, blocking bool) (int, error) {
+	return cb.readContext(context.Background(), p, &blocking)
+}
+
+// readContext reads with the configured blocking behavior when blocking is nil, which is re-checked while waiting
+func (cb *CircularBuffer[T]) readContext(ctx context.Context, p []T, blocking *bool) (int, error) {
 	cb.mu.Lock()
 	defer cb.mu.Unlock()
 
-	if cb.size == 0 {
-		if blocking {
-			for cb.size == 0 {
-				cb.canRead.Wait()
-			}
-		} else {
+	isBlocking := func() bool {
+		if blocking != nil {
+			return *blocking
+		}
+		return cb.blockRead
+	}
+
+	for cb.size == 0 {
+		if !isBlocking() {
 			return 0, io.EOF
 		}
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		cb.canRead.Wait()
 	}
 
 	readSpace := cb.exposeReadSpace()
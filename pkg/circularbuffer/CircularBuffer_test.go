@@ -1,6 +1,7 @@
 package circularbuffer_test
 
 import (
+	"context"
 	"errors"
 	"io"
 	"testing"
@@ -578,3 +579,27 @@ func BenchmarkRead(b *testing.B) {
 		b.StartTimer()
 	}
 }
+
+func TestReadContextAbortsBlockingRead(t *testing.T) {
+	t.Parallel()
+
+	cb := circularbuffer.NewCircularBuffer[byte](0, 10)
+	cb.SetReadBlocking(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := cb.ReadContext(ctx, make([]byte, 5))
+		done <- err
+	}()
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("blocking read wasnt aborted")
+	}
+}
@@ -2,20 +2,33 @@ package diskcache
 
 import (
 	"bytes"
+	"crypto/cipher"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache/evictionpolicy"
+)
+
+var logger = slog.With("Module", "DiskCache")
+
+var (
+	_ cache.ExpiringCache = (*Cache)(nil)
+	_ cache.PinningCache  = (*Cache)(nil)
+	_ cache.StatsCache    = (*Cache)(nil)
 )
 
 var ErrInvalidCacheOptions = errors.New("invalid cache settings")
 
 func NewCache(options *CacheOptions) (*Cache, error) {
-	if options.MaxSize < 0 || options.ItemMaxSize < 0 || options.CacheDir == "" {
+	if options.MaxSize < 0 || options.ItemMaxSize < 0 || options.TTL < 0 || options.OwnerQuota < 0 || options.PinnedMaxSize < 0 || options.MinFreeSpace < 0 || options.CacheDir == "" {
 		return nil, ErrInvalidCacheOptions
 	}
 
@@ -33,93 +46,130 @@ func NewCache(options *CacheOptions) (*Cache, error) {
 		return nil, err
 	}
 
-	if options.EvictPolicyHook == nil {
-		options.EvictPolicyHook = defaultCacheOptions.EvictPolicyHook
+	if options.EvictionPolicy == nil {
+		options.EvictionPolicy = evictionpolicy.NewLRU()
 	}
-
-	cache := &Cache{
-		mu:      &sync.RWMutex{},
-		options: options,
-		items:   make(map[string]CacheItemHeader),
+	if options.PinnedMaxSize == 0 {
+		options.PinnedMaxSize = options.MaxSize / 2
 	}
 
-	if err := cache.loadExistingItems(); err != nil {
-		return nil, err
+	var itemCodec codec
+	if options.Compression != CompressionNone {
+		var err error
+		itemCodec, err = codecOf(options.Compression)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidCacheOptions, err)
+		}
 	}
 
-	// Run sizeEvict, when current size is too large for maxSize
-	if cache.options.MaxSize > 0 && cache.currentSize > cache.options.MaxSize {
-		err := cache.maxSizeEvict(0)
+	var itemAead cipher.AEAD
+	if options.EncryptionSecret != "" {
+		var err error
+		itemAead, err = newItemAead(options.EncryptionSecret)
 		if err != nil {
-			return nil, fmt.Errorf("failed initial evicting: %w", err)
+			return nil, err
 		}
 	}
 
-	return cache, nil
-}
-
-func (c *Cache) loadExistingItems() error {
-	files, err := os.ReadDir(c.options.CacheDir)
-	if err != nil {
-		return fmt.Errorf("failed reading dir: %w", err)
+	c := &Cache{
+		codec:         itemCodec,
+		aead:          itemAead,
+		mu:            &sync.RWMutex{},
+		options:       options,
+		items:         make(map[string]CacheItemHeader),
+		ownerSizes:    make(map[string]int64),
+		ownerPolicies: make(map[string]*evictionpolicy.LRU),
+		evictions:     make(map[cache.EvictionReason]int64),
 	}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	if err := c.loadExistingItems(); err != nil {
+		return nil, err
+	}
 
-	for _, file := range files {
-		filePath := filepath.Join(c.options.CacheDir, file.Name())
-		info, err := os.Stat(filePath)
+	// Run sizeEvict, when current size is too large for maxSize
+	if c.options.MaxSize > 0 && c.currentSize > c.options.MaxSize {
+		err := c.maxSizeEvict(0)
 		if err != nil {
-			continue
+			return nil, fmt.Errorf("failed initial evicting: %w", err)
 		}
-		if info.IsDir() {
-			continue
+	}
+	// Low disk space isnt fatal, items are passed through until space is available
+	if c.options.MinFreeSpace > 0 {
+		if err := c.refreshFreeSpace(); err != nil {
+			return nil, err
 		}
-
-		c.items[file.Name()] = CacheItemHeader{
-			lock:    &sync.RWMutex{},
-			ModTime: info.ModTime(),
-			Size:    info.Size(),
+		if err := c.freeSpaceEvict(0); err != nil && !errors.Is(err, ErrLowDiskSpace) {
+			return nil, fmt.Errorf("failed initial evicting for free space: %w", err)
 		}
-		c.currentSize += info.Size()
 	}
 
-	return nil
+	return c, nil
 }
 
 var (
 	ErrCouldNotMakeEnoughSpace = errors.New("could not make required space")
-	ErrItemNotFound            = errors.New("item not found")
+	ErrItemNotFound            = cache.ErrItemNotFound
 )
 
 func (c *Cache) maxSizeEvict(requiredSpace int64) error {
 	for c.options.MaxSize-c.currentSize < requiredSpace {
-		key := c.options.EvictPolicyHook(c.items)
+		key := c.options.EvictionPolicy.Victim()
 		if key == "" {
 			return ErrCouldNotMakeEnoughSpace
 		}
 
-		header, exists := c.items[key]
-		if !exists {
-			return ErrItemNotFound
-		}
-
-		header.lock.Lock()
-		err := c.removeFile(key)
-		header.lock.Unlock()
-		if err != nil {
+		if err := c.evict(key, cache.EvictedMaxSize); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// maxSizeEvictForItem evicts so the item being written fits with storedSize, in background unless MaxSizeEvictBlocking
+func (c *Cache) maxSizeEvictForItem(storedSize int64) error {
+	if c.options.MaxSize <= 0 {
+		return nil
+	}
+
+	if !defaultCacheOptions.MaxSizeEvictBlocking {
+		go func() {
+			c.mu.Lock()
+			err := c.maxSizeEvict(storedSize)
+			c.mu.Unlock()
+			if err != nil {
+				logger.Error("Couldnt evict for item", "wanted space", storedSize, "error", err)
+			}
+		}()
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.maxSizeEvict(storedSize)
+}
+
 const ReadBufferSize = 1024 * 1024 // 1MB buffer for reading, adjust size as needed
 
-func (c *Cache) SetWithReader(key string, reader io.Reader) (int64, error) {
+func (c *Cache) SetWithReader(key string, reader io.Reader, options ...cache.SetOption) (int64, error) {
+	setOptions := cache.NewSetOptions(c.options.TTL, options)
+
+	// Check before reading anything, so the caller can still pass the content through
+	// Chunks are only checked against the free space tracked since, so the filesystem is asked once per item
+	if c.options.MinFreeSpace > 0 {
+		if err := c.refreshFreeSpace(); err != nil {
+			return 0, err
+		}
+		c.mu.Lock()
+		err := c.freeSpaceEvict(0)
+		c.mu.Unlock()
+		if err != nil {
+			return 0, err
+		}
+	}
+
 	// Define the path for the temporary file
-	tempFilePath := filepath.Join(c.options.TmpCacheDir, key)
+	finalFilePath := c.itemPath(key)
+	tempFilePath := filepath.Join(c.options.TmpCacheDir, filepath.Base(finalFilePath))
 
 	file, err := os.Create(tempFilePath)
 	if err != nil {
@@ -135,41 +185,48 @@ func (c *Cache) SetWithReader(key string, reader io.Reader) (int64, error) {
 
 	var totalWritten int64
 	buf := make([]byte, ReadBufferSize)
+	// Checksum covers what is stored, so corruption is found without decompressing or decrypting
+	checksum := crc32.New(checksumTable)
+	// Counts the stored size, which is what currentSize tracks
+	stored := &countingWriter{writer: file}
+	var out io.Writer = io.MultiWriter(stored, checksum)
+	var encryptor *encryptingWriter
+	if c.aead != nil {
+		encryptor, err = newEncryptingWriter(out, c.aead, key)
+		if err != nil {
+			return 0, err
+		}
+		out = encryptor
+	}
+	var compressor *compressingWriter
+	if c.codec != nil {
+		compressor = newCompressingWriter(out, c.codec)
+		out = compressor
+	}
 
-	var totalN int64 = 0
 	for {
 		// Read a chunk
 		n, readErr := reader.Read(buf)
-		totalN += int64(n)
 		if n > 0 {
-			if c.options.MaxSize > 0 {
-				if defaultCacheOptions.MaxSizeEvictBlocking {
-					// Ensure there is enough space, evict if necessary
-					c.mu.Lock()
-					err = c.maxSizeEvict(totalN)
-					c.mu.Unlock()
-					if err != nil {
-						return totalWritten, err
-					}
-				} else {
-					go func(totalN int64) {
-						// Ensure there is enough space, evict if necessary
-						c.mu.Lock()
-						err = c.maxSizeEvict(totalN)
-						c.mu.Unlock()
-						if err != nil {
-							slog.Error("Couldnt evict for item", "wanted space", totalN, "error", err)
-						}
-					}(totalN)
+			if c.options.MinFreeSpace > 0 {
+				c.mu.Lock()
+				err = c.freeSpaceEvict(int64(n))
+				c.mu.Unlock()
+				if err != nil {
+					return totalWritten, err
 				}
 			}
 
 			// Write the chunk
-			nw, writeErr := file.Write(buf[:n])
+			nw, writeErr := out.Write(buf[:n])
 			if writeErr != nil {
 				return totalWritten, fmt.Errorf("failed writing chunk: %w", writeErr)
 			}
 			totalWritten += int64(nw)
+
+			if err = c.maxSizeEvictForItem(stored.written); err != nil {
+				return totalWritten, err
+			}
 		}
 
 		// End of reader, or error
@@ -181,11 +238,60 @@ func (c *Cache) SetWithReader(key string, reader io.Reader) (int64, error) {
 		}
 	}
 
+	compression := CompressionNone
+	if compressor != nil {
+		var compressed bool
+		compressed, err = compressor.Close()
+		if err != nil {
+			return totalWritten, fmt.Errorf("failed finishing compression: %w", err)
+		}
+		if compressed {
+			compression = c.options.Compression
+		}
+	}
+	if encryptor != nil {
+		if err = encryptor.Close(); err != nil {
+			return totalWritten, fmt.Errorf("failed finishing encryption: %w", err)
+		}
+	}
+	storedSize := stored.written
+	// Finishing wrote the last buffered block and trailers
+	if err = c.maxSizeEvictForItem(storedSize); err != nil {
+		return totalWritten, err
+	}
+
 	if err := file.Sync(); err != nil {
 		return totalWritten, fmt.Errorf("failed syncing file: %w", err)
 	}
 
-	finalFilePath := filepath.Join(c.options.CacheDir, key)
+	now := time.Now()
+	sum := checksum.Sum32()
+	sidecar := itemSidecar{
+		Key:         key,
+		Size:        storedSize,
+		Compression: compression,
+		Encrypted:   encryptor != nil,
+		Checksum:    &sum,
+		ExpiresAt:   setOptions.ExpiresAt(now),
+		Owner:       setOptions.Owner,
+		Pinned:      setOptions.Pinned && c.canPin(storedSize),
+	}
+	if compression != CompressionNone || sidecar.Encrypted {
+		sidecar.ContentSize = totalWritten
+	}
+
+	if err = os.MkdirAll(filepath.Dir(finalFilePath), DirFileMode); err != nil {
+		return totalWritten, fmt.Errorf("failed creating shard-dir: %w", err)
+	}
+	// Sidecar and journal first, items without are removed on load
+	if err = writeSidecar(sidecarPath(finalFilePath), sidecar); err != nil {
+		return totalWritten, err
+	}
+	if c.journal != nil {
+		if err = c.journal.appendSet(journalRecord{itemSidecar: sidecar, ModTime: now}); err != nil {
+			return totalWritten, err
+		}
+	}
 	err = os.Rename(tempFilePath, finalFilePath)
 	if err != nil {
 		return totalWritten, fmt.Errorf("faile drenaming file: %w", err)
@@ -194,22 +300,48 @@ func (c *Cache) SetWithReader(key string, reader io.Reader) (int64, error) {
 	// Successfully updated, update header
 	c.mu.Lock()
 	header, exists := c.items[key]
-	if !exists {
+	if exists {
+		// Overwritten, old size isnt on disk anymore
+		c.untrack(key, header)
+	} else {
 		header = CacheItemHeader{
-			lock:    &sync.RWMutex{},
-			ModTime: time.Now(),
+			lock: &sync.RWMutex{},
+			ItemHeader: cache.ItemHeader{
+				ModTime: now,
+			},
 		}
 	}
 	header.Size = totalWritten
+	header.storedSize = storedSize
+	header.compression = compression
+	header.encrypted = sidecar.Encrypted
+	header.ExpiresAt = sidecar.ExpiresAt
+	header.checksum = sidecar.Checksum
+	header.owner = sidecar.Owner
+	header.pinned = sidecar.Pinned
+	// Just written, no need to check it again
+	header.verified = true
 	c.items[key] = header
-	c.currentSize += totalWritten
+	c.track(key, header)
+	if err := c.quotaEvict(header.owner, key); err != nil {
+		logger.Error("Couldnt evict for quota", "owner", header.owner, "error", err)
+	}
+	if c.journal != nil {
+		c.journal.commit(key)
+		if c.journal.needsCompaction(len(c.items)) {
+			if err := c.journal.compact(c.journalRecords()); err != nil {
+				logger.Error("Failed compacting journal", "error", err)
+			}
+		}
+	}
 	c.mu.Unlock()
+	c.bytesWritten.Add(totalWritten)
 
 	return totalWritten, nil
 }
 
-func (c *Cache) Set(key string, data []byte) (int64, error) {
-	return c.SetWithReader(key, bytes.NewReader(data))
+func (c *Cache) Set(key string, data []byte, options ...cache.SetOption) (int64, error) {
+	return c.SetWithReader(key, bytes.NewReader(data), options...)
 }
 
 func (c *Cache) Remove(key string) error {
@@ -228,55 +360,117 @@ func (c *Cache) Remove(key string) error {
 }
 
 func (c *Cache) removeFile(key string) error {
-	filePath := filepath.Join(c.options.CacheDir, key)
+	filePath := c.itemPath(key)
 	if _, exists := c.items[key]; exists {
-		if err := os.Remove(filePath); err != nil {
+		// Might already be missing e.g. when journaled right before a crash
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
 			return fmt.Errorf("removing file failed: %w", err)
 		}
-		c.currentSize -= c.items[key].Size
+		if err := os.Remove(sidecarPath(filePath)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing sidecar failed: %w", err)
+		}
+		c.untrack(key, c.items[key])
 		delete(c.items, key)
+
+		if c.journal != nil {
+			if err := c.journal.appendRemove(key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// evict removes the item, counting it as evicted for reason; c.mu has to be held
+func (c *Cache) evict(key string, reason cache.EvictionReason) error {
+	header, exists := c.items[key]
+	if !exists {
+		return ErrItemNotFound
 	}
+
+	header.lock.Lock()
+	err := c.removeFile(key)
+	header.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	c.evictions[reason]++
 	return nil
 }
 
-func (c *Cache) GetWithReader(key string) (io.ReadSeekCloser, *CacheItemHeader, error) {
+func (c *Cache) GetWithReader(key string) (io.ReadSeekCloser, *cache.ItemHeader, error) {
 	c.mu.Lock()
 
 	header, exists := c.items[key]
 	if !exists {
 		c.mu.Unlock()
+		c.misses.Add(1)
 		return nil, nil, ErrItemNotFound
 	}
-	filePath := filepath.Join(c.options.CacheDir, key)
+	if header.Expired(time.Now()) {
+		err := c.evict(key, cache.EvictedExpired)
+		c.mu.Unlock()
+		c.misses.Add(1)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed removing expired item '%s': %w", key, err)
+		}
+		return nil, nil, ErrItemNotFound
+	}
+	filePath := c.itemPath(key)
 
 	header.lock.RLock()
 
 	// Update access-time
 	header.ModTime = time.Now()
 	c.items[key] = header
+	c.accessed(key, header)
 
 	c.mu.Unlock()
 
+	file, err := os.Open(filePath)
+	if err != nil {
+		header.lock.RUnlock()
+		if os.IsNotExist(err) {
+			logger.Warn("Dropping missing item", "key", key)
+			return nil, nil, c.drop(key, header.lock)
+		}
+		return nil, nil, fmt.Errorf("failed opening file for item '%s': %w", key, err)
+	}
+
+	if !header.verified {
+		if err := verify(file, header); err != nil {
+			file.Close()
+			header.lock.RUnlock()
+			logger.Warn("Dropping corrupt item", "key", key, "error", err)
+			return nil, nil, c.drop(key, header.lock)
+		}
+		c.markVerified(key, header.lock)
+	}
+
 	// Update access-time on disk
-	err := os.Chtimes(filePath, header.ModTime, header.ModTime)
+	err = os.Chtimes(filePath, header.ModTime, header.ModTime)
 	if err != nil {
+		file.Close()
 		header.lock.RUnlock()
 		return nil, nil, fmt.Errorf("failed changing access&modification times: %w", err)
 	}
 
-	file, err := os.Open(filePath)
+	reader, err := c.decodingReader(key, file, header)
 	if err != nil {
+		file.Close()
 		header.lock.RUnlock()
-		return nil, nil, fmt.Errorf("failed opening file for item '%s': %w", key, err)
+		logger.Warn("Dropping undecodable item", "key", key, "error", err)
+		return nil, nil, c.drop(key, header.lock)
 	}
 
+	c.hits.Add(1)
 	return &CacheItemReader{
 		lock:             header.lock,
-		underlyingReader: file,
-	}, &header, nil
+		underlyingReader: reader,
+	}, &header.ItemHeader, nil
 }
 
-func (c *Cache) Get(key string) ([]byte, *CacheItemHeader, error) {
+func (c *Cache) Get(key string) ([]byte, *cache.ItemHeader, error) {
 	reader, header, err := c.GetWithReader(key)
 	if err != nil {
 		return nil, nil, err
@@ -287,10 +481,32 @@ func (c *Cache) Get(key string) ([]byte, *CacheItemHeader, error) {
 	return data, header, fmt.Errorf("failed reading all data from item '%s': %w", key, err)
 }
 
-func (c *Cache) Exists(key string) (bool, CacheItemHeader) {
+func (c *Cache) Exists(key string) (bool, cache.ItemHeader) {
 	c.mu.RLock()
 	header, exists := c.items[key]
 	c.mu.RUnlock()
 
-	return exists, header
+	if exists && header.Expired(time.Now()) {
+		return false, cache.ItemHeader{}
+	}
+	return exists, header.ItemHeader
+}
+
+func (c *Cache) RemoveExpired() (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	removed := 0
+	for key, header := range c.items {
+		if !header.Expired(now) {
+			continue
+		}
+
+		if err := c.evict(key, cache.EvictedExpired); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
 }
@@ -3,9 +3,43 @@ package diskcache
 import (
 	"fmt"
 	"io"
+	"os"
 	"sync"
 )
 
+// decodingReader wraps file to decrypt and decompress the item as needed
+func (c *Cache) decodingReader(key string, file *os.File, header CacheItemHeader) (io.ReadSeekCloser, error) {
+	var reader interface {
+		io.ReadSeekCloser
+		readerAtCloser
+	} = file
+	storedSize := header.storedSize
+
+	if header.encrypted {
+		if c.aead == nil {
+			return nil, ErrItemUndecryptable
+		}
+		decrypting, err := newDecryptingReader(file, c.aead, key, storedSize)
+		if err != nil {
+			return nil, err
+		}
+		reader = decrypting
+		storedSize = decrypting.size
+	} else if c.aead != nil {
+		// Written before encryption was enabled, shouldnt stay in plaintext
+		return nil, fmt.Errorf("%w: item isnt encrypted", ErrItemUndecryptable)
+	}
+
+	if header.compression != CompressionNone {
+		itemCodec, err := codecOf(header.compression)
+		if err != nil {
+			return nil, err
+		}
+		return newDecompressingReader(reader, itemCodec, storedSize, header.Size)
+	}
+	return reader, nil
+}
+
 type CacheItemReader struct {
 	lock             *sync.RWMutex
 	underlyingReader io.ReadSeekCloser
@@ -13,10 +47,11 @@ type CacheItemReader struct {
 
 func (r *CacheItemReader) Read(p []byte) (n int, err error) {
 	n, err = r.underlyingReader.Read(p)
-	if err != nil {
+	// EOF has to stay unwrapped for callers comparing it directly e.g. io.ReadAll
+	if err != nil && err != io.EOF {
 		return n, fmt.Errorf("failed reading from underlying reader: %w", err)
 	}
-	return n, nil
+	return n, err
 }
 
 func (r *CacheItemReader) Seek(offset int64, whence int) (int64, error) {
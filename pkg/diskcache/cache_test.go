@@ -0,0 +1,805 @@
+package diskcache_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/diskcache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/automergerresource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/bytesresource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/fullcacheresource"
+)
+
+func readItem(t *testing.T, c cache.Cache, key string) []byte {
+	t.Helper()
+	reader, _, err := c.GetWithReader(key)
+	if err != nil {
+		t.Fatalf("failed getting %s: %v", key, err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed reading %s: %v", key, err)
+	}
+	return data
+}
+
+// countFiles returns the number of regular files below dir, excluding the tmp-dir
+func countFiles(t *testing.T, dir string) (files int, topLevel int) {
+	t.Helper()
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == ".tmp" {
+			return filepath.SkipDir
+		}
+		if entry.Type().IsRegular() {
+			files++
+			if filepath.Dir(path) == dir {
+				topLevel++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files, topLevel
+}
+
+func TestDiskCacheUnsafeKeys(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	c, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []string{
+		"<part1of2.abc$def@news.example>",
+		"../../escape/attempt",
+		strings.Repeat("long", 200),
+	}
+	for _, key := range keys {
+		if _, err := c.SetWithReader(key, bytes.NewReader([]byte(key))); err != nil {
+			t.Fatalf("failed setting %q: %v", key[:20], err)
+		}
+	}
+	for _, key := range keys {
+		if data := readItem(t, c, key); string(data) != key {
+			t.Errorf("content mismatch for %q", key[:20])
+		}
+	}
+
+	// Item and sidecar each, nothing stored flat or outside the cache-dir
+	files, topLevel := countFiles(t, dir)
+	if files != 2*len(keys) || topLevel != 0 {
+		t.Errorf("expected %d files in shard-dirs, got %d with %d top-level", 2*len(keys), files, topLevel)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "escape")); !os.IsNotExist(err) {
+		t.Error("expected key not to escape the cache-dir")
+	}
+
+	if err := c.Remove(keys[0]); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := countFiles(t, dir); files != 2*(len(keys)-1) {
+		t.Errorf("expected item and sidecar to be removed, %d files left", files)
+	}
+}
+
+func TestDiskCacheReload(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	c, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SetWithReader("a/b", bytes.NewReader([]byte("Hello"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SetWithReader("expiring", bytes.NewReader([]byte("Bye")), cache.WithTTL(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	_, header := c.Exists("expiring")
+
+	reloaded, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data := readItem(t, reloaded, "a/b"); string(data) != "Hello" {
+		t.Errorf("expected 'Hello' after reload, got '%s'", data)
+	}
+	exists, reloadedHeader := reloaded.Exists("expiring")
+	if !exists || !reloadedHeader.ExpiresAt.Equal(header.ExpiresAt) {
+		t.Errorf("expected per-item expiry to be kept, got %v instead of %v", reloadedHeader.ExpiresAt, header.ExpiresAt)
+	}
+}
+
+func TestDiskCacheMigratesFlatItems(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for _, key := range []string{"<segment1@news>", "segment2"} {
+		if err := os.WriteFile(filepath.Join(dir, key), []byte(key), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"<segment1@news>", "segment2"} {
+		if data := readItem(t, c, key); string(data) != key {
+			t.Errorf("content mismatch for migrated %s", key)
+		}
+	}
+	if files, topLevel := countFiles(t, dir); files != 4 || topLevel != 0 {
+		t.Errorf("expected migrated items in shard-dirs, got %d files with %d top-level", files, topLevel)
+	}
+}
+
+func TestDiskCacheRemovesItemsWithoutSidecar(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	c, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b"} {
+		if _, err := c.SetWithReader(key, bytes.NewReader([]byte(key))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Simulate a crash, losing the sidecar of a
+	sidecars, err := filepath.Glob(filepath.Join(dir, "*", "*", "*.meta"))
+	if err != nil || len(sidecars) != 2 {
+		t.Fatalf("expected 2 sidecars, got %d: %v", len(sidecars), err)
+	}
+	for _, sidecar := range sidecars {
+		if data, _ := os.ReadFile(sidecar); strings.Contains(string(data), `"a"`) {
+			os.Remove(sidecar)
+		}
+	}
+
+	reloaded, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := reloaded.Exists("a"); exists {
+		t.Error("expected item without sidecar to be dropped")
+	}
+	if data := readItem(t, reloaded, "b"); string(data) != "b" {
+		t.Errorf("expected b to stay, got '%s'", data)
+	}
+	if files, _ := countFiles(t, dir); files != 2 {
+		t.Errorf("expected orphaned item to be removed from disk, %d files left", files)
+	}
+}
+
+// itemFile returns the path of the only item in dir
+func itemFile(t *testing.T, dir string) string {
+	t.Helper()
+	sidecars, err := filepath.Glob(filepath.Join(dir, "*", "*", "*.meta"))
+	if err != nil || len(sidecars) != 1 {
+		t.Fatalf("expected 1 item, got %d: %v", len(sidecars), err)
+	}
+	return strings.TrimSuffix(sidecars[0], ".meta")
+}
+
+func TestDiskCacheDropsCorruptItems(t *testing.T) {
+	t.Parallel()
+
+	for name, corrupt := range map[string]func(path string) error{
+		"Truncated": func(path string) error {
+			return os.Truncate(path, 3)
+		},
+		"Modified": func(path string) error {
+			return os.WriteFile(path, []byte("Hallo World"), 0o644)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			c, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.SetWithReader("a", bytes.NewReader([]byte("Hello World"))); err != nil {
+				t.Fatal(err)
+			}
+			if err := corrupt(itemFile(t, dir)); err != nil {
+				t.Fatal(err)
+			}
+
+			reloaded, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := reloaded.GetWithReader("a"); !errors.Is(err, cache.ErrItemNotFound) {
+				t.Errorf("expected corrupt item to be reported as not found, got %v", err)
+			}
+			if exists, _ := reloaded.Exists("a"); exists {
+				t.Error("expected corrupt item to be dropped")
+			}
+			if files, _ := countFiles(t, dir); files != 0 {
+				t.Errorf("expected corrupt item to be removed from disk, %d files left", files)
+			}
+		})
+	}
+}
+
+func TestDiskCacheJournal(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	options := func() *diskcache.CacheOptions {
+		return &diskcache.CacheOptions{CacheDir: dir, Journal: true}
+	}
+
+	c, err := diskcache.NewCache(options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := c.SetWithReader(key, bytes.NewReader([]byte(key))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Remove("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Sidecars arent read with a journal, losing them doesnt matter
+	sidecars, _ := filepath.Glob(filepath.Join(dir, "*", "*", "*.meta"))
+	for _, sidecar := range sidecars {
+		os.Remove(sidecar)
+	}
+
+	reloaded, err := diskcache.NewCache(options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, expected := range map[string]bool{"a": true, "b": false, "c": true} {
+		if exists, _ := reloaded.Exists(key); exists != expected {
+			t.Errorf("expected %s to exist after replay: %v", key, expected)
+		}
+	}
+	if data := readItem(t, reloaded, "a"); string(data) != "a" {
+		t.Errorf("expected 'a', got '%s'", data)
+	}
+
+	// Journaled item missing on disk e.g. after a crash
+	if err := os.Remove(itemFileOf(t, dir, "c")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := reloaded.GetWithReader("c"); !errors.Is(err, cache.ErrItemNotFound) {
+		t.Errorf("expected missing item to be reported as not found, got %v", err)
+	}
+
+	// Disabling the journal removes it, as it would be outdated when enabled again
+	if _, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: dir}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, diskcache.JournalFileName)); !os.IsNotExist(err) {
+		t.Errorf("expected journal to be removed when disabled, got %v", err)
+	}
+}
+
+func TestDiskCacheJournalCompaction(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	c, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: dir, Journal: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2000 {
+		if _, err := c.SetWithReader("a", bytes.NewReader([]byte("a"))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, diskcache.JournalFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines > 1100 {
+		t.Errorf("expected journal to be compacted, has %d records", lines)
+	}
+}
+
+// itemFileOf returns the path an item with key is stored at, found by its sidecar or journal-content
+func itemFileOf(t *testing.T, dir, key string) string {
+	t.Helper()
+	items, err := filepath.Glob(filepath.Join(dir, "*", "*", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range items {
+		if strings.HasSuffix(item, ".meta") {
+			continue
+		}
+		if data, _ := os.ReadFile(item); string(data) == key {
+			return item
+		}
+	}
+	t.Fatalf("item %s not found", key)
+	return ""
+}
+
+func TestDiskCachePinnedItemsArentEvicted(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	c, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: dir, MaxSize: 30, MaxSizeEvictBlocking: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.SetWithReader("pinned", bytes.NewReader(make([]byte, 10)), cache.WithOwner("nzb"), cache.WithPinned(true)); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b", "c", "d"} {
+		if _, err := c.SetWithReader(key, bytes.NewReader(make([]byte, 10)), cache.WithOwner("nzb")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, func() bool {
+		exists, _ := c.Exists("b")
+		return !exists
+	})
+	if exists, _ := c.Exists("pinned"); !exists {
+		t.Error("expected pinned item to survive eviction")
+	}
+
+	// Unpinning persists and allows evicting it
+	if err := c.UnpinOwner("nzb"); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: dir, MaxSize: 30, MaxSizeEvictBlocking: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloaded.SetWithReader("e", bytes.NewReader(make([]byte, 10))); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		exists, _ := reloaded.Exists("pinned")
+		return !exists
+	})
+}
+
+func TestDiskCacheMaxSizeCountsStoredSize(t *testing.T) {
+	t.Parallel()
+
+	c, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: t.TempDir(), MaxSize: 100_000, Compression: diskcache.CompressionZstd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Set("a", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Larger than MaxSize, but not when compressed
+	if _, err := c.Set("b", bytes.Repeat([]byte("compressible content "), 20000)); err != nil {
+		t.Fatal(err)
+	}
+	// Eviction runs in background
+	time.Sleep(50 * time.Millisecond)
+
+	for _, key := range []string{"a", "b"} {
+		if exists, _ := c.Exists(key); !exists {
+			t.Errorf("expected %s to fit into the cache", key)
+		}
+	}
+	if evicted := c.Stats().Evictions[cache.EvictedMaxSize]; evicted != 0 {
+		t.Errorf("expected no evictions, got %d", evicted)
+	}
+}
+
+func TestDiskCachePinnedMaxSize(t *testing.T) {
+	t.Parallel()
+
+	c, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: t.TempDir(), MaxSize: 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Half of MaxSize can be pinned by default
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := c.SetWithReader(key, bytes.NewReader(make([]byte, 10)), cache.WithPinned(true)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, key := range []string{"d", "e", "f"} {
+		if _, err := c.SetWithReader(key, bytes.NewReader(make([]byte, 10))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, func() bool {
+		exists, _ := c.Exists("c")
+		return !exists
+	})
+	for _, key := range []string{"a", "b"} {
+		if exists, _ := c.Exists(key); !exists {
+			t.Errorf("expected pinned %s to stay", key)
+		}
+	}
+}
+
+func TestDiskCacheOwnerQuota(t *testing.T) {
+	t.Parallel()
+
+	c, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: t.TempDir(), OwnerQuota: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.SetWithReader("other", bytes.NewReader(make([]byte, 10)), cache.WithOwner("small")); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := c.SetWithReader(key, bytes.NewReader(make([]byte, 10)), cache.WithOwner("binge")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for key, expected := range map[string]bool{"other": true, "a": false, "b": true, "c": true} {
+		if exists, _ := c.Exists(key); exists != expected {
+			t.Errorf("expected %s to exist: %v", key, expected)
+		}
+	}
+}
+
+// waitFor polls condition, as eviction might run in background
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDiskCacheLowDiskSpace(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	c, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Set("a", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	// No disk has that much free space, so everything is evicted and nothing accepted
+	full, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: dir, MinFreeSpace: math.MaxInt64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := full.Exists("a"); exists {
+		t.Error("expected item to be evicted for free space")
+	}
+
+	reader := bytes.NewReader([]byte("world"))
+	n, err := full.SetWithReader("b", reader)
+	if !errors.Is(err, cache.ErrInsufficientSpace) {
+		t.Fatalf("expected ErrInsufficientSpace, got %v", err)
+	}
+	if n != 0 || reader.Len() != 5 {
+		t.Error("expected reader to be untouched, so content can be passed through")
+	}
+}
+
+func TestDiskCacheCompression(t *testing.T) {
+	t.Parallel()
+
+	compressible := bytes.Repeat([]byte("compressible content "), 20000)
+	random := make([]byte, 200000)
+	rand.NewChaCha8([32]byte{}).Read(random)
+
+	for _, compression := range []string{diskcache.CompressionZstd, diskcache.CompressionLz4} {
+		t.Run(compression, func(t *testing.T) {
+			t.Parallel()
+
+			for name, tc := range map[string]struct {
+				content    []byte
+				compressed bool
+			}{
+				"compressible":   {compressible, true},
+				"incompressible": {random, false},
+				"empty":          {nil, false},
+			} {
+				t.Run(name, func(t *testing.T) {
+					t.Parallel()
+
+					dir := t.TempDir()
+					options := &diskcache.CacheOptions{CacheDir: dir, Compression: compression, Journal: true}
+					c, err := diskcache.NewCache(options)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if _, err := c.Set("item", tc.content); err != nil {
+						t.Fatal(err)
+					}
+
+					info, err := os.Stat(itemFile(t, dir))
+					if err != nil {
+						t.Fatal(err)
+					}
+					if compressed := info.Size() < int64(len(tc.content)); compressed != tc.compressed {
+						t.Errorf("expected compressed %v, stored %d of %d bytes", tc.compressed, info.Size(), len(tc.content))
+					}
+
+					// Also after reload, which has to verify the stored checksum
+					reloaded, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: dir, Journal: true})
+					if err != nil {
+						t.Fatal(err)
+					}
+					for _, c := range []*diskcache.Cache{c, reloaded} {
+						if _, header := c.Exists("item"); header.Size != int64(len(tc.content)) {
+							t.Errorf("expected size %d, got %d", len(tc.content), header.Size)
+						}
+						if data := readItem(t, c, "item"); !bytes.Equal(data, tc.content) {
+							t.Error("content doesnt match")
+						}
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestDiskCacheCompressionSeek(t *testing.T) {
+	t.Parallel()
+
+	content := make([]byte, 3*diskcache.CompressionBlockSize+123)
+	for i := range content {
+		content[i] = byte(i / 100)
+	}
+
+	c, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: t.TempDir(), Compression: diskcache.CompressionZstd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Set("item", content); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, _, err := c.GetWithReader("item")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	for _, offset := range []int64{int64(len(content)) - 10, 5, diskcache.CompressionBlockSize - 3, 2*diskcache.CompressionBlockSize + 7} {
+		if _, err := reader.Seek(offset, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		// Crossing block-boundaries
+		buf := make([]byte, 10)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, content[offset:offset+10]) {
+			t.Errorf("content at %d doesnt match", offset)
+		}
+	}
+	if _, err := reader.Seek(0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected EOF at end, got %v", err)
+	}
+}
+
+// segmentResource is a segment fetched as a stream, like articles are
+type segmentResource struct {
+	bytesresource.BytesResource
+}
+
+func (r *segmentResource) Open() (io.ReadCloser, error) {
+	return r.BytesResource.Open()
+}
+
+func TestDiskCacheCompressionThroughMerger(t *testing.T) {
+	t.Parallel()
+
+	c, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: t.TempDir(), Compression: diskcache.CompressionZstd})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var content []byte
+	segments := make([]resource.ReadSeekCloseableResource, 3)
+	for i := range segments {
+		segment := bytes.Repeat([]byte(fmt.Sprintf("Segment %d ", i)), 30_000)
+		content = append(content, segment...)
+		segments[i] = fullcacheresource.NewFullCacheResource(&segmentResource{BytesResource: bytesresource.BytesResource{Content: segment}}, fmt.Sprintf("segment-%d", i), c, &fullcacheresource.FullCacheResourceOptions{})
+	}
+
+	// Read twice, first filling the cache, then from the compressed items
+	merger := automergerresource.NewAutoMergerResource(segments)
+	for range 2 {
+		reader, err := merger.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		read := make([]byte, len(content))
+		_, err = io.ReadFull(reader, read)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("failed reading merged segments: %v", err)
+		}
+		if !bytes.Equal(read, content) {
+			t.Fatalf("merged content doesnt match")
+		}
+	}
+}
+
+func TestDiskCacheUnknownCompression(t *testing.T) {
+	t.Parallel()
+
+	_, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: t.TempDir(), Compression: "gzip"})
+	if !errors.Is(err, diskcache.ErrUnknownCompression) {
+		t.Errorf("expected ErrUnknownCompression, got %v", err)
+	}
+}
+
+func TestDiskCacheEncryption(t *testing.T) {
+	t.Parallel()
+
+	content := bytes.Repeat([]byte("secret usenet content "), 10000)
+
+	for _, compression := range []string{diskcache.CompressionNone, diskcache.CompressionZstd} {
+		t.Run("compression="+compression, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			c, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: dir, EncryptionSecret: "correct secret", Compression: compression})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, data := range map[string][]byte{"item": content, "empty": nil} {
+				if _, err := c.Set(key, data); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			hash := fmt.Sprintf("%x", sha256.Sum256([]byte("item")))
+			stored, err := os.ReadFile(filepath.Join(dir, hash[:2], hash[2:4], hash))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(stored, []byte("secret usenet")) {
+				t.Error("expected content to be unreadable on disk")
+			}
+
+			reader, _, err := c.GetWithReader("item")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Random-access across blocks
+			offset := int64(diskcache.EncryptionBlockSize - 5)
+			if _, err := reader.Seek(offset, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, 10)
+			if _, err := io.ReadFull(reader, buf); err != nil {
+				t.Fatal(err)
+			}
+			reader.Close()
+			if !bytes.Equal(buf, content[offset:offset+10]) {
+				t.Error("content after seek doesnt match")
+			}
+
+			reloaded, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: dir, EncryptionSecret: "correct secret"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data := readItem(t, reloaded, "item"); !bytes.Equal(data, content) {
+				t.Error("content doesnt match after reload")
+			}
+			if data := readItem(t, reloaded, "empty"); len(data) != 0 {
+				t.Error("expected empty item")
+			}
+
+			// Without the right secret, items cant be read and are dropped
+			for _, secret := range []string{"wrong secret", ""} {
+				wrong, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: dir, EncryptionSecret: secret})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, _, err := wrong.GetWithReader("item"); !errors.Is(err, cache.ErrItemNotFound) {
+					t.Errorf("expected item to be unreadable with secret '%s', got %v", secret, err)
+				}
+				if _, err := wrong.Set("item", content); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestDiskCacheEncryptionDropsPlaintextItems(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	c, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Set("item", []byte("plaintext")); err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: dir, EncryptionSecret: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := encrypted.GetWithReader("item"); !errors.Is(err, cache.ErrItemNotFound) {
+		t.Errorf("expected plaintext item to be dropped, got %v", err)
+	}
+}
+
+func TestDiskCacheStats(t *testing.T) {
+	t.Parallel()
+
+	c, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: t.TempDir(), OwnerQuota: 20, TTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := c.SetWithReader(key, bytes.NewReader(make([]byte, 10)), cache.WithOwner("binge")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.SetWithReader("short", bytes.NewReader(make([]byte, 5)), cache.WithOwner("other"), cache.WithTTL(time.Nanosecond)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+
+	readItem(t, c, "b")
+	readItem(t, c, "c")
+	for _, key := range []string{"a", "short", "missing"} {
+		if _, _, err := c.GetWithReader(key); !errors.Is(err, cache.ErrItemNotFound) {
+			t.Errorf("expected %s not to be found, got %v", key, err)
+		}
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 2 || stats.Misses != 3 || stats.BytesWritten != 35 {
+		t.Errorf("expected 2 hits, 3 misses and 35 bytes written, got %+v", stats)
+	}
+	if stats.Evictions[cache.EvictedQuota] != 1 || stats.Evictions[cache.EvictedExpired] != 1 {
+		t.Errorf("expected one eviction for quota and one expired, got %v", stats.Evictions)
+	}
+	if stats.Items != 2 || stats.Size != 20 || len(stats.OwnerSizes) != 1 || stats.OwnerSizes["binge"] != 20 {
+		t.Errorf("expected 2 items of 20 bytes of owner binge, got %+v", stats)
+	}
+}
@@ -0,0 +1,330 @@
+package diskcache
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// Compressed items are split into blocks of CompressionBlockSize, compressed independently to allow seeking
+// File layout: blocks, stored length of each block as uint32, block count as uint32, block size as uint32
+// A block with the stored length of its content isnt compressed, as it didnt shrink
+const (
+	CompressionNone = ""
+	CompressionZstd = "zstd"
+	CompressionLz4  = "lz4"
+
+	CompressionBlockSize = 64 * 1024
+	// The first block has to shrink at least to this ratio, otherwise the item is stored uncompressed
+	compressionMaxRatio = 0.9
+
+	compressionTrailerSize = 8
+)
+
+var ErrUnknownCompression = errors.New("unknown compression")
+
+type codec interface {
+	// compress appends the compressed src to dst
+	compress(dst, src []byte) ([]byte, error)
+	// decompress writes the decompressed src to dst, which has the size of the content
+	decompress(dst, src []byte) error
+}
+
+var codecs = sync.OnceValues(func() (map[string]codec, error) {
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, fmt.Errorf("failed creating zstd-encoder: %w", err)
+	}
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+	if err != nil {
+		return nil, fmt.Errorf("failed creating zstd-decoder: %w", err)
+	}
+
+	return map[string]codec{
+		CompressionZstd: zstdCodec{encoder: encoder, decoder: decoder},
+		CompressionLz4:  lz4Codec{},
+	}, nil
+})
+
+func codecOf(compression string) (codec, error) {
+	all, err := codecs()
+	if err != nil {
+		return nil, err
+	}
+	codec, exists := all[compression]
+	if !exists {
+		return nil, fmt.Errorf("%w '%s', expected one of {zstd, lz4}", ErrUnknownCompression, compression)
+	}
+	return codec, nil
+}
+
+type zstdCodec struct {
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+func (c zstdCodec) compress(dst, src []byte) ([]byte, error) {
+	return c.encoder.EncodeAll(src, dst), nil
+}
+
+func (c zstdCodec) decompress(dst, src []byte) error {
+	out, err := c.decoder.DecodeAll(src, dst[:0])
+	if err != nil {
+		return err
+	}
+	if len(out) != len(dst) {
+		return fmt.Errorf("%w: block decompressed to %d instead of %d bytes", ErrItemCorrupt, len(out), len(dst))
+	}
+	return nil
+}
+
+type lz4Codec struct{}
+
+func (lz4Codec) compress(dst, src []byte) ([]byte, error) {
+	start := len(dst)
+	dst = append(dst, make([]byte, lz4.CompressBlockBound(len(src)))...)
+	n, err := lz4.CompressBlock(src, dst[start:], nil)
+	if err != nil {
+		return nil, err
+	}
+	// Incompressible, stored as is
+	if n == 0 {
+		return append(dst[:start], src...), nil
+	}
+	return dst[:start+n], nil
+}
+
+func (lz4Codec) decompress(dst, src []byte) error {
+	n, err := lz4.UncompressBlock(src, dst)
+	if err != nil {
+		return err
+	}
+	if n != len(dst) {
+		return fmt.Errorf("%w: block decompressed to %d instead of %d bytes", ErrItemCorrupt, n, len(dst))
+	}
+	return nil
+}
+
+// compressingWriter decides on the first block if the content is worth compressing and writes it block-wise
+type compressingWriter struct {
+	out   io.Writer
+	codec codec
+	// Content of the current block
+	block      []byte
+	compressed []byte
+	// Stored length of each block, nil when not compressing
+	blockLengths []uint32
+	decided      bool
+}
+
+func newCompressingWriter(out io.Writer, codec codec) *compressingWriter {
+	return &compressingWriter{
+		out:   out,
+		codec: codec,
+		block: make([]byte, 0, CompressionBlockSize),
+	}
+}
+
+func (w *compressingWriter) Write(p []byte) (int, error) {
+	// Decided against compressing, pass through
+	if w.decided && w.blockLengths == nil {
+		return w.out.Write(p)
+	}
+
+	written := 0
+	for len(p) > 0 {
+		n := copy(w.block[len(w.block):cap(w.block)], p)
+		w.block = w.block[:len(w.block)+n]
+		p = p[n:]
+		written += n
+
+		if len(w.block) == cap(w.block) {
+			if err := w.flushBlock(); err != nil {
+				return written, err
+			}
+			if w.blockLengths == nil {
+				_, err := w.out.Write(p)
+				return written + len(p), err
+			}
+		}
+	}
+	return written, nil
+}
+
+// flushBlock compresses and writes the current block, on the first block it decides whether to compress at all
+func (w *compressingWriter) flushBlock() error {
+	var err error
+	w.compressed, err = w.codec.compress(w.compressed[:0], w.block)
+	if err != nil {
+		return fmt.Errorf("failed compressing block: %w", err)
+	}
+
+	if !w.decided {
+		w.decided = true
+		if float64(len(w.compressed)) > float64(len(w.block))*compressionMaxRatio {
+			_, err := w.out.Write(w.block)
+			w.block = w.block[:0]
+			return err
+		}
+		w.blockLengths = make([]uint32, 0)
+	}
+
+	stored := w.compressed
+	if len(stored) >= len(w.block) {
+		stored = w.block
+	}
+	if _, err := w.out.Write(stored); err != nil {
+		return err
+	}
+	w.blockLengths = append(w.blockLengths, uint32(len(stored)))
+	w.block = w.block[:0]
+	return nil
+}
+
+// Close writes the remaining block and the trailer; returns if the content was compressed
+func (w *compressingWriter) Close() (bool, error) {
+	if len(w.block) > 0 {
+		if err := w.flushBlock(); err != nil {
+			return false, err
+		}
+	}
+	if w.blockLengths == nil {
+		return false, nil
+	}
+
+	trailer := make([]byte, 0, len(w.blockLengths)*4+compressionTrailerSize)
+	for _, length := range w.blockLengths {
+		trailer = binary.LittleEndian.AppendUint32(trailer, length)
+	}
+	trailer = binary.LittleEndian.AppendUint32(trailer, uint32(len(w.blockLengths)))
+	trailer = binary.LittleEndian.AppendUint32(trailer, CompressionBlockSize)
+	if _, err := w.out.Write(trailer); err != nil {
+		return false, fmt.Errorf("failed writing trailer: %w", err)
+	}
+	return true, nil
+}
+
+// decompressingReader reads a block-wise compressed item, decompressing only the blocks read
+type decompressingReader struct {
+	file      readerAtCloser
+	codec     codec
+	blockSize int64
+	// Start of each block in the file, with the end of the last block appended
+	offsets []int64
+	size    int64
+	index   int64
+
+	block      []byte
+	blockIndex int64
+	compressed []byte
+}
+
+func newDecompressingReader(file readerAtCloser, codec codec, storedSize, size int64) (*decompressingReader, error) {
+	if storedSize < compressionTrailerSize {
+		return nil, fmt.Errorf("%w: too small for trailer", ErrItemCorrupt)
+	}
+	trailer := make([]byte, compressionTrailerSize)
+	if _, err := file.ReadAt(trailer, storedSize-compressionTrailerSize); err != nil {
+		return nil, fmt.Errorf("failed reading trailer: %w", err)
+	}
+	blockCount := int64(binary.LittleEndian.Uint32(trailer))
+	blockSize := int64(binary.LittleEndian.Uint32(trailer[4:]))
+
+	indexSize := blockCount * 4
+	if blockSize == 0 || storedSize < compressionTrailerSize+indexSize || (size+blockSize-1)/blockSize != blockCount {
+		return nil, fmt.Errorf("%w: invalid trailer", ErrItemCorrupt)
+	}
+	index := make([]byte, indexSize)
+	if _, err := file.ReadAt(index, storedSize-compressionTrailerSize-indexSize); err != nil {
+		return nil, fmt.Errorf("failed reading block-index: %w", err)
+	}
+
+	offsets := make([]int64, blockCount+1)
+	for i := range blockCount {
+		offsets[i+1] = offsets[i] + int64(binary.LittleEndian.Uint32(index[i*4:]))
+	}
+	if offsets[blockCount] != storedSize-compressionTrailerSize-indexSize {
+		return nil, fmt.Errorf("%w: block-index doesnt match size", ErrItemCorrupt)
+	}
+
+	return &decompressingReader{
+		file:       file,
+		codec:      codec,
+		blockSize:  blockSize,
+		offsets:    offsets,
+		size:       size,
+		blockIndex: -1,
+	}, nil
+}
+
+func (r *decompressingReader) Read(p []byte) (int, error) {
+	if r.index >= r.size {
+		return 0, io.EOF
+	}
+
+	// Filling p across blocks, so exact-size reads dont come back short at each block-boundary
+	n := 0
+	for n < len(p) && r.index < r.size {
+		blockIndex := r.index / r.blockSize
+		if blockIndex != r.blockIndex {
+			if err := r.loadBlock(blockIndex); err != nil {
+				return n, err
+			}
+		}
+
+		copied := copy(p[n:], r.block[r.index-blockIndex*r.blockSize:])
+		n += copied
+		r.index += int64(copied)
+	}
+	return n, nil
+}
+
+func (r *decompressingReader) loadBlock(blockIndex int64) error {
+	contentSize := min(r.blockSize, r.size-blockIndex*r.blockSize)
+	storedSize := r.offsets[blockIndex+1] - r.offsets[blockIndex]
+
+	r.compressed = append(r.compressed[:0], make([]byte, storedSize)...)
+	if _, err := r.file.ReadAt(r.compressed, r.offsets[blockIndex]); err != nil {
+		return fmt.Errorf("failed reading block %d: %w", blockIndex, err)
+	}
+
+	r.block = append(r.block[:0], make([]byte, contentSize)...)
+	// Didnt shrink, stored as is
+	if storedSize == contentSize {
+		copy(r.block, r.compressed)
+	} else if err := r.codec.decompress(r.block, r.compressed); err != nil {
+		r.blockIndex = -1
+		return fmt.Errorf("failed decompressing block %d: %w", blockIndex, err)
+	}
+	r.blockIndex = blockIndex
+	return nil
+}
+
+func (r *decompressingReader) Seek(offset int64, whence int) (int64, error) {
+	var newIndex int64
+	switch whence {
+	case io.SeekStart:
+		newIndex = offset
+	case io.SeekCurrent:
+		newIndex = r.index + offset
+	case io.SeekEnd:
+		newIndex = r.size + offset
+	default:
+		return 0, resource.ErrInvalidSeek
+	}
+	if newIndex < 0 {
+		return 0, resource.ErrInvalidSeek
+	}
+	r.index = newIndex
+	return r.index, nil
+}
+
+func (r *decompressingReader) Close() error {
+	return r.file.Close()
+}
@@ -0,0 +1,61 @@
+package diskcache
+
+import (
+	"fmt"
+	"syscall"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache"
+)
+
+var ErrLowDiskSpace = fmt.Errorf("low disk space: %w", cache.ErrInsufficientSpace)
+
+// freeSpace returns the bytes available to unprivileged users on the filesystem of path
+func freeSpace(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, fmt.Errorf("failed getting filesystem stats for '%s': %w", path, err)
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
+
+// refreshFreeSpace takes the free space from the filesystem, which isnt asked while holding c.mu
+func (c *Cache) refreshFreeSpace() error {
+	free, err := freeSpace(c.options.CacheDir)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.freeSpace = free
+	c.mu.Unlock()
+	return nil
+}
+
+// freeSpaceEvict evicts items until requiredSpace can be written without going below MinFreeSpace, and reserves it; c.mu has to be held
+// The free space is the one of the last refresh, minus what was reserved and plus what was evicted since
+func (c *Cache) freeSpaceEvict(requiredSpace int64) error {
+	deficit := c.options.MinFreeSpace + requiredSpace - c.freeSpace
+	for deficit > 0 {
+		key := c.options.EvictionPolicy.Victim()
+		if key == "" {
+			if !c.lowDiskSpace {
+				logger.Warn("Low disk space and nothing left to evict, passing items through uncached", "free", c.freeSpace, "minFree", c.options.MinFreeSpace)
+				c.lowDiskSpace = true
+			}
+			return ErrLowDiskSpace
+		}
+
+		storedSize := c.items[key].storedSize
+		if err := c.evict(key, cache.EvictedFreeSpace); err != nil {
+			return err
+		}
+		c.freeSpace += storedSize
+		deficit -= storedSize
+	}
+
+	if c.lowDiskSpace {
+		logger.Info("Free disk space recovered, caching again", "free", c.freeSpace)
+		c.lowDiskSpace = false
+	}
+	c.freeSpace -= requiredSpace
+	return nil
+}
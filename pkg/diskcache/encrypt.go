@@ -0,0 +1,286 @@
+package diskcache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
+)
+
+// Encrypted items are split into blocks of EncryptionBlockSize, each sealed with AES-GCM to allow seeking
+// File layout: random nonce-prefix, sealed blocks; the last block is always present, even when empty
+// Nonces are the prefix followed by the block-index, the additional data binds blocks to the key and marks the last one
+// so blocks cant be swapped between items, reordered or cut off
+const (
+	EncryptionBlockSize = 64 * 1024
+
+	encryptionPrefixSize = 8
+	encryptionKeyLabel   = "nzbStreamer diskcache item encryption"
+)
+
+var (
+	ErrItemUndecryptable = errors.New("item cant be decrypted, secret missing or changed")
+	errEncryptionTooLong = errors.New("item has too many blocks for encryption")
+)
+
+// newItemAead derives the key from secret, which should be long and random as it isnt stretched
+func newItemAead(secret string) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(encryptionKeyLabel))
+
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, fmt.Errorf("failed creating cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating gcm: %w", err)
+	}
+	return aead, nil
+}
+
+// blockCipher seals and opens the blocks of one item
+type blockCipher struct {
+	aead  cipher.AEAD
+	nonce []byte
+	// Key of the item, followed by the last-block flag
+	additionalData []byte
+}
+
+func newBlockCipher(aead cipher.AEAD, key string, prefix []byte) *blockCipher {
+	nonce := make([]byte, aead.NonceSize())
+	copy(nonce, prefix)
+	return &blockCipher{
+		aead:           aead,
+		nonce:          nonce,
+		additionalData: append([]byte(key), 0),
+	}
+}
+
+func (c *blockCipher) prepare(blockIndex int64, last bool) error {
+	if blockIndex > 1<<32-1 {
+		return errEncryptionTooLong
+	}
+	binary.BigEndian.PutUint32(c.nonce[encryptionPrefixSize:], uint32(blockIndex))
+	c.additionalData[len(c.additionalData)-1] = 0
+	if last {
+		c.additionalData[len(c.additionalData)-1] = 1
+	}
+	return nil
+}
+
+func (c *blockCipher) seal(dst, block []byte, blockIndex int64, last bool) ([]byte, error) {
+	if err := c.prepare(blockIndex, last); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(dst, c.nonce, block, c.additionalData), nil
+}
+
+func (c *blockCipher) open(dst, sealed []byte, blockIndex int64, last bool) ([]byte, error) {
+	if err := c.prepare(blockIndex, last); err != nil {
+		return nil, err
+	}
+	block, err := c.aead.Open(dst, c.nonce, sealed, c.additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: block %d: %w", ErrItemUndecryptable, blockIndex, err)
+	}
+	return block, nil
+}
+
+// encryptingWriter seals the written content block-wise
+type encryptingWriter struct {
+	out        io.Writer
+	cipher     *blockCipher
+	block      []byte
+	sealed     []byte
+	blockIndex int64
+}
+
+// newEncryptingWriter writes a new random nonce-prefix to out
+func newEncryptingWriter(out io.Writer, aead cipher.AEAD, key string) (*encryptingWriter, error) {
+	prefix := make([]byte, encryptionPrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, fmt.Errorf("failed generating nonce-prefix: %w", err)
+	}
+	if _, err := out.Write(prefix); err != nil {
+		return nil, fmt.Errorf("failed writing nonce-prefix: %w", err)
+	}
+
+	return &encryptingWriter{
+		out:    out,
+		cipher: newBlockCipher(aead, key, prefix),
+		block:  make([]byte, 0, EncryptionBlockSize),
+	}, nil
+}
+
+func (w *encryptingWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// Full blocks are only sealed when more follows, as the last block is sealed differently
+		if len(w.block) == cap(w.block) {
+			if err := w.flushBlock(false); err != nil {
+				return written, err
+			}
+		}
+
+		n := copy(w.block[len(w.block):cap(w.block)], p)
+		w.block = w.block[:len(w.block)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (w *encryptingWriter) flushBlock(last bool) error {
+	var err error
+	w.sealed, err = w.cipher.seal(w.sealed[:0], w.block, w.blockIndex, last)
+	if err != nil {
+		return err
+	}
+	if _, err := w.out.Write(w.sealed); err != nil {
+		return err
+	}
+	w.block = w.block[:0]
+	w.blockIndex++
+	return nil
+}
+
+// Close seals the last block
+func (w *encryptingWriter) Close() error {
+	return w.flushBlock(true)
+}
+
+// decryptingReader reads an encrypted item, opening only the blocks read
+type decryptingReader struct {
+	file   readerAtCloser
+	cipher *blockCipher
+	// Count of sealed blocks and size of the decrypted content
+	blockCount int64
+	size       int64
+	index      int64
+
+	block      []byte
+	blockIndex int64
+	sealed     []byte
+}
+
+type readerAtCloser interface {
+	io.ReaderAt
+	io.Closer
+}
+
+func newDecryptingReader(file readerAtCloser, aead cipher.AEAD, key string, storedSize int64) (*decryptingReader, error) {
+	sealedBlockSize := int64(EncryptionBlockSize + aead.Overhead())
+	sealedSize := storedSize - encryptionPrefixSize
+	blockCount := (sealedSize + sealedBlockSize - 1) / sealedBlockSize
+	// Each block, including an empty last one, has at least the overhead
+	if sealedSize < int64(aead.Overhead()) || sealedSize-(blockCount-1)*sealedBlockSize < int64(aead.Overhead()) {
+		return nil, fmt.Errorf("%w: invalid size for encrypted item", ErrItemCorrupt)
+	}
+
+	prefix := make([]byte, encryptionPrefixSize)
+	if _, err := file.ReadAt(prefix, 0); err != nil {
+		return nil, fmt.Errorf("failed reading nonce-prefix: %w", err)
+	}
+
+	r := &decryptingReader{
+		file:       file,
+		cipher:     newBlockCipher(aead, key, prefix),
+		blockCount: blockCount,
+		size:       sealedSize - blockCount*int64(aead.Overhead()),
+		blockIndex: -1,
+	}
+	// Noticing a wrong secret on open, so the item is dropped instead of failing the read
+	if err := r.loadBlock(0); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *decryptingReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, resource.ErrInvalidSeek
+	}
+
+	n := 0
+	for n < len(p) {
+		if off >= r.size {
+			return n, io.EOF
+		}
+
+		blockIndex := off / EncryptionBlockSize
+		if blockIndex != r.blockIndex {
+			if err := r.loadBlock(blockIndex); err != nil {
+				return n, err
+			}
+		}
+
+		copied := copy(p[n:], r.block[off-blockIndex*EncryptionBlockSize:])
+		n += copied
+		off += int64(copied)
+	}
+	return n, nil
+}
+
+func (r *decryptingReader) loadBlock(blockIndex int64) error {
+	sealedBlockSize := int64(EncryptionBlockSize + r.cipher.aead.Overhead())
+	start := encryptionPrefixSize + blockIndex*sealedBlockSize
+	sealedSize := min(sealedBlockSize, r.size+r.blockCount*int64(r.cipher.aead.Overhead())-blockIndex*sealedBlockSize)
+
+	r.sealed = append(r.sealed[:0], make([]byte, sealedSize)...)
+	if _, err := r.file.ReadAt(r.sealed, start); err != nil {
+		return fmt.Errorf("failed reading block %d: %w", blockIndex, err)
+	}
+
+	r.blockIndex = -1
+	var err error
+	r.block, err = r.cipher.open(r.block[:0], r.sealed, blockIndex, blockIndex == r.blockCount-1)
+	if err != nil {
+		return err
+	}
+	r.blockIndex = blockIndex
+	return nil
+}
+
+func (r *decryptingReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n, err := r.ReadAt(p, r.index)
+	r.index += int64(n)
+	// Partial reads are fine, EOF is reported on the next read
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *decryptingReader) Seek(offset int64, whence int) (int64, error) {
+	var newIndex int64
+	switch whence {
+	case io.SeekStart:
+		newIndex = offset
+	case io.SeekCurrent:
+		newIndex = r.index + offset
+	case io.SeekEnd:
+		newIndex = r.size + offset
+	default:
+		return 0, resource.ErrInvalidSeek
+	}
+	if newIndex < 0 {
+		return 0, resource.ErrInvalidSeek
+	}
+	r.index = newIndex
+	return r.index, nil
+}
+
+func (r *decryptingReader) Close() error {
+	return r.file.Close()
+}
@@ -0,0 +1,189 @@
+package diskcache
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// The journal is an append-only index of all items, so startup doesnt have to stat every item and read its sidecar
+// Accesses arent journaled, after a restart items are ordered by the time they were set
+const (
+	JournalFileName = "index.journal"
+
+	journalOpSet    = "set"
+	journalOpRemove = "remove"
+
+	// Compacted when holding more records than factor*items, but not below min
+	journalCompactFactor = 2
+	journalCompactMin    = 1024
+)
+
+type journalRecord struct {
+	Op string `json:"op"`
+	itemSidecar
+	ModTime time.Time `json:"modTime,omitempty"`
+}
+
+type journal struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	records int
+	// Sets written to the journal but not yet added to the items, which compaction must keep
+	pending map[string]journalRecord
+}
+
+// replayJournal reads the items from the journal at path; false when there is none
+func replayJournal(path string) (map[string]journalRecord, bool, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed opening journal: %w", err)
+	}
+	defer file.Close()
+
+	items := make(map[string]journalRecord)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record journalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// Partially written record from a crash, everything before is still valid
+			logger.Warn("Ignoring corrupt journal record", "error", err)
+			continue
+		}
+
+		switch record.Op {
+		case journalOpSet:
+			items[record.Key] = record
+		case journalOpRemove:
+			delete(items, record.Key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, false, fmt.Errorf("failed reading journal: %w", err)
+	}
+	return items, true, nil
+}
+
+// writeJournal writes a compacted journal containing records and opens it for appending
+func writeJournal(path string, records []journalRecord) (*journal, error) {
+	j := &journal{
+		path:    path,
+		pending: make(map[string]journalRecord),
+	}
+	if err := j.rewrite(records); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// rewrite replaces the journal with records and pending sets; j.mu has to be held when already in use
+func (j *journal) rewrite(records []journalRecord) error {
+	for _, record := range j.pending {
+		records = append(records, record)
+	}
+
+	tmpPath := j.path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, FileMode)
+	if err != nil {
+		return fmt.Errorf("failed creating journal: %w", err)
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			file.Close()
+			return fmt.Errorf("failed writing journal: %w", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed writing journal: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed syncing journal: %w", err)
+	}
+	file.Close()
+
+	if err := os.Rename(tmpPath, j.path); err != nil {
+		return fmt.Errorf("failed replacing journal: %w", err)
+	}
+
+	if j.file != nil {
+		j.file.Close()
+	}
+	j.file, err = os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, FileMode)
+	if err != nil {
+		return fmt.Errorf("failed opening journal for appending: %w", err)
+	}
+	j.records = len(records)
+	return nil
+}
+
+// append writes a single record, lines are small enough to be written in one go
+func (j *journal) append(record journalRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed marshalling journal record: %w", err)
+	}
+
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed appending to journal: %w", err)
+	}
+	j.records++
+	return nil
+}
+
+// appendSet journals an item before its file is moved in place, so a crash leaves a missing item instead of an unknown file
+func (j *journal) appendSet(record journalRecord) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	record.Op = journalOpSet
+	if err := j.append(record); err != nil {
+		return err
+	}
+	j.pending[record.Key] = record
+	return nil
+}
+
+// commit marks a set as added to the items
+func (j *journal) commit(key string) {
+	j.mu.Lock()
+	delete(j.pending, key)
+	j.mu.Unlock()
+}
+
+func (j *journal) appendRemove(key string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.append(journalRecord{
+		Op:          journalOpRemove,
+		itemSidecar: itemSidecar{Key: key},
+	})
+}
+
+func (j *journal) needsCompaction(items int) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.records > max(journalCompactFactor*items, journalCompactMin)
+}
+
+func (j *journal) compact(records []journalRecord) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.rewrite(records)
+}
@@ -0,0 +1,239 @@
+package diskcache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache"
+)
+
+type loadedItem struct {
+	sidecar itemSidecar
+	modTime time.Time
+}
+
+// loadExistingItems reads all items from the journal or, if not available, the sharded dirs
+// Items from an old flat cache-dir are migrated first
+func (c *Cache) loadExistingItems() error {
+	if err := c.migrateFlatItems(); err != nil {
+		return err
+	}
+
+	journalPath := filepath.Join(c.options.CacheDir, JournalFileName)
+	var loaded []loadedItem
+	fromJournal := false
+
+	if c.options.Journal {
+		records, exists, err := replayJournal(journalPath)
+		if err != nil {
+			return err
+		}
+		fromJournal = exists
+		for _, record := range records {
+			loaded = append(loaded, loadedItem{
+				sidecar: record.itemSidecar,
+				modTime: record.ModTime,
+			})
+		}
+	} else if err := os.Remove(journalPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		// A journal left over would miss all changes from now on
+		return fmt.Errorf("failed removing outdated journal: %w", err)
+	}
+
+	if !fromJournal {
+		err := c.walkShards(c.options.CacheDir, ShardLevels, func(dir string) error {
+			items, err := loadShard(dir)
+			loaded = append(loaded, items...)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Add oldest first, so the eviction-policy starts with a sensible order
+	slices.SortFunc(loaded, func(a, b loadedItem) int {
+		return a.modTime.Compare(b.modTime)
+	})
+
+	for _, item := range loaded {
+		expiresAt := item.sidecar.ExpiresAt
+		if expiresAt.IsZero() {
+			expiresAt = cache.NewSetOptions(c.options.TTL, nil).ExpiresAt(item.modTime)
+		}
+
+		header := item.sidecar.header()
+		header.lock = &sync.RWMutex{}
+		header.ModTime = item.modTime
+		header.ExpiresAt = expiresAt
+		c.items[item.sidecar.Key] = header
+		c.track(item.sidecar.Key, header)
+	}
+
+	if c.options.Journal {
+		journal, err := writeJournal(journalPath, c.journalRecords())
+		if err != nil {
+			return err
+		}
+		c.journal = journal
+	}
+
+	return nil
+}
+
+// walkShards calls fn for every shard-dir at the last level
+func (c *Cache) walkShards(dir string, levels int, fn func(dir string) error) error {
+	if levels == 0 {
+		return fn(dir)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed reading dir '%s': %w", dir, err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !isShardName(entry.Name()) {
+			continue
+		}
+		if err := c.walkShards(filepath.Join(dir, entry.Name()), levels-1, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadShard reads items with their sidecars from dir
+// Items or sidecars missing their counterpart e.g. after a crash, and items not matching their size are removed
+func loadShard(dir string) ([]loadedItem, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading dir '%s': %w", dir, err)
+	}
+
+	items := make([]loadedItem, 0, len(entries)/2)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+
+		if strings.HasSuffix(entry.Name(), sidecarSuffix) {
+			if _, err := os.Stat(strings.TrimSuffix(path, sidecarSuffix)); os.IsNotExist(err) {
+				os.Remove(path)
+			}
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		sidecar, err := readSidecar(sidecarPath(path))
+		if err != nil || hashKey(sidecar.Key) != entry.Name() {
+			logger.Warn("Removing item without valid sidecar", "path", path, "error", err)
+			os.Remove(path)
+			os.Remove(sidecarPath(path))
+			continue
+		}
+		// Items without checksum were written before sizes were stored
+		if sidecar.Checksum == nil {
+			sidecar.Size = info.Size()
+		}
+		if sidecar.Size != info.Size() {
+			logger.Warn("Removing truncated item", "key", sidecar.Key, "expected", sidecar.Size, "actual", info.Size())
+			os.Remove(path)
+			os.Remove(sidecarPath(path))
+			continue
+		}
+
+		items = append(items, loadedItem{
+			sidecar: sidecar,
+			modTime: info.ModTime(),
+		})
+	}
+	return items, nil
+}
+
+// migrateFlatItems moves items stored directly in the cache-dir with their raw key as filename into the sharded layout
+func (c *Cache) migrateFlatItems() error {
+	entries, err := os.ReadDir(c.options.CacheDir)
+	if err != nil {
+		return fmt.Errorf("failed reading dir: %w", err)
+	}
+
+	migrated := 0
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), JournalFileName) {
+			continue
+		}
+
+		key := entry.Name()
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		path := c.itemPath(key)
+
+		if err := os.MkdirAll(filepath.Dir(path), DirFileMode); err != nil {
+			return fmt.Errorf("failed creating shard-dir for '%s': %w", key, err)
+		}
+		// Without expiry, the TTL is applied from the modification-time on loading
+		if err := writeSidecar(sidecarPath(path), itemSidecar{Key: key, Size: info.Size()}); err != nil {
+			return err
+		}
+		if err := os.Rename(filepath.Join(c.options.CacheDir, key), path); err != nil {
+			return fmt.Errorf("failed moving item '%s': %w", key, err)
+		}
+		// Keep modification-time as last access
+		os.Chtimes(path, info.ModTime(), info.ModTime())
+		migrated++
+	}
+
+	if migrated > 0 {
+		logger.Info("Migrated items from flat cache-dir", "count", migrated)
+		// Journal doesnt know the migrated items
+		if err := os.Remove(filepath.Join(c.options.CacheDir, JournalFileName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed removing outdated journal: %w", err)
+		}
+	}
+	return nil
+}
+
+// journalRecords returns a set-record for each item; c.mu has to be held
+func (c *Cache) journalRecords() []journalRecord {
+	records := make([]journalRecord, 0, len(c.items))
+	for key, header := range c.items {
+		records = append(records, journalRecord{
+			Op:          journalOpSet,
+			itemSidecar: c.sidecarOf(key, header),
+			ModTime:     header.ModTime,
+		})
+	}
+	return records
+}
+
+func (c *Cache) sidecarOf(key string, header CacheItemHeader) itemSidecar {
+	sidecar := itemSidecar{
+		Key:         key,
+		Size:        header.storedSize,
+		Compression: header.compression,
+		Encrypted:   header.encrypted,
+		Checksum:    header.checksum,
+		ExpiresAt:   header.ExpiresAt,
+		Owner:       header.owner,
+		Pinned:      header.pinned,
+	}
+	if header.compression != CompressionNone || header.encrypted {
+		sidecar.ContentSize = header.Size
+	}
+	return sidecar
+}
@@ -0,0 +1,125 @@
+package diskcache
+
+import (
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache/evictionpolicy"
+)
+
+// track adds the item to the sizes and eviction-policies; c.mu has to be held
+// Pinned items arent known to the policies, so they are never chosen for eviction
+func (c *Cache) track(key string, header CacheItemHeader) {
+	c.currentSize += header.storedSize
+	if header.owner != "" {
+		c.ownerSizes[header.owner] += header.storedSize
+	}
+	if header.pinned {
+		c.pinnedSize += header.storedSize
+		return
+	}
+
+	c.options.EvictionPolicy.Added(key)
+	if header.owner != "" {
+		policy, exists := c.ownerPolicies[header.owner]
+		if !exists {
+			policy = evictionpolicy.NewLRU()
+			c.ownerPolicies[header.owner] = policy
+		}
+		policy.Added(key)
+	}
+}
+
+// untrack reverts track; c.mu has to be held
+func (c *Cache) untrack(key string, header CacheItemHeader) {
+	c.currentSize -= header.storedSize
+	if header.owner != "" {
+		c.ownerSizes[header.owner] -= header.storedSize
+		if c.ownerSizes[header.owner] <= 0 {
+			delete(c.ownerSizes, header.owner)
+		}
+	}
+	if header.pinned {
+		c.pinnedSize -= header.storedSize
+		return
+	}
+
+	c.options.EvictionPolicy.Removed(key)
+	if policy, exists := c.ownerPolicies[header.owner]; exists {
+		policy.Removed(key)
+		if policy.Victim() == "" {
+			delete(c.ownerPolicies, header.owner)
+		}
+	}
+}
+
+// accessed notifies the policies of the item; c.mu has to be held
+func (c *Cache) accessed(key string, header CacheItemHeader) {
+	if header.pinned {
+		return
+	}
+	c.options.EvictionPolicy.Accessed(key)
+	if policy, exists := c.ownerPolicies[header.owner]; exists {
+		policy.Accessed(key)
+	}
+}
+
+// canPin checks if another item of size fits within PinnedMaxSize
+func (c *Cache) canPin(size int64) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.options.PinnedMaxSize == 0 || c.pinnedSize+size <= c.options.PinnedMaxSize
+}
+
+// quotaEvict evicts items of owner until its within OwnerQuota, keeping the item key; c.mu has to be held
+func (c *Cache) quotaEvict(owner, key string) error {
+	if owner == "" || c.options.OwnerQuota == 0 {
+		return nil
+	}
+
+	for c.ownerSizes[owner] > c.options.OwnerQuota {
+		policy, exists := c.ownerPolicies[owner]
+		if !exists {
+			// Only pinned items left
+			return nil
+		}
+		victim := policy.Victim()
+		if victim == key {
+			return nil
+		}
+
+		if err := c.evict(victim, cache.EvictedQuota); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnpinOwner makes all pinned items of owner evictable again e.g. when the nzb was removed
+func (c *Cache) UnpinOwner(owner string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, header := range c.items {
+		if header.owner != owner || !header.pinned {
+			continue
+		}
+
+		c.untrack(key, header)
+		header.pinned = false
+		c.items[key] = header
+		c.track(key, header)
+
+		// Persist, otherwise its pinned again after a restart
+		sidecar := c.sidecarOf(key, header)
+		if err := writeSidecar(sidecarPath(c.itemPath(key)), sidecar); err != nil {
+			return err
+		}
+		if c.journal != nil {
+			if err := c.journal.appendSet(journalRecord{itemSidecar: sidecar, ModTime: header.ModTime}); err != nil {
+				return err
+			}
+			c.journal.commit(key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package diskcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+)
+
+// Keys are hashed to a safe filename and sharded into ShardLevels nested dirs, named by the first hash-bytes
+// e.g. key -> ab/cd/abcd0123..
+const (
+	ShardLevels    = 2
+	shardNameChars = 2
+
+	sidecarSuffix = ".meta"
+)
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// shardDir returns the dir of the item relative to the cache-dir
+func shardDir(hash string) string {
+	parts := make([]string, ShardLevels)
+	for i := range parts {
+		parts[i] = hash[i*shardNameChars : (i+1)*shardNameChars]
+	}
+	return filepath.Join(parts...)
+}
+
+func (c *Cache) itemPath(key string) string {
+	hash := hashKey(key)
+	return filepath.Join(c.options.CacheDir, shardDir(hash), hash)
+}
+
+func sidecarPath(itemPath string) string {
+	return itemPath + sidecarSuffix
+}
+
+func isShardName(name string) bool {
+	if len(name) != shardNameChars {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
@@ -0,0 +1,74 @@
+package diskcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"time"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache"
+)
+
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// itemSidecar is stored next to each item, as the key cant be recovered from the hashed filename
+type itemSidecar struct {
+	Key string `json:"key"`
+	// Size on disk
+	Size int64 `json:"size"`
+	// Empty when stored uncompressed
+	Compression string `json:"compression,omitempty"`
+	Encrypted   bool   `json:"encrypted,omitempty"`
+	// Size of the decompressed and decrypted content, only set when compressed or encrypted
+	ContentSize int64 `json:"contentSize,omitempty"`
+	// CRC32C of the stored content; unknown for items migrated from a flat cache-dir
+	Checksum  *uint32   `json:"checksum,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Owner     string    `json:"owner,omitempty"`
+	Pinned    bool      `json:"pinned,omitempty"`
+}
+
+// header creates the item-header, without lock and times
+func (s itemSidecar) header() CacheItemHeader {
+	size := s.Size
+	if s.Compression != CompressionNone || s.Encrypted {
+		size = s.ContentSize
+	}
+	return CacheItemHeader{
+		ItemHeader: cache.ItemHeader{
+			Size:      size,
+			ExpiresAt: s.ExpiresAt,
+		},
+		storedSize:  s.Size,
+		compression: s.Compression,
+		encrypted:   s.Encrypted,
+		checksum:    s.Checksum,
+		owner:       s.Owner,
+		pinned:      s.Pinned,
+	}
+}
+
+func writeSidecar(path string, sidecar itemSidecar) error {
+	data, err := json.Marshal(sidecar)
+	if err != nil {
+		return fmt.Errorf("failed marshalling sidecar: %w", err)
+	}
+	if err := os.WriteFile(path, data, FileMode); err != nil {
+		return fmt.Errorf("failed writing sidecar '%s': %w", path, err)
+	}
+	return nil
+}
+
+func readSidecar(path string) (itemSidecar, error) {
+	var sidecar itemSidecar
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return sidecar, fmt.Errorf("failed reading sidecar '%s': %w", path, err)
+	}
+	if err := json.Unmarshal(data, &sidecar); err != nil {
+		return sidecar, fmt.Errorf("failed unmarshalling sidecar '%s': %w", path, err)
+	}
+	return sidecar, nil
+}
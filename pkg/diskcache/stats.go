@@ -0,0 +1,23 @@
+package diskcache
+
+import (
+	"maps"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache"
+)
+
+// Stats returns the counters since the cache was created and its current sizes, which are the ones on disk
+func (c *Cache) Stats() cache.Stats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return cache.Stats{
+		Hits:         c.hits.Load(),
+		Misses:       c.misses.Load(),
+		BytesWritten: c.bytesWritten.Load(),
+		Evictions:    maps.Clone(c.evictions),
+		Items:        len(c.items),
+		Size:         c.currentSize,
+		OwnerSizes:   maps.Clone(c.ownerSizes),
+	}
+}
@@ -1,23 +1,56 @@
 package diskcache
 
 import (
+	"crypto/cipher"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache/evictionpolicy"
 )
 
 type CacheItemHeader struct {
-	lock    *sync.RWMutex
-	ModTime time.Time
-	Size    int64
+	lock *sync.RWMutex
+	cache.ItemHeader
+	// Size on disk, differs from Size when compressed
+	storedSize int64
+	// Empty when stored uncompressed
+	compression string
+	encrypted   bool
+	// CRC32C of the stored content, nil when unknown
+	checksum *uint32
+	// If content was checked against size and checksum, done lazily on first read
+	verified bool
+	owner    string
+	pinned   bool
 }
 
-type CacheEvictPolicyHook func(entries map[string]CacheItemHeader) string
-
 type Cache struct {
 	options     *CacheOptions
 	mu          *sync.RWMutex
 	items       map[string]CacheItemHeader
 	currentSize int64
+	// Nil when disabled
+	journal *journal
+	// Nil when compression is disabled
+	codec codec
+	// Nil when encryption is disabled
+	aead cipher.AEAD
+	// Free space on the filesystem of CacheDir, as of the last refresh and kept up to date with what was written and evicted since
+	freeSpace int64
+	// If the last free-space check was below MinFreeSpace, to only log changes
+	lowDiskSpace bool
+
+	pinnedSize    int64
+	ownerSizes    map[string]int64
+	ownerPolicies map[string]*evictionpolicy.LRU
+
+	hits         atomic.Int64
+	misses       atomic.Int64
+	bytesWritten atomic.Int64
+	// Guarded by mu
+	evictions map[cache.EvictionReason]int64
 }
 
 type CacheOptions struct {
@@ -31,10 +64,24 @@ type CacheOptions struct {
 	MaxSizeEvictBlocking bool
 	// Max size an item can be before its rejected
 	ItemMaxSize int64
-	// Called when eviction is required e.g. due to missing free space
-	EvictPolicyHook CacheEvictPolicyHook
+	// Chooses which item to evict e.g. due to missing free space; defaults to LRU
+	EvictionPolicy evictionpolicy.Policy
+	// Time after which items expire, can be overwritten per item; 0 never expires
+	// Items migrated from a flat cache-dir expire TTL after their last access, as the time they were set isnt known
+	TTL time.Duration
+	// Keep an index-journal of all items, so startup doesnt need to read every item; recommended for large caches
+	Journal bool
+	// Max total size of items of one owner, its own items are evicted first when exceeded; 0 is unlimited
+	OwnerQuota int64
+	// Max total size of pinned items, further items arent pinned; defaults to half of MaxSize, 0 is unlimited
+	PinnedMaxSize int64
+	// Min free space on the filesystem of CacheDir in bytes, items are evicted when below and new items rejected with ErrLowDiskSpace when that isnt enough; 0 disables
+	MinFreeSpace int64
+	// Compress items block-wise, one of {"", zstd, lz4}; items not shrinking on their first block are stored uncompressed
+	Compression string
+	// Encrypt items with AES-GCM using a key derived from the secret, which should be long and random; empty disables
+	// Items encrypted with another secret or unencrypted ones are dropped when read
+	EncryptionSecret string
 }
 
-var defaultCacheOptions CacheOptions = CacheOptions{
-	EvictPolicyHook: EvictLRU,
-}
+var defaultCacheOptions CacheOptions = CacheOptions{}
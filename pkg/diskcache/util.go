@@ -2,11 +2,15 @@ package diskcache
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 )
 
-const DirFileMode = 0o755
+const (
+	DirFileMode = 0o755
+	FileMode    = 0o644
+)
 
 func ensureDirExists(dirPath string) error {
 	if _, err := os.Stat(dirPath); os.IsNotExist(err) {
@@ -35,3 +39,15 @@ func clearDirectory(dirPath string) error {
 
 	return nil
 }
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	writer  io.Writer
+	written int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.written += int64(n)
+	return n, err
+}
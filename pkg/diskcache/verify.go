@@ -0,0 +1,61 @@
+package diskcache
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache"
+)
+
+var ErrItemCorrupt = errors.New("item doesnt match its size or checksum")
+
+// verify reads the whole file, checks it against the header and rewinds it
+func verify(file *os.File, header CacheItemHeader) error {
+	checksum := crc32.New(checksumTable)
+	n, err := io.Copy(checksum, file)
+	if err != nil {
+		return fmt.Errorf("failed reading item: %w", err)
+	}
+	if n != header.storedSize {
+		return fmt.Errorf("%w: size %d instead of %d", ErrItemCorrupt, n, header.storedSize)
+	}
+	if header.checksum != nil && checksum.Sum32() != *header.checksum {
+		return fmt.Errorf("%w: checksum %08x instead of %08x", ErrItemCorrupt, checksum.Sum32(), *header.checksum)
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed rewinding item: %w", err)
+	}
+	return nil
+}
+
+// markVerified remembers the item as verified, unless it was replaced meanwhile
+func (c *Cache) markVerified(key string, lock *sync.RWMutex) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	header, exists := c.items[key]
+	if exists && header.lock == lock {
+		header.verified = true
+		c.items[key] = header
+	}
+}
+
+// drop removes a broken item, unless it was replaced meanwhile, and reports it as not found so its fetched again
+func (c *Cache) drop(key string, lock *sync.RWMutex) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.misses.Add(1)
+	header, exists := c.items[key]
+	if exists && header.lock == lock {
+		if err := c.evict(key, cache.EvictedCorrupt); err != nil {
+			return fmt.Errorf("failed removing broken item '%s': %w", key, err)
+		}
+	}
+	return ErrItemNotFound
+}
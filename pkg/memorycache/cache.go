@@ -0,0 +1,176 @@
+package memorycache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache/evictionpolicy"
+)
+
+var _ cache.ExpiringCache = (*Cache)(nil)
+
+var (
+	ErrInvalidCacheOptions = errors.New("invalid cache settings")
+	ErrItemTooLarge        = errors.New("item too large")
+)
+
+func NewCache(options *CacheOptions) (*Cache, error) {
+	if options.MaxSize <= 0 || options.ItemMaxSize < 0 || options.TTL < 0 {
+		return nil, ErrInvalidCacheOptions
+	}
+	if options.ItemMaxSize == 0 || options.ItemMaxSize > options.MaxSize {
+		options.ItemMaxSize = options.MaxSize
+	}
+	if options.EvictionPolicy == nil {
+		options.EvictionPolicy = evictionpolicy.NewLRU()
+	}
+
+	return &Cache{
+		options: options,
+		items:   make(map[string]*cacheItem),
+	}, nil
+}
+
+func (c *Cache) SetWithReader(key string, reader io.Reader, options ...cache.SetOption) (int64, error) {
+	setOptions := cache.NewSetOptions(c.options.TTL, options)
+
+	// Read one byte more than allowed, to detect too large items without reading them fully
+	data, err := io.ReadAll(io.LimitReader(reader, c.options.ItemMaxSize+1))
+	if err != nil {
+		return int64(len(data)), fmt.Errorf("failed reading item: %w", err)
+	}
+	if int64(len(data)) > c.options.ItemMaxSize {
+		return int64(len(data)), fmt.Errorf("item '%s' exceeds %d bytes: %w", key, c.options.ItemMaxSize, ErrItemTooLarge)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Overwritten item counts as accessed, not as new one, unless it gets evicted itself
+	var oldSize int64
+	old, overwritten := c.items[key]
+	if overwritten {
+		oldSize = old.header.Size
+	}
+	for c.options.MaxSize-c.currentSize+oldSize < int64(len(data)) {
+		victim := c.options.EvictionPolicy.Victim()
+		if victim == key {
+			overwritten = false
+			oldSize = 0
+		}
+		c.remove(victim)
+	}
+	c.currentSize -= oldSize
+
+	now := time.Now()
+	item := &cacheItem{
+		data: data,
+		header: cache.ItemHeader{
+			ModTime:   now,
+			Size:      int64(len(data)),
+			ExpiresAt: setOptions.ExpiresAt(now),
+		},
+	}
+	c.items[key] = item
+	c.currentSize += item.header.Size
+	if overwritten {
+		c.options.EvictionPolicy.Accessed(key)
+	} else {
+		c.options.EvictionPolicy.Added(key)
+	}
+
+	return item.header.Size, nil
+}
+
+func (c *Cache) GetWithReader(key string) (io.ReadSeekCloser, *cache.ItemHeader, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, exists := c.items[key]
+	if !exists {
+		return nil, nil, cache.ErrItemNotFound
+	}
+	now := time.Now()
+	if item.header.Expired(now) {
+		c.remove(key)
+		return nil, nil, cache.ErrItemNotFound
+	}
+	c.options.EvictionPolicy.Accessed(key)
+
+	item.header.ModTime = now
+	header := item.header
+
+	// Data is never modified after set, so readers can keep it even when the item is evicted meanwhile
+	return &itemReader{Reader: bytes.NewReader(item.data)}, &header, nil
+}
+
+func (c *Cache) Exists(key string) (bool, cache.ItemHeader) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, exists := c.items[key]
+	if !exists {
+		return false, cache.ItemHeader{}
+	}
+	header := item.header
+	if header.Expired(time.Now()) {
+		return false, cache.ItemHeader{}
+	}
+	return true, header
+}
+
+func (c *Cache) RemoveExpired() (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	removed := 0
+	for key, item := range c.items {
+		if item.header.Expired(now) {
+			c.remove(key)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (c *Cache) Remove(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.remove(key) {
+		return cache.ErrItemNotFound
+	}
+	return nil
+}
+
+// remove deletes the item, returns false when it didnt exist; lock has to be held
+func (c *Cache) remove(key string) bool {
+	item, exists := c.items[key]
+	if !exists {
+		return false
+	}
+	delete(c.items, key)
+	c.currentSize -= item.header.Size
+	c.options.EvictionPolicy.Removed(key)
+	return true
+}
+
+// CurrentSize returns the total size of all items in bytes
+func (c *Cache) CurrentSize() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.currentSize
+}
+
+type itemReader struct {
+	*bytes.Reader
+}
+
+func (r *itemReader) Close() error {
+	return nil
+}
@@ -0,0 +1,185 @@
+package memorycache_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/memorycache"
+)
+
+func set(t *testing.T, c cache.Cache, key string, data []byte) {
+	t.Helper()
+	n, err := c.SetWithReader(key, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed setting %s: %v", key, err)
+	}
+	if n != int64(len(data)) {
+		t.Fatalf("expected %d bytes written for %s, got %d", len(data), key, n)
+	}
+}
+
+func get(t *testing.T, c cache.Cache, key string) []byte {
+	t.Helper()
+	reader, header, err := c.GetWithReader(key)
+	if err != nil {
+		t.Fatalf("failed getting %s: %v", key, err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed reading %s: %v", key, err)
+	}
+	if header.Size != int64(len(data)) {
+		t.Errorf("header size %d doesnt match data size %d for %s", header.Size, len(data), key)
+	}
+	return data
+}
+
+func TestMemoryCacheSetGet(t *testing.T) {
+	t.Parallel()
+
+	c, err := memorycache.NewCache(&memorycache.CacheOptions{MaxSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set(t, c, "a", []byte("Hello World"))
+	if data := get(t, c, "a"); string(data) != "Hello World" {
+		t.Errorf("expected 'Hello World', got '%s'", data)
+	}
+
+	if exists, header := c.Exists("a"); !exists || header.Size != 11 {
+		t.Errorf("expected a to exist with size 11, got %v %d", exists, header.Size)
+	}
+
+	// Overwrite
+	set(t, c, "a", []byte("Bye"))
+	if data := get(t, c, "a"); string(data) != "Bye" {
+		t.Errorf("expected 'Bye', got '%s'", data)
+	}
+	if c.CurrentSize() != 3 {
+		t.Errorf("expected size 3 after overwrite, got %d", c.CurrentSize())
+	}
+
+	if err := c.Remove("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.GetWithReader("a"); !errors.Is(err, cache.ErrItemNotFound) {
+		t.Errorf("expected ErrItemNotFound after remove, got %v", err)
+	}
+	if err := c.Remove("a"); !errors.Is(err, cache.ErrItemNotFound) {
+		t.Errorf("expected ErrItemNotFound removing again, got %v", err)
+	}
+}
+
+func TestMemoryCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	t.Parallel()
+
+	c, err := memorycache.NewCache(&memorycache.CacheOptions{MaxSize: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set(t, c, "a", make([]byte, 10))
+	set(t, c, "b", make([]byte, 10))
+	set(t, c, "c", make([]byte, 10))
+	// Make a recently used
+	get(t, c, "a")
+	set(t, c, "d", make([]byte, 10))
+
+	for key, expected := range map[string]bool{"a": true, "b": false, "c": true, "d": true} {
+		if exists, _ := c.Exists(key); exists != expected {
+			t.Errorf("expected %s to exist: %v", key, expected)
+		}
+	}
+	if c.CurrentSize() != 30 {
+		t.Errorf("expected size 30, got %d", c.CurrentSize())
+	}
+}
+
+func TestMemoryCacheRejectsTooLargeItems(t *testing.T) {
+	t.Parallel()
+
+	c, err := memorycache.NewCache(&memorycache.CacheOptions{MaxSize: 30, ItemMaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set(t, c, "a", make([]byte, 10))
+	if _, err := c.SetWithReader("b", bytes.NewReader(make([]byte, 11))); !errors.Is(err, memorycache.ErrItemTooLarge) {
+		t.Errorf("expected ErrItemTooLarge, got %v", err)
+	}
+	if exists, _ := c.Exists("a"); !exists {
+		t.Error("expected rejected item not to evict others")
+	}
+
+	if _, err := memorycache.NewCache(&memorycache.CacheOptions{}); !errors.Is(err, memorycache.ErrInvalidCacheOptions) {
+		t.Errorf("expected ErrInvalidCacheOptions without MaxSize, got %v", err)
+	}
+}
+
+func TestMemoryCacheTTL(t *testing.T) {
+	t.Parallel()
+
+	c, err := memorycache.NewCache(&memorycache.CacheOptions{MaxSize: 100, TTL: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set(t, c, "default", []byte("a"))
+	if _, err := c.SetWithReader("long", bytes.NewReader([]byte("b")), cache.WithTTL(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SetWithReader("never", bytes.NewReader([]byte("c")), cache.WithTTL(0)); err != nil {
+		t.Fatal(err)
+	}
+	get(t, c, "default")
+
+	time.Sleep(30 * time.Millisecond)
+
+	if exists, _ := c.Exists("default"); exists {
+		t.Error("expected item with default TTL to be expired")
+	}
+	if _, _, err := c.GetWithReader("default"); !errors.Is(err, cache.ErrItemNotFound) {
+		t.Errorf("expected ErrItemNotFound for expired item, got %v", err)
+	}
+	if c.CurrentSize() != 2 {
+		t.Errorf("expected expired item to be removed on get, size is %d", c.CurrentSize())
+	}
+	get(t, c, "long")
+	get(t, c, "never")
+}
+
+func TestMemoryCacheRemoveExpired(t *testing.T) {
+	t.Parallel()
+
+	c, err := memorycache.NewCache(&memorycache.CacheOptions{MaxSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"a", "b"} {
+		if _, err := c.SetWithReader(key, bytes.NewReader([]byte(key)), cache.WithTTL(time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	set(t, c, "c", []byte("c"))
+
+	time.Sleep(5 * time.Millisecond)
+
+	removed, err := c.RemoveExpired()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 2 {
+		t.Errorf("expected 2 expired items to be removed, got %d", removed)
+	}
+	if exists, _ := c.Exists("c"); !exists {
+		t.Error("expected item without TTL to stay")
+	}
+}
@@ -0,0 +1,33 @@
+package memorycache
+
+import (
+	"sync"
+	"time"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache/evictionpolicy"
+)
+
+type cacheItem struct {
+	data   []byte
+	header cache.ItemHeader
+}
+
+// Cache keeps items in memory, bounded by MaxSize
+type Cache struct {
+	options     *CacheOptions
+	mu          sync.Mutex
+	items       map[string]*cacheItem
+	currentSize int64
+}
+
+type CacheOptions struct {
+	// Max total size of items in memory in bytes, required
+	MaxSize int64
+	// Max size an item can be before its rejected; defaults to MaxSize
+	ItemMaxSize int64
+	// Time after which items expire, can be overwritten per item; 0 never expires
+	TTL time.Duration
+	// Chooses which item to evict when space is needed; defaults to LRU
+	EvictionPolicy evictionpolicy.Policy
+}
@@ -0,0 +1,80 @@
+package nzbparser
+
+import "slices"
+
+// GetArchiveListing returns the cached listing of the archive-group or nil if none is cached
+func (nzb *NzbData) GetArchiveListing(group string) *ArchiveListing {
+	for i := range nzb.ArchiveListings {
+		if nzb.ArchiveListings[i].Group == group {
+			return &nzb.ArchiveListings[i]
+		}
+	}
+	return nil
+}
+
+// SetArchiveListing caches the listing of the archive-group and the password that opened it, replacing a previous one
+func (nzb *NzbData) SetArchiveListing(group string, files []ArchiveFile, password string) {
+	if listing := nzb.GetArchiveListing(group); listing != nil {
+		listing.Files = files
+		listing.Password = password
+		return
+	}
+	nzb.ArchiveListings = append(nzb.ArchiveListings, ArchiveListing{
+		Group:    group,
+		Password: password,
+		Files:    files,
+	})
+}
+
+// SetSplitListing caches the parts of a raw split file and their exact sizes, replacing a previous listing
+func (nzb *NzbData) SetSplitListing(group string, parts []ArchiveFile) {
+	nzb.SetArchiveListing(group, parts, "")
+	nzb.GetArchiveListing(group).Split = true
+}
+
+// SetArchiveFileChecksum sets the checksum-state of a file in the listing of the archive-group
+// Returns false if the file isnt listed or already had the state
+func (nzb *NzbData) SetArchiveFileChecksum(group, name string, state ChecksumState) bool {
+	listing := nzb.GetArchiveListing(group)
+	if listing == nil {
+		return false
+	}
+	for i := range listing.Files {
+		if listing.Files[i].Name == name {
+			if listing.Files[i].Checksum == state {
+				return false
+			}
+			listing.Files[i].Checksum = state
+			return true
+		}
+	}
+	return false
+}
+
+// CloneArchiveListings returns a copy of the listings, which isnt affected by later changes to the ones of the nzb
+func (nzb *NzbData) CloneArchiveListings() []ArchiveListing {
+	listings := make([]ArchiveListing, len(nzb.ArchiveListings))
+	for i, listing := range nzb.ArchiveListings {
+		listing.Files = slices.Clone(listing.Files)
+		listings[i] = listing
+	}
+	return listings
+}
+
+// ArchiveListingsEqual checks if both contain the same listings with the same files
+func ArchiveListingsEqual(a, b []ArchiveListing) bool {
+	return slices.EqualFunc(a, b, func(a, b ArchiveListing) bool {
+		return a.Group == b.Group &&
+			a.Password == b.Password &&
+			a.Split == b.Split &&
+			a.Extension == b.Extension &&
+			slices.EqualFunc(a.Files, b.Files, func(a, b ArchiveFile) bool {
+				return a.Name == b.Name &&
+					a.Size == b.Size &&
+					a.Offset == b.Offset &&
+					a.Checksum == b.Checksum &&
+					a.Stored == b.Stored &&
+					slices.Equal(a.Extents, b.Extents)
+			})
+	})
+}
@@ -0,0 +1,72 @@
+package nzbparser_test
+
+import (
+	"testing"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/nzbparser"
+)
+
+func TestSetArchiveListing(t *testing.T) {
+	t.Parallel()
+
+	nzb := &nzbparser.NzbData{}
+	if nzb.GetArchiveListing("movie.rar") != nil {
+		t.Fatalf("expected no listing before setting one")
+	}
+
+	nzb.SetArchiveListing("movie.rar", []nzbparser.ArchiveFile{{Name: "movie.mkv", Size: 10}}, "secret")
+	nzb.SetArchiveListing("movie.rar", []nzbparser.ArchiveFile{{Name: "movie.mkv", Size: 20}}, "other")
+
+	if len(nzb.ArchiveListings) != 1 {
+		t.Fatalf("expected listing to be replaced, got %d listings", len(nzb.ArchiveListings))
+	}
+	listing := nzb.GetArchiveListing("movie.rar")
+	if listing.Password != "other" || listing.Files[0].Size != 20 {
+		t.Errorf("expected replaced listing, got %+v", listing)
+	}
+
+	nzb.SetSplitListing("movie.mkv", []nzbparser.ArchiveFile{{Name: "movie.mkv.001", Size: 5}})
+	if !nzb.GetArchiveListing("movie.mkv").Split {
+		t.Errorf("expected split listing to be marked as split")
+	}
+}
+
+func TestArchiveListingsEqual(t *testing.T) {
+	t.Parallel()
+
+	nzb := &nzbparser.NzbData{}
+	nzb.SetArchiveListing("movie.rar", []nzbparser.ArchiveFile{{Name: "movie.mkv", Size: 10}}, "")
+
+	before := nzb.CloneArchiveListings()
+	if !nzbparser.ArchiveListingsEqual(before, nzb.ArchiveListings) {
+		t.Errorf("expected clone to equal the listings")
+	}
+
+	// Changes to the nzb dont affect the clone
+	nzb.SetArchiveFileChecksum("movie.rar", "movie.mkv", nzbparser.ChecksumValid)
+	if nzbparser.ArchiveListingsEqual(before, nzb.ArchiveListings) {
+		t.Errorf("expected changed checksum-state to be detected")
+	}
+
+	before = nzb.CloneArchiveListings()
+	nzb.GetArchiveListing("movie.rar").Extension = ".rar"
+	if nzbparser.ArchiveListingsEqual(before, nzb.ArchiveListings) {
+		t.Errorf("expected changed extension to be detected")
+	}
+
+	before = nzb.CloneArchiveListings()
+	nzb.GetArchiveListing("movie.rar").Files[0].Stored = true
+	if nzbparser.ArchiveListingsEqual(before, nzb.ArchiveListings) {
+		t.Errorf("expected changed stored-flag to be detected")
+	}
+
+	before = nzb.CloneArchiveListings()
+	nzb.SetArchiveListing("other.7z", nil, "")
+	if nzbparser.ArchiveListingsEqual(before, nzb.ArchiveListings) {
+		t.Errorf("expected added listing to be detected")
+	}
+
+	if !nzbparser.ArchiveListingsEqual(nil, (&nzbparser.NzbData{}).CloneArchiveListings()) {
+		t.Errorf("expected no listings to equal an empty clone")
+	}
+}
@@ -0,0 +1,43 @@
+package nzbparser
+
+import (
+	"slices"
+	"strings"
+)
+
+// normalizeMetaType brings meta-types into the form used as key in Meta, e.g. "password" -> "Password"
+func normalizeMetaType(metaType string) string {
+	if metaType == "" {
+		return metaType
+	}
+	return strings.ToUpper(metaType[:1]) + strings.ToLower(metaType[1:])
+}
+
+// SetMeta sets the meta-value in Meta and RawMeta, so it is kept when the nzb is stored
+func (nzb *NzbData) SetMeta(key, value string) {
+	key = normalizeMetaType(key)
+	if nzb.Meta == nil {
+		nzb.Meta = make(map[string]string, 1)
+	}
+	nzb.Meta[key] = value
+
+	for i := range nzb.RawMeta {
+		if normalizeMetaType(nzb.RawMeta[i].Type) == key {
+			nzb.RawMeta[i].Value = value
+			return
+		}
+	}
+	nzb.RawMeta = append(nzb.RawMeta, metadataEntry{
+		Type:  strings.ToLower(key),
+		Value: value,
+	})
+}
+
+// DeleteMeta removes the meta-value from Meta and RawMeta
+func (nzb *NzbData) DeleteMeta(key string) {
+	key = normalizeMetaType(key)
+	delete(nzb.Meta, key)
+	nzb.RawMeta = slices.DeleteFunc(nzb.RawMeta, func(entry metadataEntry) bool {
+		return normalizeMetaType(entry.Type) == key
+	})
+}
@@ -0,0 +1,56 @@
+package nzbparser_test
+
+import (
+	"strings"
+	"testing"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/nzbparser"
+)
+
+func TestSetMeta(t *testing.T) {
+	t.Parallel()
+
+	nzb, err := nzbparser.ParseNzb(strings.NewReader(`<nzb><head><meta type="name">Movie</meta><meta type="password">old</meta></head></nzb>`))
+	if err != nil {
+		t.Fatalf("failed parsing nzb: %v", err)
+	}
+
+	nzb.SetMeta("password", "new")
+	if nzb.Meta[nzbparser.MetaKeyPassword] != "new" {
+		t.Errorf("expected Password meta %q, got %q", "new", nzb.Meta[nzbparser.MetaKeyPassword])
+	}
+	if len(nzb.RawMeta) != 2 || nzb.RawMeta[1].Value != "new" {
+		t.Errorf("expected existing raw meta to be replaced, got %+v", nzb.RawMeta)
+	}
+
+	nzb.SetMeta("Category", "movies")
+	if nzb.Meta["Category"] != "movies" {
+		t.Errorf("expected Category meta %q, got %q", "movies", nzb.Meta["Category"])
+	}
+	if len(nzb.RawMeta) != 3 || nzb.RawMeta[2].Type != "category" || nzb.RawMeta[2].Value != "movies" {
+		t.Errorf("expected new raw meta to be appended, got %+v", nzb.RawMeta)
+	}
+}
+
+func TestDeleteMeta(t *testing.T) {
+	t.Parallel()
+
+	nzb, err := nzbparser.ParseNzb(strings.NewReader(`<nzb><head><meta type="name">Movie</meta><meta type="password">old</meta></head></nzb>`))
+	if err != nil {
+		t.Fatalf("failed parsing nzb: %v", err)
+	}
+
+	nzb.DeleteMeta("Password")
+	if _, exists := nzb.Meta[nzbparser.MetaKeyPassword]; exists {
+		t.Errorf("expected Password meta to be removed")
+	}
+	if len(nzb.RawMeta) != 1 || nzb.RawMeta[0].Type != "name" {
+		t.Errorf("expected only the raw password meta to be removed, got %+v", nzb.RawMeta)
+	}
+
+	// Missing keys are ignored
+	nzb.DeleteMeta("Category")
+	if len(nzb.RawMeta) != 1 {
+		t.Errorf("expected raw meta to be unchanged, got %+v", nzb.RawMeta)
+	}
+}
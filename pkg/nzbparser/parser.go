@@ -27,8 +27,7 @@ func ParseNzb(inputStream io.Reader) (*NzbData, error) {
 	// Parse meta
 	nzb.Meta = make(map[string]string, len(nzb.RawMeta))
 	for _, meta := range nzb.RawMeta {
-		meta.Type = strings.ToUpper(string(meta.Type[0])) + strings.ToLower(meta.Type[1:])
-		nzb.Meta[meta.Type] = meta.Value
+		nzb.Meta[normalizeMetaType(meta.Type)] = meta.Value
 	}
 
 	// Parse additional data
@@ -0,0 +1,50 @@
+package nzbparser
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var passwordPatterns = []*regexp.Regexp{
+	// name{{password}}
+	regexp.MustCompile(`\{\{(.+?)\}\}`),
+	// name password=password
+	regexp.MustCompile(`(?i)\bpassword=([^\s&;]+)`),
+}
+
+// ExtractPasswords returns passwords embedded in the text using the {{password}} or password= notation
+func ExtractPasswords(text string) []string {
+	var passwords []string
+	for _, pattern := range passwordPatterns {
+		for _, match := range pattern.FindAllStringSubmatch(text, -1) {
+			if password := strings.TrimSpace(match[1]); password != "" {
+				passwords = append(passwords, password)
+			}
+		}
+	}
+	return passwords
+}
+
+// PasswordCandidates returns possible passwords for the nzb, starting with the Password meta, followed by passwords embedded in the Title meta and nzb filename
+// Duplicates are removed
+func (nzb *NzbData) PasswordCandidates() []string {
+	var candidates []string
+	if password := nzb.Meta[MetaKeyPassword]; password != "" {
+		candidates = append(candidates, password)
+	}
+	candidates = append(candidates, ExtractPasswords(nzb.Meta["Title"])...)
+	candidates = append(candidates, ExtractPasswords(nzb.Meta[MetaKeyName])...)
+	candidates = append(candidates, ExtractPasswords(strings.TrimSuffix(nzb.Filename, filepath.Ext(nzb.Filename)))...)
+
+	seen := make(map[string]struct{}, len(candidates))
+	unique := candidates[:0]
+	for _, candidate := range candidates {
+		if _, ok := seen[candidate]; ok {
+			continue
+		}
+		seen[candidate] = struct{}{}
+		unique = append(unique, candidate)
+	}
+	return unique
+}
@@ -0,0 +1,51 @@
+package nzbparser_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/nzbparser"
+)
+
+func TestExtractPasswords(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{"Movie.2024{{secret}}", []string{"secret"}},
+		{"Movie {{ spaced }}", []string{"spaced"}},
+		{"Movie password=abc123", []string{"abc123"}},
+		{"Movie PASSWORD=abc&other=1", []string{"abc"}},
+		{"Movie{{one}} password=two", []string{"one", "two"}},
+		{"Movie{{}}", nil},
+		{"Movie.2024", nil},
+	}
+	for _, test := range tests {
+		if passwords := nzbparser.ExtractPasswords(test.text); !slices.Equal(passwords, test.expected) {
+			t.Errorf("ExtractPasswords(%q): expected %v, got %v", test.text, test.expected, passwords)
+		}
+	}
+}
+
+func TestPasswordCandidates(t *testing.T) {
+	t.Parallel()
+
+	nzb, err := nzbparser.ParseNzb(strings.NewReader(`<nzb><head>` +
+		`<meta type="password">meta</meta>` +
+		`<meta type="title">Movie{{title}}</meta>` +
+		`<meta type="name">Movie{{meta}}</meta>` +
+		`</head></nzb>`))
+	if err != nil {
+		t.Fatalf("failed parsing nzb: %v", err)
+	}
+	nzb.Filename = "Movie{{file}}.nzb"
+
+	// Duplicate "meta" from Name is dropped, order is kept
+	expected := []string{"meta", "title", "file"}
+	if candidates := nzb.PasswordCandidates(); !slices.Equal(candidates, expected) {
+		t.Errorf("expected candidates %v, got %v", expected, candidates)
+	}
+}
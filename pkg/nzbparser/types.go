@@ -31,8 +31,53 @@ type Segment struct {
 type NzbData struct {
 	Meta     map[string]string `xml:"-"`
 	MetaName string            `xml:"-"`
-	RawMeta  []metadataEntry   `xml:"head>meta"`
-	Files    []File            `xml:"file"`
+	// Name of the nzb-file it was loaded from, if known; Stored as passwords might be embedded in it
+	Filename string          `xml:"filename,attr,omitempty"`
+	RawMeta  []metadataEntry `xml:"head>meta"`
+	// Cached archive contents, stored alongside the nzb to avoid reading archive-headers again
+	ArchiveListings []ArchiveListing `xml:"head>archive"`
+	Files           []File           `xml:"file"`
+}
+
+// ArchiveListing describes the files contained in an archive-group of the nzb
+type ArchiveListing struct {
+	Group string `xml:"group,attr"`
+	// Password that opened the archive, if it needed one
+	Password string `xml:"password,attr,omitempty"`
+	// Group is a raw split file and Files are its parts
+	Split bool `xml:"split,attr,omitempty"`
+	// Archive-type detected by magic-bytes, when the group-name doesnt tell
+	Extension string        `xml:"extension,attr,omitempty"`
+	Files     []ArchiveFile `xml:"file"`
+}
+
+// ArchiveFile is a single file inside an archive
+type ArchiveFile struct {
+	Name string `xml:"name,attr"`
+	Size int64  `xml:"size,attr"`
+	// Position of the data for containers storing files uncompressed, e.g. tar
+	Offset int64 `xml:"offset,attr,omitempty"`
+	// Positions of the data for files stored in multiple parts, e.g. fragmented in an iso; Offset is unused then
+	Extents []ArchiveExtent `xml:"extent"`
+	// Result of the last time the file was read to its end with its checksum calculated
+	Checksum ChecksumState `xml:"checksum,attr,omitempty"`
+	// Stored uncompressed and unencrypted in an archive which could do either, so reading it doesnt decode anything
+	Stored bool `xml:"stored,attr,omitempty"`
+}
+
+// ChecksumState tells if an archive-entry was verified against its stored checksum
+type ChecksumState string
+
+const (
+	ChecksumUnverified ChecksumState = ""
+	ChecksumValid      ChecksumState = "valid"
+	ChecksumInvalid    ChecksumState = "invalid"
+)
+
+// ArchiveExtent is a contiguous part of a file inside an archive
+type ArchiveExtent struct {
+	Offset int64 `xml:"offset,attr"`
+	Size   int64 `xml:"size,attr"`
 }
 
 // Internal XML Metadata entries
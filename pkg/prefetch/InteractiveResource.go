@@ -0,0 +1,73 @@
+package prefetch
+
+import (
+	"context"
+	"io"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
+)
+
+// InteractiveResource marks reads as interactive at the manager while a reader is open, so prefetching backs off
+type InteractiveResource struct {
+	underlying resource.ReadSeekCloseableResource
+	manager    *Manager
+}
+
+func NewInteractiveResource(underlying resource.ReadSeekCloseableResource, manager *Manager) *InteractiveResource {
+	return &InteractiveResource{
+		underlying: underlying,
+		manager:    manager,
+	}
+}
+
+type InteractiveResourceReader struct {
+	io.ReadSeekCloser
+	end func()
+}
+
+func (r *InteractiveResource) Open() (io.ReadSeekCloser, error) {
+	return r.OpenContext(context.Background())
+}
+
+var _ resource.ContextResource = (*InteractiveResource)(nil)
+
+func (r *InteractiveResource) OpenContext(ctx context.Context) (io.ReadSeekCloser, error) {
+	reader, err := resource.OpenContext(ctx, r.underlying)
+	if err != nil {
+		return nil, err
+	}
+
+	return &InteractiveResourceReader{
+		ReadSeekCloser: reader,
+		end:            r.manager.BeginInteractive(),
+	}, nil
+}
+
+func (r *InteractiveResource) Size() (int64, error) {
+	return r.underlying.Size()
+}
+
+func (r *InteractiveResource) IsSizeAccurate() bool {
+	sizeAccurateResource, ok := r.underlying.(resource.SizeAccurateResource)
+	if !ok {
+		return true
+	}
+	return sizeAccurateResource.IsSizeAccurate()
+}
+
+func (r *InteractiveResourceReader) Close() error {
+	r.end()
+	return r.ReadSeekCloser.Close()
+}
+
+func (r *InteractiveResourceReader) ReadContext(ctx context.Context, p []byte) (int, error) {
+	return resource.ReadContext(ctx, r.ReadSeekCloser, p)
+}
+
+func (r *InteractiveResourceReader) ReadAt(p []byte, off int64) (int, error) {
+	return r.ReadAtContext(context.Background(), p, off)
+}
+
+func (r *InteractiveResourceReader) ReadAtContext(ctx context.Context, p []byte, off int64) (int, error) {
+	return resource.ReadAtContext(ctx, r.ReadSeekCloser, p, off)
+}
@@ -0,0 +1,288 @@
+package prefetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache"
+)
+
+var logger = slog.With("Module", "Prefetch")
+
+// Finished jobs kept for querying their status, the oldest are dropped first
+const MaxFinishedJobs = 50
+
+var ErrJobNotFound = errors.New("prefetch-job not found")
+
+// Task fetches one item into cache e.g. a segment
+type Task interface {
+	Prefetch() error
+}
+
+type State string
+
+const (
+	StateRunning   State = "running"
+	StateDone      State = "done"
+	StateCancelled State = "cancelled"
+	StateFailed    State = "failed"
+)
+
+type JobStatus struct {
+	ID    string
+	Name  string
+	State State
+	// Count of tasks, of the ones completed and of the ones failed
+	Total  int
+	Done   int
+	Failed int
+	// Error of the first failed task
+	Error    string
+	Started  time.Time
+	Finished time.Time
+}
+
+type job struct {
+	status JobStatus
+	cancel context.CancelFunc
+}
+
+// Manager runs prefetch-jobs with bounded concurrency over all jobs
+// While interactive reads are ongoing, fewer tasks run so prefetching doesnt slow them down
+type Manager struct {
+	ctx     context.Context
+	options *ManagerOptions
+
+	mutex  sync.Mutex
+	jobs   map[string]*job
+	order  []string
+	nextID int
+	// Tasks running over all jobs and interactive readers open
+	running     int
+	interactive int
+	// Closed and replaced whenever running or interactive changes
+	changed chan struct{}
+}
+
+type ManagerOptions struct {
+	// Tasks running at the same time over all jobs
+	Concurrency int
+	// Tasks running at the same time while interactive reads are ongoing, 0 pauses prefetching meanwhile
+	InteractiveConcurrency int
+}
+
+// NewManager creates a manager whose jobs are cancelled when ctx is done
+func NewManager(ctx context.Context, options *ManagerOptions) *Manager {
+	if options.Concurrency < 1 {
+		options.Concurrency = 1
+	}
+
+	return &Manager{
+		ctx:     ctx,
+		options: options,
+		jobs:    make(map[string]*job),
+		changed: make(chan struct{}),
+	}
+}
+
+// Start runs the tasks in order as a new job in the background
+func (m *Manager) Start(name string, tasks []Task) JobStatus {
+	ctx, cancel := context.WithCancel(m.ctx)
+
+	m.mutex.Lock()
+	m.nextID++
+	j := &job{
+		status: JobStatus{
+			ID:      strconv.Itoa(m.nextID),
+			Name:    name,
+			State:   StateRunning,
+			Total:   len(tasks),
+			Started: time.Now(),
+		},
+		cancel: cancel,
+	}
+	m.jobs[j.status.ID] = j
+	m.order = append(m.order, j.status.ID)
+	status := j.status
+	m.mutex.Unlock()
+
+	logger.Info("Started prefetch-job", "id", status.ID, "name", name, "tasks", len(tasks))
+	go m.run(ctx, j, tasks)
+
+	return status
+}
+
+func (m *Manager) run(ctx context.Context, j *job, tasks []Task) {
+	defer j.cancel()
+
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		if err := m.acquire(ctx); err != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer m.release()
+
+			err := task.Prefetch()
+
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+			if err == nil {
+				j.status.Done++
+				return
+			}
+			j.status.Failed++
+			if j.status.Error == "" {
+				j.status.Error = err.Error()
+			}
+			// Further tasks would only evict what was just fetched
+			if errors.Is(err, cache.ErrInsufficientSpace) {
+				j.cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	m.mutex.Lock()
+	switch {
+	case j.status.Failed > 0:
+		j.status.State = StateFailed
+	case ctx.Err() != nil:
+		j.status.State = StateCancelled
+	default:
+		j.status.State = StateDone
+	}
+	j.status.Finished = time.Now()
+	status := j.status
+	m.dropFinishedJobs()
+	m.mutex.Unlock()
+
+	logger.Info("Finished prefetch-job", "id", status.ID, "name", status.Name, "state", status.State, "done", status.Done, "failed", status.Failed, "error", status.Error)
+}
+
+// dropFinishedJobs drops the oldest finished jobs above MaxFinishedJobs; Requires the mutex
+func (m *Manager) dropFinishedJobs() {
+	finished := 0
+	for _, id := range m.order {
+		if m.jobs[id].status.State != StateRunning {
+			finished++
+		}
+	}
+
+	for i := 0; i < len(m.order) && finished > MaxFinishedJobs; {
+		id := m.order[i]
+		if m.jobs[id].status.State == StateRunning {
+			i++
+			continue
+		}
+		delete(m.jobs, id)
+		m.order = append(m.order[:i], m.order[i+1:]...)
+		finished--
+	}
+}
+
+// acquire waits until another task may run
+func (m *Manager) acquire(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		m.mutex.Lock()
+		if m.running < m.limit() {
+			m.running++
+			m.mutex.Unlock()
+			return nil
+		}
+		changed := m.changed
+		m.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (m *Manager) release() {
+	m.mutex.Lock()
+	m.running--
+	m.notify()
+	m.mutex.Unlock()
+}
+
+// limit of running tasks; Requires the mutex
+func (m *Manager) limit() int {
+	if m.interactive > 0 {
+		return min(m.options.InteractiveConcurrency, m.options.Concurrency)
+	}
+	return m.options.Concurrency
+}
+
+// notify wakes up waiting tasks; Requires the mutex
+func (m *Manager) notify() {
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+// BeginInteractive marks an interactive read as ongoing until the returned function is called
+func (m *Manager) BeginInteractive() (end func()) {
+	m.mutex.Lock()
+	m.interactive++
+	m.mutex.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mutex.Lock()
+			m.interactive--
+			m.notify()
+			m.mutex.Unlock()
+		})
+	}
+}
+
+func (m *Manager) Job(id string) (JobStatus, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	j, exists := m.jobs[id]
+	if !exists {
+		return JobStatus{}, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	return j.status, nil
+}
+
+// Jobs returns the status of all kept jobs, in the order they were started
+func (m *Manager) Jobs() []JobStatus {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	statuses := make([]JobStatus, 0, len(m.order))
+	for _, id := range m.order {
+		statuses = append(statuses, m.jobs[id].status)
+	}
+	return statuses
+}
+
+// Cancel stops the job from starting further tasks, running ones are finished
+func (m *Manager) Cancel(id string) (JobStatus, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	j, exists := m.jobs[id]
+	if !exists {
+		return JobStatus{}, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	j.cancel()
+	return j.status, nil
+}
@@ -0,0 +1,214 @@
+package prefetch_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/prefetch"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/bytesresource"
+)
+
+// blockingTask waits for release and records the highest count of tasks running at once
+type blockingTask struct {
+	release <-chan struct{}
+	running *atomic.Int32
+	peak    *atomic.Int32
+	err     error
+}
+
+func (t *blockingTask) Prefetch() error {
+	running := t.running.Add(1)
+	defer t.running.Add(-1)
+	for {
+		peak := t.peak.Load()
+		if running <= peak || t.peak.CompareAndSwap(peak, running) {
+			break
+		}
+	}
+	<-t.release
+	return t.err
+}
+
+func newTasks(count int, release <-chan struct{}) ([]prefetch.Task, *atomic.Int32, *atomic.Int32) {
+	var running, peak atomic.Int32
+	tasks := make([]prefetch.Task, count)
+	for i := range tasks {
+		tasks[i] = &blockingTask{release: release, running: &running, peak: &peak}
+	}
+	return tasks, &running, &peak
+}
+
+func waitForState(t *testing.T, manager *prefetch.Manager, id string, state prefetch.State) prefetch.JobStatus {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		status, err := manager.Job(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.State == state {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected job to be %s, is %s", state, status.State)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func waitForRunning(t *testing.T, running *atomic.Int32, count int32) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for running.Load() != count {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d tasks running, are %d", count, running.Load())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestManagerBoundsConcurrency(t *testing.T) {
+	t.Parallel()
+
+	manager := prefetch.NewManager(context.Background(), &prefetch.ManagerOptions{Concurrency: 2})
+	release := make(chan struct{})
+	tasks, running, peak := newTasks(5, release)
+
+	status := manager.Start("file", tasks)
+	if status.State != prefetch.StateRunning || status.Total != 5 {
+		t.Errorf("expected running job with 5 tasks, got %+v", status)
+	}
+
+	waitForRunning(t, running, 2)
+	close(release)
+
+	status = waitForState(t, manager, status.ID, prefetch.StateDone)
+	if status.Done != 5 || status.Failed != 0 {
+		t.Errorf("expected all tasks done, got %+v", status)
+	}
+	if peak.Load() != 2 {
+		t.Errorf("expected at most 2 tasks at once, peak was %d", peak.Load())
+	}
+}
+
+func TestManagerCancel(t *testing.T) {
+	t.Parallel()
+
+	manager := prefetch.NewManager(context.Background(), &prefetch.ManagerOptions{Concurrency: 1})
+	release := make(chan struct{})
+	tasks, running, _ := newTasks(5, release)
+
+	status := manager.Start("file", tasks)
+	waitForRunning(t, running, 1)
+
+	if _, err := manager.Cancel(status.ID); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+
+	status = waitForState(t, manager, status.ID, prefetch.StateCancelled)
+	if status.Done != 1 {
+		t.Errorf("expected only the running task to finish, got %+v", status)
+	}
+
+	if _, err := manager.Cancel("unknown"); !errors.Is(err, prefetch.ErrJobNotFound) {
+		t.Errorf("expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestManagerFailedTasks(t *testing.T) {
+	t.Parallel()
+
+	manager := prefetch.NewManager(context.Background(), &prefetch.ManagerOptions{Concurrency: 1})
+	release := make(chan struct{})
+	close(release)
+	tasks, _, _ := newTasks(4, release)
+	tasks[1].(*blockingTask).err = errors.New("article missing")
+	// Cache being full stops the job
+	tasks[2].(*blockingTask).err = fmt.Errorf("no space: %w", cache.ErrInsufficientSpace)
+
+	status := manager.Start("file", tasks)
+	status = waitForState(t, manager, status.ID, prefetch.StateFailed)
+	if status.Done != 1 || status.Failed != 2 || status.Error != "article missing" {
+		t.Errorf("expected 1 done and 2 failed tasks stopping before the last, got %+v", status)
+	}
+}
+
+func TestManagerBacksOffForInteractiveReads(t *testing.T) {
+	t.Parallel()
+
+	manager := prefetch.NewManager(context.Background(), &prefetch.ManagerOptions{Concurrency: 3, InteractiveConcurrency: 0})
+	file := prefetch.NewInteractiveResource(&bytesresource.BytesResource{Content: []byte("Hello")}, manager)
+
+	reader, err := file.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := make(chan struct{})
+	tasks, running, _ := newTasks(3, release)
+	status := manager.Start("file", tasks)
+
+	time.Sleep(50 * time.Millisecond)
+	if running.Load() != 0 {
+		t.Errorf("expected prefetching to pause while reading, %d tasks running", running.Load())
+	}
+
+	reader.Close()
+	waitForRunning(t, running, 3)
+	close(release)
+	waitForState(t, manager, status.ID, prefetch.StateDone)
+}
+
+func TestManagerDropsOldFinishedJobs(t *testing.T) {
+	t.Parallel()
+
+	manager := prefetch.NewManager(context.Background(), &prefetch.ManagerOptions{Concurrency: 1})
+	ids := make([]string, 0)
+	for range prefetch.MaxFinishedJobs + 2 {
+		status := manager.Start("file", nil)
+		ids = append(ids, status.ID)
+		waitForState(t, manager, status.ID, prefetch.StateDone)
+	}
+
+	jobs := manager.Jobs()
+	if len(jobs) != prefetch.MaxFinishedJobs {
+		t.Fatalf("expected %d jobs kept, got %d", prefetch.MaxFinishedJobs, len(jobs))
+	}
+	if jobs[0].ID != ids[2] || jobs[len(jobs)-1].ID != ids[len(ids)-1] {
+		t.Errorf("expected oldest jobs dropped, kept %s to %s", jobs[0].ID, jobs[len(jobs)-1].ID)
+	}
+}
+
+func TestSelectInRanges(t *testing.T) {
+	t.Parallel()
+
+	sizes := []int64{10, 10, 10, 10, 10, 10}
+	tests := []struct {
+		name     string
+		ranges   []prefetch.Range
+		margin   int
+		expected []int
+	}{
+		{"start", []prefetch.Range{{Offset: 0, Length: 15}}, 0, []int{0, 1}},
+		{"to end", []prefetch.Range{{Offset: 45}}, 0, []int{4, 5}},
+		{"multiple", []prefetch.Range{{Offset: 0, Length: 5}, {Offset: 50, Length: 10}}, 0, []int{0, 5}},
+		{"margin", []prefetch.Range{{Offset: 20, Length: 10}}, 1, []int{1, 2, 3}},
+		{"outside", []prefetch.Range{{Offset: 100, Length: 10}}, 1, []int{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			if got := prefetch.SelectInRanges(sizes, test.ranges, test.margin); !slices.Equal(got, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
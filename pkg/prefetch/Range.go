@@ -0,0 +1,35 @@
+package prefetch
+
+// Range of bytes in a file, Length 0 reaches to the end
+type Range struct {
+	Offset int64
+	Length int64
+}
+
+// SelectInRanges returns the indexes of the consecutive parts with the given sizes overlapping any range
+// margin parts are added on both sides of each range, as part-sizes might only be estimated
+func SelectInRanges(sizes []int64, ranges []Range, margin int) []int {
+	selected := make([]bool, len(sizes))
+
+	var start int64
+	for i, size := range sizes {
+		end := start + size
+		for _, r := range ranges {
+			if end > r.Offset && (r.Length <= 0 || start < r.Offset+r.Length) {
+				for j := max(0, i-margin); j <= min(len(sizes)-1, i+margin); j++ {
+					selected[j] = true
+				}
+				break
+			}
+		}
+		start = end
+	}
+
+	indexes := make([]int, 0)
+	for i, isSelected := range selected {
+		if isSelected {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
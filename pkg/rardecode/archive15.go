@@ -67,8 +67,10 @@ type archive15 struct {
 	multi     bool // archive is multi-volume
 	solid     bool // archive is a solid archive
 	encrypted bool
-	pass      []uint16              // password in UTF-16
-	keyCache  [cacheSize30]struct { // cache of previously calculated decryption keys
+	// a header was decrypted with a matching CRC, so the password is known to be right
+	headerDecrypted bool
+	pass            []uint16              // password in UTF-16
+	keyCache        [cacheSize30]struct { // cache of previously calculated decryption keys
 		salt []byte
 		key  []byte
 		iv   []byte
@@ -272,6 +274,7 @@ func (a *archive15) parseFileHeader(h *blockHeader15) (*fileBlockHeader, error)
 	f.ModificationTime = parseDosTime(b.uint32())
 	unpackver := b.byte()     // decoder version
 	method := b.byte() - 0x30 // decryption method
+	f.Stored = method == 0
 	namesize := int(b.uint16())
 	f.Attributes = int64(b.uint32())
 	if h.flags&fileLargeData > 0 {
@@ -349,6 +352,16 @@ func (a *archive15) parseFileHeader(h *blockHeader15) (*fileBlockHeader, error)
 	return f, nil
 }
 
+// headerCRCError returns the error for a block header with a bad CRC.
+// RAR 1.5 archives have no password check, so with encrypted headers a wrong
+// password only shows as a bad CRC of the first decrypted header and ErrBadPassword is returned instead.
+func (a *archive15) headerCRCError() error {
+	if a.encrypted && !a.headerDecrypted {
+		return ErrBadPassword
+	}
+	return ErrBadHeaderCRC
+}
+
 // readBlockHeader returns the next block header in the archive.
 // It will return io.EOF if there were no bytes read.
 func (a *archive15) readBlockHeader(r sliceReader) (*blockHeader15, error) {
@@ -404,7 +417,10 @@ func (a *archive15) readBlockHeader(r sliceReader) (*blockHeader15, error) {
 		_, _ = hash.Write(h.data[2:])
 	}
 	if crc != uint16(hash.Sum32()) {
-		return nil, ErrBadHeaderCRC
+		return nil, a.headerCRCError()
+	}
+	if a.encrypted {
+		a.headerDecrypted = true
 	}
 	h.data = h.data[7:]
 	if h.flags&blockHasData > 0 {
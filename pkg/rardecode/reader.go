@@ -43,6 +43,7 @@ type FileHeader struct {
 	IsDir            bool      // is a directory
 	Solid            bool      // is a solid file
 	Encrypted        bool      // is encrypted
+	Stored           bool      // is stored without compression
 	HostOS           byte      // Host OS the archive was created on
 	Attributes       int64     // Host OS specific file attributes
 	PackedSize       int64     // packed file size (or first block if the file spans volumes)
@@ -539,3 +540,28 @@ func List(name string, opts ...Option) ([]*File, error) {
 		fl = append(fl, f)
 	}
 }
+
+// ListMulti returns the FileHeaders of all files in the archive made up of the volume readers r.
+// Only block headers are read, packed file data is skipped without being decoded.
+// When the readers implement io.Seeker, skipping is done by seeking, so only the parts of
+// the volumes holding headers are actually read.
+func ListMulti(r []io.Reader, opts ...Option) ([]*FileHeader, error) {
+	pr, err := newPackedFileReader(r, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var fl []*FileHeader
+	for {
+		h, err := pr.next()
+		if err != nil {
+			if err == io.EOF {
+				return fl, nil
+			}
+			return nil, err
+		}
+
+		fh := h.FileHeader
+		fl = append(fl, &fh)
+	}
+}
@@ -1,9 +1,14 @@
 package readeratwrapper
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"sync"
+	"sync/atomic"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
 )
 
 // Taken from https://stackoverflow.com/a/40206454
@@ -11,15 +16,31 @@ import (
 type ReadSeekerAt struct {
 	mu               sync.Mutex
 	underlyingReader io.ReadSeeker
+	// Set once the native ReadAt of the ReadSeeker failed as unsupported
+	readAtUnsupported atomic.Bool
 }
 
-// Creates a new ReadSeekerAt from a ReadSeeker; Limitation: Supports only one ReadAt at a time (enforced with mutex)
-func NewReadSeekerAt(r io.ReadSeeker) io.ReaderAt {
+// Creates a new ReadSeekerAt from a ReadSeeker; The ReadSeeker's own ReadAt is used when supported, allowing concurrent reads
+// Limitation otherwise: Supports only one ReadAt at a time (enforced with mutex)
+func NewReadSeekerAt(r io.ReadSeeker) *ReadSeekerAt {
 	return &ReadSeekerAt{underlyingReader: r}
 }
 
 // ReadAt uses the ReadSeeker's Seek method to navigate and read data at a given offset.
 func (r *ReadSeekerAt) ReadAt(p []byte, off int64) (n int, err error) {
+	return r.ReadAtContext(context.Background(), p, off)
+}
+
+// ReadAtContext reads with ctx, when the ReadSeeker supports it
+func (r *ReadSeekerAt) ReadAtContext(ctx context.Context, p []byte, off int64) (n int, err error) {
+	if !r.readAtUnsupported.Load() {
+		n, err = resource.ReadAtContext(ctx, r.underlyingReader, p, off)
+		if !errors.Is(err, resource.ErrReadAtUnsupported) {
+			return n, err
+		}
+		r.readAtUnsupported.Store(true)
+	}
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -28,7 +49,7 @@ func (r *ReadSeekerAt) ReadAt(p []byte, off int64) (n int, err error) {
 		return 0, fmt.Errorf("failed seeking: %w", err)
 	}
 
-	n, err = r.underlyingReader.Read(p)
+	n, err = resource.ReadContext(ctx, r.underlyingReader, p)
 
 	return n, err
 }
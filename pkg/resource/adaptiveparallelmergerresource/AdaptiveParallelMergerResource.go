@@ -17,17 +17,28 @@ import (
 // It reads underlying sources in parallel and can handle their size to be unknown.
 type AdaptiveParallelMergerResource struct {
 	resources []resource.ReadSeekCloseableResource
+	// How many underlying readers are kept open per reader
+	openWindow int
 }
 
 func NewAdaptiveParallelMergerResource(resources []resource.ReadSeekCloseableResource) *AdaptiveParallelMergerResource {
 	return &AdaptiveParallelMergerResource{
-		resources: resources,
+		resources:  resources,
+		openWindow: resource.DefaultOpenWindow,
 	}
 }
 
+// SetOpenWindow sets how many underlying readers are kept open per reader, others are opened when read
+func (r *AdaptiveParallelMergerResource) SetOpenWindow(window int) {
+	r.openWindow = window
+}
+
 type AdaptiveParallelMergerResourceReader struct {
-	resource    *AdaptiveParallelMergerResource
-	readers     []io.ReadSeekCloser
+	resource *AdaptiveParallelMergerResource
+	readers  *resource.LazyReaders
+	// Cancelled on Close, aborting reads still running
+	ctx         context.Context
+	cancel      context.CancelFunc
 	mutex       sync.RWMutex
 	readerGroup errgroup.Group
 	// Position in data
@@ -38,20 +49,14 @@ type AdaptiveParallelMergerResourceReader struct {
 	readerByteIndex int64
 }
 
-// Open prepares buffers and eagerly opens all underlying Resources
+// Open opens the underlying Resources lazily, once their range is read
 func (r *AdaptiveParallelMergerResource) Open() (io.ReadSeekCloser, error) {
-	readers := make([]io.ReadSeekCloser, len(r.resources))
-	var err error
-	for i, resource := range r.resources {
-		readers[i], err = resource.Open()
-		if err != nil {
-			return nil, fmt.Errorf("failed opening resource %d: %w", i, err)
-		}
-	}
-
+	ctx, cancel := context.WithCancel(context.Background())
 	return &AdaptiveParallelMergerResourceReader{
 		resource:        r,
-		readers:         readers,
+		readers:         resource.NewLazyReaders(r.resources, r.openWindow),
+		ctx:             ctx,
+		cancel:          cancel,
 		index:           0,
 		readerIndex:     0,
 		readerByteIndex: 0,
@@ -76,17 +81,27 @@ type readResponse struct {
 	readerIndex     int
 	readerByteIndex int64
 	buffer          []byte
-	n               int
-	err             error
+	// buffer is the part of p it belongs to, so nothing needs to be copied; Filled up to n
+	direct bool
+	n      int
+	err    error
 }
 
 func (r *AdaptiveParallelMergerResourceReader) Read(p []byte) (int, error) {
+	return r.ReadContext(context.Background(), p)
+}
+
+// ReadContext passes ctx to the underlying readers, reads still running after returning are aborted when ctx is done or on Close
+func (r *AdaptiveParallelMergerResourceReader) ReadContext(ctx context.Context, p []byte) (int, error) {
 	if len(p) == 0 {
 		return 0, nil
 	}
 
 	r.mutex.Lock()
 
+	underlyingCtx, underlyingCtxDone := context.WithCancel(ctx)
+	stopAfterClose := context.AfterFunc(r.ctx, underlyingCtxDone)
+
 	totalRead := 0
 	expectedTotalRead := 0
 
@@ -103,18 +118,32 @@ func (r *AdaptiveParallelMergerResourceReader) Read(p []byte) (int, error) {
 	activeReaders := 0
 	processIndex := 0
 
+	// While all sizes up to here are accurate, the position in p is known and readers write directly into it
+	directPossible := true
+	lastDirectReadIndex := -1
+
 	// Unlock mutex, when group finished
 	// TODO: Maybe its possible to only block affected readers separately not to halt all activity? Might not be that critical though
 	defer func() {
+		// Direct readers still running would write into p after returning, abort and wait for them
+		if processIndex <= lastDirectReadIndex {
+			underlyingCtxDone()
+			group.Wait()
+		}
+
 		// When already everything processed, dont start goroutine
 		if processIndex >= len(responses) {
 			defer r.mutex.Unlock()
+			defer stopAfterClose()
+			defer underlyingCtxDone()
 			// group should have finished, in case it hasnt, wait
 			group.Wait()
 			return
 		}
 		go func() {
 			defer r.mutex.Unlock()
+			defer stopAfterClose()
+			defer underlyingCtxDone()
 
 			// Function to process responses
 			processResponses := func() {
@@ -129,7 +158,7 @@ func (r *AdaptiveParallelMergerResourceReader) Read(p []byte) (int, error) {
 					response := responses[processIndex]
 
 					// Read has concluded, seek back
-					r.readers[response.readerIndex].Seek(0, io.SeekStart)
+					r.readers.Reader(response.readerIndex).Seek(0, io.SeekStart)
 
 					// Delete to skip in the next step
 					responses[processIndex] = nil
@@ -149,7 +178,7 @@ func (r *AdaptiveParallelMergerResourceReader) Read(p []byte) (int, error) {
 	}()
 
 	// Start readers
-	for expectedTotalRead < len(p) && r.readerIndex < len(r.readers) {
+	for expectedTotalRead < len(p) && r.readerIndex < r.readers.Len() {
 		requiredRead := len(p) - expectedTotalRead
 
 		resourceSize, err := r.resource.resources[r.readerIndex].Size()
@@ -163,6 +192,16 @@ func (r *AdaptiveParallelMergerResourceReader) Read(p []byte) (int, error) {
 			resourceSizeLeft = 0
 		}
 
+		sizeAccurateResource, ok := r.resource.resources[r.readerIndex].(resource.SizeAccurateResource)
+		sizeAccurate := ok && sizeAccurateResource.IsSizeAccurate()
+
+		// Fully read with accurate size, nothing left to expect from it
+		if resourceSizeLeft == 0 && sizeAccurate {
+			r.readerIndex++
+			r.readerByteIndex = 0
+			continue
+		}
+
 		// Expect either full resource or part up to whatever is expected to be needed at this point
 		expectedRead := resourceSizeLeft
 		if requiredRead < expectedRead {
@@ -181,6 +220,14 @@ func (r *AdaptiveParallelMergerResourceReader) Read(p []byte) (int, error) {
 			expectedRead = 1
 		}
 
+		var direct []byte
+		if directPossible && sizeAccurate {
+			direct = p[expectedTotalRead : expectedTotalRead+expectedRead]
+			lastDirectReadIndex = readIndex
+		} else {
+			directPossible = false
+		}
+
 		expectedTotalRead += expectedRead
 
 		// Copy non-local vars to local stack for goroutine
@@ -197,24 +244,42 @@ func (r *AdaptiveParallelMergerResourceReader) Read(p []byte) (int, error) {
 			r.readerByteIndex = 0
 		}
 
+		if direct != nil {
+			group.Go(func() error {
+				n, err := readFull(underlyingCtx, r.readers.Reader(readerIndex), direct)
+
+				responsesLock.RLock()
+				responses[localReadIndex] = &readResponse{
+					index:           localReadIndex,
+					readerIndex:     readerIndex,
+					readerByteIndex: readerByteIndex,
+					buffer:          direct,
+					direct:          true,
+					n:               n,
+					err:             err,
+				}
+				responsesLock.RUnlock()
+				responsesCond.Signal()
+				return nil
+			})
+			continue
+		}
+
 		group.Go(func() error {
 			// Check if resource supports size accuracy reporting
 			sizeAccurateResource, sizeAccurateResourceOk := r.resource.resources[readerIndex].(resource.SizeAccurateResource)
-			// TODO: Support writing directly to p if supported (all previous readers also need to have accurate resource)
 			buf := make([]byte, expectedRead)
 			totalN := 0
 			var n int
 			var err error
 			var prevNCount int
 			for {
-				// Check if job is cancelled while before next read
-				select {
-				case <-readCtx.Done():
+				// Check if read is aborted before next read
+				if err = underlyingCtx.Err(); err != nil {
 					break
-				default:
 				}
 
-				n, err = r.readers[readerIndex].Read(buf[totalN:])
+				n, err = resource.ReadContext(underlyingCtx, r.readers.Reader(readerIndex), buf[totalN:])
 				totalN += n
 
 				// If underlyingResource supports accuracy reporting and its accurate, single read suffices
@@ -265,6 +330,11 @@ func (r *AdaptiveParallelMergerResourceReader) Read(p []byte) (int, error) {
 		})
 	}
 
+	// All readers were already fully read
+	if len(responses) == 0 {
+		return 0, io.EOF
+	}
+
 	// Process responses
 	for processIndex < len(responses) {
 		responsesLock.Lock()
@@ -283,6 +353,21 @@ func (r *AdaptiveParallelMergerResourceReader) Read(p []byte) (int, error) {
 
 		actualRead := response.n
 
+		if response.direct {
+			// Already in place, as all responses before were exactly as expected
+			totalRead += actualRead
+			r.index += int64(actualRead)
+			r.readerIndex = response.readerIndex
+			r.readerByteIndex = response.readerByteIndex + int64(actualRead)
+			processIndex++
+
+			// When it came up short, the following direct responses arent where they belong, so stop here
+			if actualRead < len(response.buffer) || totalRead == len(p) {
+				break
+			}
+			continue
+		}
+
 		// Copy data to p
 		if totalRead < len(p) {
 			copied := copy(p[totalRead:], response.buffer[:actualRead])
@@ -295,7 +380,7 @@ func (r *AdaptiveParallelMergerResourceReader) Read(p []byte) (int, error) {
 			// TODO: Also move this into deferred group-finish action to not have to wait for seek?
 			if copied < actualRead {
 				// When not all was copied, we filled p, the rest is too much
-				_, err := r.readers[response.readerIndex].Seek(int64(copied), io.SeekStart)
+				_, err := r.readers.Reader(response.readerIndex).Seek(int64(copied), io.SeekStart)
 				if err != nil {
 					return totalRead, fmt.Errorf("failed seeking reader %d back to %d: %w", response.readerIndex, r.readerByteIndex, err)
 				}
@@ -327,7 +412,7 @@ func (r *AdaptiveParallelMergerResourceReader) Read(p []byte) (int, error) {
 		}*/
 
 		// When last response was from last actual reader
-		if lastReadResponse.readerIndex == len(r.readers)-1 && lastReadResponse.err != nil {
+		if lastReadResponse.readerIndex == r.readers.Len()-1 && lastReadResponse.err != nil {
 			err = lastReadResponse.err
 		}
 	}
@@ -335,18 +420,89 @@ func (r *AdaptiveParallelMergerResourceReader) Read(p []byte) (int, error) {
 	return totalRead, err
 }
 
+func (r *AdaptiveParallelMergerResourceReader) ReadAt(p []byte, off int64) (int, error) {
+	return r.ReadAtContext(context.Background(), p, off)
+}
+
+// ReadAtContext reads the underlying readers at their offsets in parallel, without touching the position of Read
+// Offsets depend on the sizes before, so readers up to the end of the read with inaccurate sizes are loaded first
+func (r *AdaptiveParallelMergerResourceReader) ReadAtContext(ctx context.Context, p []byte, off int64) (int, error) {
+	loaded := make(map[int]bool)
+	for {
+		sizes, inaccurate, err := r.sizesUpTo(off + int64(len(p)))
+		if err != nil {
+			return 0, err
+		}
+
+		// Readers staying inaccurate after loading are taken as they are
+		toLoad := make([]int, 0, len(inaccurate))
+		for _, i := range inaccurate {
+			if !loaded[i] {
+				toLoad = append(toLoad, i)
+				loaded[i] = true
+			}
+		}
+		if len(toLoad) == 0 {
+			part := func(i int) io.Reader {
+				return r.readers.Reader(i)
+			}
+			return resource.ReadAtParts(ctx, part, resource.NewOffsetIndex(sizes), p, off)
+		}
+
+		if err := r.loadReaders(ctx, toLoad); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// sizesUpTo returns the sizes of all resources and which ones starting before end have an inaccurate size
+func (r *AdaptiveParallelMergerResourceReader) sizesUpTo(end int64) ([]int64, []int, error) {
+	sizes := make([]int64, len(r.resource.resources))
+	inaccurate := make([]int, 0)
+	var start int64
+	for i, underlying := range r.resource.resources {
+		size, err := underlying.Size()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed getting size from resource %d: %w", i, err)
+		}
+		sizes[i] = size
+
+		if start < end {
+			if sizeAccurateResource, ok := underlying.(resource.SizeAccurateResource); ok && !sizeAccurateResource.IsSizeAccurate() {
+				inaccurate = append(inaccurate, i)
+			}
+		}
+		start += size
+	}
+	return sizes, inaccurate, nil
+}
+
+// loadReaders reads the start of the readers in parallel, which gets their accurate size
+func (r *AdaptiveParallelMergerResourceReader) loadReaders(ctx context.Context, readerIndexes []int) error {
+	group, groupCtx := errgroup.WithContext(ctx)
+	for _, i := range readerIndexes {
+		group.Go(func() error {
+			_, err := resource.ReadAtContext(groupCtx, r.readers.Reader(i), make([]byte, 1), 0)
+			if err != nil && !errors.Is(err, io.EOF) {
+				return fmt.Errorf("failed loading reader %d: %w", i, err)
+			}
+			return nil
+		})
+	}
+	//nolint:wrapcheck // Errors are wrapped in the group
+	return group.Wait()
+}
+
 func (r *AdaptiveParallelMergerResourceReader) Close() error {
-	// TODO: Cancel everything immediately on close
+	// Abort running reads, so the mutex is released early
+	r.cancel()
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	for i, reader := range r.readers {
-		err := reader.Close()
-		if err != nil {
-			return fmt.Errorf("failed closing reader %d: %w", i, err)
-		}
+	err := r.readers.Close()
+	if err != nil {
+		return fmt.Errorf("failed closing readers: %w", err)
 	}
-	r.readers = nil
 	return nil
 }
 
@@ -414,9 +570,9 @@ func (r *AdaptiveParallelMergerResourceReader) seekForwards(seekAmount int64) er
 	responsesLock := &sync.RWMutex{}
 	responsesCond := sync.NewCond(responsesLock)
 
-	for totalSeeked < seekAmount && readerIndex < len(r.readers) {
-		for expectedTotalSeek < seekAmount && readerIndex < len(r.readers) {
-			reader := r.readers[readerIndex]
+	for totalSeeked < seekAmount && readerIndex < r.readers.Len() {
+		for expectedTotalSeek < seekAmount && readerIndex < r.readers.Len() {
+			reader := r.readers.Reader(readerIndex)
 			resource := r.resource.resources[readerIndex]
 
 			resourceSizeHint, err := resource.Size()
@@ -485,7 +641,7 @@ func (r *AdaptiveParallelMergerResourceReader) seekForwards(seekAmount int64) er
 						// If reader is still current one, add its readerByteIndex
 						seekOffset += r.readerByteIndex
 					}
-					_, err := r.readers[response.readerIndex].Seek(seekOffset, io.SeekStart)
+					_, err := r.readers.Reader(response.readerIndex).Seek(seekOffset, io.SeekStart)
 					if err != nil {
 						return fmt.Errorf("failed to SeekStart resource %d to %d bytes: %w", response.readerIndex, seekOffset, err)
 					}
@@ -497,7 +653,7 @@ func (r *AdaptiveParallelMergerResourceReader) seekForwards(seekAmount int64) er
 				}
 			} else {
 				// Already reached, seek reader back
-				_, err := r.readers[response.readerIndex].Seek(0, io.SeekStart)
+				_, err := r.readers.Reader(response.readerIndex).Seek(0, io.SeekStart)
 				if err != nil {
 					return fmt.Errorf("failed to SeekStart resource %d to %d bytes: %w", response.readerIndex, 0, err)
 				}
@@ -548,7 +704,7 @@ func (r *AdaptiveParallelMergerResourceReader) seekBackwards(seekAmount int64) e
 
 	for (totalSeeked < seekAmount && readerIndex >= 0) || processIndex < len(responses) {
 		for expectedTotalSeek < seekAmount && readerIndex >= 0 {
-			reader := r.readers[readerIndex]
+			reader := r.readers.Reader(readerIndex)
 			resource := r.resource.resources[readerIndex]
 
 			resourceSizeHint, err := resource.Size()
@@ -610,7 +766,7 @@ func (r *AdaptiveParallelMergerResourceReader) seekBackwards(seekAmount int64) e
 				if totalSeeked >= seekAmount {
 					// Seek affected reader back
 					seekPos := totalSeeked - seekAmount
-					_, err := r.readers[response.readerIndex].Seek(seekPos, io.SeekStart)
+					_, err := r.readers.Reader(response.readerIndex).Seek(seekPos, io.SeekStart)
 					if err != nil {
 						return fmt.Errorf("failed to SeekStart resource %d to %d bytes: %w", response.readerIndex, seekPos, err)
 					}
@@ -621,7 +777,7 @@ func (r *AdaptiveParallelMergerResourceReader) seekBackwards(seekAmount int64) e
 					r.index -= seekAmount
 				} else {
 					// Otherwise seek to 0
-					_, err := r.readers[response.readerIndex].Seek(0, io.SeekStart)
+					_, err := r.readers.Reader(response.readerIndex).Seek(0, io.SeekStart)
 					if err != nil {
 						return fmt.Errorf("failed to SeekStart resource %d to %d bytes: %w", response.readerIndex, 0, err)
 					}
@@ -643,9 +799,9 @@ func (r *AdaptiveParallelMergerResourceReader) seekToEnd() error {
 	var seekAmountAtomic atomic.Int64
 	seekAmountAtomic.Add(-r.readerByteIndex)
 
-	for i := r.readerIndex; i < len(r.readers); i++ {
+	for i := r.readerIndex; i < r.readers.Len(); i++ {
 		r.readerGroup.Go(func() error {
-			size, err := r.readers[i].Seek(0, io.SeekEnd)
+			size, err := r.readers.Reader(i).Seek(0, io.SeekEnd)
 			if err != nil {
 				//nolint:wrapcheck // Error is handled outside
 				return err
@@ -653,7 +809,7 @@ func (r *AdaptiveParallelMergerResourceReader) seekToEnd() error {
 			seekAmountAtomic.Add(size)
 
 			// Last reader sets readerByteIndex
-			if i == len(r.readers)-1 {
+			if i == r.readers.Len()-1 {
 				r.readerByteIndex = size
 			}
 
@@ -666,7 +822,7 @@ func (r *AdaptiveParallelMergerResourceReader) seekToEnd() error {
 		return fmt.Errorf("failed seeking all readers to end: %w", err)
 	}
 
-	r.readerIndex = len(r.readers) - 1
+	r.readerIndex = r.readers.Len() - 1
 	r.index += seekAmountAtomic.Load()
 
 	return nil
@@ -684,3 +840,27 @@ func (r *AdaptiveParallelMergerResource) IsSizeAccurate() bool {
 	}
 	return true
 }
+
+// readFull reads until p is full, EOF or an error occurred
+func readFull(ctx context.Context, reader io.Reader, p []byte) (int, error) {
+	totalN := 0
+	noProgressCount := 0
+	for totalN < len(p) {
+		n, err := resource.ReadContext(ctx, reader, p[totalN:])
+		totalN += n
+		if err != nil {
+			return totalN, err //nolint:wrapcheck // Passed on as the readers error
+		}
+
+		// If we read nothing 3 times consecutively with no error, stop with error
+		if n == 0 {
+			noProgressCount++
+			if noProgressCount >= 3 {
+				return totalN, io.ErrNoProgress
+			}
+		} else {
+			noProgressCount = 0
+		}
+	}
+	return totalN, nil
+}
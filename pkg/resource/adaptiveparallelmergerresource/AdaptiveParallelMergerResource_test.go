@@ -2,8 +2,12 @@ package adaptiveparallelmergerresource_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"testing"
+	"time"
 
 	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
 	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/adaptiveparallelmergerresource"
@@ -378,3 +382,205 @@ func TestSeekBackward(t *testing.T) {
 		return
 	}
 }
+
+// blockingResource blocks reads until their ctx is done, like a stalled download
+type blockingResource struct{}
+
+func (r *blockingResource) Open() (io.ReadSeekCloser, error) {
+	return &blockingResourceReader{}, nil
+}
+
+func (r *blockingResource) Size() (int64, error) {
+	return 5, nil
+}
+
+type blockingResourceReader struct{}
+
+func (r *blockingResourceReader) Read(p []byte) (int, error) {
+	return r.ReadContext(context.Background(), p)
+}
+
+func (r *blockingResourceReader) ReadContext(ctx context.Context, p []byte) (int, error) {
+	<-ctx.Done()
+	return 0, ctx.Err()
+}
+
+func (r *blockingResourceReader) Seek(offset int64, whence int) (int64, error) {
+	return 0, nil
+}
+
+func (r *blockingResourceReader) Close() error {
+	return nil
+}
+
+func TestAdaptiveParallelMergerResourceReadContext(t *testing.T) {
+	t.Parallel()
+
+	resources := []resource.ReadSeekCloseableResource{
+		&bytesresource.BytesResource{Content: []byte("Hello")},
+		&blockingResource{},
+	}
+
+	reader, err := adaptiveparallelmergerresource.NewAdaptiveParallelMergerResource(resources).Open()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = resource.ReadContext(ctx, reader, make([]byte, 10))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	if err := reader.Close(); err != nil {
+		t.Errorf("unexpected error closing: %v", err)
+	}
+}
+
+func TestAdaptiveParallelMergerResourceReadAt(t *testing.T) {
+	t.Parallel()
+
+	resources := []resource.ReadSeekCloseableResource{
+		&bytesresource.BytesResource{Content: []byte("Hel")},
+		&bytesresource.BytesResource{Content: []byte("lo")},
+		&bytesresource.BytesResource{Content: []byte("World")},
+	}
+
+	reader, err := adaptiveparallelmergerresource.NewAdaptiveParallelMergerResource(resources).Open()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer reader.Close()
+	readerAt := reader.(io.ReaderAt)
+
+	buf := make([]byte, 5)
+	n, err := readerAt.ReadAt(buf, 2)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if string(buf[:n]) != "lloWo" {
+		t.Errorf("expected %q, got %q", "lloWo", buf[:n])
+	}
+
+	n, err = readerAt.ReadAt(buf, 7)
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("expected EOF, got %v", err)
+	}
+	if string(buf[:n]) != "rld" {
+		t.Errorf("expected %q, got %q", "rld", buf[:n])
+	}
+}
+
+func BenchmarkAdaptiveParallelMergerResourceRead(b *testing.B) {
+	// Segments about the size of usual articles
+	segmentSize := 768 * 1024
+	segmentCount := 16
+	resources := make([]resource.ReadSeekCloseableResource, segmentCount)
+	for i := range resources {
+		resources[i] = NewTestResouce(make([]byte, segmentSize), int64(segmentSize))
+	}
+	totalSize := int64(segmentSize * segmentCount)
+
+	// Read-sizes as requested by FUSE and WebDAV-copying
+	for _, bufSize := range []int{128 * 1024, 1024 * 1024, 4 * 1024 * 1024} {
+		b.Run(fmt.Sprintf("buf=%dKiB", bufSize/1024), func(b *testing.B) {
+			reader, err := adaptiveparallelmergerresource.NewAdaptiveParallelMergerResource(resources).Open()
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer reader.Close()
+			buf := make([]byte, bufSize)
+
+			b.SetBytes(totalSize)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				if _, err := reader.Seek(0, io.SeekStart); err != nil {
+					b.Fatal(err)
+				}
+				var total int64
+				for {
+					n, err := reader.Read(buf)
+					total += int64(n)
+					if errors.Is(err, io.EOF) {
+						break
+					}
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+				if total != totalSize {
+					b.Fatalf("expected to read %d, got %d", totalSize, total)
+				}
+			}
+		})
+	}
+}
+
+// shortReadResource has an accurate size, but its reader returns at most 2 bytes per Read
+type shortReadResource struct {
+	bytesresource.BytesResource
+}
+
+type shortReadResourceReader struct {
+	io.ReadSeekCloser
+}
+
+func (r *shortReadResource) Open() (io.ReadSeekCloser, error) {
+	reader, err := r.BytesResource.Open()
+	return &shortReadResourceReader{ReadSeekCloser: reader}, err
+}
+
+func (r *shortReadResource) IsSizeAccurate() bool {
+	return true
+}
+
+func (r *shortReadResourceReader) Read(p []byte) (int, error) {
+	if len(p) > 2 {
+		p = p[:2]
+	}
+	return r.ReadSeekCloser.Read(p)
+}
+
+func TestAdaptiveParallelMergerResourceDirectRead(t *testing.T) {
+	t.Parallel()
+
+	content := "Hello, direct World!"
+	resources := []resource.ReadSeekCloseableResource{
+		&shortReadResource{bytesresource.BytesResource{Content: []byte(content[:5])}},
+		&shortReadResource{bytesresource.BytesResource{Content: []byte(content[5:12])}},
+		&shortReadResource{bytesresource.BytesResource{Content: []byte(content[12:])}},
+	}
+
+	reader, err := adaptiveparallelmergerresource.NewAdaptiveParallelMergerResource(resources).Open()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer reader.Close()
+
+	// Reads spanning and ending at segment-boundaries
+	for _, bufSize := range []int{5, 7, 3, 100} {
+		if _, err := reader.Seek(0, io.SeekStart); err != nil {
+			t.Fatalf("failed to seek: %v", err)
+		}
+
+		buf := new(bytes.Buffer)
+		p := make([]byte, bufSize)
+		for {
+			n, err := reader.Read(p)
+			buf.Write(p[:n])
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		if buf.String() != content {
+			t.Errorf("expected content %q with buffer of %d, got %q", content, bufSize, buf.String())
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package adaptivereadaheadcache
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -47,6 +48,13 @@ type AdaptiveReadaheadCacheReader struct {
 	cache               *circularbuffer.CircularBuffer[byte]
 	mutex               sync.RWMutex
 	readaheadRunning    atomic.Bool
+	// Aborts reading ahead, cancelled on Close
+	ctx    context.Context
+	cancel context.CancelFunc
+	// ReadAt: Serializes reads through the readahead, where they ended and where the last direct read ended
+	sequentialMutex sync.Mutex
+	sequentialEnd   atomic.Int64
+	directEnd       atomic.Int64
 }
 
 type readHistoryEntry struct {
@@ -55,6 +63,13 @@ type readHistoryEntry struct {
 }
 
 func (r *AdaptiveReadaheadCache) Open() (io.ReadSeekCloser, error) {
+	return r.OpenContext(context.Background())
+}
+
+var _ resource.ContextResource = (*AdaptiveReadaheadCache)(nil)
+
+// OpenContext opens a reader, which stops reading ahead when ctx is done
+func (r *AdaptiveReadaheadCache) OpenContext(ctx context.Context) (io.ReadSeekCloser, error) {
 	underlyingReader, err := r.underlyingResource.Open()
 	if err != nil {
 		return nil, fmt.Errorf("failed opening underlying resource: %w", err)
@@ -63,11 +78,14 @@ func (r *AdaptiveReadaheadCache) Open() (io.ReadSeekCloser, error) {
 	cache := circularbuffer.NewCircularBuffer[byte](r.cacheMinSize, r.cacheMaxSize)
 	cache.SetReadBlocking(true)
 
+	readerCtx, cancel := context.WithCancel(ctx)
 	return &AdaptiveReadaheadCacheReader{
 		resource:         r,
 		underlyingReader: underlyingReader,
 		readHistory:      make([]readHistoryEntry, 0, int(r.cacheAvgSpeedTime.Seconds())),
 		cache:            cache,
+		ctx:              readerCtx,
+		cancel:           cancel,
 	}, nil
 }
 
@@ -80,6 +98,8 @@ func (r *AdaptiveReadaheadCache) Size() (int64, error) {
 }
 
 func (r *AdaptiveReadaheadCacheReader) Close() error {
+	// Abort a running readahead, so the mutex is released early
+	r.cancel()
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
@@ -130,19 +150,26 @@ func (r *AdaptiveReadaheadCacheReader) Seek(offset int64, whence int) (int64, er
 		return r.index, nil
 	}
 
-	newIndex, err := r.underlyingReader.Seek(offset, whence)
-	if err != nil {
-		return -1, fmt.Errorf("failed seeking underlying reader: %w", err)
-	}
-
-	indexDelta := newIndex - r.index
-	cacheValid := r.trySeekCache(indexDelta)
+	// Skipping forward within what was read ahead keeps the underlying reader where it is
+	cacheValid := whence != io.SeekEnd && r.trySeekCache(newIndex-r.index)
 
 	if !cacheValid {
+		var err error
+		if whence == io.SeekEnd {
+			newIndex, err = r.underlyingReader.Seek(offset, whence)
+		} else {
+			// Underlying reader is ahead by what was read ahead, so seek absolute
+			newIndex, err = r.underlyingReader.Seek(newIndex, io.SeekStart)
+		}
+		if err != nil {
+			return -1, fmt.Errorf("failed seeking underlying reader: %w", err)
+		}
+
 		if err := r.clearCache(); err != nil {
 			return 0, fmt.Errorf("failed to clear cache during seek: %w", err)
 		}
 		r.underlyingReaderEOF = false
+		r.cache.SetReadBlocking(true)
 	}
 
 	if !r.underlyingReaderEOF && r.readaheadRunning.CompareAndSwap(false, true) {
@@ -162,13 +189,18 @@ func (r *AdaptiveReadaheadCacheReader) clearCache() error {
 }
 
 func (r *AdaptiveReadaheadCacheReader) Read(p []byte) (int, error) {
+	return r.ReadContext(context.Background(), p)
+}
+
+// ReadContext aborts waiting for the readahead when ctx is done, the readahead itself continues until Close or the ctx of OpenContext is done
+func (r *AdaptiveReadaheadCacheReader) ReadContext(ctx context.Context, p []byte) (int, error) {
 	r.recordRead(int64(len(p)))
 	if !r.underlyingReaderEOF && r.readaheadRunning.CompareAndSwap(false, true) {
 		go r.readahead()
 	}
 
 	// Try to fulfill the read request from the cache
-	n, err := r.cache.Read(p)
+	n, err := r.cache.ReadContext(ctx, p)
 	r.index += int64(n)
 	if err != nil && !errors.Is(err, io.EOF) {
 		if errors.Is(err, io.EOF) {
@@ -186,6 +218,53 @@ func (r *AdaptiveReadaheadCacheReader) Read(p []byte) (int, error) {
 	return n, err
 }
 
+func (r *AdaptiveReadaheadCacheReader) ReadAt(p []byte, off int64) (int, error) {
+	return r.ReadAtContext(context.Background(), p, off)
+}
+
+// ReadAtContext serves reads following the readahead from its buffer, others are read directly from the underlying reader in parallel
+// A read continuing the previous direct one moves the readahead there; Underlying readers not supporting ReadAt are always read through the readahead
+// Must not be mixed with Read and Seek
+func (r *AdaptiveReadaheadCacheReader) ReadAtContext(ctx context.Context, p []byte, off int64) (int, error) {
+	if !r.followsReadahead(off) {
+		n, err := resource.ReadAtContext(ctx, r.underlyingReader, p, off)
+		if !errors.Is(err, resource.ErrReadAtUnsupported) {
+			r.directEnd.Store(off + int64(n))
+			return n, err
+		}
+	}
+
+	r.sequentialMutex.Lock()
+	defer r.sequentialMutex.Unlock()
+
+	if _, err := r.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for total < len(p) {
+		n, err := r.ReadContext(ctx, p[total:])
+		total += n
+		r.sequentialEnd.Store(off + int64(total))
+		if err != nil {
+			return total, err
+		}
+		if n == 0 {
+			return total, io.ErrNoProgress
+		}
+	}
+	return total, nil
+}
+
+// followsReadahead tells if off is within what was read ahead, or continues the last direct read
+func (r *AdaptiveReadaheadCacheReader) followsReadahead(off int64) bool {
+	if off == r.directEnd.Load() {
+		return true
+	}
+	sequentialEnd := r.sequentialEnd.Load()
+	return off >= sequentialEnd && off <= sequentialEnd+int64(r.cache.GetSize())
+}
+
 func (r *AdaptiveReadaheadCacheReader) recordRead(bytesRead int64) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
@@ -279,7 +358,7 @@ func (r *AdaptiveReadaheadCacheReader) readahead() error {
 
 	// Directly read into buffer
 	exposedBuffer := r.cache.ExposeWriteSpace()
-	n, err := r.underlyingReader.Read(exposedBuffer)
+	n, err := resource.ReadContext(r.ctx, r.underlyingReader, exposedBuffer)
 
 	// Immediately commit the result (even if n==0) so that the cache unblocks waiting reads:
 	if commitErr := r.cache.CommitWrite(n); commitErr != nil {
@@ -289,6 +368,8 @@ func (r *AdaptiveReadaheadCacheReader) readahead() error {
 	if err != nil {
 		if errors.Is(err, io.EOF) {
 			r.underlyingReaderEOF = true
+			// Nothing more will be read ahead, so reads waiting for it can return
+			r.cache.SetReadBlocking(false)
 			return io.EOF
 		} else {
 			return fmt.Errorf("failed reading from underlying reader: %w", err)
@@ -237,3 +237,39 @@ func TestAdaptiveReadaheadCacheSequentialReadWriteSeek(t *testing.T) {
 		t.Errorf("expected 'Hello', got %q", string(buf))
 	}
 }
+
+func TestAdaptiveReadaheadCacheReadAt(t *testing.T) {
+	t.Parallel()
+
+	content := "Hello, World! Hello, Readahead!"
+	res := bytesresource.BytesResource{Content: []byte(content)}
+	arc := adaptivereadaheadcache.NewAdaptiveReadaheadCache(&res, time.Second, time.Second*2, 5, 20, 10)
+
+	reader, err := arc.Open()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer reader.Close()
+	readerAt := reader.(io.ReaderAt)
+
+	// Sequential reads through the readahead, a random one in between directly
+	for _, off := range []int64{0, 5, 20, 10, 15} {
+		buf := make([]byte, 5)
+		n, err := readerAt.ReadAt(buf, off)
+		if err != nil {
+			t.Fatalf("unexpected error at %d: %v", off, err)
+		}
+		if expected := content[off : off+5]; string(buf[:n]) != expected {
+			t.Errorf("expected %q at %d, got %q", expected, off, buf[:n])
+		}
+	}
+
+	buf := make([]byte, 10)
+	n, err := readerAt.ReadAt(buf, 25)
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("expected EOF, got %v", err)
+	}
+	if expected := content[25:]; string(buf[:n]) != expected {
+		t.Errorf("expected %q, got %q", expected, buf[:n])
+	}
+}
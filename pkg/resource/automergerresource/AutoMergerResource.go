@@ -0,0 +1,65 @@
+package automergerresource
+
+import (
+	"io"
+	"sync/atomic"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/adaptiveparallelmergerresource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/parallelmergerresource"
+)
+
+// AutoMergerResource is a Resource type which allows combining multiple Resources as if it was one.
+// It chooses the merger on every Open: When the sizes of all resources are accurate the ParallelMergerResource with its offset-index,
+// otherwise the AdaptiveParallelMergerResource handling unknown sizes; So readers switch, once all sizes became known
+type AutoMergerResource struct {
+	resources []resource.ReadSeekCloseableResource
+	exact     *parallelmergerresource.ParallelMergerResource
+	adaptive  *adaptiveparallelmergerresource.AdaptiveParallelMergerResource
+	// Accurate sizes dont become inaccurate again, so they are only checked until they are
+	sizesAccurate atomic.Bool
+}
+
+func NewAutoMergerResource(resources []resource.ReadSeekCloseableResource) *AutoMergerResource {
+	return &AutoMergerResource{
+		resources: resources,
+		exact:     parallelmergerresource.NewParallelMergerResource(resources),
+		adaptive:  adaptiveparallelmergerresource.NewAdaptiveParallelMergerResource(resources),
+	}
+}
+
+// SetOpenWindow sets how many underlying readers are kept open per reader, others are opened when read
+func (r *AutoMergerResource) SetOpenWindow(window int) {
+	r.exact.SetOpenWindow(window)
+	r.adaptive.SetOpenWindow(window)
+}
+
+func (r *AutoMergerResource) Open() (io.ReadSeekCloser, error) {
+	if r.IsSizeAccurate() {
+		return r.exact.Open()
+	}
+	return r.adaptive.Open()
+}
+
+func (r *AutoMergerResource) Size() (int64, error) {
+	if r.IsSizeAccurate() {
+		return r.exact.Size()
+	}
+	return r.adaptive.Size()
+}
+
+// IsSizeAccurate when all resources report their size as accurate
+func (r *AutoMergerResource) IsSizeAccurate() bool {
+	if r.sizesAccurate.Load() {
+		return true
+	}
+
+	for _, underlying := range r.resources {
+		sizeAccurateResource, ok := underlying.(resource.SizeAccurateResource)
+		if !ok || !sizeAccurateResource.IsSizeAccurate() {
+			return false
+		}
+	}
+	r.sizesAccurate.Store(true)
+	return true
+}
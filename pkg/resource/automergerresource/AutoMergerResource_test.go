@@ -0,0 +1,102 @@
+package automergerresource_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/adaptiveparallelmergerresource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/automergerresource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/bytesresource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/parallelmergerresource"
+)
+
+type TestResource struct {
+	bytesresource.BytesResource
+	sizeAccurate bool
+}
+
+func (r *TestResource) IsSizeAccurate() bool {
+	return r.sizeAccurate
+}
+
+func readAll(t *testing.T, reader io.Reader) string {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	_, err := buf.ReadFrom(reader)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	return buf.String()
+}
+
+func TestAutoMergerResourceSwitchesToExact(t *testing.T) {
+	t.Parallel()
+
+	last := &TestResource{BytesResource: bytesresource.BytesResource{Content: []byte("World")}}
+	resources := []resource.ReadSeekCloseableResource{
+		&TestResource{BytesResource: bytesresource.BytesResource{Content: []byte("Hello")}, sizeAccurate: true},
+		last,
+	}
+	merger := automergerresource.NewAutoMergerResource(resources)
+
+	if merger.IsSizeAccurate() {
+		t.Errorf("expected size to be inaccurate")
+	}
+	reader, err := merger.Open()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := reader.(*adaptiveparallelmergerresource.AdaptiveParallelMergerResourceReader); !ok {
+		t.Errorf("expected adaptive merger-reader with inaccurate sizes, got %T", reader)
+	}
+	if content := readAll(t, reader); content != "HelloWorld" {
+		t.Errorf("expected content %q, got %q", "HelloWorld", content)
+	}
+	reader.Close()
+
+	last.sizeAccurate = true
+
+	if !merger.IsSizeAccurate() {
+		t.Errorf("expected size to be accurate")
+	}
+	reader, err = merger.Open()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer reader.Close()
+	if _, ok := reader.(*parallelmergerresource.ParallelMergerResourceReader); !ok {
+		t.Errorf("expected exact merger-reader with accurate sizes, got %T", reader)
+	}
+
+	_, err = reader.Seek(3, io.SeekStart)
+	if err != nil {
+		t.Fatalf("failed to seek: %v", err)
+	}
+	if content := readAll(t, reader); content != "loWorld" {
+		t.Errorf("expected content %q, got %q", "loWorld", content)
+	}
+
+	size, err := merger.Size()
+	if err != nil {
+		t.Fatalf("failed get Size() %v", err)
+	}
+	if size != 10 {
+		t.Errorf("expected size %d, got %d", 10, size)
+	}
+}
+
+func TestAutoMergerResourceWithoutSizeAccurateResource(t *testing.T) {
+	t.Parallel()
+
+	resources := []resource.ReadSeekCloseableResource{
+		&bytesresource.BytesResource{Content: []byte("Hello")},
+	}
+	merger := automergerresource.NewAutoMergerResource(resources)
+
+	if merger.IsSizeAccurate() {
+		t.Errorf("expected size to be inaccurate when resources dont report it")
+	}
+}
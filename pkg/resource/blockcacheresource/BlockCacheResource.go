@@ -0,0 +1,221 @@
+package blockcacheresource
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
+)
+
+var logger = slog.With("Module", "BlockCacheResource")
+
+const DefaultBlockSize = 1024 * 1024
+
+// BlockCacheResource caches the content of the underlying resource in fixed-size blocks, e.g. decoded archive-entries
+// Cached blocks are served without touching the underlying resource, so repeated and backward reads dont decode again
+type BlockCacheResource struct {
+	underlying resource.ReadSeekCloseableResource
+	cache      cache.Cache
+	// Blocks are stored as keyPrefix@blockIndex
+	keyPrefix string
+	options   *BlockCacheResourceOptions
+}
+
+type BlockCacheResourceOptions struct {
+	// Size of the blocks stored in cache; defaults to DefaultBlockSize
+	BlockSize int64
+	// Passed when storing blocks e.g. owner
+	CacheSetOptions []cache.SetOption
+}
+
+func NewBlockCacheResource(underlying resource.ReadSeekCloseableResource, blockCache cache.Cache, keyPrefix string, options *BlockCacheResourceOptions) *BlockCacheResource {
+	if options == nil {
+		options = &BlockCacheResourceOptions{}
+	}
+	if options.BlockSize <= 0 {
+		options.BlockSize = DefaultBlockSize
+	}
+
+	return &BlockCacheResource{
+		underlying: underlying,
+		cache:      blockCache,
+		keyPrefix:  keyPrefix,
+		options:    options,
+	}
+}
+
+type BlockCacheResourceReader struct {
+	resource *BlockCacheResource
+	size     int64
+	index    int64
+	// Opened on the first block not in cache
+	underlyingReader io.ReadSeekCloser
+	underlyingIndex  int64
+
+	block      []byte
+	blockIndex int64
+}
+
+func (r *BlockCacheResource) Open() (io.ReadSeekCloser, error) {
+	size, err := r.underlying.Size()
+	if err != nil {
+		return nil, fmt.Errorf("failed getting size from underlying resource: %w", err)
+	}
+
+	return &BlockCacheResourceReader{
+		resource:   r,
+		size:       size,
+		blockIndex: -1,
+	}, nil
+}
+
+func (r *BlockCacheResource) Size() (int64, error) {
+	return r.underlying.Size()
+}
+
+func (r *BlockCacheResource) IsSizeAccurate() bool {
+	sizeAccurateResource, ok := r.underlying.(resource.SizeAccurateResource)
+	if !ok {
+		return true
+	}
+	return sizeAccurateResource.IsSizeAccurate()
+}
+
+func (r *BlockCacheResource) blockKey(blockIndex int64) string {
+	return fmt.Sprintf("%s@%d", r.keyPrefix, blockIndex)
+}
+
+func (r *BlockCacheResourceReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if r.index >= r.size {
+		return 0, io.EOF
+	}
+
+	blockSize := r.resource.options.BlockSize
+	blockIndex := r.index / blockSize
+	if blockIndex != r.blockIndex {
+		if err := r.loadBlock(blockIndex); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.block[r.index-blockIndex*blockSize:])
+	r.index += int64(n)
+	return n, nil
+}
+
+// loadBlock reads the block from cache, or from the underlying resource storing it in cache
+func (r *BlockCacheResourceReader) loadBlock(blockIndex int64) error {
+	blockSize := r.resource.options.BlockSize
+	expectedSize := min(blockSize, r.size-blockIndex*blockSize)
+	key := r.resource.blockKey(blockIndex)
+	r.blockIndex = -1
+
+	cached, err := r.readCached(key, expectedSize)
+	if err != nil {
+		return err
+	}
+	if cached {
+		r.blockIndex = blockIndex
+		return nil
+	}
+
+	if err := r.readUnderlying(blockIndex*blockSize, expectedSize); err != nil {
+		return err
+	}
+	r.blockIndex = blockIndex
+
+	// Not being able to cache only costs decoding again later
+	if _, err := r.resource.cache.SetWithReader(key, bytes.NewReader(r.block), r.resource.options.CacheSetOptions...); err != nil {
+		logger.Debug("Failed caching block", "key", key, "error", err)
+	}
+	return nil
+}
+
+// readCached reads the block into r.block; false when not cached or not matching the expected size
+func (r *BlockCacheResourceReader) readCached(key string, expectedSize int64) (bool, error) {
+	reader, _, err := r.resource.cache.GetWithReader(key)
+	if errors.Is(err, cache.ErrItemNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed getting block from cache: %w", err)
+	}
+	defer reader.Close()
+
+	r.block = append(r.block[:0], make([]byte, expectedSize)...)
+	n, err := io.ReadFull(reader, r.block)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return false, fmt.Errorf("failed reading block from cache: %w", err)
+	}
+	if int64(n) != expectedSize {
+		logger.Warn("Cached block has wrong size, reading again", "key", key, "expected", expectedSize, "actual", n)
+		return false, nil
+	}
+	return true, nil
+}
+
+func (r *BlockCacheResourceReader) readUnderlying(offset, size int64) error {
+	if r.underlyingReader == nil {
+		reader, err := r.resource.underlying.Open()
+		if err != nil {
+			return fmt.Errorf("failed opening underlying resource: %w", err)
+		}
+		r.underlyingReader = reader
+		r.underlyingIndex = 0
+	}
+
+	if r.underlyingIndex != offset {
+		if _, err := r.underlyingReader.Seek(offset, io.SeekStart); err != nil {
+			return fmt.Errorf("failed seeking underlying reader to %d: %w", offset, err)
+		}
+		r.underlyingIndex = offset
+	}
+
+	r.block = append(r.block[:0], make([]byte, size)...)
+	n, err := io.ReadFull(r.underlyingReader, r.block)
+	r.underlyingIndex += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed reading underlying reader at %d: %w", offset, err)
+	}
+	return nil
+}
+
+func (r *BlockCacheResourceReader) Seek(offset int64, whence int) (int64, error) {
+	var newIndex int64
+
+	switch whence {
+	case io.SeekStart:
+		newIndex = offset
+	case io.SeekCurrent:
+		newIndex = r.index + offset
+	case io.SeekEnd:
+		newIndex = r.size + offset
+	default:
+		return 0, resource.ErrInvalidSeek
+	}
+
+	if newIndex < 0 || newIndex > r.size {
+		return 0, resource.ErrInvalidSeek
+	}
+
+	r.index = newIndex
+	return r.index, nil
+}
+
+func (r *BlockCacheResourceReader) Close() error {
+	if r.underlyingReader != nil {
+		err := r.underlyingReader.Close()
+		r.underlyingReader = nil
+		if err != nil {
+			return fmt.Errorf("failed closing underlying reader: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package blockcacheresource_test
+
+import (
+	"io"
+	"testing"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/memorycache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/blockcacheresource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/bytesresource"
+)
+
+// countingResource counts the bytes read from it, standing in for an expensive decoder
+type countingResource struct {
+	bytesresource.BytesResource
+	read int
+}
+
+type countingReader struct {
+	io.ReadSeekCloser
+	resource *countingResource
+}
+
+func (r *countingResource) Open() (io.ReadSeekCloser, error) {
+	reader, err := r.BytesResource.Open()
+	return &countingReader{ReadSeekCloser: reader, resource: r}, err
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadSeekCloser.Read(p)
+	r.resource.read += n
+	return n, err
+}
+
+func readAt(t *testing.T, reader io.ReadSeeker, offset int64, length int) string {
+	t.Helper()
+	if _, err := reader.Seek(offset, io.SeekStart); err != nil {
+		t.Fatalf("failed seeking to %d: %v", offset, err)
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		t.Fatalf("failed reading at %d: %v", offset, err)
+	}
+	return string(buf)
+}
+
+func TestBlockCacheResource(t *testing.T) {
+	t.Parallel()
+
+	blockCache, err := memorycache.NewCache(&memorycache.CacheOptions{MaxSize: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	underlying := &countingResource{BytesResource: bytesresource.BytesResource{Content: []byte("HelloWorldFooBar")}}
+	blockResource := blockcacheresource.NewBlockCacheResource(underlying, blockCache, "nzb/archive.rar/file", &blockcacheresource.BlockCacheResourceOptions{BlockSize: 5})
+
+	reader, err := blockResource.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "HelloWorldFooBar" {
+		t.Errorf("expected content %s, got %s", "HelloWorldFooBar", content)
+	}
+	if underlying.read != len(content) {
+		t.Errorf("expected underlying to be read once, read %d bytes", underlying.read)
+	}
+
+	// Backward and repeated reads, also from another reader, dont touch the underlying resource
+	if got := readAt(t, reader, 3, 8); got != "loWorldF" {
+		t.Errorf("expected %s, got %s", "loWorldF", got)
+	}
+	reader.Close()
+
+	reader, err = blockResource.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if got := readAt(t, reader, 14, 2); got != "ar" {
+		t.Errorf("expected %s, got %s", "ar", got)
+	}
+	if got := readAt(t, reader, 0, 5); got != "Hello" {
+		t.Errorf("expected %s, got %s", "Hello", got)
+	}
+	if underlying.read != len(content) {
+		t.Errorf("expected cached blocks to be used, underlying read %d bytes", underlying.read)
+	}
+}
+
+func TestBlockCacheResourceEvictedBlock(t *testing.T) {
+	t.Parallel()
+
+	// Only fits 2 blocks, so earlier ones have to be decoded again
+	blockCache, err := memorycache.NewCache(&memorycache.CacheOptions{MaxSize: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	underlying := &countingResource{BytesResource: bytesresource.BytesResource{Content: []byte("abcdefghijkl")}}
+	blockResource := blockcacheresource.NewBlockCacheResource(underlying, blockCache, "key", &blockcacheresource.BlockCacheResourceOptions{BlockSize: 4})
+
+	reader, err := blockResource.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	if _, err := io.ReadAll(reader); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAt(t, reader, 1, 2); got != "bc" {
+		t.Errorf("expected %s, got %s", "bc", got)
+	}
+	if underlying.read != 16 {
+		t.Errorf("expected evicted block to be read again, read %d bytes", underlying.read)
+	}
+}
@@ -28,7 +28,7 @@ func (r *BytesResource) Size() (int64, error) {
 }
 
 func (r *BytesResourceReader) Close() error {
-	r.resource.Content = nil
+	// Only drop the reference, the resource can be opened again
 	r.resource = nil
 	return nil
 }
@@ -48,6 +48,22 @@ func (r *BytesResourceReader) Read(p []byte) (int, error) {
 	return n, nil
 }
 
+// ReadAt reads without touching the position of Read
+func (r *BytesResourceReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, resource.ErrInvalidSeek
+	}
+	if off >= int64(len(r.resource.Content)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, r.resource.Content[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
 func (r *BytesResourceReader) Seek(offset int64, whence int) (int64, error) {
 	var newIndex int64
 
@@ -0,0 +1,313 @@
+package compressedfileresource
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
+	"github.com/ulikunitz/xz"
+)
+
+type Format int
+
+const (
+	FormatGzip Format = iota
+	FormatXz
+	FormatZstd
+	FormatBzip2
+)
+
+var ErrUnknownFormat = errors.New("unknown compression format")
+
+// FormatFromExtension returns the compression format for a file-extension like ".gz" or ".tgz"
+func FormatFromExtension(extension string) (Format, error) {
+	switch strings.ToLower(extension) {
+	case ".gz", ".tgz":
+		return FormatGzip, nil
+	case ".xz", ".txz":
+		return FormatXz, nil
+	case ".zst", ".tzst":
+		return FormatZstd, nil
+	case ".bz2", ".tbz2", ".tbz":
+		return FormatBzip2, nil
+	}
+	return 0, fmt.Errorf("%w: %s", ErrUnknownFormat, extension)
+}
+
+// CompressedFileResource presents the decompressed content of a single compressed file
+type CompressedFileResource struct {
+	resource    resource.ReadSeekCloseableResource
+	format      Format
+	checkpoints *checkpoints
+
+	// Guards size fields
+	mutex        sync.Mutex
+	size         int64
+	sizeAccurate bool
+	// Size has been looked up from the stream, when not accurate its only known after a reader reached the end
+	sizeChecked bool
+}
+
+func NewCompressedFileResource(resource resource.ReadSeekCloseableResource, format Format) *CompressedFileResource {
+	return &CompressedFileResource{
+		resource:    resource,
+		format:      format,
+		checkpoints: newCheckpoints(),
+		size:        -1,
+	}
+}
+
+// NewCompressedFileResourceWithSize creates a CompressedFileResource whose decompressed size is already known,
+// so the stream doesnt have to be read to get it
+func NewCompressedFileResourceWithSize(resource resource.ReadSeekCloseableResource, format Format, size int64) *CompressedFileResource {
+	r := NewCompressedFileResource(resource, format)
+	r.setSize(size)
+	return r
+}
+
+type CompressedFileResourceReader struct {
+	resource         *CompressedFileResource
+	underlyingReader io.ReadSeekCloser
+	decompressor     io.ReadCloser
+	index            int64
+}
+
+func (r *CompressedFileResource) Open() (io.ReadSeekCloser, error) {
+	underlyingReader, err := r.resource.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed opening underlying resource: %w", err)
+	}
+
+	reader := &CompressedFileResourceReader{
+		resource:         r,
+		underlyingReader: underlyingReader,
+	}
+	reader.decompressor, err = reader.newDecompressor(checkpoint{})
+	if err != nil {
+		underlyingReader.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+// newDecompressor starts decompressing from the checkpoint, the underlying reader has to be at its position
+func (r *CompressedFileResourceReader) newDecompressor(from checkpoint) (io.ReadCloser, error) {
+	source := newCountingReader(r.underlyingReader, from.bit/8)
+	// Offset of a checkpoint is where the reader is when its reached
+	onCheckpoint := func(cp checkpoint) {
+		cp.offset = r.index
+		r.resource.checkpoints.add(cp)
+	}
+
+	switch r.resource.format {
+	case FormatGzip:
+		return newGzipDecoder(source, onCheckpoint)
+	case FormatXz:
+		decompressor, err := xz.NewReader(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed creating xz reader: %w", err)
+		}
+		return io.NopCloser(decompressor), nil
+	case FormatZstd:
+		return newZstdDecoder(source, onCheckpoint)
+	case FormatBzip2:
+		return newBzip2Decoder(source, from, onCheckpoint), nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+// Size returns the decompressed size
+// Its taken from the xz index, zstd frame-header or gzip trailer; Otherwise the compressed size is returned as estimate until a reader reached the end
+func (r *CompressedFileResource) Size() (int64, error) {
+	r.mutex.Lock()
+	size, checked := r.size, r.sizeChecked
+	r.mutex.Unlock()
+	if size >= 0 {
+		return size, nil
+	}
+
+	if !checked {
+		size, accurate, err := r.streamSize()
+		if err != nil {
+			return 0, err
+		}
+
+		r.mutex.Lock()
+		r.sizeChecked = true
+		if accurate && r.size < 0 {
+			r.size = size
+			r.sizeAccurate = true
+		}
+		size = r.size
+		r.mutex.Unlock()
+		if size >= 0 {
+			return size, nil
+		}
+	}
+
+	compressedSize, err := r.resource.Size()
+	if err != nil {
+		return 0, fmt.Errorf("failed getting size from underlying resource: %w", err)
+	}
+	return compressedSize, nil
+}
+
+func (r *CompressedFileResource) IsSizeAccurate() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.sizeAccurate
+}
+
+func (r *CompressedFileResource) setSize(size int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.size = size
+	r.sizeAccurate = true
+	r.sizeChecked = true
+}
+
+// streamSize reads the size from where the format stores it, false if it doesnt
+func (r *CompressedFileResource) streamSize() (int64, bool, error) {
+	if r.format == FormatBzip2 {
+		return 0, false, nil
+	}
+
+	compressedSize, err := r.resource.Size()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed getting size from underlying resource: %w", err)
+	}
+
+	reader, err := r.resource.Open()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed opening underlying resource: %w", err)
+	}
+	defer reader.Close()
+
+	switch r.format {
+	case FormatXz:
+		size, err := xzUncompressedSize(reader, compressedSize)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed reading xz index: %w", err)
+		}
+		return size, true, nil
+	case FormatZstd:
+		size, ok, err := zstdContentSize(reader, compressedSize)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed reading zstd frame-headers: %w", err)
+		}
+		return size, ok, nil
+	case FormatGzip:
+		size, ok, err := gzipTrailerSize(reader, compressedSize)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed reading gzip trailer: %w", err)
+		}
+		return size, ok, nil
+	}
+	return 0, false, nil
+}
+
+func (r *CompressedFileResourceReader) Close() error {
+	err := r.decompressor.Close()
+	if underlyingErr := r.underlyingReader.Close(); underlyingErr != nil {
+		return fmt.Errorf("failed closing underlying reader: %w", underlyingErr)
+	}
+	return err
+}
+
+func (r *CompressedFileResourceReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	n, err := r.decompressor.Read(p)
+	r.index += int64(n)
+	if errors.Is(err, io.EOF) {
+		r.resource.setSize(r.index)
+	}
+
+	return n, err
+}
+
+func (r *CompressedFileResourceReader) Seek(offset int64, whence int) (int64, error) {
+	var newIndex int64
+
+	switch whence {
+	case io.SeekStart:
+		newIndex = offset
+	case io.SeekCurrent:
+		newIndex = r.index + offset
+	case io.SeekEnd:
+		size, err := r.exactSize()
+		if err != nil {
+			return 0, err
+		}
+		newIndex = size + offset
+	default:
+		return 0, resource.ErrInvalidSeek
+	}
+
+	// Seek to same pos we are at
+	if newIndex == r.index {
+		return r.index, nil
+	}
+	// Out of range; Upper bound only checked when known, as getting it can require decompressing everything
+	if newIndex < 0 {
+		return 0, resource.ErrInvalidSeek
+	}
+	if size, err := r.resource.Size(); err == nil && r.resource.IsSizeAccurate() && newIndex > size {
+		return 0, resource.ErrInvalidSeek
+	}
+
+	// Compressed streams cannot seek, so decompression restarts from the nearest checkpoint when seeking backwards or past it
+	if cp := r.resource.checkpoints.nearest(newIndex); newIndex < r.index || cp.offset > r.index {
+		if err := r.restart(cp); err != nil {
+			return 0, err
+		}
+	}
+
+	// Skip forwards
+	skip := newIndex - r.index
+	if _, err := io.CopyN(io.Discard, r, skip); err != nil {
+		return 0, fmt.Errorf("failed discarding %d bytes forward: %w", skip, err)
+	}
+
+	return r.index, nil
+}
+
+// restart decompresses from the checkpoint on
+func (r *CompressedFileResourceReader) restart(cp checkpoint) error {
+	if _, err := r.underlyingReader.Seek(cp.bit/8, io.SeekStart); err != nil {
+		return fmt.Errorf("failed seeking underlying reader to %d: %w", cp.bit/8, err)
+	}
+	r.decompressor.Close()
+
+	r.index = cp.offset
+	decompressor, err := r.newDecompressor(cp)
+	if err != nil {
+		return err
+	}
+	r.decompressor = decompressor
+	return nil
+}
+
+// exactSize returns the size, decompressing up to the end when it isnt known yet
+func (r *CompressedFileResourceReader) exactSize() (int64, error) {
+	size, err := r.resource.Size()
+	if err != nil || r.resource.IsSizeAccurate() {
+		return size, err
+	}
+
+	if cp := r.resource.checkpoints.nearest(math.MaxInt64); cp.offset > r.index {
+		if err := r.restart(cp); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return 0, fmt.Errorf("failed decompressing to get size: %w", err)
+	}
+	return r.index, nil
+}
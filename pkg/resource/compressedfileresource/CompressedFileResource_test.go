@@ -0,0 +1,324 @@
+package compressedfileresource_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/bytesresource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/compressedfileresource"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestCompressedFileResource(t *testing.T) {
+	t.Parallel()
+
+	expectedContent, err := os.ReadFile("testdata/content.txt")
+	if err != nil {
+		t.Fatalf("failed reading expected content: %v", err)
+	}
+
+	tests := []struct {
+		file   string
+		format compressedfileresource.Format
+		// Size is stored in the stream, otherwise its only known after reading to the end
+		sizeStored bool
+	}{
+		{"testdata/content.txt.gz", compressedfileresource.FormatGzip, true},
+		{"testdata/content.txt.xz", compressedfileresource.FormatXz, true},
+		{"testdata/content.multistream.xz", compressedfileresource.FormatXz, true},
+		{"testdata/content.txt.zst", compressedfileresource.FormatZstd, true},
+		{"testdata/content.txt.bz2", compressedfileresource.FormatBzip2, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			t.Parallel()
+
+			compressed, err := os.ReadFile(test.file)
+			if err != nil {
+				t.Fatalf("failed reading test file: %v", err)
+			}
+			decompressed := compressedfileresource.NewCompressedFileResource(&bytesresource.BytesResource{Content: compressed}, test.format)
+
+			size, err := decompressed.Size()
+			if err != nil {
+				t.Fatalf("failed get Size() %v", err)
+			}
+			if decompressed.IsSizeAccurate() != test.sizeStored {
+				t.Errorf("expected size accurate to be %v", test.sizeStored)
+			}
+			if test.sizeStored && size != int64(len(expectedContent)) {
+				t.Errorf("expected size %d, got %d", len(expectedContent), size)
+			}
+
+			reader, err := decompressed.Open()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer reader.Close()
+
+			// Forward
+			offset := int64(10000)
+			if _, err = reader.Seek(offset, io.SeekStart); err != nil {
+				t.Fatalf("failed to SeekStart with offset=%d: %v", offset, err)
+			}
+			buf := make([]byte, 100)
+			if _, err = io.ReadFull(reader, buf); err != nil {
+				t.Fatalf("failed to read: %v", err)
+			}
+			if !bytes.Equal(buf, expectedContent[offset:offset+100]) {
+				t.Errorf("content after forward seek doesnt match")
+			}
+
+			// Backward
+			offset = 20
+			if _, err = reader.Seek(offset, io.SeekStart); err != nil {
+				t.Fatalf("failed to SeekStart backwards with offset=%d: %v", offset, err)
+			}
+			if _, err = io.ReadFull(reader, buf); err != nil {
+				t.Fatalf("failed to read: %v", err)
+			}
+			if !bytes.Equal(buf, expectedContent[offset:offset+100]) {
+				t.Errorf("content after backward seek doesnt match")
+			}
+
+			// From end
+			if _, err = reader.Seek(-100, io.SeekEnd); err != nil {
+				t.Fatalf("failed to SeekEnd: %v", err)
+			}
+			rest, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("failed to read: %v", err)
+			}
+			if !bytes.Equal(rest, expectedContent[len(expectedContent)-100:]) {
+				t.Errorf("content after SeekEnd doesnt match")
+			}
+
+			size, err = decompressed.Size()
+			if err != nil {
+				t.Fatalf("failed get Size() %v", err)
+			}
+			if !decompressed.IsSizeAccurate() || size != int64(len(expectedContent)) {
+				t.Errorf("expected accurate size %d after reading to the end, got %d", len(expectedContent), size)
+			}
+		})
+	}
+}
+
+// countingResource counts the bytes read from it
+type countingResource struct {
+	bytesresource.BytesResource
+	read atomic.Int64
+}
+
+func (r *countingResource) Open() (io.ReadSeekCloser, error) {
+	reader, err := r.BytesResource.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &countingResourceReader{ReadSeekCloser: reader, resource: r}, nil
+}
+
+type countingResourceReader struct {
+	io.ReadSeekCloser
+	resource *countingResource
+}
+
+func (r *countingResourceReader) Read(p []byte) (int, error) {
+	n, err := r.ReadSeekCloser.Read(p)
+	r.resource.read.Add(int64(n))
+	return n, err
+}
+
+// compressChunks compresses each chunk on its own and concatenates them, as gzip-members or zstd-frames
+func compressChunks(t *testing.T, content []byte, chunkSize int, format compressedfileresource.Format) []byte {
+	t.Helper()
+
+	var compressed bytes.Buffer
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatalf("failed creating zstd encoder: %v", err)
+	}
+	defer encoder.Close()
+
+	for chunk := range slices.Chunk(content, chunkSize) {
+		switch format {
+		case compressedfileresource.FormatGzip:
+			writer := gzip.NewWriter(&compressed)
+			if _, err := writer.Write(chunk); err != nil {
+				t.Fatalf("failed compressing: %v", err)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatalf("failed compressing: %v", err)
+			}
+		case compressedfileresource.FormatZstd:
+			compressed.Write(encoder.EncodeAll(chunk, nil))
+		default:
+			t.Fatalf("unsupported format %v", format)
+		}
+	}
+	return compressed.Bytes()
+}
+
+func TestCompressedFileResourceSeeksFromCheckpoints(t *testing.T) {
+	t.Parallel()
+
+	content, err := os.ReadFile("testdata/content.txt")
+	if err != nil {
+		t.Fatalf("failed reading content: %v", err)
+	}
+	expectedContent := bytes.Repeat(content, 100)
+
+	bzip2Blocks, err := os.ReadFile("testdata/content.blocks.bz2")
+	if err != nil {
+		t.Fatalf("failed reading test file: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		compressed []byte
+		format     compressedfileresource.Format
+	}{
+		{"gzip members", compressChunks(t, expectedContent, 300_000, compressedfileresource.FormatGzip), compressedfileresource.FormatGzip},
+		{"zstd frames", compressChunks(t, expectedContent, 300_000, compressedfileresource.FormatZstd), compressedfileresource.FormatZstd},
+		{"bzip2 blocks", bzip2Blocks, compressedfileresource.FormatBzip2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			underlying := &countingResource{BytesResource: bytesresource.BytesResource{Content: test.compressed}}
+			decompressed := compressedfileresource.NewCompressedFileResource(underlying, test.format)
+
+			reader, err := decompressed.Open()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer reader.Close()
+
+			// Reading once collects the checkpoints
+			all, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("failed to read: %v", err)
+			}
+			if !bytes.Equal(all, expectedContent) {
+				t.Fatalf("content doesnt match")
+			}
+
+			buf := make([]byte, 1000)
+			for _, offset := range []int64{int64(len(expectedContent)) - 5000, 1_500_000, 10, 2_000_000} {
+				underlying.read.Store(0)
+				if _, err = reader.Seek(offset, io.SeekStart); err != nil {
+					t.Fatalf("failed to seek to %d: %v", offset, err)
+				}
+				if _, err = io.ReadFull(reader, buf); err != nil {
+					t.Fatalf("failed to read at %d: %v", offset, err)
+				}
+				if !bytes.Equal(buf, expectedContent[offset:offset+int64(len(buf))]) {
+					t.Errorf("content at %d doesnt match", offset)
+				}
+				if read := underlying.read.Load(); read > int64(len(test.compressed))/2 {
+					t.Errorf("expected seeking to %d to decompress from a checkpoint, read %d of %d compressed bytes", offset, read, len(test.compressed))
+				}
+			}
+		})
+	}
+}
+
+func TestCompressedFileResourceConcatenatedSize(t *testing.T) {
+	t.Parallel()
+
+	content, err := os.ReadFile("testdata/content.txt")
+	if err != nil {
+		t.Fatalf("failed reading content: %v", err)
+	}
+	expectedContent := bytes.Repeat(content, 20)
+
+	tests := []struct {
+		name       string
+		compressed []byte
+		format     compressedfileresource.Format
+		// Size of all parts is stored, otherwise its only known after reading to the end
+		sizeStored bool
+	}{
+		// Only the last member stores its size
+		{"gzip members", compressChunks(t, expectedContent, len(expectedContent)/2+1, compressedfileresource.FormatGzip), compressedfileresource.FormatGzip, false},
+		{"zstd frames", compressChunks(t, expectedContent, len(expectedContent)/3+1, compressedfileresource.FormatZstd), compressedfileresource.FormatZstd, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			decompressed := compressedfileresource.NewCompressedFileResource(&bytesresource.BytesResource{Content: test.compressed}, test.format)
+			size, err := decompressed.Size()
+			if err != nil {
+				t.Fatalf("failed get Size() %v", err)
+			}
+			if decompressed.IsSizeAccurate() != test.sizeStored {
+				t.Fatalf("expected size accurate to be %v, got size %d", test.sizeStored, size)
+			}
+			if test.sizeStored && size != int64(len(expectedContent)) {
+				t.Errorf("expected size %d, got %d", len(expectedContent), size)
+			}
+
+			reader, err := decompressed.Open()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer reader.Close()
+
+			// Seeking into the last part
+			offset := int64(len(expectedContent)) - 100
+			if _, err = reader.Seek(offset, io.SeekStart); err != nil {
+				t.Fatalf("failed to seek to %d: %v", offset, err)
+			}
+			rest, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("failed to read: %v", err)
+			}
+			if !bytes.Equal(rest, expectedContent[offset:]) {
+				t.Errorf("content at %d doesnt match", offset)
+			}
+		})
+	}
+}
+
+func TestCompressedFileResourceZstdWithoutContentSize(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("Hello zstd")
+	// Streamed frames dont know their content-size: Descriptor without it, window-descriptor and a single raw block
+	compressed := bytes.NewBuffer([]byte{0x28, 0xb5, 0x2f, 0xfd, 0x00, 0x00})
+	blockHeader := uint32(len(content))<<3 | 1
+	compressed.Write([]byte{byte(blockHeader), byte(blockHeader >> 8), byte(blockHeader >> 16)})
+	compressed.Write(content)
+	compressed.Write(compressChunks(t, content, len(content), compressedfileresource.FormatZstd))
+
+	decompressed := compressedfileresource.NewCompressedFileResource(&bytesresource.BytesResource{Content: compressed.Bytes()}, compressedfileresource.FormatZstd)
+	if _, err := decompressed.Size(); err != nil {
+		t.Fatalf("failed get Size() %v", err)
+	}
+	if decompressed.IsSizeAccurate() {
+		t.Errorf("expected size of frames without content-size to be inaccurate")
+	}
+
+	reader, err := decompressed.Open()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer reader.Close()
+	all, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if !bytes.Equal(all, append(content, content...)) {
+		t.Errorf("content doesnt match")
+	}
+}
@@ -0,0 +1,307 @@
+package compressedfileresource
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	bzip2BlockMagic = 0x314159265359
+	bzip2FinalMagic = 0x177245385090
+	bzip2MagicMask  = 1<<48 - 1
+)
+
+var ErrBzip2CorruptStream = errors.New("bzip2: corrupt stream")
+
+// bzip2Decoder decompresses block by block, so each block start can be used as checkpoint
+// Blocks arent byte-aligned, so each is realigned into a standalone single-block stream for decompressing
+type bzip2Decoder struct {
+	scanner      *bzip2BlockScanner
+	block        io.Reader
+	blockStart   checkpoint
+	blockStarted bool
+	onCheckpoint func(checkpoint)
+}
+
+func newBzip2Decoder(source *countingReader, from checkpoint, onCheckpoint func(checkpoint)) *bzip2Decoder {
+	return &bzip2Decoder{
+		scanner: &bzip2BlockScanner{
+			source:   source,
+			basePos:  from.bit / 8,
+			startBit: int(from.bit % 8),
+			level:    from.level,
+		},
+		onCheckpoint: onCheckpoint,
+	}
+}
+
+func (d *bzip2Decoder) Read(p []byte) (int, error) {
+	for {
+		if d.block == nil {
+			stream, start, err := d.scanner.nextBlock()
+			if err != nil {
+				return 0, err
+			}
+			d.block = bzip2.NewReader(bytes.NewReader(stream))
+			d.blockStart = start
+			d.blockStarted = false
+		}
+
+		n, err := d.block.Read(p)
+		if !d.blockStarted {
+			if n == 0 && err != nil && !errors.Is(err, io.EOF) {
+				// Magic might have been found inside the block data, so the block is retried up to the next one
+				stream, extended, extendErr := d.scanner.extendBlock()
+				if extendErr != nil {
+					return 0, extendErr
+				}
+				if !extended {
+					return 0, fmt.Errorf("failed decompressing bzip2 block: %w", err)
+				}
+				d.block = bzip2.NewReader(bytes.NewReader(stream))
+				continue
+			}
+			d.blockStarted = true
+			d.onCheckpoint(d.blockStart)
+		}
+
+		if n > 0 || !errors.Is(err, io.EOF) {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return n, err
+		}
+		d.block = nil
+	}
+}
+
+func (d *bzip2Decoder) Close() error {
+	return nil
+}
+
+// bzip2BlockScanner splits the compressed stream into blocks by their magic
+type bzip2BlockScanner struct {
+	source *countingReader
+	level  byte
+
+	// Bytes from the one containing the current blocks first bit on
+	data []byte
+	// Position of data in the compressed stream
+	basePos int64
+	// Bit of the current block in data
+	startBit int
+	// Bit of the marker ending the current block in data, 0 if not found yet
+	endBit int
+	// All of source has been read
+	eof bool
+}
+
+// nextBlock returns the block after the current one as single-block stream, together with its checkpoint
+func (s *bzip2BlockScanner) nextBlock() ([]byte, checkpoint, error) {
+	if s.endBit > 0 {
+		// Drop the finished block
+		dropped := s.endBit / 8
+		s.data = s.data[:copy(s.data, s.data[dropped:])]
+		s.basePos += int64(dropped)
+		s.startBit = s.endBit % 8
+		s.endBit = 0
+	}
+
+	for {
+		if s.level == 0 {
+			if err := s.readStreamHeader(); err != nil {
+				return nil, checkpoint{}, err
+			}
+		}
+
+		marker, err := s.bitsAt(s.startBit, 48)
+		if err != nil {
+			return nil, checkpoint{}, err
+		}
+		if marker == bzip2BlockMagic {
+			break
+		}
+		if marker != bzip2FinalMagic {
+			return nil, checkpoint{}, fmt.Errorf("%w: bad block magic", ErrBzip2CorruptStream)
+		}
+
+		// End of stream, another one might follow byte-aligned after the combined crc
+		streamEnd := (s.startBit + 48 + 32 + 7) / 8
+		if err := s.fill(streamEnd); err != nil {
+			return nil, checkpoint{}, err
+		}
+		s.data = s.data[:copy(s.data, s.data[streamEnd:])]
+		s.basePos += int64(streamEnd)
+		s.startBit = 0
+		s.level = 0
+	}
+
+	start := checkpoint{
+		bit:   s.basePos*8 + int64(s.startBit),
+		level: s.level,
+	}
+	stream, _, err := s.extendBlock()
+	return stream, start, err
+}
+
+// extendBlock moves the end of the current block to the next marker, false if there is none
+func (s *bzip2BlockScanner) extendBlock() ([]byte, bool, error) {
+	from := s.startBit + 48
+	if s.endBit > 0 {
+		if s.eof && s.endBit == len(s.data)*8 {
+			return nil, false, nil
+		}
+		from = s.endBit + 1
+	}
+
+	end, err := s.findMarker(from)
+	if err != nil {
+		return nil, false, err
+	}
+	s.endBit = end
+	return s.blockStream(), true, nil
+}
+
+// findMarker returns the bit in data of the first block or end-of-stream magic at or after from, or the end of data if there is none
+func (s *bzip2BlockScanner) findMarker(from int) (int, error) {
+	// Byte holding the last bit of a marker starting at from
+	first := (from + 47) / 8
+
+	var window uint64
+	for i := max(first-7, 0); ; i++ {
+		if err := s.fill(i + 1); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return len(s.data) * 8, nil
+			}
+			return 0, err
+		}
+		window = window<<8 | uint64(s.data[i])
+		if i < first {
+			continue
+		}
+
+		// Earlier starting markers are in the higher bits
+		for shift := 7; shift >= 0; shift-- {
+			start := i*8 + 8 - shift - 48
+			if start < from {
+				continue
+			}
+			if marker := (window >> shift) & bzip2MagicMask; marker == bzip2BlockMagic || marker == bzip2FinalMagic {
+				return start, nil
+			}
+		}
+	}
+}
+
+// blockStream realigns the current block into a standalone stream
+// The streams crc is the blocks crc, as its the only block
+func (s *bzip2BlockScanner) blockStream() []byte {
+	writer := bitWriter{
+		out: make([]byte, 0, (s.endBit-s.startBit)/8+16),
+	}
+	writer.out = append(writer.out, 'B', 'Z', 'h', s.level)
+
+	bit := s.startBit
+	for ; bit+8 <= s.endBit; bit += 8 {
+		writer.writeBits(uint64(s.byteAt(bit)), 8)
+	}
+	if rest := s.endBit - bit; rest > 0 {
+		writer.writeBits(uint64(s.byteAt(bit)>>(8-rest)), rest)
+	}
+
+	// Block crc follows its magic
+	crc, _ := s.bitsAt(s.startBit+48, 32)
+	writer.writeBits(bzip2FinalMagic, 48)
+	writer.writeBits(crc, 32)
+	return writer.flush()
+}
+
+func (s *bzip2BlockScanner) readStreamHeader() error {
+	if err := s.fill(1); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return io.EOF
+		}
+		return err
+	}
+	if err := s.fill(4); err != nil {
+		return err
+	}
+	if !bytes.Equal(s.data[:3], []byte("BZh")) || s.data[3] < '1' || s.data[3] > '9' {
+		return fmt.Errorf("%w: bad stream header", ErrBzip2CorruptStream)
+	}
+	s.level = s.data[3]
+	s.data = s.data[:copy(s.data, s.data[4:])]
+	s.basePos += 4
+	return nil
+}
+
+// bitsAt returns n bits from bit in data, reading it when necessary
+func (s *bzip2BlockScanner) bitsAt(bit, n int) (uint64, error) {
+	if err := s.fill((bit + n + 7) / 8); err != nil {
+		return 0, err
+	}
+	var value uint64
+	for i := range n {
+		position := bit + i
+		value = value<<1 | uint64(s.data[position/8]>>(7-position%8)&1)
+	}
+	return value, nil
+}
+
+func (s *bzip2BlockScanner) byteAt(bit int) byte {
+	shift := bit % 8
+	if shift == 0 {
+		return s.data[bit/8]
+	}
+	b := s.data[bit/8] << shift
+	if bit/8+1 < len(s.data) {
+		b |= s.data[bit/8+1] >> (8 - shift)
+	}
+	return b
+}
+
+// fill reads from source until data has n bytes
+func (s *bzip2BlockScanner) fill(n int) error {
+	for len(s.data) < n {
+		if s.eof {
+			return io.ErrUnexpectedEOF
+		}
+		b, err := s.source.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				s.eof = true
+				continue
+			}
+			return fmt.Errorf("failed reading compressed stream: %w", err)
+		}
+		s.data = append(s.data, b)
+	}
+	return nil
+}
+
+type bitWriter struct {
+	out   []byte
+	value uint64
+	bits  int
+}
+
+// writeBits appends the lowest n bits of value, n has to be at most 56
+func (w *bitWriter) writeBits(value uint64, n int) {
+	w.value = w.value<<n | value&(1<<n-1)
+	w.bits += n
+	for w.bits >= 8 {
+		w.bits -= 8
+		w.out = append(w.out, byte(w.value>>w.bits))
+	}
+}
+
+// flush pads the last byte with zeros
+func (w *bitWriter) flush() []byte {
+	if w.bits > 0 {
+		w.writeBits(0, 8-w.bits)
+	}
+	return w.out
+}
@@ -0,0 +1,91 @@
+package compressedfileresource
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Minimum distance between checkpoints, so streams with many small frames or blocks dont keep one for each
+const checkpointInterval = 1 << 20
+
+// checkpoint is a position decompression can be restarted from
+type checkpoint struct {
+	// Decompressed offset
+	offset int64
+	// Bit-position in the compressed stream, byte-aligned for all formats but bzip2
+	bit int64
+	// Block-size level of the bzip2 stream, 0 when at the start of a stream
+	level byte
+}
+
+// checkpoints are collected while decompressing, so seeking only has to decompress from the nearest one
+type checkpoints struct {
+	mutex sync.Mutex
+	// Sorted by offset, starts with the beginning of the stream
+	list []checkpoint
+}
+
+func newCheckpoints() *checkpoints {
+	return &checkpoints{
+		list: []checkpoint{{}},
+	}
+}
+
+func (c *checkpoints) add(cp checkpoint) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	i := sort.Search(len(c.list), func(i int) bool {
+		return c.list[i].offset >= cp.offset
+	})
+	if i > 0 && cp.offset-c.list[i-1].offset < checkpointInterval {
+		return
+	}
+	if i < len(c.list) && c.list[i].offset-cp.offset < checkpointInterval {
+		return
+	}
+	c.list = append(c.list, checkpoint{})
+	copy(c.list[i+1:], c.list[i:])
+	c.list[i] = cp
+}
+
+// nearest returns the last checkpoint at or before offset
+func (c *checkpoints) nearest(offset int64) checkpoint {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	i := sort.Search(len(c.list), func(i int) bool {
+		return c.list[i].offset > offset
+	})
+	return c.list[max(i-1, 0)]
+}
+
+// countingReader tracks the position in the compressed stream
+// Its a ByteReader, so decompressors dont buffer ahead and the position stays exact
+type countingReader struct {
+	reader   *bufio.Reader
+	position int64
+}
+
+func newCountingReader(reader io.Reader, position int64) *countingReader {
+	return &countingReader{
+		reader:   bufio.NewReader(reader),
+		position: position,
+	}
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.position += int64(n)
+	return n, err
+}
+
+func (r *countingReader) ReadByte() (byte, error) {
+	b, err := r.reader.ReadByte()
+	if err == nil {
+		r.position++
+	}
+	return b, err
+}
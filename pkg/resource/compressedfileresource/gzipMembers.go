@@ -0,0 +1,82 @@
+package compressedfileresource
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// gzipDecoder decompresses member by member, so each member start can be used as checkpoint
+type gzipDecoder struct {
+	source       *countingReader
+	reader       *gzip.Reader
+	onCheckpoint func(checkpoint)
+}
+
+func newGzipDecoder(source *countingReader, onCheckpoint func(checkpoint)) (*gzipDecoder, error) {
+	reader, err := gzip.NewReader(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating gzip reader: %w", err)
+	}
+	reader.Multistream(false)
+
+	return &gzipDecoder{
+		source:       source,
+		reader:       reader,
+		onCheckpoint: onCheckpoint,
+	}, nil
+}
+
+func (d *gzipDecoder) Read(p []byte) (int, error) {
+	for {
+		n, err := d.reader.Read(p)
+		if n > 0 || !errors.Is(err, io.EOF) {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return n, err
+		}
+
+		// Member done, continue with the next if there is one
+		position := d.source.position
+		if err := d.reader.Reset(d.source); err != nil {
+			if errors.Is(err, io.EOF) {
+				return 0, io.EOF
+			}
+			return 0, fmt.Errorf("failed reading gzip member: %w", err)
+		}
+		d.reader.Multistream(false)
+		d.onCheckpoint(checkpoint{bit: position * 8})
+	}
+}
+
+func (d *gzipDecoder) Close() error {
+	return d.reader.Close()
+}
+
+// Deflate expands at most 1032:1, a member with less compressed data than this cant reach 4GiB
+const gzipMaxCompressedForIsize = (1<<32 - 1) / 1032
+
+// gzipTrailerSize takes the decompressed size from the trailer of the last member
+// Its only stored modulo 4GiB and only for the last member, so its only used when the stream is provably a single member below 4GiB
+func gzipTrailerSize(reader io.ReadSeeker, compressedSize int64) (int64, bool, error) {
+	if compressedSize < 18 || compressedSize > gzipMaxCompressedForIsize {
+		return 0, false, nil
+	}
+
+	compressed := make([]byte, compressedSize)
+	if err := readAt(reader, compressed, 0); err != nil {
+		return 0, false, err
+	}
+	// Members start byte-aligned with magic, deflate-method and flags with the reserved bits unset
+	// Compressed data looking like it is taken as a further member, leaving the size to be found by reading
+	for i := 1; i+18 <= len(compressed); i++ {
+		if compressed[i] == 0x1f && compressed[i+1] == 0x8b && compressed[i+2] == 8 && compressed[i+3]&0xe0 == 0 {
+			return 0, false, nil
+		}
+	}
+
+	return int64(binary.LittleEndian.Uint32(compressed[compressedSize-4:])), true, nil
+}
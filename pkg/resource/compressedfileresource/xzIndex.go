@@ -0,0 +1,112 @@
+package compressedfileresource
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const xzFooterSize = 12
+
+var (
+	ErrXzCorruptFooter = errors.New("xz: corrupt stream footer")
+	ErrXzCorruptIndex  = errors.New("xz: corrupt index")
+)
+
+// xzUncompressedSize sums the uncompressed sizes of all blocks from the stream-indexes
+// Streams are walked from the end, so only footers and indexes have to be read
+func xzUncompressedSize(reader io.ReadSeeker, size int64) (int64, error) {
+	var totalSize int64
+
+	pos := size
+	for pos > 0 {
+		// Skip stream padding
+		padding := make([]byte, 4)
+		for pos >= 4 {
+			if err := readAt(reader, padding, pos-4); err != nil {
+				return 0, err
+			}
+			if !bytes.Equal(padding, []byte{0, 0, 0, 0}) {
+				break
+			}
+			pos -= 4
+		}
+		if pos == 0 {
+			break
+		}
+
+		footer := make([]byte, xzFooterSize)
+		if pos < xzFooterSize {
+			return 0, ErrXzCorruptFooter
+		}
+		if err := readAt(reader, footer, pos-xzFooterSize); err != nil {
+			return 0, err
+		}
+		if footer[10] != 'Y' || footer[11] != 'Z' {
+			return 0, ErrXzCorruptFooter
+		}
+		indexSize := (int64(binary.LittleEndian.Uint32(footer[4:8])) + 1) * 4
+
+		indexStart := pos - xzFooterSize - indexSize
+		if indexStart < 0 {
+			return 0, ErrXzCorruptFooter
+		}
+		index := make([]byte, indexSize)
+		if err := readAt(reader, index, indexStart); err != nil {
+			return 0, err
+		}
+
+		blocksSize, uncompressedSize, err := parseXzIndex(index)
+		if err != nil {
+			return 0, err
+		}
+		totalSize += uncompressedSize
+
+		// Stream-header has the same size as the footer
+		pos = indexStart - blocksSize - xzFooterSize
+		if pos < 0 {
+			return 0, ErrXzCorruptIndex
+		}
+	}
+
+	return totalSize, nil
+}
+
+// parseXzIndex returns the size of all blocks including padding and their total uncompressed size
+func parseXzIndex(index []byte) (blocksSize, uncompressedSize int64, err error) {
+	if len(index) == 0 || index[0] != 0 {
+		return 0, 0, ErrXzCorruptIndex
+	}
+	buf := bytes.NewReader(index[1:])
+
+	records, err := binary.ReadUvarint(buf)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %w", ErrXzCorruptIndex, err)
+	}
+	for range records {
+		unpaddedSize, err := binary.ReadUvarint(buf)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%w: %w", ErrXzCorruptIndex, err)
+		}
+		blockUncompressedSize, err := binary.ReadUvarint(buf)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%w: %w", ErrXzCorruptIndex, err)
+		}
+		blocksSize += int64((unpaddedSize + 3) &^ 3)
+		uncompressedSize += int64(blockUncompressedSize)
+	}
+
+	return blocksSize, uncompressedSize, nil
+}
+
+func readAt(reader io.ReadSeeker, p []byte, offset int64) error {
+	if _, err := reader.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed seeking to %d: %w", offset, err)
+	}
+	if _, err := io.ReadFull(reader, p); err != nil {
+		return fmt.Errorf("failed reading %d bytes at %d: %w", len(p), offset, err)
+	}
+	return nil
+}
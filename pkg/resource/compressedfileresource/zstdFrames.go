@@ -0,0 +1,296 @@
+package compressedfileresource
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	zstdFrameMagic          = 0xFD2FB528
+	zstdSkippableMagicMask  = 0xFFFFFFF0
+	zstdSkippableFrameMagic = 0x184D2A50
+)
+
+var ErrZstdCorruptFrame = errors.New("zstd: corrupt frame")
+
+// zstdDecoder decompresses frame by frame, so each frame start can be used as checkpoint
+type zstdDecoder struct {
+	source       *countingReader
+	decoder      *zstd.Decoder
+	frame        *zstdFrameReader
+	onCheckpoint func(checkpoint)
+}
+
+func newZstdDecoder(source *countingReader, onCheckpoint func(checkpoint)) (*zstdDecoder, error) {
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, fmt.Errorf("failed creating zstd reader: %w", err)
+	}
+
+	d := &zstdDecoder{
+		source:       source,
+		decoder:      decoder,
+		onCheckpoint: onCheckpoint,
+	}
+	if err := d.nextFrame(); err != nil {
+		decoder.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *zstdDecoder) nextFrame() error {
+	d.frame = &zstdFrameReader{source: d.source}
+	if err := d.decoder.Reset(d.frame); err != nil {
+		return fmt.Errorf("failed resetting zstd reader: %w", err)
+	}
+	return nil
+}
+
+func (d *zstdDecoder) Read(p []byte) (int, error) {
+	for {
+		n, err := d.decoder.Read(p)
+		if n > 0 || !errors.Is(err, io.EOF) {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return n, err
+		}
+		if d.frame.empty {
+			return 0, io.EOF
+		}
+
+		// Frame done, continue with the next
+		position := d.source.position
+		if err := d.nextFrame(); err != nil {
+			return 0, err
+		}
+		d.onCheckpoint(checkpoint{bit: position * 8})
+	}
+}
+
+func (d *zstdDecoder) Close() error {
+	d.decoder.Close()
+	return nil
+}
+
+// zstdFrameReader passes through a single frame of the source, ending exactly at its end
+type zstdFrameReader struct {
+	source *countingReader
+
+	started bool
+	// Source had no more frames
+	empty bool
+	// Parsed headers not passed through yet
+	pending []byte
+	// Bytes of the current block or skippable frame left to pass through
+	remaining int64
+	lastBlock bool
+	checksum  bool
+	done      bool
+}
+
+func (f *zstdFrameReader) Read(p []byte) (int, error) {
+	for {
+		if len(f.pending) > 0 {
+			n := copy(p, f.pending)
+			f.pending = f.pending[n:]
+			return n, nil
+		}
+
+		if f.remaining > 0 {
+			n, err := f.source.Read(p[:min(int64(len(p)), f.remaining)])
+			f.remaining -= int64(n)
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+
+		if f.done {
+			return 0, io.EOF
+		}
+		if err := f.next(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// next parses the next header of the frame
+func (f *zstdFrameReader) next() error {
+	if !f.started {
+		f.started = true
+		return f.readFrameHeader()
+	}
+
+	if f.lastBlock {
+		f.done = true
+		if f.checksum {
+			f.remaining = 4
+		}
+		return nil
+	}
+
+	header, err := f.readPending(3)
+	if err != nil {
+		return err
+	}
+	blockHeader := uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16
+	f.lastBlock = blockHeader&1 == 1
+	switch (blockHeader >> 1) & 3 {
+	case 1:
+		// RLE block only stores the byte to repeat
+		f.remaining = 1
+	case 3:
+		return fmt.Errorf("%w: reserved block type", ErrZstdCorruptFrame)
+	default:
+		f.remaining = int64(blockHeader >> 3)
+	}
+	return nil
+}
+
+func (f *zstdFrameReader) readFrameHeader() error {
+	magic, err := f.readPending(4)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			f.empty = true
+			f.done = true
+			return nil
+		}
+		return err
+	}
+
+	if binary.LittleEndian.Uint32(magic)&zstdSkippableMagicMask == zstdSkippableFrameMagic {
+		size, err := f.readPending(4)
+		if err != nil {
+			return err
+		}
+		f.remaining = int64(binary.LittleEndian.Uint32(size))
+		f.done = true
+		return nil
+	}
+	if binary.LittleEndian.Uint32(magic) != zstdFrameMagic {
+		return fmt.Errorf("%w: bad magic", ErrZstdCorruptFrame)
+	}
+
+	descriptor, err := f.readPending(1)
+	if err != nil {
+		return err
+	}
+	f.checksum = descriptor[0]&0x04 != 0
+	_, err = f.readPending(zstdFrameHeaderSize(descriptor[0]))
+	return err
+}
+
+// readPending reads n bytes from the source, they are passed through afterwards
+func (f *zstdFrameReader) readPending(n int) ([]byte, error) {
+	start := len(f.pending)
+	f.pending = append(f.pending, make([]byte, n)...)
+	read, err := io.ReadFull(f.source, f.pending[start:])
+	if err != nil {
+		if read == 0 && start == 0 && errors.Is(err, io.EOF) {
+			f.pending = f.pending[:0]
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("%w: %w", ErrZstdCorruptFrame, io.ErrUnexpectedEOF)
+	}
+	return f.pending[start:], nil
+}
+
+// zstdFrameHeaderSize returns the size of the frame header following the descriptor
+func zstdFrameHeaderSize(descriptor byte) int {
+	singleSegment := descriptor&0x20 != 0
+
+	size := [4]int{0, 1, 2, 4}[descriptor&0x03]
+	if !singleSegment {
+		// Window descriptor
+		size++
+	}
+	return size + zstdContentSizeFieldSize(descriptor)
+}
+
+func zstdContentSizeFieldSize(descriptor byte) int {
+	flag := descriptor >> 6
+	if flag == 0 {
+		if descriptor&0x20 != 0 {
+			return 1
+		}
+		return 0
+	}
+	return 1 << flag
+}
+
+// zstdContentSize sums the content-sizes of all frames, walking their block-headers to find where the next frame starts
+// Frames written without content-size, e.g. when streamed, make it unknown
+func zstdContentSize(reader io.ReadSeeker, compressedSize int64) (int64, bool, error) {
+	var size int64
+	offset := int64(0)
+	for offset < compressedSize {
+		header := make([]byte, 5)
+		if err := readAt(reader, header[:4], offset); err != nil {
+			return 0, false, err
+		}
+		magic := binary.LittleEndian.Uint32(header)
+		if magic&zstdSkippableMagicMask == zstdSkippableFrameMagic {
+			if err := readAt(reader, header[:4], offset+4); err != nil {
+				return 0, false, err
+			}
+			offset += 8 + int64(binary.LittleEndian.Uint32(header))
+			continue
+		}
+		if magic != zstdFrameMagic {
+			return 0, false, fmt.Errorf("%w: bad magic at %d", ErrZstdCorruptFrame, offset)
+		}
+
+		if err := readAt(reader, header[4:], offset+4); err != nil {
+			return 0, false, err
+		}
+		descriptor := header[4]
+		fieldSize := zstdContentSizeFieldSize(descriptor)
+		if fieldSize == 0 {
+			return 0, false, nil
+		}
+		field := make([]byte, 8)
+		if err := readAt(reader, field[:fieldSize], offset+int64(5+zstdFrameHeaderSize(descriptor)-fieldSize)); err != nil {
+			return 0, false, err
+		}
+		frameSize := int64(binary.LittleEndian.Uint64(field))
+		if fieldSize == 2 {
+			frameSize += 256
+		}
+		if frameSize < 0 || size+frameSize < size {
+			return 0, false, nil
+		}
+		size += frameSize
+
+		offset += int64(5 + zstdFrameHeaderSize(descriptor))
+		for lastBlock := false; !lastBlock; {
+			if err := readAt(reader, header[:3], offset); err != nil {
+				return 0, false, err
+			}
+			blockHeader := uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16
+			lastBlock = blockHeader&1 == 1
+			offset += 3
+			switch (blockHeader >> 1) & 3 {
+			case 1:
+				// RLE block only stores the byte to repeat
+				offset++
+			case 3:
+				return 0, false, fmt.Errorf("%w: reserved block type", ErrZstdCorruptFrame)
+			default:
+				offset += int64(blockHeader >> 3)
+			}
+		}
+		if descriptor&0x04 != 0 {
+			offset += 4
+		}
+	}
+	if offset != compressedSize {
+		return 0, false, fmt.Errorf("%w: %w", ErrZstdCorruptFrame, io.ErrUnexpectedEOF)
+	}
+	return size, true, nil
+}
@@ -0,0 +1,71 @@
+package resource
+
+import (
+	"context"
+	"io"
+)
+
+// ReadContext reads with ctx when r supports it, otherwise ctx is only checked before reading
+func ReadContext(ctx context.Context, r io.Reader, p []byte) (int, error) {
+	if contextReader, ok := r.(ContextReader); ok {
+		return contextReader.ReadContext(ctx, p)
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.Read(p)
+}
+
+// OpenContext opens the resource with ctx when it supports it, otherwise only checks ctx before opening
+func OpenContext(ctx context.Context, r ReadSeekCloseableResource) (io.ReadSeekCloser, error) {
+	if contextResource, ok := r.(ContextResource); ok {
+		return contextResource.OpenContext(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.Open()
+}
+
+// BindContext returns a reader reading r with ctx on every Read, for callers not passing ctx themselves
+func BindContext(ctx context.Context, r io.ReadSeekCloser) io.ReadSeekCloser {
+	return &contextBoundReader{ReadSeekCloser: r, ctx: ctx}
+}
+
+type contextBoundReader struct {
+	io.ReadSeekCloser
+	ctx context.Context
+}
+
+func (r *contextBoundReader) Read(p []byte) (int, error) {
+	return ReadContext(r.ctx, r.ReadSeekCloser, p)
+}
+
+// NewContextReader returns a reader checking ctx before every Read of r, for readers not supporting ctx themselves
+func NewContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return &contextReader{Reader: r, ctx: ctx}
+}
+
+type contextReader struct {
+	io.Reader
+	ctx context.Context
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	return ReadContext(r.ctx, r.Reader, p)
+}
+
+// ReadAtContext reads at off with ctx when r supports it, readers only implementing io.ReaderAt have ctx checked before reading
+func ReadAtContext(ctx context.Context, r io.Reader, p []byte, off int64) (int, error) {
+	switch readerAt := r.(type) {
+	case ContextReaderAt:
+		return readerAt.ReadAtContext(ctx, p, off)
+	case io.ReaderAt:
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		return readerAt.ReadAt(p, off)
+	default:
+		return 0, ErrReadAtUnsupported
+	}
+}
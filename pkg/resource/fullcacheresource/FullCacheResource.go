@@ -1,12 +1,14 @@
 package fullcacheresource
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"sync"
+	"sync/atomic"
 
-	"git.ruekov.eu/ruakij/nzbStreamer/pkg/diskcache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache"
 	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
 )
 
@@ -19,7 +21,7 @@ var (
 type FullCacheResource struct {
 	UnderlyingResource       resource.ReadCloseableResource
 	CacheKey                 string
-	Cache                    *diskcache.Cache
+	Cache                    cache.Cache
 	cachedSize               int64
 	cachedSizeAccurate       bool
 	cachedSizeAccurateCached bool
@@ -29,9 +31,25 @@ type FullCacheResource struct {
 type FullCacheResourceOptions struct {
 	// Force lookup Size() from underlying resource, ignoring any Caches
 	SizeAlwaysFromResource bool
+	// Passed when storing the content e.g. owner or pinning
+	CacheSetOptions []cache.SetOption
+	// Counts how reads were served, shared between resources; nil disables
+	Stats *Stats
 }
 
-func NewFullCacheResource(underlyingResource resource.ReadCloseableResource, cacheKey string, cache *diskcache.Cache, options *FullCacheResourceOptions) *FullCacheResource {
+// Stats count over all resources sharing them, how their content was served
+type Stats struct {
+	// Readers served from an item already cached, and items fetched from the underlying resource for readers
+	Hits   atomic.Int64
+	Misses atomic.Int64
+	// Bytes read from cached items by readers served from cache, and bytes fetched from the underlying resource e.g. network
+	BytesFromCache      atomic.Int64
+	BytesFromUnderlying atomic.Int64
+	// Items passed through uncached, as the cache had no space
+	Passthroughs atomic.Int64
+}
+
+func NewFullCacheResource(underlyingResource resource.ReadCloseableResource, cacheKey string, itemCache cache.Cache, options *FullCacheResourceOptions) *FullCacheResource {
 	// Create cache-keyed mutex if not exists
 	mutexMapMutex.Lock()
 	_, exists := mutexMap[cacheKey]
@@ -44,7 +62,7 @@ func NewFullCacheResource(underlyingResource resource.ReadCloseableResource, cac
 		UnderlyingResource: underlyingResource,
 		options:            options,
 		CacheKey:           cacheKey,
-		Cache:              cache,
+		Cache:              itemCache,
 		cachedSize:         -1,
 	}
 }
@@ -53,6 +71,11 @@ type FullCacheResourceReader struct {
 	resource         *FullCacheResource
 	underlyingReader io.ReadCloser
 	index            int64
+	// Content held in memory, when the cache couldnt store it
+	passthrough []byte
+	// If the item was cached already on the first read, for stats
+	hit     bool
+	counted bool
 }
 
 func (r *FullCacheResource) Open() (io.ReadSeekCloser, error) {
@@ -115,10 +138,11 @@ func (r *FullCacheResource) IsSizeAccurate() bool {
 		return true
 	}
 
-	if r.cachedSizeAccurateCached {
-		return r.cachedSizeAccurate
+	if r.cachedSizeAccurateCached && r.cachedSizeAccurate {
+		return true
 	}
 
+	// Checked again while inaccurate, as the item might have been cached meanwhile e.g. by prefetching
 	if !r.options.SizeAlwaysFromResource {
 		exists, header := r.Cache.Exists(r.CacheKey)
 		if exists {
@@ -129,6 +153,10 @@ func (r *FullCacheResource) IsSizeAccurate() bool {
 		}
 	}
 
+	if r.cachedSizeAccurateCached {
+		return r.cachedSizeAccurate
+	}
+
 	// Get from underlying
 	r.cachedSizeAccurate = sizeAccurateResource.IsSizeAccurate()
 	r.cachedSizeAccurateCached = true
@@ -185,11 +213,43 @@ func (r *FullCacheResourceReader) Seek(offset int64, whence int) (int64, error)
 }
 
 func (r *FullCacheResourceReader) Read(p []byte) (int, error) {
+	return r.ReadContext(context.Background(), p)
+}
+
+// ReadContext aborts fetching the content from the underlying resource when ctx is done, nothing is cached then
+func (r *FullCacheResourceReader) ReadContext(ctx context.Context, p []byte) (int, error) {
+	n, err := r.readAt(ctx, p, r.index)
+	r.index += int64(n)
+	return n, err
+}
+
+func (r *FullCacheResourceReader) ReadAt(p []byte, off int64) (int, error) {
+	return r.ReadAtContext(context.Background(), p, off)
+}
+
+// ReadAtContext reads at off without touching the position of Read; Reads on the same item are serialized while fetching it
+func (r *FullCacheResourceReader) ReadAtContext(ctx context.Context, p []byte, off int64) (int, error) {
+	total := 0
+	for total < len(p) {
+		n, err := r.readAt(ctx, p[total:], off+int64(total))
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n == 0 {
+			return total, io.ErrNoProgress
+		}
+	}
+	return total, nil
+}
+
+// readAt reads once at off, fetching the content into cache first if missing
+func (r *FullCacheResourceReader) readAt(ctx context.Context, p []byte, off int64) (int, error) {
 	if len(p) == 0 {
 		return 0, nil
 	}
-	if r.resource.cachedSize > 0 && r.index >= r.resource.cachedSize {
-		return 0, io.EOF
+	if off < 0 {
+		return 0, resource.ErrInvalidSeek
 	}
 
 	mutexMapMutex.Lock()
@@ -199,11 +259,52 @@ func (r *FullCacheResourceReader) Read(p []byte) (int, error) {
 	mu.Lock()
 	defer mu.Unlock()
 
+	// Cached size is only accessed with the lock held
+	if r.resource.cachedSize > 0 && off >= r.resource.cachedSize {
+		return 0, io.EOF
+	}
+
+	if r.passthrough != nil {
+		return r.readPassthroughAt(p, off)
+	}
+
+	stats := r.resource.options.Stats
 	reader, header, err := r.resource.Cache.GetWithReader(r.resource.CacheKey)
-	if errors.Is(err, diskcache.ErrItemNotFound) {
-		n, err := r.resource.Cache.SetWithReader(r.resource.CacheKey, r.underlyingReader)
+	if errors.Is(err, cache.ErrItemNotFound) {
+		r.counted = true
+		if stats != nil {
+			stats.Misses.Add(1)
+		}
+
+		// Closed after caching, but the item was evicted since, or reopening failed
+		if r.underlyingReader == nil {
+			if err := r.reopenUnderlying(); err != nil {
+				return 0, err
+			}
+		}
+
+		// Counted, as the underlying reader cant be rewound when the cache ran out of space after reading from it
+		underlying := &countingReader{reader: resource.NewContextReader(ctx, r.underlyingReader)}
+		n, err := r.resource.Cache.SetWithReader(r.resource.CacheKey, underlying, r.resource.options.CacheSetOptions...)
+		if errors.Is(err, cache.ErrInsufficientSpace) {
+			if err := r.fillPassthrough(underlying.read > 0); err != nil {
+				return 0, err
+			}
+			if stats != nil {
+				stats.Passthroughs.Add(1)
+				stats.BytesFromUnderlying.Add(underlying.read + int64(len(r.passthrough)))
+			}
+			return r.readPassthroughAt(p, off)
+		}
+		if stats != nil {
+			stats.BytesFromUnderlying.Add(n)
+		}
 		if err != nil {
-			return int(n), err
+			// The underlying reader was partly consumed e.g. when ctx was done, so the next read starts over
+			if reopenErr := r.reopenUnderlying(); reopenErr != nil {
+				return 0, errors.Join(err, reopenErr)
+			}
+			return 0, err
 		}
 		// Free resources, we wont need it anymore
 		if err := r.underlyingReader.Close(); err != nil {
@@ -217,17 +318,25 @@ func (r *FullCacheResourceReader) Read(p []byte) (int, error) {
 		}
 	} else if err != nil {
 		return 0, fmt.Errorf("failed getting item from cache: %w", err)
+	} else if !r.counted {
+		r.counted = true
+		r.hit = true
+		if stats != nil {
+			stats.Hits.Add(1)
+		}
 	}
 
 	defer reader.Close()
 
-	_, err = reader.Seek(r.index, io.SeekStart)
+	_, err = reader.Seek(off, io.SeekStart)
 	if err != nil {
-		return 0, fmt.Errorf("failed seeking cache-reader to %d: %w", r.index, err)
+		return 0, fmt.Errorf("failed seeking cache-reader to %d: %w", off, err)
 	}
 
 	n, err := reader.Read(p)
-	r.index += int64(n)
+	if r.hit && stats != nil {
+		stats.BytesFromCache.Add(int64(n))
+	}
 
 	// Update cachedSize on read
 	r.resource.cachedSize = header.Size
@@ -236,3 +345,95 @@ func (r *FullCacheResourceReader) Read(p []byte) (int, error) {
 
 	return n, err
 }
+
+func (r *FullCacheResourceReader) reopenUnderlying() error {
+	if r.underlyingReader != nil {
+		if err := r.underlyingReader.Close(); err != nil {
+			return fmt.Errorf("failed closing underlying reader: %w", err)
+		}
+	}
+	underlyingReader, err := r.resource.UnderlyingResource.Open()
+	if err != nil {
+		r.underlyingReader = nil
+		return fmt.Errorf("failed reopening underlying resource: %w", err)
+	}
+	r.underlyingReader = underlyingReader
+	return nil
+}
+
+// fillPassthrough reads the underlying reader into memory, to serve it uncached
+// When it was already read from, its reopened to start over; Not aborted by ctx, as the content is needed to serve the read
+func (r *FullCacheResourceReader) fillPassthrough(reopen bool) error {
+	if reopen {
+		if err := r.reopenUnderlying(); err != nil {
+			return err
+		}
+	}
+	content, err := io.ReadAll(r.underlyingReader)
+	if err != nil {
+		return fmt.Errorf("failed reading underlying reader for passthrough: %w", err)
+	}
+	if err := r.underlyingReader.Close(); err != nil {
+		return fmt.Errorf("failed closing underlying reader: %w", err)
+	}
+	r.underlyingReader = nil
+	r.passthrough = content
+
+	r.resource.cachedSize = int64(len(r.passthrough))
+	r.resource.cachedSizeAccurate = true
+	r.resource.cachedSizeAccurateCached = true
+	return nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	reader io.Reader
+	read   int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	return n, err
+}
+
+func (r *FullCacheResourceReader) readPassthroughAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(r.passthrough)) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.passthrough[off:])
+	return n, nil
+}
+
+// Prefetch reads the content of the underlying resource into cache, unless already cached
+func (r *FullCacheResource) Prefetch() error {
+	mutexMapMutex.Lock()
+	mu := mutexMap[r.CacheKey]
+	mutexMapMutex.Unlock()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if exists, _ := r.Cache.Exists(r.CacheKey); exists {
+		return nil
+	}
+
+	underlyingReader, err := r.UnderlyingResource.Open()
+	if err != nil {
+		return fmt.Errorf("failed opening underlying resource: %w", err)
+	}
+	defer underlyingReader.Close()
+
+	n, err := r.Cache.SetWithReader(r.CacheKey, underlyingReader, r.options.CacheSetOptions...)
+	if r.options.Stats != nil {
+		r.options.Stats.BytesFromUnderlying.Add(n)
+	}
+	if err != nil {
+		return fmt.Errorf("failed caching %s: %w", r.CacheKey, err)
+	}
+
+	r.cachedSize = n
+	r.cachedSizeAccurate = true
+	r.cachedSizeAccurateCached = true
+	return nil
+}
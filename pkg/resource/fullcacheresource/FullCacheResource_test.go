@@ -0,0 +1,116 @@
+package fullcacheresource_test
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/memorycache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/bytesresource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/fullcacheresource"
+)
+
+// openCountingResource counts how often its opened
+type openCountingResource struct {
+	bytesresource.BytesResource
+	opens atomic.Int64
+}
+
+func (r *openCountingResource) Open() (io.ReadCloser, error) {
+	r.opens.Add(1)
+	return r.BytesResource.Open()
+}
+
+// noSpaceCache runs out of space after reading consume bytes of an item
+type noSpaceCache struct {
+	*memorycache.Cache
+	consume int64
+}
+
+func (c *noSpaceCache) SetWithReader(_ string, reader io.Reader, _ ...cache.SetOption) (int64, error) {
+	n, _ := io.CopyN(io.Discard, reader, c.consume)
+	return n, cache.ErrInsufficientSpace
+}
+
+func TestFullCacheResourcePassthrough(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("Hello World")
+	for _, test := range []struct {
+		name    string
+		consume int64
+		opens   int64
+	}{
+		{"RejectedUpfront", 0, 1},
+		{"RejectedWhileReading", 5, 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			memoryCache, err := memorycache.NewCache(&memorycache.CacheOptions{MaxSize: 100})
+			if err != nil {
+				t.Fatal(err)
+			}
+			underlying := &openCountingResource{BytesResource: bytesresource.BytesResource{Content: content}}
+			stats := &fullcacheresource.Stats{}
+			fileResource := fullcacheresource.NewFullCacheResource(underlying, "passthrough-"+test.name, &noSpaceCache{Cache: memoryCache, consume: test.consume}, &fullcacheresource.FullCacheResourceOptions{Stats: stats})
+
+			reader, err := fileResource.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			read, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(read, content) {
+				t.Errorf("expected %q passed through, got %q", content, read)
+			}
+			if opens := underlying.opens.Load(); opens != test.opens {
+				t.Errorf("expected underlying resource to be opened %d times, got %d", test.opens, opens)
+			}
+			if stats.Passthroughs.Load() != 1 || stats.BytesFromUnderlying.Load() != test.consume+int64(len(content)) {
+				t.Errorf("expected 1 passthrough of %d bytes, got %d of %d", test.consume+int64(len(content)), stats.Passthroughs.Load(), stats.BytesFromUnderlying.Load())
+			}
+		})
+	}
+}
+
+func TestFullCacheResourceConcurrentReads(t *testing.T) {
+	t.Parallel()
+
+	memoryCache, err := memorycache.NewCache(&memorycache.CacheOptions{MaxSize: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := bytes.Repeat([]byte("Hello World "), 50)
+	fileResource := fullcacheresource.NewFullCacheResource(&openCountingResource{BytesResource: bytesresource.BytesResource{Content: content}}, "concurrent", memoryCache, &fullcacheresource.FullCacheResourceOptions{})
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			reader, err := fileResource.Open()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer reader.Close()
+
+			if read, err := io.ReadAll(reader); err != nil || !bytes.Equal(read, content) {
+				t.Errorf("expected content read concurrently, got %d bytes and %v", len(read), err)
+			}
+			if size, err := fileResource.Size(); err != nil || size != int64(len(content)) {
+				t.Errorf("expected size %d, got %d and %v", len(content), size, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
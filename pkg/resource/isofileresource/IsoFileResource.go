@@ -0,0 +1,136 @@
+package isofileresource
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/offsetresource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/parallelmergerresource"
+)
+
+// IsoFileResource gives access to the files in an ISO9660 or UDF disc-image
+// Images dont compress, so each file is an offset-view into the underlying resource
+type IsoFileResource struct {
+	resource resource.ReadSeekCloseableResource
+}
+
+// IsoFile is a file in the image with the positions of its data
+// Files are usually stored in one extent, but can be split into multiple e.g. when larger than 4GiB in ISO9660
+type IsoFile struct {
+	Name    string
+	Size    int64
+	Extents []IsoExtent
+}
+
+type IsoExtent struct {
+	Offset int64
+	Size   int64
+}
+
+var ErrNoFilesystem = errors.New("neither UDF nor ISO9660 filesystem found")
+
+func NewIsoFileResource(resource resource.ReadSeekCloseableResource) *IsoFileResource {
+	return &IsoFileResource{
+		resource: resource,
+	}
+}
+
+// GetFiles lists all files in the image with their full path.
+// UDF is preferred when available, as its used by Blu-rays and DVDs with ISO9660 only as fallback.
+// Only the filesystem-structures are read.
+func (r *IsoFileResource) GetFiles() ([]IsoFile, error) {
+	reader, err := r.resource.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed opening underlying resource: %w", err)
+	}
+	defer reader.Close()
+
+	size, err := reader.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting image size: %w", err)
+	}
+	image := &imageReader{reader: reader, size: size}
+
+	isUdf, err := image.hasUdf()
+	if err != nil {
+		return nil, err
+	}
+	if isUdf {
+		files, err := image.listUdf()
+		if err != nil {
+			return nil, fmt.Errorf("failed listing UDF: %w", err)
+		}
+		return files, nil
+	}
+
+	isIso9660, err := image.hasIso9660()
+	if err != nil {
+		return nil, err
+	}
+	if isIso9660 {
+		files, err := image.listIso9660()
+		if err != nil {
+			return nil, fmt.Errorf("failed listing ISO9660: %w", err)
+		}
+		return files, nil
+	}
+
+	return nil, ErrNoFilesystem
+}
+
+// GetFileResource returns the resource for a file listed by GetFiles
+func (r *IsoFileResource) GetFileResource(file IsoFile) resource.ReadSeekCloseableResource {
+	if len(file.Extents) == 0 {
+		return offsetresource.NewOffsetResource(r.resource, 0, 0)
+	}
+	if len(file.Extents) == 1 {
+		return offsetresource.NewOffsetResource(r.resource, file.Extents[0].Offset, file.Extents[0].Size)
+	}
+
+	extents := make([]resource.ReadSeekCloseableResource, len(file.Extents))
+	for i, extent := range file.Extents {
+		extents[i] = offsetresource.NewOffsetResource(r.resource, extent.Offset, extent.Size)
+	}
+	return parallelmergerresource.NewParallelMergerResource(extents)
+}
+
+const sectorSize = 2048
+
+// imageReader reads from arbitrary positions in the image
+type imageReader struct {
+	reader io.ReadSeeker
+	size   int64
+}
+
+// readAt reads length bytes at offset; Lengths come from the image, so they are checked against its size before allocating
+func (r *imageReader) readAt(offset, length int64) ([]byte, error) {
+	if offset < 0 || length < 0 || offset+length > r.size {
+		return nil, fmt.Errorf("reading %d bytes at %d exceeds image of %d bytes: %w", length, offset, r.size, io.ErrUnexpectedEOF)
+	}
+	if _, err := r.reader.Seek(offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed seeking to %d: %w", offset, err)
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r.reader, buf); err != nil {
+		return nil, fmt.Errorf("failed reading %d bytes at %d: %w", length, offset, err)
+	}
+	return buf, nil
+}
+
+func (r *imageReader) readSector(sector int64) ([]byte, error) {
+	return r.readAt(sector*sectorSize, sectorSize)
+}
+
+// readVolumeDescriptorId returns the standard-identifier of the volume-descriptor at the sector, or "" when the image ends before
+func (r *imageReader) readVolumeDescriptorId(sector int64) (byte, string, error) {
+	data, err := r.readSector(sector)
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return 0, "", nil
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	return data[0], string(data[1:6]), nil
+}
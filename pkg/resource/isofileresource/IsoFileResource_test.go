@@ -0,0 +1,297 @@
+package isofileresource_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"os"
+	"testing"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/bytesresource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/isofileresource"
+)
+
+func patternContent(size, factor, modulo int) string {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte((i * factor) % modulo)
+	}
+	return string(content)
+}
+
+func readGzipFixture(t *testing.T, name string) []byte {
+	t.Helper()
+
+	file, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatalf("failed opening fixture: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("failed opening gzip: %v", err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed reading fixture: %v", err)
+	}
+	return data
+}
+
+func checkFiles(t *testing.T, image []byte, expected map[string]string) {
+	t.Helper()
+
+	isoResource := isofileresource.NewIsoFileResource(&bytesresource.BytesResource{Content: image})
+	files, err := isoResource.GetFiles()
+	if err != nil {
+		t.Fatalf("failed listing files: %v", err)
+	}
+	if len(files) != len(expected) {
+		t.Fatalf("expected %d files, got %d: %v", len(expected), len(files), files)
+	}
+
+	for _, file := range files {
+		content, ok := expected[file.Name]
+		if !ok {
+			t.Errorf("unexpected file %s", file.Name)
+			continue
+		}
+		if file.Size != int64(len(content)) {
+			t.Errorf("expected size %d for %s, got %d", len(content), file.Name, file.Size)
+		}
+
+		reader, err := isoResource.GetFileResource(file).Open()
+		if err != nil {
+			t.Fatalf("failed opening %s: %v", file.Name, err)
+		}
+
+		read, err := io.ReadAll(reader)
+		if err != nil {
+			t.Errorf("failed reading %s: %v", file.Name, err)
+		}
+		if string(read) != content {
+			t.Errorf("content mismatch for %s", file.Name)
+		}
+
+		// Seek back into the middle
+		offset := int64(len(content) / 2)
+		if _, err := reader.Seek(offset, io.SeekStart); err != nil {
+			t.Errorf("failed seeking %s: %v", file.Name, err)
+		}
+		read, err = io.ReadAll(reader)
+		if err != nil {
+			t.Errorf("failed reading %s after seek: %v", file.Name, err)
+		}
+		if string(read) != content[offset:] {
+			t.Errorf("content mismatch for %s after seek", file.Name)
+		}
+
+		reader.Close()
+	}
+}
+
+var isoContents = map[string]string{
+	"readme.txt":                       "Hello ISO",
+	"A long file name with spaces.txt": "long name content",
+	"VIDEO_TS/VTS_01_1.VOB":            patternContent(5000, 7, 251),
+	"BDMV/STREAM/00000.m2ts":           patternContent(3000, 13, 241),
+}
+
+func TestIsoFileResourceIso9660(t *testing.T) {
+	t.Parallel()
+
+	checkFiles(t, readGzipFixture(t, "plain.iso.gz"), map[string]string{
+		"README.TXT":            isoContents["readme.txt"],
+		"A_LONG_F.TXT":          isoContents["A long file name with spaces.txt"],
+		"VIDEO_TS/VTS_01_1.VOB": isoContents["VIDEO_TS/VTS_01_1.VOB"],
+		"BDMV/STREAM/00000.M2T": isoContents["BDMV/STREAM/00000.m2ts"],
+	})
+}
+
+func TestIsoFileResourceJoliet(t *testing.T) {
+	t.Parallel()
+
+	checkFiles(t, readGzipFixture(t, "joliet.iso.gz"), isoContents)
+}
+
+func TestIsoFileResourceRockRidge(t *testing.T) {
+	t.Parallel()
+
+	checkFiles(t, readGzipFixture(t, "rockridge.iso.gz"), isoContents)
+}
+
+func TestIsoFileResourceNoFilesystem(t *testing.T) {
+	t.Parallel()
+
+	isoResource := isofileresource.NewIsoFileResource(&bytesresource.BytesResource{Content: make([]byte, 64*2048)})
+	if _, err := isoResource.GetFiles(); err == nil {
+		t.Errorf("expected error for image without filesystem")
+	}
+}
+
+func TestIsoFileResourceCorruptRootRecord(t *testing.T) {
+	t.Parallel()
+
+	// Size of the root record in the primary volume-descriptor
+	const rootSizeOffset = 16*2048 + 156 + 10
+
+	for _, size := range []uint32{0, 0xFFFFFFFF} {
+		image := readGzipFixture(t, "plain.iso.gz")
+		binary.LittleEndian.PutUint32(image[rootSizeOffset:], size)
+
+		isoResource := isofileresource.NewIsoFileResource(&bytesresource.BytesResource{Content: image})
+		if _, err := isoResource.GetFiles(); err == nil {
+			t.Errorf("expected error for root record with size %d", size)
+		}
+	}
+}
+
+// udfImage writes a minimal UDF image with a single physical partition
+type udfImage struct {
+	data           []byte
+	partitionStart int
+}
+
+const udfSector = 2048
+
+func (u *udfImage) sector(sector int) []byte {
+	end := (sector + 1) * udfSector
+	if end > len(u.data) {
+		u.data = append(u.data, make([]byte, end-len(u.data))...)
+	}
+	return u.data[sector*udfSector : end]
+}
+
+func (u *udfImage) block(block int) []byte {
+	return u.sector(u.partitionStart + block)
+}
+
+// write copies data starting at a block, spanning as many blocks as needed
+func (u *udfImage) write(block int, data []byte) {
+	for i := 0; i*udfSector < len(data); i++ {
+		copy(u.block(block+i), data[i*udfSector:])
+	}
+}
+
+func putTag(data []byte, id uint16) {
+	binary.LittleEndian.PutUint16(data[0:2], id)
+}
+
+func putLongAd(data []byte, length uint32, block uint32) {
+	binary.LittleEndian.PutUint32(data[0:4], length)
+	binary.LittleEndian.PutUint32(data[4:8], block)
+}
+
+// fileEntry writes a file entry with short allocation descriptors, or embedded data when no extents are given
+func (u *udfImage) fileEntry(block int, isDir bool, size int, extents [][2]int, embedded []byte) {
+	data := u.block(block)
+	putTag(data, 261)
+	if isDir {
+		data[27] = 4
+	}
+	binary.LittleEndian.PutUint64(data[56:64], uint64(size))
+
+	if embedded != nil {
+		binary.LittleEndian.PutUint16(data[34:36], 3)
+		binary.LittleEndian.PutUint32(data[172:176], uint32(len(embedded)))
+		copy(data[176:], embedded)
+		return
+	}
+
+	binary.LittleEndian.PutUint32(data[172:176], uint32(len(extents)*8))
+	for i, extent := range extents {
+		binary.LittleEndian.PutUint32(data[176+i*8:], uint32(extent[1]))
+		binary.LittleEndian.PutUint32(data[180+i*8:], uint32(extent[0]))
+	}
+}
+
+func fileIdentifier(name string, isDir, isParent bool, icbBlock int) []byte {
+	var encoded []byte
+	if name != "" {
+		encoded = append([]byte{8}, name...)
+	}
+	fid := make([]byte, (38+len(encoded)+3)&^3)
+	putTag(fid, 257)
+	if isDir {
+		fid[18] |= 0x02
+	}
+	if isParent {
+		fid[18] |= 0x08
+	}
+	fid[19] = byte(len(encoded))
+	putLongAd(fid[20:36], udfSector, uint32(icbBlock))
+	copy(fid[38:], encoded)
+	return fid
+}
+
+func (u *udfImage) directory(entryBlock, dataBlock, parentBlock int, fids ...[]byte) {
+	data := append(fileIdentifier("", true, true, parentBlock), bytes.Join(fids, nil)...)
+	u.write(dataBlock, data)
+	u.fileEntry(entryBlock, true, len(data), [][2]int{{dataBlock, len(data)}}, nil)
+}
+
+func buildUdfImage(video, readme string) []byte {
+	u := &udfImage{partitionStart: 300}
+
+	// Volume recognition sequence
+	for i, id := range []string{"BEA01", "NSR02", "TEA01"} {
+		copy(u.sector(16 + i)[1:6], id)
+	}
+
+	// Anchor pointing at the volume descriptor sequence
+	anchor := u.sector(256)
+	putTag(anchor, 2)
+	binary.LittleEndian.PutUint32(anchor[16:20], 3*udfSector)
+	binary.LittleEndian.PutUint32(anchor[20:24], 32)
+
+	partition := u.sector(32)
+	putTag(partition, 5)
+	binary.LittleEndian.PutUint32(partition[188:192], uint32(u.partitionStart))
+
+	logicalVolume := u.sector(33)
+	putTag(logicalVolume, 6)
+	binary.LittleEndian.PutUint32(logicalVolume[212:216], udfSector)
+	putLongAd(logicalVolume[248:264], udfSector, 0)
+	binary.LittleEndian.PutUint32(logicalVolume[268:272], 1)
+	logicalVolume[440], logicalVolume[441] = 1, 6
+
+	putTag(u.sector(34), 8)
+
+	// File set descriptor
+	fileSet := u.block(0)
+	putTag(fileSet, 256)
+	putLongAd(fileSet[400:416], udfSector, 1)
+
+	// Root with VIDEO_TS directory and an embedded readme
+	u.directory(1, 2, 1,
+		fileIdentifier("VIDEO_TS", true, false, 3),
+		fileIdentifier("readme.txt", false, false, 5),
+	)
+	u.directory(3, 4, 1,
+		fileIdentifier("VTS_01_1.VOB", false, false, 6),
+	)
+	u.fileEntry(5, false, len(readme), nil, []byte(readme))
+
+	// Video is split into two extents which arent contiguous, the second is allocated in full blocks
+	firstExtent := 2 * udfSector
+	u.write(10, []byte(video[:firstExtent]))
+	u.write(20, []byte(video[firstExtent:]))
+	secondExtent := (len(video) - firstExtent + udfSector - 1) / udfSector * udfSector
+	u.fileEntry(6, false, len(video), [][2]int{{10, firstExtent}, {20, secondExtent}}, nil)
+
+	return u.data
+}
+
+func TestIsoFileResourceUdf(t *testing.T) {
+	t.Parallel()
+
+	video := patternContent(3*udfSector+100, 7, 251)
+	readme := "Hello UDF"
+
+	checkFiles(t, buildUdfImage(video, readme), map[string]string{
+		"readme.txt":            readme,
+		"VIDEO_TS/VTS_01_1.VOB": video,
+	})
+}
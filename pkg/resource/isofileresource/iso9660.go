@@ -0,0 +1,319 @@
+package isofileresource
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	iso9660FirstDescriptor = 16
+	iso9660MaxDescriptors  = 64
+
+	iso9660TypePrimary       = 1
+	iso9660TypeSupplementary = 2
+	iso9660TypeTerminator    = 255
+
+	iso9660FlagDirectory   = 0x02
+	iso9660FlagMultiExtent = 0x80
+)
+
+var ErrIso9660Corrupt = errors.New("corrupt ISO9660 structure")
+
+func (r *imageReader) hasIso9660() (bool, error) {
+	_, id, err := r.readVolumeDescriptorId(iso9660FirstDescriptor)
+	return id == "CD001", err
+}
+
+type iso9660Record struct {
+	extent    int64
+	size      int64
+	flags     byte
+	name      []byte
+	systemUse []byte
+}
+
+func parseIso9660Record(data []byte) (iso9660Record, error) {
+	if len(data) < 34 {
+		return iso9660Record{}, ErrIso9660Corrupt
+	}
+	length := int(data[0])
+	if length < 34 || length > len(data) {
+		return iso9660Record{}, ErrIso9660Corrupt
+	}
+	nameLength := int(data[32])
+	if 33+nameLength > length {
+		return iso9660Record{}, ErrIso9660Corrupt
+	}
+
+	systemUseStart := 33 + nameLength
+	// Padding to even length
+	if nameLength%2 == 0 {
+		systemUseStart++
+	}
+	systemUseStart = min(systemUseStart, length)
+
+	return iso9660Record{
+		extent:    int64(binary.LittleEndian.Uint32(data[2:6])) + int64(data[1]),
+		size:      int64(binary.LittleEndian.Uint32(data[10:14])),
+		flags:     data[25],
+		name:      data[33 : 33+nameLength],
+		systemUse: data[systemUseStart:length],
+	}, nil
+}
+
+// iso9660Walker holds the state while walking the directory-tree
+type iso9660Walker struct {
+	image *imageReader
+	// Decodes the identifiers of the used volume-descriptor
+	decodeName func([]byte) string
+	// Rock Ridge is used for names, with this many bytes to skip in each system-use area
+	rockRidge     bool
+	rockRidgeSkip int
+	visited       map[int64]struct{}
+	files         []IsoFile
+}
+
+func (r *imageReader) listIso9660() ([]IsoFile, error) {
+	var primary, joliet []byte
+	for sector := int64(iso9660FirstDescriptor); sector < iso9660FirstDescriptor+iso9660MaxDescriptors; sector++ {
+		descriptor, err := r.readSector(sector)
+		if err != nil {
+			return nil, err
+		}
+		if string(descriptor[1:6]) != "CD001" || descriptor[0] == iso9660TypeTerminator {
+			break
+		}
+
+		switch descriptor[0] {
+		case iso9660TypePrimary:
+			if primary == nil {
+				primary = descriptor
+			}
+		case iso9660TypeSupplementary:
+			if isJolietEscape(descriptor[88:91]) {
+				joliet = descriptor
+			}
+		}
+	}
+	if primary == nil {
+		return nil, fmt.Errorf("%w: no primary volume-descriptor", ErrIso9660Corrupt)
+	}
+
+	walker := &iso9660Walker{
+		image:      r,
+		decodeName: decodeIso9660Name,
+		visited:    make(map[int64]struct{}),
+	}
+
+	// Prefer Rock Ridge on primary, then Joliet
+	root, err := parseIso9660Record(primary[156:190])
+	if err != nil {
+		return nil, err
+	}
+	walker.rockRidge, walker.rockRidgeSkip, err = walker.detectRockRidge(root)
+	if err != nil {
+		return nil, err
+	}
+	if !walker.rockRidge && joliet != nil {
+		if root, err = parseIso9660Record(joliet[156:190]); err != nil {
+			return nil, err
+		}
+		walker.decodeName = decodeJolietName
+	}
+
+	if err := walker.walk(root, ""); err != nil {
+		return nil, err
+	}
+	return walker.files, nil
+}
+
+func isJolietEscape(escape []byte) bool {
+	return escape[0] == '%' && escape[1] == '/' && (escape[2] == '@' || escape[2] == 'C' || escape[2] == 'E')
+}
+
+// detectRockRidge checks the "." record of the root for the SUSP-indicator
+func (w *iso9660Walker) detectRockRidge(root iso9660Record) (bool, int, error) {
+	data, err := w.image.readAt(root.extent*sectorSize, min(root.size, sectorSize))
+	if err != nil {
+		return false, 0, err
+	}
+	self, err := parseIso9660Record(data)
+	if err != nil {
+		return false, 0, err
+	}
+
+	su := self.systemUse
+	if len(su) >= 7 && string(su[0:2]) == "SP" && su[4] == 0xbe && su[5] == 0xef {
+		return true, int(su[6]), nil
+	}
+	return false, 0, nil
+}
+
+func (w *iso9660Walker) walk(dir iso9660Record, dirPath string) error {
+	if _, ok := w.visited[dir.extent]; ok {
+		return nil
+	}
+	w.visited[dir.extent] = struct{}{}
+
+	data, err := w.image.readAt(dir.extent*sectorSize, dir.size)
+	if err != nil {
+		return err
+	}
+
+	var pending *IsoFile
+	for pos := 0; pos < len(data); {
+		// Records dont cross sectors, rest of sector is zero
+		if data[pos] == 0 {
+			pos = (pos/sectorSize + 1) * sectorSize
+			continue
+		}
+
+		record, err := parseIso9660Record(data[pos:])
+		if err != nil {
+			return err
+		}
+		pos += int(data[pos])
+
+		// Self and parent
+		if len(record.name) == 1 && (record.name[0] == 0 || record.name[0] == 1) {
+			continue
+		}
+
+		name := w.decodeName(record.name)
+		if w.rockRidge {
+			entries, err := w.readSystemUse(record.systemUse[min(w.rockRidgeSkip, len(record.systemUse)):])
+			if err != nil {
+				return err
+			}
+			// Relocated directories are reached by their child-link
+			if entries.relocated {
+				continue
+			}
+			if entries.name != "" {
+				name = entries.name
+			}
+			if entries.childLink >= 0 {
+				if err := w.walkChildLink(entries.childLink, path.Join(dirPath, name)); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		filePath := path.Join(dirPath, name)
+
+		if record.flags&iso9660FlagDirectory != 0 {
+			if err := w.walk(record, filePath); err != nil {
+				return err
+			}
+			continue
+		}
+
+		extent := IsoExtent{
+			Offset: record.extent * sectorSize,
+			Size:   record.size,
+		}
+		if pending == nil || pending.Name != filePath {
+			pending = &IsoFile{Name: filePath}
+		}
+		pending.Extents = append(pending.Extents, extent)
+		pending.Size += extent.Size
+
+		// Multi-extent files continue in the next record
+		if record.flags&iso9660FlagMultiExtent == 0 {
+			w.files = append(w.files, *pending)
+			pending = nil
+		}
+	}
+
+	return nil
+}
+
+// walkChildLink walks a directory relocated by Rock Ridge, the size is taken from its "." record
+func (w *iso9660Walker) walkChildLink(extent int64, dirPath string) error {
+	data, err := w.image.readAt(extent*sectorSize, sectorSize)
+	if err != nil {
+		return err
+	}
+	self, err := parseIso9660Record(data)
+	if err != nil {
+		return err
+	}
+	return w.walk(self, dirPath)
+}
+
+type rockRidgeEntries struct {
+	name      string
+	relocated bool
+	childLink int64
+}
+
+// readSystemUse parses the SUSP-entries relevant for names and relocated directories, following continuation-areas
+func (w *iso9660Walker) readSystemUse(su []byte) (rockRidgeEntries, error) {
+	entries := rockRidgeEntries{childLink: -1}
+	var name strings.Builder
+
+	for continuations := 0; su != nil && continuations < 16; continuations++ {
+		var next []byte
+		for pos := 0; pos+4 <= len(su); {
+			length := int(su[pos+2])
+			if length < 4 || pos+length > len(su) {
+				break
+			}
+			entry := su[pos : pos+length]
+			pos += length
+
+			switch string(entry[0:2]) {
+			case "NM":
+				// Skip current- and parent-flags
+				if len(entry) > 5 && entry[4]&0x06 == 0 {
+					name.Write(entry[5:])
+				}
+			case "RE":
+				entries.relocated = true
+			case "CL":
+				if len(entry) >= 8 {
+					entries.childLink = int64(binary.LittleEndian.Uint32(entry[4:8]))
+				}
+			case "CE":
+				if len(entry) >= 28 {
+					block := int64(binary.LittleEndian.Uint32(entry[4:8]))
+					offset := int64(binary.LittleEndian.Uint32(entry[12:16]))
+					ceLength := int64(binary.LittleEndian.Uint32(entry[20:24]))
+					var err error
+					if next, err = w.image.readAt(block*sectorSize+offset, ceLength); err != nil {
+						return entries, err
+					}
+				}
+			case "ST":
+				pos = len(su)
+			}
+		}
+		su = next
+	}
+
+	entries.name = name.String()
+	return entries, nil
+}
+
+// decodeIso9660Name removes the version-suffix and trailing dot of d-characters, e.g. "FILE.TXT;1"
+func decodeIso9660Name(name []byte) string {
+	decoded := string(name)
+	if i := strings.IndexByte(decoded, ';'); i >= 0 {
+		decoded = decoded[:i]
+	}
+	return strings.TrimSuffix(decoded, ".")
+}
+
+// decodeJolietName decodes UCS-2 big-endian names
+func decodeJolietName(name []byte) string {
+	units := make([]uint16, len(name)/2)
+	for i := range units {
+		units[i] = binary.BigEndian.Uint16(name[i*2:])
+	}
+	return decodeIso9660Name(bytes.TrimRight([]byte(string(utf16.Decode(units))), "\x00"))
+}
@@ -0,0 +1,457 @@
+package isofileresource
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	udfAnchorSector = 256
+
+	udfTagAnchor                 = 2
+	udfTagPartition              = 5
+	udfTagLogicalVolume          = 6
+	udfTagTerminating            = 8
+	udfTagFileSet                = 256
+	udfTagFileIdentifier         = 257
+	udfTagAllocationExtent       = 258
+	udfTagFileEntry              = 261
+	udfTagExtendedFileEntry      = 266
+	udfFileTypeDirectory         = 4
+	udfCharacteristicDirectory   = 0x02
+	udfCharacteristicDeleted     = 0x04
+	udfCharacteristicParent      = 0x08
+	udfAllocationShort           = 0
+	udfAllocationLong            = 1
+	udfAllocationEmbedded        = 3
+	udfExtentRecorded            = 0
+	udfExtentNextAllocation      = 3
+	udfMaxAllocationContinuation = 64
+)
+
+var (
+	ErrUdfCorrupt     = errors.New("corrupt UDF structure")
+	ErrUdfUnsupported = errors.New("unsupported UDF feature")
+)
+
+// hasUdf checks the volume recognition sequence for an NSR descriptor
+func (r *imageReader) hasUdf() (bool, error) {
+	for sector := int64(iso9660FirstDescriptor); sector < iso9660FirstDescriptor+iso9660MaxDescriptors; sector++ {
+		_, id, err := r.readVolumeDescriptorId(sector)
+		if err != nil {
+			return false, err
+		}
+		switch id {
+		case "NSR02", "NSR03":
+			return true, nil
+		case "BEA01", "TEA01", "CD001", "CDW02", "BOOT2":
+			continue
+		}
+		return false, nil
+	}
+	return false, nil
+}
+
+type udfLongAd struct {
+	length    uint32
+	block     uint32
+	partition uint16
+}
+
+func parseUdfLongAd(data []byte) udfLongAd {
+	return udfLongAd{
+		length:    binary.LittleEndian.Uint32(data[0:4]) & 0x3fffffff,
+		block:     binary.LittleEndian.Uint32(data[4:8]),
+		partition: binary.LittleEndian.Uint16(data[8:10]),
+	}
+}
+
+// udfPartition maps blocks of a logical partition to image-offsets
+type udfPartition struct {
+	// Physical partitions start at a fixed sector
+	start int64
+	// Metadata partitions are mapped through the extents of the metadata-file
+	metadataExtents []IsoExtent
+}
+
+type udfFileEntry struct {
+	isDir   bool
+	size    int64
+	extents []IsoExtent
+}
+
+type udfReader struct {
+	image      *imageReader
+	partitions []udfPartition
+	visited    map[int64]struct{}
+	files      []IsoFile
+}
+
+func udfTagId(data []byte) uint16 {
+	return binary.LittleEndian.Uint16(data[0:2])
+}
+
+func (r *imageReader) listUdf() ([]IsoFile, error) {
+	anchor, err := r.readSector(udfAnchorSector)
+	if err != nil {
+		return nil, err
+	}
+	if udfTagId(anchor) != udfTagAnchor {
+		return nil, fmt.Errorf("%w: no anchor volume-descriptor pointer", ErrUdfCorrupt)
+	}
+	sequenceLength := int64(binary.LittleEndian.Uint32(anchor[16:20]))
+	sequenceStart := int64(binary.LittleEndian.Uint32(anchor[20:24]))
+
+	// Volume descriptor sequence
+	partitionStarts := make(map[uint16]int64)
+	var logicalVolume []byte
+	for sector := sequenceStart; sector < sequenceStart+sequenceLength/sectorSize; sector++ {
+		descriptor, err := r.readSector(sector)
+		if err != nil {
+			return nil, err
+		}
+		tagId := udfTagId(descriptor)
+		if tagId == udfTagTerminating {
+			break
+		}
+		switch tagId {
+		case udfTagPartition:
+			number := binary.LittleEndian.Uint16(descriptor[22:24])
+			partitionStarts[number] = int64(binary.LittleEndian.Uint32(descriptor[188:192]))
+		case udfTagLogicalVolume:
+			logicalVolume = descriptor
+		}
+	}
+	if logicalVolume == nil {
+		return nil, fmt.Errorf("%w: no logical volume descriptor", ErrUdfCorrupt)
+	}
+	if blockSize := binary.LittleEndian.Uint32(logicalVolume[212:216]); blockSize != sectorSize {
+		return nil, fmt.Errorf("%w: block size %d", ErrUdfUnsupported, blockSize)
+	}
+
+	u := &udfReader{
+		image:   r,
+		visited: make(map[int64]struct{}),
+	}
+	if err := u.readPartitionMaps(logicalVolume, partitionStarts); err != nil {
+		return nil, err
+	}
+
+	fileSetAd := parseUdfLongAd(logicalVolume[248:264])
+	fileSetOffset, err := u.blockOffset(fileSetAd.partition, fileSetAd.block)
+	if err != nil {
+		return nil, err
+	}
+	fileSet, err := r.readAt(fileSetOffset, sectorSize)
+	if err != nil {
+		return nil, err
+	}
+	if udfTagId(fileSet) != udfTagFileSet {
+		return nil, fmt.Errorf("%w: no file set descriptor", ErrUdfCorrupt)
+	}
+
+	if err := u.walk(parseUdfLongAd(fileSet[400:416]), ""); err != nil {
+		return nil, err
+	}
+	return u.files, nil
+}
+
+func (u *udfReader) readPartitionMaps(logicalVolume []byte, partitionStarts map[uint16]int64) error {
+	mapCount := int(binary.LittleEndian.Uint32(logicalVolume[268:272]))
+	var metadataFiles []int
+
+	pos := 440
+	for range mapCount {
+		if pos+2 > len(logicalVolume) {
+			return fmt.Errorf("%w: partition maps exceed descriptor", ErrUdfCorrupt)
+		}
+		mapType, mapLength := logicalVolume[pos], int(logicalVolume[pos+1])
+		if mapLength < 6 || pos+mapLength > len(logicalVolume) {
+			return fmt.Errorf("%w: invalid partition map", ErrUdfCorrupt)
+		}
+		partitionMap := logicalVolume[pos : pos+mapLength]
+		pos += mapLength
+
+		switch mapType {
+		case 1:
+			start, ok := partitionStarts[binary.LittleEndian.Uint16(partitionMap[4:6])]
+			if !ok {
+				return fmt.Errorf("%w: partition descriptor missing", ErrUdfCorrupt)
+			}
+			u.partitions = append(u.partitions, udfPartition{start: start})
+		case 2:
+			if mapLength < 44 {
+				return fmt.Errorf("%w: invalid partition map", ErrUdfCorrupt)
+			}
+			identifier := strings.TrimRight(string(partitionMap[5:28]), "\x00")
+			start, ok := partitionStarts[binary.LittleEndian.Uint16(partitionMap[38:40])]
+			if !ok {
+				return fmt.Errorf("%w: partition descriptor missing", ErrUdfCorrupt)
+			}
+
+			switch identifier {
+			case "*UDF Sparable Partition":
+				// Sparing only matters for rewritable media, images are read as is
+				u.partitions = append(u.partitions, udfPartition{start: start})
+			case "*UDF Metadata Partition":
+				// Resolved once all maps are known, the metadata-file is located in the physical partition
+				metadataFiles = append(metadataFiles, len(u.partitions))
+				u.partitions = append(u.partitions, udfPartition{
+					start: start,
+					metadataExtents: []IsoExtent{{
+						Offset: int64(binary.LittleEndian.Uint32(partitionMap[40:44])),
+					}},
+				})
+			default:
+				return fmt.Errorf("%w: partition type %q", ErrUdfUnsupported, identifier)
+			}
+		default:
+			return fmt.Errorf("%w: partition map type %d", ErrUdfUnsupported, mapType)
+		}
+	}
+
+	for _, index := range metadataFiles {
+		partition := &u.partitions[index]
+		metadataFileOffset := (partition.start + partition.metadataExtents[0].Offset) * sectorSize
+
+		entry, err := u.readFileEntryAt(metadataFileOffset, uint16(index), partition.start)
+		if err != nil {
+			return fmt.Errorf("failed reading metadata file: %w", err)
+		}
+		partition.metadataExtents = entry.extents
+	}
+
+	return nil
+}
+
+// blockOffset returns the image-offset of a block in a logical partition
+func (u *udfReader) blockOffset(partitionRef uint16, block uint32) (int64, error) {
+	if int(partitionRef) >= len(u.partitions) {
+		return 0, fmt.Errorf("%w: partition reference %d", ErrUdfCorrupt, partitionRef)
+	}
+	partition := u.partitions[partitionRef]
+
+	if partition.metadataExtents == nil {
+		return (partition.start + int64(block)) * sectorSize, nil
+	}
+
+	offset := int64(block) * sectorSize
+	for _, extent := range partition.metadataExtents {
+		if offset < extent.Size {
+			return extent.Offset + offset, nil
+		}
+		offset -= extent.Size
+	}
+	return 0, fmt.Errorf("%w: block %d outside metadata partition", ErrUdfCorrupt, block)
+}
+
+func (u *udfReader) readFileEntry(icb udfLongAd) (udfFileEntry, error) {
+	offset, err := u.blockOffset(icb.partition, icb.block)
+	if err != nil {
+		return udfFileEntry{}, err
+	}
+	return u.readFileEntryAt(offset, icb.partition, -1)
+}
+
+// readFileEntryAt reads a (extended) file entry and resolves its allocation descriptors to image-offsets
+// Short allocation descriptors are relative to the partition of the entry; physicalStart is used instead while metadata partitions are not resolved yet
+func (u *udfReader) readFileEntryAt(offset int64, partitionRef uint16, physicalStart int64) (udfFileEntry, error) {
+	data, err := u.image.readAt(offset, sectorSize)
+	if err != nil {
+		return udfFileEntry{}, err
+	}
+
+	var extendedAttributesLength, allocationLength, allocationStart int
+	switch udfTagId(data) {
+	case udfTagFileEntry:
+		extendedAttributesLength = int(binary.LittleEndian.Uint32(data[168:172]))
+		allocationLength = int(binary.LittleEndian.Uint32(data[172:176]))
+		allocationStart = 176 + extendedAttributesLength
+	case udfTagExtendedFileEntry:
+		extendedAttributesLength = int(binary.LittleEndian.Uint32(data[208:212]))
+		allocationLength = int(binary.LittleEndian.Uint32(data[212:216]))
+		allocationStart = 216 + extendedAttributesLength
+	default:
+		return udfFileEntry{}, fmt.Errorf("%w: expected file entry at %d", ErrUdfCorrupt, offset)
+	}
+	if allocationStart+allocationLength > len(data) {
+		return udfFileEntry{}, fmt.Errorf("%w: allocation descriptors exceed file entry", ErrUdfCorrupt)
+	}
+
+	entry := udfFileEntry{
+		isDir: data[27] == udfFileTypeDirectory,
+		size:  int64(binary.LittleEndian.Uint64(data[56:64])),
+	}
+
+	allocationType := binary.LittleEndian.Uint16(data[34:36]) & 0x7
+	if allocationType == udfAllocationEmbedded {
+		entry.extents = []IsoExtent{{
+			Offset: offset + int64(allocationStart),
+			Size:   min(entry.size, int64(allocationLength)),
+		}}
+		return entry, nil
+	}
+
+	resolve := func(partition uint16, block uint32) (int64, error) {
+		if physicalStart >= 0 {
+			return (physicalStart + int64(block)) * sectorSize, nil
+		}
+		return u.blockOffset(partition, block)
+	}
+
+	descriptors := data[allocationStart : allocationStart+allocationLength]
+	for continuations := 0; descriptors != nil; continuations++ {
+		if continuations > udfMaxAllocationContinuation {
+			return udfFileEntry{}, fmt.Errorf("%w: too many allocation extents", ErrUdfCorrupt)
+		}
+
+		var next []byte
+		var descriptorLength int
+		switch allocationType {
+		case udfAllocationShort:
+			descriptorLength = 8
+		case udfAllocationLong:
+			descriptorLength = 16
+		default:
+			return udfFileEntry{}, fmt.Errorf("%w: allocation descriptor type %d", ErrUdfUnsupported, allocationType)
+		}
+
+		for pos := 0; pos+descriptorLength <= len(descriptors); pos += descriptorLength {
+			rawLength := binary.LittleEndian.Uint32(descriptors[pos : pos+4])
+			extentType, length := rawLength>>30, int64(rawLength&0x3fffffff)
+			if length == 0 {
+				break
+			}
+			block := binary.LittleEndian.Uint32(descriptors[pos+4 : pos+8])
+			partition := partitionRef
+			if allocationType == udfAllocationLong {
+				partition = binary.LittleEndian.Uint16(descriptors[pos+8 : pos+10])
+			}
+
+			extentOffset, err := resolve(partition, block)
+			if err != nil {
+				return udfFileEntry{}, err
+			}
+
+			switch extentType {
+			case udfExtentRecorded:
+				entry.extents = append(entry.extents, IsoExtent{Offset: extentOffset, Size: length})
+			case udfExtentNextAllocation:
+				extent, err := u.image.readAt(extentOffset, min(length, sectorSize))
+				if err != nil {
+					return udfFileEntry{}, err
+				}
+				if udfTagId(extent) != udfTagAllocationExtent || len(extent) < 24 {
+					return udfFileEntry{}, fmt.Errorf("%w: expected allocation extent", ErrUdfCorrupt)
+				}
+				nextLength := int(binary.LittleEndian.Uint32(extent[20:24]))
+				next = extent[24:min(24+nextLength, len(extent))]
+			default:
+				return udfFileEntry{}, fmt.Errorf("%w: unrecorded extent", ErrUdfUnsupported)
+			}
+		}
+		descriptors = next
+	}
+
+	// Extents are allocated in blocks, cut to the actual size
+	remaining := entry.size
+	for i := range entry.extents {
+		entry.extents[i].Size = min(entry.extents[i].Size, remaining)
+		remaining -= entry.extents[i].Size
+	}
+
+	return entry, nil
+}
+
+func (u *udfReader) walk(icb udfLongAd, dirPath string) error {
+	entryOffset, err := u.blockOffset(icb.partition, icb.block)
+	if err != nil {
+		return err
+	}
+	if _, ok := u.visited[entryOffset]; ok {
+		return nil
+	}
+	u.visited[entryOffset] = struct{}{}
+
+	dir, err := u.readFileEntry(icb)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	for _, extent := range dir.extents {
+		extentData, err := u.image.readAt(extent.Offset, extent.Size)
+		if err != nil {
+			return err
+		}
+		data = append(data, extentData...)
+	}
+
+	for pos := 0; pos+38 <= len(data); {
+		if udfTagId(data[pos:]) != udfTagFileIdentifier {
+			return fmt.Errorf("%w: expected file identifier in %q", ErrUdfCorrupt, dirPath)
+		}
+		characteristics := data[pos+18]
+		identifierLength := int(data[pos+19])
+		childIcb := parseUdfLongAd(data[pos+20 : pos+36])
+		implementationLength := int(binary.LittleEndian.Uint16(data[pos+36 : pos+38]))
+
+		nameStart := pos + 38 + implementationLength
+		if nameStart+identifierLength > len(data) {
+			return fmt.Errorf("%w: file identifier exceeds directory", ErrUdfCorrupt)
+		}
+		name := decodeUdfName(data[nameStart : nameStart+identifierLength])
+		pos += (38 + implementationLength + identifierLength + 3) &^ 3
+
+		if characteristics&(udfCharacteristicParent|udfCharacteristicDeleted) != 0 || name == "" {
+			continue
+		}
+		filePath := path.Join(dirPath, name)
+
+		if characteristics&udfCharacteristicDirectory != 0 {
+			if err := u.walk(childIcb, filePath); err != nil {
+				return err
+			}
+			continue
+		}
+
+		entry, err := u.readFileEntry(childIcb)
+		if err != nil {
+			return fmt.Errorf("failed reading %s: %w", filePath, err)
+		}
+		u.files = append(u.files, IsoFile{
+			Name:    filePath,
+			Size:    entry.size,
+			Extents: entry.extents,
+		})
+	}
+
+	return nil
+}
+
+// decodeUdfName decodes OSTA compressed unicode, where the first byte tells if characters are 8 or 16 bit
+func decodeUdfName(name []byte) string {
+	if len(name) == 0 {
+		return ""
+	}
+
+	switch name[0] {
+	case 8:
+		runes := make([]rune, len(name)-1)
+		for i, b := range name[1:] {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	case 16:
+		units := make([]uint16, (len(name)-1)/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(name[1+i*2:])
+		}
+		return string(utf16.Decode(units))
+	}
+	return ""
+}
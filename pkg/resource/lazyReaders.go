@@ -0,0 +1,301 @@
+package resource
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// DefaultOpenWindow is how many readers of a merger are kept open by default
+const DefaultOpenWindow = 64
+
+// LazyReaders opens the readers of resources when they are first used instead of all upfront.
+// Only a window of the most recently used readers is kept open, idle ones beyond it are closed and reopened when used again.
+// Readers keep their position while closed, so this is transparent to the user
+type LazyReaders struct {
+	resources []ReadSeekCloseableResource
+	window    int
+
+	mutex   sync.Mutex
+	readers []*lazyReader
+	// Open readers, most recently used at the front
+	open *list.List
+	// Once closed, readers are closed as soon as they arent used anymore
+	closed bool
+}
+
+func NewLazyReaders(resources []ReadSeekCloseableResource, window int) *LazyReaders {
+	return &LazyReaders{
+		resources: resources,
+		window:    max(window, 1),
+		readers:   make([]*lazyReader, len(resources)),
+		open:      list.New(),
+	}
+}
+
+func (l *LazyReaders) Len() int {
+	return len(l.resources)
+}
+
+// Reader returns the reader of resource i, which only opens it once read
+func (l *LazyReaders) Reader(i int) io.ReadSeekCloser {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.readers[i] == nil {
+		l.readers[i] = &lazyReader{
+			readers: l,
+			index:   i,
+		}
+	}
+	return l.readers[i]
+}
+
+// Rewind sets the readers from index on back to their start, without touching the ones not used yet
+func (l *LazyReaders) Rewind(from int) {
+	l.mutex.Lock()
+	readers := make([]*lazyReader, 0, l.open.Len())
+	for _, reader := range l.readers[from:] {
+		if reader != nil {
+			readers = append(readers, reader)
+		}
+	}
+	l.mutex.Unlock()
+
+	for _, reader := range readers {
+		reader.mutex.Lock()
+		reader.position = 0
+		reader.mutex.Unlock()
+	}
+}
+
+// Close closes all open readers, the ones in use once they are released; They are reopened when used again, but not kept open
+func (l *LazyReaders) Close() error {
+	l.mutex.Lock()
+	l.closed = true
+	toClose := make([]*lazyReader, 0, l.open.Len())
+	for e := l.open.Front(); e != nil; e = e.Next() {
+		toClose = append(toClose, e.Value.(*lazyReader))
+	}
+	l.mutex.Unlock()
+
+	var errs []error
+	for _, reader := range toClose {
+		if err := reader.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// evict detaches the least recently used idle readers beyond the window, or all idle ones when closed; They have to be closed by the caller
+func (l *LazyReaders) evict() []io.Closer {
+	window := l.window
+	if l.closed {
+		window = 0
+	}
+
+	var toClose []io.Closer
+	for e := l.open.Back(); e != nil && l.open.Len() > window; {
+		prev := e.Prev()
+		reader := e.Value.(*lazyReader)
+		if reader.users == 0 {
+			l.open.Remove(e)
+			toClose = append(toClose, reader.open.reader)
+			reader.open = nil
+		}
+		e = prev
+	}
+	return toClose
+}
+
+type lazyReader struct {
+	readers *LazyReaders
+	index   int
+
+	// Guards position, sequential reads and seeks
+	mutex    sync.Mutex
+	position int64
+	// Guards opening, so its only opened once at a time
+	openMutex sync.Mutex
+
+	// Guarded by readers.mutex
+	open  *openReader
+	users int
+}
+
+type openReader struct {
+	reader io.ReadSeekCloser
+	// Position of reader, guarded by lazyReader.mutex
+	position int64
+	element  *list.Element
+}
+
+// acquire returns the open reader, opening it when necessary; It isnt closed until released
+func (r *lazyReader) acquire(ctx context.Context) (*openReader, error) {
+	l := r.readers
+
+	l.mutex.Lock()
+	r.users++
+	open := r.use()
+	l.mutex.Unlock()
+	if open != nil {
+		return open, nil
+	}
+
+	r.openMutex.Lock()
+	defer r.openMutex.Unlock()
+
+	// Might have been opened while waiting
+	l.mutex.Lock()
+	open = r.use()
+	l.mutex.Unlock()
+	if open != nil {
+		return open, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		r.release()
+		return nil, err
+	}
+	reader, err := l.resources[r.index].Open()
+	if err != nil {
+		r.release()
+		return nil, fmt.Errorf("failed opening resource %d: %w", r.index, err)
+	}
+
+	open = &openReader{reader: reader}
+	l.mutex.Lock()
+	open.element = l.open.PushFront(r)
+	r.open = open
+	l.mutex.Unlock()
+	return open, nil
+}
+
+// use marks the reader as most recently used, has to be called with readers.mutex held
+func (r *lazyReader) use() *openReader {
+	if r.open != nil {
+		r.readers.open.MoveToFront(r.open.element)
+	}
+	return r.open
+}
+
+func (r *lazyReader) release() {
+	l := r.readers
+
+	l.mutex.Lock()
+	r.users--
+	toClose := l.evict()
+	l.mutex.Unlock()
+
+	for _, closer := range toClose {
+		//nolint:errcheck // Reader is done with, nobody to report to
+		closer.Close()
+	}
+}
+
+func (r *lazyReader) Read(p []byte) (int, error) {
+	return r.ReadContext(context.Background(), p)
+}
+
+func (r *lazyReader) ReadContext(ctx context.Context, p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	open, err := r.acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer r.release()
+
+	// Seeks are only applied when reading
+	if open.position != r.position {
+		_, err := open.reader.Seek(r.position, io.SeekStart)
+		if err != nil {
+			return 0, fmt.Errorf("failed seeking resource %d to %d: %w", r.index, r.position, err)
+		}
+		open.position = r.position
+	}
+
+	n, err := ReadContext(ctx, open.reader, p)
+	r.position += int64(n)
+	open.position = r.position
+	return n, err
+}
+
+func (r *lazyReader) ReadAt(p []byte, off int64) (int, error) {
+	return r.ReadAtContext(context.Background(), p, off)
+}
+
+func (r *lazyReader) ReadAtContext(ctx context.Context, p []byte, off int64) (int, error) {
+	open, err := r.acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer r.release()
+
+	return ReadAtContext(ctx, open.reader, p, off)
+}
+
+// Seek only sets the position, the reader is seeked when read; Seeking from the end requires opening it
+func (r *lazyReader) Seek(offset int64, whence int) (int64, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var newPosition int64
+	switch whence {
+	case io.SeekStart:
+		newPosition = offset
+	case io.SeekCurrent:
+		newPosition = r.position + offset
+	case io.SeekEnd:
+		open, err := r.acquire(context.Background())
+		if err != nil {
+			return 0, err
+		}
+		defer r.release()
+
+		position, err := open.reader.Seek(offset, io.SeekEnd)
+		if err != nil {
+			return 0, fmt.Errorf("failed seeking resource %d: %w", r.index, err)
+		}
+		open.position = position
+		r.position = position
+		return r.position, nil
+	default:
+		return 0, ErrInvalidSeek
+	}
+
+	if newPosition < 0 {
+		return 0, ErrInvalidSeek
+	}
+	r.position = newPosition
+	return r.position, nil
+}
+
+// Close closes the reader when its idle, keeping its position for when its used again; Readers in use are left open
+func (r *lazyReader) Close() error {
+	l := r.readers
+
+	l.mutex.Lock()
+	open := r.open
+	if open == nil || r.users > 0 {
+		l.mutex.Unlock()
+		return nil
+	}
+	l.open.Remove(open.element)
+	r.open = nil
+	l.mutex.Unlock()
+
+	if err := open.reader.Close(); err != nil {
+		return fmt.Errorf("failed closing resource %d: %w", r.index, err)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package mergerresource
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -62,13 +63,18 @@ func (r *MergerResource) Size() (int64, error) {
 }
 
 func (r *MergerResourceReader) Read(p []byte) (int, error) {
+	return r.ReadContext(context.Background(), p)
+}
+
+// ReadContext passes ctx to the underlying readers
+func (r *MergerResourceReader) ReadContext(ctx context.Context, p []byte) (int, error) {
 	if len(p) == 0 {
 		return 0, nil
 	}
 
 	var totalRead int
 	for r.readerIndex < len(r.readers) {
-		readerRead, err := r.readers[r.readerIndex].Read(p[totalRead:])
+		readerRead, err := resource.ReadContext(ctx, r.readers[r.readerIndex], p[totalRead:])
 		totalRead += readerRead
 		r.index += int64(readerRead)
 		r.readerByteIndex += int64(readerRead)
@@ -90,6 +96,26 @@ func (r *MergerResourceReader) Read(p []byte) (int, error) {
 	return totalRead, io.EOF
 }
 
+func (r *MergerResourceReader) ReadAt(p []byte, off int64) (int, error) {
+	return r.ReadAtContext(context.Background(), p, off)
+}
+
+// ReadAtContext reads the underlying readers at their offsets, without touching the position of Read
+func (r *MergerResourceReader) ReadAtContext(ctx context.Context, p []byte, off int64) (int, error) {
+	sizes := make([]int64, len(r.readers))
+	for i := range r.readers {
+		size, err := r.resource.resources[i].Size()
+		if err != nil {
+			return 0, fmt.Errorf("failed getting size from underlying resource %d: %w", i, err)
+		}
+		sizes[i] = size
+	}
+	part := func(i int) io.Reader {
+		return r.readers[i]
+	}
+	return resource.ReadAtParts(ctx, part, resource.NewOffsetIndex(sizes), p, off)
+}
+
 func (r *MergerResourceReader) Close() error {
 	for i, reader := range r.readers {
 		err := reader.Close()
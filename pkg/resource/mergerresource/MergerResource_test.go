@@ -2,6 +2,8 @@ package mergerresource_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
 	"testing"
 
@@ -68,3 +70,73 @@ func TestMergerResource(t *testing.T) {
 		t.Errorf("failed to close: %v", err)
 	}
 }
+
+func TestMergerResourceReadContext(t *testing.T) {
+	t.Parallel()
+
+	resources := []resource.ReadSeekCloseableResource{
+		&bytesresource.BytesResource{Content: []byte("Hello")},
+		&bytesresource.BytesResource{Content: []byte("World")},
+	}
+
+	reader, err := mergerresource.NewMergerResource(resources).Open()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer reader.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = resource.ReadContext(ctx, reader, make([]byte, 10))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	// Reads without the cancelled ctx still work
+	buf := make([]byte, 10)
+	n, _ := reader.Read(buf)
+	if !bytes.Equal(buf[:n], []byte("HelloWorld")) {
+		t.Errorf("expected %q, got %q", "HelloWorld", buf[:n])
+	}
+}
+
+func TestMergerResourceReadAt(t *testing.T) {
+	t.Parallel()
+
+	resources := []resource.ReadSeekCloseableResource{
+		&bytesresource.BytesResource{Content: []byte("Hello")},
+		&bytesresource.BytesResource{Content: []byte("World")},
+	}
+
+	reader, err := mergerresource.NewMergerResource(resources).Open()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer reader.Close()
+	readerAt := reader.(io.ReaderAt)
+
+	buf := make([]byte, 4)
+	n, err := readerAt.ReadAt(buf, 3)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if string(buf[:n]) != "loWo" {
+		t.Errorf("expected %q, got %q", "loWo", buf[:n])
+	}
+
+	n, err = readerAt.ReadAt(buf, 8)
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("expected EOF, got %v", err)
+	}
+	if string(buf[:n]) != "ld" {
+		t.Errorf("expected %q, got %q", "ld", buf[:n])
+	}
+
+	// Position of Read is untouched
+	buf = make([]byte, 10)
+	n, _ = reader.Read(buf)
+	if string(buf[:n]) != "HelloWorld" {
+		t.Errorf("expected %q, got %q", "HelloWorld", buf[:n])
+	}
+}
@@ -2,10 +2,12 @@ package nzbpostresource
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 
 	"astuart.co/nntp"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
 	"github.com/chrisfarms/yenc"
 )
 
@@ -17,6 +19,8 @@ type NzbPostResource struct {
 	SizeHint      int64
 	SizeHintExact bool
 	NntpClient    *nntp.Client
+	// End of the post inside the whole file from the yEnc part-header, set once loaded
+	FileEnd int64
 }
 
 type NzbPostResourceReader struct {
@@ -46,12 +50,17 @@ func (r *NzbPostResourceReader) Close() error {
 }
 
 func (r *NzbPostResourceReader) Read(p []byte) (int, error) {
+	return r.ReadContext(context.Background(), p)
+}
+
+// ReadContext aborts fetching the post when ctx is done, the next read fetches it again
+func (r *NzbPostResourceReader) ReadContext(ctx context.Context, p []byte) (int, error) {
 	if len(p) == 0 {
 		return 0, nil
 	}
 
 	if r.dataReader == nil {
-		err := r.loadPostFromServer()
+		err := r.loadPostFromServer(ctx)
 		if err != nil {
 			return 0, err
 		}
@@ -63,25 +72,68 @@ func (r *NzbPostResourceReader) Read(p []byte) (int, error) {
 	return n, err
 }
 
-func (r *NzbPostResourceReader) loadPostFromServer() error {
-	res, err := r.resource.NntpClient.GetArticle(r.resource.Group, r.resource.ID)
+func (r *NzbPostResourceReader) loadPostFromServer(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	res, err := r.getArticle(ctx)
 	if err != nil {
-		return fmt.Errorf("failed getting article: %w", err)
+		return err
 	}
 	defer res.Body.Close()
 
-	part, err := yenc.Decode(res.Body)
+	// The client doesnt support ctx, so the body is checked while downloading
+	part, err := yenc.Decode(resource.NewContextReader(ctx, res.Body))
 	if err != nil {
+		// Decoder might not wrap the error of the body
+		if ctx.Err() != nil {
+			return fmt.Errorf("aborted yenc-decoding body: %w", ctx.Err())
+		}
 		return fmt.Errorf("failed yenc-decoding body: %w", err)
 	}
 
-	// Update size if differs
-	if part.Size != r.resource.SizeHint {
-		r.resource.SizeHint = part.Size
-		r.resource.SizeHintExact = true
+	// Size is exact now, from the yEnc-header
+	r.resource.SizeHint = part.Size
+	r.resource.SizeHintExact = true
+
+	r.resource.FileEnd = part.End
+	if part.End == 0 {
+		// Single-part posts have no part-header, they are the whole file
+		r.resource.FileEnd = part.Size
 	}
 
 	r.dataReader = bytes.NewReader(part.Body)
 
 	return nil
 }
+
+type articleResult struct {
+	response *nntp.Response
+	err      error
+}
+
+// getArticle requests the article, returning when ctx is done while still waiting for a connection or the response
+// The client doesnt support ctx, so the request keeps running then and its body is closed once it arrives
+func (r *NzbPostResourceReader) getArticle(ctx context.Context) (*nntp.Response, error) {
+	results := make(chan articleResult, 1)
+	go func() {
+		res, err := r.resource.NntpClient.GetArticle(r.resource.Group, r.resource.ID)
+		results <- articleResult{response: res, err: err}
+	}()
+
+	select {
+	case result := <-results:
+		if result.err != nil {
+			return nil, fmt.Errorf("failed getting article: %w", result.err)
+		}
+		return result.response, nil
+	case <-ctx.Done():
+		go func() {
+			if result := <-results; result.err == nil {
+				result.response.Body.Close()
+			}
+		}()
+		return nil, fmt.Errorf("aborted getting article: %w", ctx.Err())
+	}
+}
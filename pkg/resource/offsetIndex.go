@@ -0,0 +1,46 @@
+package resource
+
+import "sort"
+
+// OffsetIndex maps offsets to parts laid out after each other, by binary-searching the prefix-sums of their sizes
+type OffsetIndex struct {
+	// Start of each part, followed by the total size
+	starts []int64
+}
+
+func NewOffsetIndex(sizes []int64) *OffsetIndex {
+	starts := make([]int64, len(sizes)+1)
+	for i, size := range sizes {
+		starts[i+1] = starts[i] + size
+	}
+	return &OffsetIndex{starts: starts}
+}
+
+// Len is the count of parts
+func (i *OffsetIndex) Len() int {
+	return len(i.starts) - 1
+}
+
+// Size is the total size of all parts
+func (i *OffsetIndex) Size() int64 {
+	return i.starts[len(i.starts)-1]
+}
+
+func (i *OffsetIndex) Start(part int) int64 {
+	return i.starts[part]
+}
+
+func (i *OffsetIndex) PartSize(part int) int64 {
+	return i.starts[part+1] - i.starts[part]
+}
+
+// Find returns the part containing off and the offset inside it, empty parts are skipped; Offsets at or behind the end return Len()
+func (i *OffsetIndex) Find(off int64) (part int, partOffset int64) {
+	if off >= i.Size() {
+		return i.Len(), off - i.Size()
+	}
+	part = sort.Search(len(i.starts), func(k int) bool {
+		return i.starts[k] > off
+	}) - 1
+	return part, off - i.starts[part]
+}
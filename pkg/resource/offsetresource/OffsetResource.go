@@ -0,0 +1,139 @@
+package offsetresource
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
+)
+
+// OffsetResource presents a section of the underlying resource, e.g. a stored file inside a container
+type OffsetResource struct {
+	underlying resource.ReadSeekCloseableResource
+	offset     int64
+	size       int64
+}
+
+type OffsetResourceReader struct {
+	resource         *OffsetResource
+	underlyingReader io.ReadSeekCloser
+	index            int64
+}
+
+func NewOffsetResource(underlying resource.ReadSeekCloseableResource, offset, size int64) *OffsetResource {
+	return &OffsetResource{
+		underlying: underlying,
+		offset:     offset,
+		size:       size,
+	}
+}
+
+func (r *OffsetResource) Open() (io.ReadSeekCloser, error) {
+	underlyingReader, err := r.underlying.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed opening underlying resource: %w", err)
+	}
+
+	if _, err := underlyingReader.Seek(r.offset, io.SeekStart); err != nil {
+		underlyingReader.Close()
+		return nil, fmt.Errorf("failed seeking underlying resource to offset %d: %w", r.offset, err)
+	}
+
+	return &OffsetResourceReader{
+		resource:         r,
+		underlyingReader: underlyingReader,
+	}, nil
+}
+
+func (r *OffsetResource) Size() (int64, error) {
+	return r.size, nil
+}
+
+func (r *OffsetResource) IsSizeAccurate() bool {
+	return true
+}
+
+func (r *OffsetResourceReader) Read(p []byte) (int, error) {
+	remaining := r.resource.size - r.index
+	if remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	n, err := r.underlyingReader.Read(p)
+	r.index += int64(n)
+
+	// Underlying resource ending early means the section is cut off
+	if err == io.EOF && r.index < r.resource.size {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *OffsetResourceReader) ReadAt(p []byte, off int64) (int, error) {
+	return r.ReadAtContext(context.Background(), p, off)
+}
+
+// ReadAtContext reads the section at off from the underlying reader, without touching the position of Read
+func (r *OffsetResourceReader) ReadAtContext(ctx context.Context, p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, resource.ErrInvalidSeek
+	}
+	remaining := r.resource.size - off
+	if remaining <= 0 {
+		return 0, io.EOF
+	}
+	cut := int64(len(p)) > remaining
+	if cut {
+		p = p[:remaining]
+	}
+
+	n, err := resource.ReadAtContext(ctx, r.underlyingReader, p, r.resource.offset+off)
+	if n < len(p) {
+		// Underlying resource ending early means the section is cut off
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return n, err
+	}
+	if cut {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *OffsetResourceReader) Seek(offset int64, whence int) (int64, error) {
+	var newIndex int64
+
+	switch whence {
+	case io.SeekStart:
+		newIndex = offset
+	case io.SeekCurrent:
+		newIndex = r.index + offset
+	case io.SeekEnd:
+		newIndex = r.resource.size + offset
+	default:
+		return 0, resource.ErrInvalidSeek
+	}
+
+	if newIndex < 0 || newIndex > r.resource.size {
+		return 0, resource.ErrInvalidSeek
+	}
+	if newIndex == r.index {
+		return r.index, nil
+	}
+
+	if _, err := r.underlyingReader.Seek(r.resource.offset+newIndex, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed seeking underlying reader: %w", err)
+	}
+
+	r.index = newIndex
+	return r.index, nil
+}
+
+func (r *OffsetResourceReader) Close() error {
+	return r.underlyingReader.Close()
+}
@@ -0,0 +1,104 @@
+package offsetresource_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/bytesresource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/offsetresource"
+)
+
+func TestOffsetResource(t *testing.T) {
+	t.Parallel()
+
+	underlying := &bytesresource.BytesResource{Content: []byte("HelloWorldFoo")}
+	section := offsetresource.NewOffsetResource(underlying, 5, 5)
+
+	size, err := section.Size()
+	if err != nil {
+		t.Errorf("failed get Size() %v", err)
+	}
+	if size != 5 {
+		t.Errorf("expected size %d, got %d", 5, size)
+	}
+
+	reader, err := section.Open()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err = buf.ReadFrom(reader); err != nil {
+		t.Errorf("failed to read: %v", err)
+	}
+	if buf.String() != "World" {
+		t.Errorf("expected content %s, got %s", "World", buf.String())
+	}
+
+	pos, err := reader.Seek(-2, io.SeekEnd)
+	if err != nil {
+		t.Errorf("failed to SeekEnd with offset=%d: %v", -2, err)
+	}
+	if pos != 3 {
+		t.Errorf("expected position %d, got %d", 3, pos)
+	}
+
+	buf.Reset()
+	if _, err = buf.ReadFrom(reader); err != nil {
+		t.Errorf("failed to read: %v", err)
+	}
+	if buf.String() != "ld" {
+		t.Errorf("expected content %s, got %s", "ld", buf.String())
+	}
+
+	if _, err = reader.Seek(6, io.SeekStart); err != resource.ErrInvalidSeek {
+		t.Errorf("expected ErrInvalidSeek when seeking beyond section, got %v", err)
+	}
+
+	if err = reader.Close(); err != nil {
+		t.Errorf("failed to close: %v", err)
+	}
+}
+
+func TestOffsetResourceReadAt(t *testing.T) {
+	t.Parallel()
+
+	underlying := &bytesresource.BytesResource{Content: []byte("HelloWorldFoo")}
+	reader, err := offsetresource.NewOffsetResource(underlying, 5, 5).Open()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer reader.Close()
+	readerAt := reader.(io.ReaderAt)
+
+	buf := make([]byte, 3)
+	n, err := readerAt.ReadAt(buf, 1)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if string(buf[:n]) != "orl" {
+		t.Errorf("expected content %s, got %s", "orl", buf[:n])
+	}
+
+	// Section ends before the underlying resource
+	buf = make([]byte, 5)
+	n, err = readerAt.ReadAt(buf, 2)
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("expected EOF, got %v", err)
+	}
+	if string(buf[:n]) != "rld" {
+		t.Errorf("expected content %s, got %s", "rld", buf[:n])
+	}
+
+	// Position of Read is untouched
+	buf = make([]byte, 5)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		t.Errorf("failed to read: %v", err)
+	}
+	if string(buf) != "World" {
+		t.Errorf("expected content %s, got %s", "World", buf)
+	}
+}
@@ -1,6 +1,7 @@
 package parallelmergerresource
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -9,21 +10,34 @@ import (
 	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
 )
 
-// AdaptiveParallelMergerResource is a Resource type which allows combining multiple Resources as if it was one.
+// ParallelMergerResource is a Resource type which allows combining multiple Resources as if it was one.
 // It reads underlying sources in parallel, but requires their size to be known and exact!
+// As sizes are exact, positions are found by binary-search in an index of the offsets of the resources
 type ParallelMergerResource struct {
 	resources []resource.ReadSeekCloseableResource
+	// How many underlying readers are kept open per reader
+	openWindow int
+	// Built on first use
+	offsetsMutex sync.Mutex
+	offsets      *resource.OffsetIndex
 }
 
 func NewParallelMergerResource(resources []resource.ReadSeekCloseableResource) *ParallelMergerResource {
 	return &ParallelMergerResource{
-		resources: resources,
+		resources:  resources,
+		openWindow: resource.DefaultOpenWindow,
 	}
 }
 
+// SetOpenWindow sets how many underlying readers are kept open per reader, others are opened when read
+func (r *ParallelMergerResource) SetOpenWindow(window int) {
+	r.openWindow = window
+}
+
 type ParallelMergerResourceReader struct {
 	resource *ParallelMergerResource
-	readers  []io.ReadSeekCloser
+	readers  *resource.LazyReaders
+	offsets  *resource.OffsetIndex
 	// Position in data
 	index int64
 	// Active reader index
@@ -32,20 +46,17 @@ type ParallelMergerResourceReader struct {
 	readerByteIndex int64
 }
 
-// Open will also eagerly open all underlying Resources
+// Open opens the underlying Resources lazily, once their range is read
 func (r *ParallelMergerResource) Open() (io.ReadSeekCloser, error) {
-	readers := make([]io.ReadSeekCloser, len(r.resources))
-	var err error
-	for i, resource := range r.resources {
-		readers[i], err = resource.Open()
-		if err != nil {
-			return nil, fmt.Errorf("failed opening underlying resource %d: %w", i, err)
-		}
+	offsets, err := r.offsetIndex()
+	if err != nil {
+		return nil, err
 	}
 
 	return &ParallelMergerResourceReader{
 		resource:        r,
-		readers:         readers,
+		readers:         resource.NewLazyReaders(r.resources, r.openWindow),
+		offsets:         offsets,
 		index:           0,
 		readerIndex:     0,
 		readerByteIndex: 0,
@@ -53,16 +64,32 @@ func (r *ParallelMergerResource) Open() (io.ReadSeekCloser, error) {
 }
 
 func (r *ParallelMergerResource) Size() (int64, error) {
-	var totalSize int64
+	offsets, err := r.offsetIndex()
+	if err != nil {
+		return 0, err
+	}
+	return offsets.Size(), nil
+}
+
+// offsetIndex builds the index from the sizes once, they are exact so dont change
+func (r *ParallelMergerResource) offsetIndex() (*resource.OffsetIndex, error) {
+	r.offsetsMutex.Lock()
+	defer r.offsetsMutex.Unlock()
+
+	if r.offsets != nil {
+		return r.offsets, nil
+	}
+
+	sizes := make([]int64, len(r.resources))
 	for i, resource := range r.resources {
 		size, err := resource.Size()
 		if err != nil {
-			return totalSize, fmt.Errorf("failed getting size from underlying resource %d: %w", i, err)
+			return nil, fmt.Errorf("failed getting size from underlying resource %d: %w", i, err)
 		}
-
-		totalSize += size
+		sizes[i] = size
 	}
-	return totalSize, nil
+	r.offsets = resource.NewOffsetIndex(sizes)
+	return r.offsets, nil
 }
 
 type readResponse struct {
@@ -73,6 +100,11 @@ type readResponse struct {
 var ErrReadMismatch = errors.New("Read amount mismatch")
 
 func (r *ParallelMergerResourceReader) Read(p []byte) (int, error) {
+	return r.ReadContext(context.Background(), p)
+}
+
+// ReadContext passes ctx to the underlying readers
+func (r *ParallelMergerResourceReader) ReadContext(ctx context.Context, p []byte) (int, error) {
 	if len(p) == 0 {
 		return 0, nil
 	}
@@ -81,11 +113,8 @@ func (r *ParallelMergerResourceReader) Read(p []byte) (int, error) {
 	wg := sync.WaitGroup{}
 	readResponses := make([]*readResponse, 0, 1)
 
-	for r.readerIndex < len(r.readers) {
-		resourceSize, err := r.resource.resources[r.readerIndex].Size()
-		if err != nil {
-			return 0, fmt.Errorf("failed getting size from underlying resource %d: %w", r.readerIndex, err)
-		}
+	for r.readerIndex < r.readers.Len() {
+		resourceSize := r.offsets.PartSize(r.readerIndex)
 
 		// What the reader can return
 		readerRead := int(resourceSize - r.readerByteIndex)
@@ -96,16 +125,17 @@ func (r *ParallelMergerResourceReader) Read(p []byte) (int, error) {
 
 		readResponse := &readResponse{}
 		readResponses = append(readResponses, readResponse)
-		reader := r.readers[r.readerIndex]
-		buf := p[totalRead:]
+		reader := r.readers.Reader(r.readerIndex)
+		buf := p[totalRead : totalRead+readerRead]
+		lastPart := r.readerIndex == r.readers.Len()-1
 		if !done { // Start in parallel
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				readWithReader(reader, readResponse, buf)
+				readWithReader(ctx, reader, readResponse, buf, lastPart)
 			}()
 		} else { // Last reader starts sequentially, this also ensures we don't start any goroutines for only 1 reader
-			readWithReader(reader, readResponse, buf)
+			readWithReader(ctx, reader, readResponse, buf, lastPart)
 		}
 
 		// If buffer p will be full, we are done reading
@@ -140,7 +170,7 @@ func (r *ParallelMergerResourceReader) Read(p []byte) (int, error) {
 		return 0, fmt.Errorf("expected to read %d but read %d: %w", totalRead, totalReadFromResponses, ErrReadMismatch)
 	}
 
-	if r.readerIndex < len(r.readers) {
+	if r.readerIndex < r.readers.Len() {
 		// Normal response
 		return totalRead, nil
 	}
@@ -148,29 +178,39 @@ func (r *ParallelMergerResourceReader) Read(p []byte) (int, error) {
 	return totalRead, io.EOF
 }
 
-func readWithReader(reader io.Reader, response *readResponse, buf []byte) {
-	// Read from underlying reader into slice
-	n, err := reader.Read(buf)
+// readWithReader fills buf from the reader, which may return short reads
+func readWithReader(ctx context.Context, reader io.Reader, response *readResponse, buf []byte, lastPart bool) {
+	n, err := io.ReadFull(resource.NewContextReader(ctx, reader), buf)
+	if lastPart && errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
 	// Store result
 	response.n = n
 	response.err = err
 }
 
+func (r *ParallelMergerResourceReader) ReadAt(p []byte, off int64) (int, error) {
+	return r.ReadAtContext(context.Background(), p, off)
+}
+
+// ReadAtContext reads the underlying readers at their offsets in parallel, without touching the position of Read
+func (r *ParallelMergerResourceReader) ReadAtContext(ctx context.Context, p []byte, off int64) (int, error) {
+	part := func(i int) io.Reader {
+		return r.readers.Reader(i)
+	}
+	return resource.ReadAtParts(ctx, part, r.offsets, p, off)
+}
+
 func (r *ParallelMergerResourceReader) Close() error {
-	for i, reader := range r.readers {
-		err := reader.Close()
-		if err != nil {
-			return fmt.Errorf("failed closing underlying resource %d: %w", i, err)
-		}
+	err := r.readers.Close()
+	if err != nil {
+		return fmt.Errorf("failed closing underlying resources: %w", err)
 	}
 	return nil
 }
 
 func (r *ParallelMergerResourceReader) Seek(offset int64, whence int) (int64, error) {
-	resourceSize, err := r.resource.Size()
-	if err != nil {
-		return 0, err
-	}
+	resourceSize := r.offsets.Size()
 
 	var newIndex int64
 
@@ -193,23 +233,17 @@ func (r *ParallelMergerResourceReader) Seek(offset int64, whence int) (int64, er
 	}
 
 	// Find affected sub-reader
-	readerIndex, readerByteIndex, err := r.getReaderIndexAndByteIndexAtByteIndex(newIndex)
-	if err != nil {
-		return 0, fmt.Errorf("failed getting reader from index: %w", err)
-	}
+	readerIndex, readerByteIndex := r.offsets.Find(newIndex)
 
-	// Seek to position in reader
-	_, err = r.readers[readerIndex].Seek(readerByteIndex, io.SeekStart)
-	if err != nil {
-		return 0, fmt.Errorf("failed seeking reader %d to index %d: %w", readerIndex, readerByteIndex, err)
-	}
-
-	// Seek to start for all following readers
-	for i := readerIndex + 1; i < len(r.readers); i++ {
-		_, err = r.readers[i].Seek(0, io.SeekStart)
+	// At the end there is no reader to seek
+	if readerIndex < r.readers.Len() {
+		_, err := r.readers.Reader(readerIndex).Seek(readerByteIndex, io.SeekStart)
 		if err != nil {
-			return 0, fmt.Errorf("failed seeking reader %d to index 0: %w", i, err)
+			return 0, fmt.Errorf("failed seeking reader %d to index %d: %w", readerIndex, readerByteIndex, err)
 		}
+
+		// Seek to start for all following readers
+		r.readers.Rewind(readerIndex + 1)
 	}
 
 	r.index = newIndex
@@ -217,27 +251,3 @@ func (r *ParallelMergerResourceReader) Seek(offset int64, whence int) (int64, er
 	r.readerByteIndex = readerByteIndex
 	return r.index, nil
 }
-
-func (r *ParallelMergerResourceReader) getReaderIndexAndByteIndexAtByteIndex(index int64) (readerIndex int, readerByteIndex int64, err error) {
-	var byteIndex int64 = 0
-	for readerIndex := range r.readers {
-		resource := r.resource.resources[readerIndex]
-		size, err := resource.Size()
-		if err != nil {
-			return 0, 0, fmt.Errorf("failed getting size from underlying resource %d: %w", readerIndex, err)
-		}
-
-		if index <= byteIndex+size {
-			byteIndex = index - byteIndex
-
-			if byteIndex == size {
-				readerIndex++
-				byteIndex = 0
-			}
-			return readerIndex, byteIndex, nil
-		}
-		byteIndex += size
-	}
-	// Arriving here means our byteIndex is higher than the actual data
-	return 0, 0, io.ErrUnexpectedEOF
-}
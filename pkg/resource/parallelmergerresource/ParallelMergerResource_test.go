@@ -2,7 +2,10 @@ package parallelmergerresource_test
 
 import (
 	"bytes"
+	"errors"
 	"io"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
@@ -74,3 +77,255 @@ func TestParallelMergerResource(t *testing.T) {
 		t.Errorf("failed to close: %v", err)
 	}
 }
+
+func TestParallelMergerResourceConcurrentReadAt(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("Hello, parallel World!")
+	resources := []resource.ReadSeekCloseableResource{
+		&bytesresource.BytesResource{Content: content[:5]},
+		&bytesresource.BytesResource{Content: content[5:14]},
+		&bytesresource.BytesResource{Content: content[14:]},
+	}
+
+	reader, err := parallelmergerresource.NewParallelMergerResource(resources).Open()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer reader.Close()
+	readerAt := reader.(io.ReaderAt)
+
+	var wg sync.WaitGroup
+	for off := 0; off < len(content)-4; off++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			buf := make([]byte, 4)
+			n, err := readerAt.ReadAt(buf, int64(off))
+			if err != nil {
+				t.Errorf("unexpected error at %d: %v", off, err)
+			}
+			if !bytes.Equal(buf[:n], content[off:off+4]) {
+				t.Errorf("expected %q at %d, got %q", content[off:off+4], off, buf[:n])
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestParallelMergerResourceSeekEnd(t *testing.T) {
+	t.Parallel()
+
+	resources := []resource.ReadSeekCloseableResource{
+		&bytesresource.BytesResource{Content: []byte("Hel")},
+		&bytesresource.BytesResource{Content: []byte("lo")},
+	}
+
+	reader, err := parallelmergerresource.NewParallelMergerResource(resources).Open()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer reader.Close()
+
+	offset, err := reader.Seek(0, io.SeekEnd)
+	if err != nil {
+		t.Fatalf("failed to SeekEnd: %v", err)
+	}
+	if offset != 5 {
+		t.Errorf("expected offset %d, got %d", 5, offset)
+	}
+
+	n, err := reader.Read(make([]byte, 1))
+	if n != 0 || err != io.EOF {
+		t.Errorf("expected EOF at end, got n=%d err=%v", n, err)
+	}
+}
+
+// countingResource counts its currently open readers
+type countingResource struct {
+	bytesresource.BytesResource
+	open *atomic.Int32
+}
+
+type countingResourceReader struct {
+	io.ReadSeekCloser
+	open *atomic.Int32
+}
+
+func (r *countingResource) Open() (io.ReadSeekCloser, error) {
+	reader, err := r.BytesResource.Open()
+	r.open.Add(1)
+	return &countingResourceReader{ReadSeekCloser: reader, open: r.open}, err
+}
+
+func (r *countingResourceReader) Close() error {
+	r.open.Add(-1)
+	return r.ReadSeekCloser.Close()
+}
+
+func TestParallelMergerResourceLazyOpen(t *testing.T) {
+	t.Parallel()
+
+	open := &atomic.Int32{}
+	content := "Hello, lazy World!"
+	resources := make([]resource.ReadSeekCloseableResource, 0, len(content)/3)
+	for i := 0; i < len(content); i += 3 {
+		resources = append(resources, &countingResource{BytesResource: bytesresource.BytesResource{Content: []byte(content[i : i+3])}, open: open})
+	}
+
+	merger := parallelmergerresource.NewParallelMergerResource(resources)
+	merger.SetOpenWindow(2)
+	reader, err := merger.Open()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := open.Load(); n != 0 {
+		t.Errorf("expected no readers open before reading, got %d", n)
+	}
+
+	buf := new(bytes.Buffer)
+	p := make([]byte, 4)
+	for {
+		n, err := reader.Read(p)
+		buf.Write(p[:n])
+		if n := open.Load(); n > 2 {
+			t.Errorf("expected at most 2 readers open, got %d", n)
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if buf.String() != content {
+		t.Errorf("expected content %q, got %q", content, buf.String())
+	}
+
+	// Closed readers are reopened at their position
+	_, err = reader.Seek(4, io.SeekStart)
+	if err != nil {
+		t.Fatalf("failed to seek: %v", err)
+	}
+	n, err := io.ReadFull(reader, p)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(p[:n]) != content[4:8] {
+		t.Errorf("expected content %q after seeking, got %q", content[4:8], p[:n])
+	}
+
+	err = reader.Close()
+	if err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	if n := open.Load(); n != 0 {
+		t.Errorf("expected all readers closed, got %d open", n)
+	}
+}
+
+// shortReadResource returns at most 2 bytes per Read, as the io.Reader contract allows
+type shortReadResource struct {
+	bytesresource.BytesResource
+}
+
+func (r *shortReadResource) Open() (io.ReadSeekCloser, error) {
+	reader, err := r.BytesResource.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &shortReader{ReadSeekCloser: reader}, nil
+}
+
+type shortReader struct {
+	io.ReadSeekCloser
+}
+
+func (r *shortReader) Read(p []byte) (int, error) {
+	return r.ReadSeekCloser.Read(p[:min(len(p), 2)])
+}
+
+func TestParallelMergerResourceShortReads(t *testing.T) {
+	t.Parallel()
+
+	content := "Hello, short-reading World!"
+	resources := make([]resource.ReadSeekCloseableResource, 0, len(content)/9)
+	for i := 0; i < len(content); i += 9 {
+		resources = append(resources, &shortReadResource{BytesResource: bytesresource.BytesResource{Content: []byte(content[i : i+9])}})
+	}
+
+	reader, err := parallelmergerresource.NewParallelMergerResource(resources).Open()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer reader.Close()
+
+	p := make([]byte, len(content))
+	n, err := reader.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(p[:n]) != content {
+		t.Errorf("expected content %q, got %q", content, p[:n])
+	}
+}
+
+// blockingResource blocks reads until release is closed
+type blockingResource struct {
+	countingResource
+	reading chan struct{}
+	release chan struct{}
+}
+
+func (r *blockingResource) Open() (io.ReadSeekCloser, error) {
+	reader, err := r.countingResource.Open()
+	return &blockingReader{ReadSeekCloser: reader, resource: r}, err
+}
+
+type blockingReader struct {
+	io.ReadSeekCloser
+	resource *blockingResource
+}
+
+func (r *blockingReader) Read(p []byte) (int, error) {
+	close(r.resource.reading)
+	<-r.resource.release
+	return r.ReadSeekCloser.Read(p)
+}
+
+func TestParallelMergerResourceCloseWhileReading(t *testing.T) {
+	t.Parallel()
+
+	open := &atomic.Int32{}
+	blocking := &blockingResource{
+		countingResource: countingResource{BytesResource: bytesresource.BytesResource{Content: []byte("Hello")}, open: open},
+		reading:          make(chan struct{}),
+		release:          make(chan struct{}),
+	}
+	merger := parallelmergerresource.NewParallelMergerResource([]resource.ReadSeekCloseableResource{blocking})
+
+	reader, err := merger.Open()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		//nolint:errcheck // Only the reader being in use matters
+		reader.Read(make([]byte, 5))
+	}()
+	<-blocking.reading
+
+	if err := reader.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	close(blocking.release)
+	<-done
+
+	// Closed once the read released it
+	if n := open.Load(); n != 0 {
+		t.Errorf("expected reader in use while closing to be closed after, got %d open", n)
+	}
+}
@@ -7,15 +7,19 @@ import (
 
 	"git.ruekov.eu/ruakij/nzbStreamer/pkg/rardecode"
 	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
-	"golang.org/x/sync/errgroup"
 )
 
+// Volumes are read one after another, so besides the current one only the previous one is kept open for reads at the boundary
+const volumeOpenWindow = 2
+
 // RarFileResource is a utility type that allows using a byte-slice resource.
 type RarFileResource struct {
 	resources []resource.ReadSeekCloseableResource
 	password  string
 	filename  string
 	size      int64
+
+	checksumListener func(err error)
 }
 
 func NewRarFileResource(resources []resource.ReadSeekCloseableResource, password, filename string) *RarFileResource {
@@ -27,8 +31,22 @@ func NewRarFileResource(resources []resource.ReadSeekCloseableResource, password
 	}
 }
 
+// NewRarFileResourceWithSize creates a RarFileResource for a file whose unpacked size is already known,
+// so the archive doesnt have to be opened to get it
+func NewRarFileResourceWithSize(resources []resource.ReadSeekCloseableResource, password, filename string, size int64) *RarFileResource {
+	r := NewRarFileResource(resources, password, filename)
+	r.size = size
+	return r
+}
+
+// SetChecksumListener sets the function called when the file was read to its end, rar verifies a CRC32 or BLAKE2 checksum then
+func (r *RarFileResource) SetChecksumListener(listener func(err error)) {
+	r.checksumListener = listener
+}
+
 type RarFileResourceReader struct {
 	resource      *RarFileResource
+	readers       *resource.LazyReaders
 	openResources []io.Reader
 	rarReader     *rardecode.Reader
 	index         int64
@@ -42,6 +60,7 @@ func (r *RarFileResource) Open() (io.ReadSeekCloser, error) {
 
 	fileheader, err := skipToFile(reader.rarReader, r.filename)
 	if err != nil {
+		reader.Close()
 		return nil, err
 	}
 	r.size = fileheader.UnPackedSize
@@ -49,53 +68,76 @@ func (r *RarFileResource) Open() (io.ReadSeekCloser, error) {
 	return reader, nil
 }
 
+// open opens the volumes lazily, once rardecode reaches them
 func (r *RarFileResource) open() (*RarFileResourceReader, error) {
-	// Open all
-	openResources := make([]io.Reader, len(r.resources))
-	for i, resource := range r.resources {
-		reader, err := resource.Open()
-		openResources[i] = reader
-
-		if err != nil {
-			return nil, fmt.Errorf("failed opening underlying resource %d: %w", i, err)
-		}
+	readers := resource.NewLazyReaders(r.resources, volumeOpenWindow)
+	openResources := make([]io.Reader, readers.Len())
+	for i := range openResources {
+		openResources[i] = readers.Reader(i)
 	}
 
 	// Create RarReader
-	rarReader, err := rardecode.NewMultiReader(openResources, rardecode.Password(r.password))
+	rarReader, err := rardecode.NewMultiReader(openResources, r.options()...)
 	if err != nil {
+		readers.Close()
 		return nil, fmt.Errorf("failed opening rar reader: %w", err)
 	}
 
 	return &RarFileResourceReader{
 		resource:      r,
+		readers:       readers,
 		openResources: openResources,
 		rarReader:     rarReader,
 		index:         0,
 	}, nil
 }
 
-func (r *RarFileResource) GetRarFiles(limit int) ([]*rardecode.FileHeader, error) {
-	reader, err := r.open()
+// options returns the options for rardecode
+// The password is only set when there is one, as rardecode would otherwise decrypt with an empty one and fail on garbled headers instead of reporting the archive as encrypted
+func (r *RarFileResource) options() []rardecode.Option {
+	if r.password == "" {
+		return nil
+	}
+	return []rardecode.Option{rardecode.Password(r.password)}
+}
+
+// CheckPassword opens the file and reads its first byte, which fails when the file is encrypted and the password is missing or wrong.
+// Rar5 stores a password-check; Rar3 only fails here on encrypted headers or compressed data, wrong passwords on stored files are only noticed by the checksum at the end.
+func (r *RarFileResource) CheckPassword() error {
+	reader, err := r.Open()
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer reader.Close()
+
+	_, err = reader.Read(make([]byte, 1))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed reading first byte: %w", err)
+	}
+	return nil
+}
 
-	fileheaders := make([]*rardecode.FileHeader, 0, 1) // Expect at least 1 file
-	header, err := reader.rarReader.Next()
+// GetRarFiles lists all files in the archive.
+// Only the headers are read, the packed data is skipped by seeking the underlying resources.
+func (r *RarFileResource) GetRarFiles() ([]*rardecode.FileHeader, error) {
+	readers := resource.NewLazyReaders(r.resources, volumeOpenWindow)
+	defer readers.Close()
+	openResources := make([]io.Reader, readers.Len())
+	for i := range openResources {
+		openResources[i] = readers.Reader(i)
+	}
+
+	headers, err := rardecode.ListMulti(openResources, r.options()...)
 	if err != nil {
-		return nil, fmt.Errorf("failed getting initial fileheader from rar reader: %w", err)
+		return nil, fmt.Errorf("failed listing fileheaders from rar: %w", err)
 	}
-	for err == nil {
+
+	fileheaders := make([]*rardecode.FileHeader, 0, len(headers))
+	for _, header := range headers {
 		if header.IsDir {
 			continue
 		}
-
 		fileheaders = append(fileheaders, header)
-		if len(fileheaders) >= limit {
-			break
-		}
-		header, err = reader.rarReader.Next()
 	}
 
 	return fileheaders, nil
@@ -128,6 +170,10 @@ func (r *RarFileResource) Size() (int64, error) {
 }
 
 func (r *RarFileResourceReader) Close() error {
+	err := r.readers.Close()
+	if err != nil {
+		return fmt.Errorf("failed closing volumes: %w", err)
+	}
 	return nil
 }
 
@@ -139,9 +185,29 @@ func (r *RarFileResourceReader) Read(p []byte) (int, error) {
 	n, err := r.rarReader.Read(p)
 	r.index += int64(n)
 
+	if errors.Is(err, rardecode.ErrBadFileChecksum) {
+		err = fmt.Errorf("%w: %w", resource.ErrBadChecksum, err)
+	}
+	r.reportChecksum(err)
+
 	return n, err
 }
 
+// reportChecksum informs the listener when the end of the file was reached, which is when rardecode compares the checksum
+func (r *RarFileResourceReader) reportChecksum(err error) {
+	listener := r.resource.checksumListener
+	if listener == nil {
+		return
+	}
+
+	switch {
+	case errors.Is(err, io.EOF):
+		listener(nil)
+	case errors.Is(err, resource.ErrBadChecksum):
+		listener(err)
+	}
+}
+
 func (r *RarFileResourceReader) Seek(offset int64, whence int) (int64, error) {
 	var newIndex int64
 
@@ -167,36 +233,16 @@ func (r *RarFileResourceReader) Seek(offset int64, whence int) (int64, error) {
 
 	// We cannot actually seek, so seeking backwards is specially not natively supported
 	if newIndex < r.index {
-		// Just reopen the reader
-		group := errgroup.Group{}
-		for i, reader := range r.openResources {
-			readerIndex := i
-			localReader := reader
-			group.Go(func() (err error) {
-				// Check if reader implements seeker
-				if seeker, ok := localReader.(io.Seeker); ok {
-					_, err = seeker.Seek(0, io.SeekStart)
-					if err != nil {
-						return fmt.Errorf("failed seeking resource %d: %w", readerIndex, err)
-					}
-				} else {
-					// If it doesnt, reopen resource
-					r.openResources[readerIndex], err = r.resource.resources[readerIndex].Open()
-					if err != nil {
-						return fmt.Errorf("failed reopening resource %d: %w", readerIndex, err)
-					}
-				}
-				return nil
-			})
-		}
-		err := group.Wait()
-		if err != nil {
-			return 0, fmt.Errorf("failed waiting for resource operations: %w", err)
+		// Just reopen the reader from the start of the volumes; rardecode removes the volumes it passed, so they are set again
+		r.readers.Rewind(0)
+		for i := range r.openResources {
+			r.openResources[i] = r.readers.Reader(i)
 		}
 
-		r.rarReader, err = rardecode.NewMultiReader(r.openResources)
+		var err error
+		r.rarReader, err = rardecode.NewMultiReader(r.openResources, r.resource.options()...)
 		if err != nil {
-			return 0, err
+			return 0, fmt.Errorf("failed reopening rar reader: %w", err)
 		}
 
 		_, err = skipToFile(r.rarReader, r.resource.filename)
@@ -0,0 +1,272 @@
+package rarfileresource_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/rardecode"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/bytesresource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/rarfileresource"
+)
+
+const testPassword = "secret"
+
+var rarFormats = []struct {
+	name  string
+	build func([]rarTestFile, rarWriterOptions) [][]byte
+}{
+	{"Rar3", buildRar3},
+	{"Rar5", buildRar5},
+}
+
+func testFiles() []rarTestFile {
+	movie := make([]byte, 100_000)
+	for i := range movie {
+		movie[i] = byte(i * 7 % 251)
+	}
+	return []rarTestFile{
+		{Name: "readme.txt", Content: []byte("Hello Rar")},
+		{Name: "dir/movie.mkv", Content: movie},
+	}
+}
+
+func volumeResources(volumes [][]byte) []resource.ReadSeekCloseableResource {
+	resources := make([]resource.ReadSeekCloseableResource, len(volumes))
+	for i, volume := range volumes {
+		resources[i] = &bytesresource.BytesResource{Content: volume}
+	}
+	return resources
+}
+
+func TestRarFileResourceEncryptedHeaders(t *testing.T) {
+	t.Parallel()
+
+	for _, format := range rarFormats {
+		t.Run(format.name, func(t *testing.T) {
+			t.Parallel()
+
+			files := testFiles()
+			resources := volumeResources(format.build(files, rarWriterOptions{Password: testPassword, EncryptHeaders: true, Volumes: 3}))
+
+			headers, err := rarfileresource.NewRarFileResource(resources, testPassword, "").GetRarFiles()
+			if err != nil {
+				t.Fatalf("failed listing: %v", err)
+			}
+			if len(headers) != len(files) {
+				t.Fatalf("expected %d files, got %d", len(files), len(headers))
+			}
+			for i, header := range headers {
+				if header.Name != files[i].Name || header.UnPackedSize != int64(len(files[i].Content)) {
+					t.Errorf("expected %s with size %d, got %s with size %d", files[i].Name, len(files[i].Content), header.Name, header.UnPackedSize)
+				}
+			}
+
+			for _, file := range files {
+				fileResource := rarfileresource.NewRarFileResource(resources, testPassword, file.Name)
+
+				var checksumResults []error
+				fileResource.SetChecksumListener(func(err error) {
+					checksumResults = append(checksumResults, err)
+				})
+
+				reader, err := fileResource.Open()
+				if err != nil {
+					t.Fatalf("failed opening %s: %v", file.Name, err)
+				}
+
+				content, err := io.ReadAll(reader)
+				if err != nil {
+					t.Fatalf("failed reading %s: %v", file.Name, err)
+				}
+				if !bytes.Equal(content, file.Content) {
+					t.Errorf("content mismatch for %s", file.Name)
+				}
+				if len(checksumResults) != 1 || checksumResults[0] != nil {
+					t.Errorf("expected one valid checksum for %s, got %v", file.Name, checksumResults)
+				}
+
+				// Seeking backwards reopens the archive, which needs the password again
+				offset := int64(len(file.Content) / 3)
+				if _, err := reader.Seek(offset, io.SeekStart); err != nil {
+					t.Fatalf("failed seeking %s: %v", file.Name, err)
+				}
+				content, err = io.ReadAll(reader)
+				if err != nil {
+					t.Fatalf("failed reading %s after seek: %v", file.Name, err)
+				}
+				if !bytes.Equal(content, file.Content[offset:]) {
+					t.Errorf("content mismatch for %s after seek", file.Name)
+				}
+
+				reader.Close()
+			}
+		})
+	}
+}
+
+func TestRarFileResourceEncryptedHeadersPasswordErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, format := range rarFormats {
+		t.Run(format.name, func(t *testing.T) {
+			t.Parallel()
+
+			// A wrong password garbles the size of the first header in Rar3, which has to stay within the volume to show as bad CRC
+			resources := volumeResources(format.build(testFiles(), rarWriterOptions{Password: testPassword, EncryptHeaders: true, Volumes: 1}))
+
+			_, err := rarfileresource.NewRarFileResource(resources, "", "").GetRarFiles()
+			if !errors.Is(err, rardecode.ErrArchiveEncrypted) {
+				t.Errorf("expected ErrArchiveEncrypted without password, got %v", err)
+			}
+
+			_, err = rarfileresource.NewRarFileResource(resources, "wrong", "").GetRarFiles()
+			if !errors.Is(err, rardecode.ErrBadPassword) {
+				t.Errorf("expected ErrBadPassword with wrong password, got %v", err)
+			}
+
+			_, err = rarfileresource.NewRarFileResource(resources, "", "readme.txt").Open()
+			if !errors.Is(err, rardecode.ErrArchiveEncrypted) {
+				t.Errorf("expected ErrArchiveEncrypted opening without password, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRarFileResourceEncryptedHeadersTruncated(t *testing.T) {
+	t.Parallel()
+
+	files := testFiles()
+	volume := buildRar3(files, rarWriterOptions{Password: testPassword, EncryptHeaders: true, Volumes: 1})[0]
+	// Cut into the header of the movie, which is followed by its encrypted data and the end-block of salt and one cipher-block
+	headerEnd := len(volume) - len(pad16(files[1].Content)) - len(rar3Salt) - 16
+	resources := volumeResources([][]byte{volume[:headerEnd-5]})
+
+	_, err := rarfileresource.NewRarFileResource(resources, testPassword, "").GetRarFiles()
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected truncation to be reported as ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestRarFileResourceEncryptedFilesCheckPassword(t *testing.T) {
+	t.Parallel()
+
+	for _, format := range rarFormats {
+		t.Run(format.name, func(t *testing.T) {
+			t.Parallel()
+
+			resources := volumeResources(format.build(testFiles(), rarWriterOptions{Password: testPassword, Volumes: 1}))
+
+			// Headers arent encrypted, so listing works without password
+			headers, err := rarfileresource.NewRarFileResource(resources, "", "").GetRarFiles()
+			if err != nil {
+				t.Fatalf("failed listing: %v", err)
+			}
+			if len(headers) != 2 || !headers[0].Encrypted {
+				t.Fatalf("expected 2 encrypted files, got %v", headers)
+			}
+
+			err = rarfileresource.NewRarFileResource(resources, "", "readme.txt").CheckPassword()
+			if !errors.Is(err, rardecode.ErrArchivedFileEncrypted) {
+				t.Errorf("expected ErrArchivedFileEncrypted without password, got %v", err)
+			}
+
+			if err := rarfileresource.NewRarFileResource(resources, testPassword, "readme.txt").CheckPassword(); err != nil {
+				t.Errorf("expected password to be correct, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRarFileResourceBadChecksum(t *testing.T) {
+	t.Parallel()
+
+	files := testFiles()
+	volumes := buildRar5(files, rarWriterOptions{Volumes: 1})
+	// Flip a byte in the stored data of the readme
+	index := bytes.Index(volumes[0], files[0].Content)
+	volumes[0][index] ^= 0xff
+
+	fileResource := rarfileresource.NewRarFileResource(volumeResources(volumes), "", files[0].Name)
+	var checksumErr error
+	fileResource.SetChecksumListener(func(err error) {
+		checksumErr = err
+	})
+
+	reader, err := fileResource.Open()
+	if err != nil {
+		t.Fatalf("failed opening: %v", err)
+	}
+	defer reader.Close()
+
+	if _, err := io.ReadAll(reader); !errors.Is(err, resource.ErrBadChecksum) {
+		t.Errorf("expected ErrBadChecksum reading, got %v", err)
+	}
+	if !errors.Is(checksumErr, resource.ErrBadChecksum) {
+		t.Errorf("expected listener to get ErrBadChecksum, got %v", checksumErr)
+	}
+}
+
+// countingResource counts the bytes read from its readers
+type countingResource struct {
+	bytesresource.BytesResource
+	read *atomic.Int64
+}
+
+type countingResourceReader struct {
+	io.ReadSeekCloser
+	read *atomic.Int64
+}
+
+func (r *countingResource) Open() (io.ReadSeekCloser, error) {
+	reader, err := r.BytesResource.Open()
+	return &countingResourceReader{ReadSeekCloser: reader, read: r.read}, err
+}
+
+func (r *countingResourceReader) Read(p []byte) (int, error) {
+	n, err := r.ReadSeekCloser.Read(p)
+	r.read.Add(int64(n))
+	return n, err
+}
+
+func TestRarFileResourceListsFromHeaders(t *testing.T) {
+	t.Parallel()
+
+	for _, format := range rarFormats {
+		t.Run(format.name, func(t *testing.T) {
+			t.Parallel()
+
+			files := testFiles()
+			volumes := format.build(files, rarWriterOptions{Volumes: 3})
+
+			read := &atomic.Int64{}
+			var total int
+			resources := make([]resource.ReadSeekCloseableResource, len(volumes))
+			for i, volume := range volumes {
+				resources[i] = &countingResource{BytesResource: bytesresource.BytesResource{Content: volume}, read: read}
+				total += len(volume)
+			}
+
+			headers, err := rarfileresource.NewRarFileResource(resources, "", "").GetRarFiles()
+			if err != nil {
+				t.Fatalf("failed listing: %v", err)
+			}
+			if len(headers) != len(files) {
+				t.Fatalf("expected %d files, got %d", len(files), len(headers))
+			}
+			for i, header := range headers {
+				if header.Name != files[i].Name || header.UnPackedSize != int64(len(files[i].Content)) {
+					t.Errorf("expected %s with size %d, got %s with size %d", files[i].Name, len(files[i].Content), header.Name, header.UnPackedSize)
+				}
+			}
+
+			// Packed data is skipped, so only a fraction is read
+			if n := read.Load(); n > int64(total/4) {
+				t.Errorf("expected to only read headers, read %d of %d bytes", n, total)
+			}
+		})
+	}
+}
@@ -0,0 +1,366 @@
+package rarfileresource_test
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash/crc32"
+	"strings"
+	"unicode/utf16"
+)
+
+// Minimal writers for rar-archives with stored (uncompressed) files, to generate encrypted fixtures without the rar-binary.
+// Only the last file is split across volumes, the others are stored in the first.
+
+type rarTestFile struct {
+	Name    string
+	Content []byte
+}
+
+type rarWriterOptions struct {
+	Password       string
+	EncryptHeaders bool
+	Volumes        int
+}
+
+func pad16(data []byte) []byte {
+	if rem := len(data) % aes.BlockSize; rem > 0 {
+		data = append(data, make([]byte, aes.BlockSize-rem)...)
+	}
+	return data
+}
+
+func encryptCbc(key, iv, data []byte) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	out := pad16(append([]byte(nil), data...))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, out)
+	return out
+}
+
+// splitParts splits data into count parts, which dont have to align to cipher-blocks
+func splitParts(data []byte, count int) [][]byte {
+	parts := make([][]byte, count)
+	partSize := len(data)/count + 1
+	for i := range parts {
+		start := min(i*partSize, len(data))
+		end := min(start+partSize, len(data))
+		if i == count-1 {
+			end = len(data)
+		}
+		parts[i] = data[start:end]
+	}
+	return parts
+}
+
+func littleEndianCrc(data []byte) []byte {
+	return binary.LittleEndian.AppendUint32(nil, crc32.ChecksumIEEE(data))
+}
+
+// Rar 2.9 / 4.x format
+
+var rar3Salt = []byte("saltsalt")
+
+func rar3Keys(password string, salt []byte) (key, iv []byte) {
+	var seed []byte
+	for _, char := range utf16.Encode([]rune(password)) {
+		seed = append(seed, byte(char), byte(char>>8))
+	}
+	seed = append(seed, salt...)
+
+	const rounds = 0x40000
+	hash := sha1.New()
+	iv = make([]byte, 16)
+	for i := range rounds {
+		hash.Write(seed)
+		hash.Write([]byte{byte(i), byte(i >> 8), byte(i >> 16)})
+		if i%(rounds/16) == 0 {
+			iv[i/(rounds/16)] = hash.Sum(nil)[19]
+		}
+	}
+	key = hash.Sum(nil)[:16]
+	for k := key; len(k) >= 4; k = k[4:] {
+		k[0], k[1], k[2], k[3] = k[3], k[2], k[1], k[0]
+	}
+	return key, iv
+}
+
+type rar3Writer struct {
+	options rarWriterOptions
+	key, iv []byte
+}
+
+func (w *rar3Writer) block(blockType byte, flags uint16, body []byte, encrypt bool) []byte {
+	header := make([]byte, 7, 7+len(body))
+	header[2] = blockType
+	binary.LittleEndian.PutUint16(header[3:5], flags)
+	binary.LittleEndian.PutUint16(header[5:7], uint16(7+len(body)))
+	header = append(header, body...)
+	binary.LittleEndian.PutUint16(header[0:2], uint16(crc32.ChecksumIEEE(header[2:])))
+
+	if !encrypt {
+		return header
+	}
+	return append(append([]byte(nil), rar3Salt...), encryptCbc(w.key, w.iv, header)...)
+}
+
+func (w *rar3Writer) fileBlock(file rarTestFile, data []byte, splitBefore, splitAfter bool) []byte {
+	flags := uint16(0x8000)
+	if w.options.Password != "" {
+		flags |= 0x0004 | 0x0400
+	}
+	if splitBefore {
+		flags |= 0x0001
+	}
+	if splitAfter {
+		flags |= 0x0002
+	}
+
+	checksum := littleEndianCrc(file.Content)
+	if splitAfter {
+		checksum = littleEndianCrc(data)
+	}
+
+	name := strings.ReplaceAll(file.Name, "/", "\\")
+	body := binary.LittleEndian.AppendUint32(nil, uint32(len(data)))
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(file.Content)))
+	body = append(body, 2) // Host-OS
+	body = append(body, checksum...)
+	body = binary.LittleEndian.AppendUint32(body, 0x5a210000) // Dos-time
+	body = append(body, 29, 0x30)                             // Version, stored
+	body = binary.LittleEndian.AppendUint16(body, uint16(len(name)))
+	body = binary.LittleEndian.AppendUint32(body, 0x20)
+	body = append(body, name...)
+	if w.options.Password != "" {
+		body = append(body, rar3Salt...)
+	}
+
+	return append(w.block(0x74, flags, body, w.options.EncryptHeaders), data...)
+}
+
+func buildRar3(files []rarTestFile, options rarWriterOptions) [][]byte {
+	w := &rar3Writer{options: options}
+	if options.Password != "" {
+		w.key, w.iv = rar3Keys(options.Password, rar3Salt)
+	}
+
+	packed := make([][]byte, len(files))
+	for i, file := range files {
+		packed[i] = file.Content
+		if options.Password != "" {
+			packed[i] = encryptCbc(w.key, w.iv, file.Content)
+		}
+	}
+	lastParts := splitParts(packed[len(files)-1], options.Volumes)
+
+	volumes := make([][]byte, options.Volumes)
+	for v := range volumes {
+		archiveFlags := uint16(0x0010)
+		if options.Volumes > 1 {
+			archiveFlags |= 0x0001
+		}
+		if options.EncryptHeaders {
+			archiveFlags |= 0x0080
+		}
+
+		volume := []byte("Rar!\x1a\x07\x00")
+		volume = append(volume, w.block(0x73, archiveFlags, make([]byte, 6), false)...)
+		if v == 0 {
+			for i, file := range files[:len(files)-1] {
+				volume = append(volume, w.fileBlock(file, packed[i], false, false)...)
+			}
+		}
+		volume = append(volume, w.fileBlock(files[len(files)-1], lastParts[v], v > 0, v < options.Volumes-1)...)
+
+		var endFlags uint16
+		if v < options.Volumes-1 {
+			endFlags = 0x0001
+		}
+		volumes[v] = append(volume, w.block(0x7b, endFlags, nil, options.EncryptHeaders)...)
+	}
+	return volumes
+}
+
+// Rar 5 format
+
+const rar5KdfCount = 10
+
+var (
+	rar5Salt = []byte("0123456789abcdef")
+	rar5Iv   = []byte("fedcba9876543210")
+)
+
+// rar5Keys returns the key for data, the key for checksums and the password-check value
+func rar5Keys(password string, salt []byte) (key, hashKey, check []byte) {
+	prf := hmac.New(sha256.New, []byte(password))
+	prf.Write(salt)
+	prf.Write([]byte{0, 0, 0, 1})
+	t := prf.Sum(nil)
+	u := append([]byte(nil), t...)
+
+	keys := make([][]byte, 3)
+	for i, iterations := range []int{1<<rar5KdfCount - 1, 16, 16} {
+		for range iterations {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range u {
+				t[j] ^= u[j]
+			}
+		}
+		keys[i] = append([]byte(nil), t...)
+	}
+
+	check = make([]byte, 8)
+	for i, v := range keys[2] {
+		check[i%8] ^= v
+	}
+	sum := sha256.Sum256(check)
+	return keys[0], keys[1], append(check, sum[:4]...)
+}
+
+func appendVint(data []byte, value uint64) []byte {
+	for value >= 0x80 {
+		data = append(data, byte(value)|0x80)
+		value >>= 7
+	}
+	return append(data, byte(value))
+}
+
+type rar5Writer struct {
+	options             rarWriterOptions
+	key, hashKey, check []byte
+}
+
+func (w *rar5Writer) block(body []byte) []byte {
+	sized := appendVint(nil, uint64(len(body)))
+	sized = append(sized, body...)
+	header := append(binary.LittleEndian.AppendUint32(nil, crc32.ChecksumIEEE(sized)), sized...)
+
+	if !w.options.EncryptHeaders {
+		return header
+	}
+	return append(append([]byte(nil), rar5Iv...), encryptCbc(w.key, rar5Iv, header)...)
+}
+
+func (w *rar5Writer) fileBlock(file rarTestFile, data []byte, splitBefore, splitAfter bool) []byte {
+	flags := uint64(0x0002)
+	if splitBefore {
+		flags |= 0x0008
+	}
+	if splitAfter {
+		flags |= 0x0010
+	}
+
+	checksum := littleEndianCrc(file.Content)
+	if splitAfter {
+		checksum = littleEndianCrc(data)
+	}
+
+	var extra []byte
+	if w.options.Password != "" {
+		flags |= 0x0001
+
+		// Encrypted files use a MAC instead of the plain checksum
+		mac := hmac.New(sha256.New, w.hashKey)
+		mac.Write(checksum)
+		sum := mac.Sum(nil)
+		for i, v := range sum[4:] {
+			sum[i&3] ^= v
+		}
+		checksum = sum[:4]
+
+		record := appendVint(nil, 1) // Encryption
+		record = appendVint(record, 0)
+		record = appendVint(record, 0x0001|0x0002) // Check present, use MAC
+		record = append(record, rar5KdfCount)
+		record = append(record, rar5Salt...)
+		record = append(record, rar5Iv...)
+		record = append(record, w.check...)
+		extra = append(appendVint(nil, uint64(len(record))), record...)
+	}
+
+	body := appendVint(nil, 2) // File
+	body = appendVint(body, flags)
+	if len(extra) > 0 {
+		body = appendVint(body, uint64(len(extra)))
+	}
+	body = appendVint(body, uint64(len(data)))
+	body = appendVint(body, 0x0004) // Checksum present
+	body = appendVint(body, uint64(len(file.Content)))
+	body = appendVint(body, 0x20)
+	body = append(body, checksum...)
+	body = appendVint(body, 0) // Stored
+	body = appendVint(body, 1) // Unix
+	body = appendVint(body, uint64(len(file.Name)))
+	body = append(body, file.Name...)
+	body = append(body, extra...)
+
+	return append(w.block(body), data...)
+}
+
+func buildRar5(files []rarTestFile, options rarWriterOptions) [][]byte {
+	w := &rar5Writer{options: options}
+	if options.Password != "" {
+		w.key, w.hashKey, w.check = rar5Keys(options.Password, rar5Salt)
+	}
+
+	packed := make([][]byte, len(files))
+	for i, file := range files {
+		packed[i] = file.Content
+		if options.Password != "" {
+			packed[i] = encryptCbc(w.key, rar5Iv, file.Content)
+		}
+	}
+	lastParts := splitParts(packed[len(files)-1], options.Volumes)
+
+	volumes := make([][]byte, options.Volumes)
+	for v := range volumes {
+		volume := []byte("Rar!\x1a\x07\x01\x00")
+
+		if options.EncryptHeaders {
+			body := appendVint(nil, 4) // Encryption
+			body = appendVint(body, 0)
+			body = appendVint(body, 0)
+			body = appendVint(body, 0x0001) // Check present
+			body = append(body, rar5KdfCount)
+			body = append(body, rar5Salt...)
+			body = append(body, w.check...)
+
+			sized := append(appendVint(nil, uint64(len(body))), body...)
+			volume = binary.LittleEndian.AppendUint32(volume, crc32.ChecksumIEEE(sized))
+			volume = append(volume, sized...)
+		}
+
+		archiveFlags := uint64(0)
+		if options.Volumes > 1 {
+			archiveFlags |= 0x0001
+		}
+		body := appendVint(nil, 1) // Main archive
+		body = appendVint(body, 0)
+		body = appendVint(body, archiveFlags)
+		volume = append(volume, w.block(body)...)
+
+		if v == 0 {
+			for i, file := range files[:len(files)-1] {
+				volume = append(volume, w.fileBlock(file, packed[i], false, false)...)
+			}
+		}
+		volume = append(volume, w.fileBlock(files[len(files)-1], lastParts[v], v > 0, v < options.Volumes-1)...)
+
+		var endFlags uint64
+		if v < options.Volumes-1 {
+			endFlags = 0x0001
+		}
+		body = appendVint(nil, 5) // End of archive
+		body = appendVint(body, 0)
+		body = appendVint(body, endFlags)
+		volumes[v] = append(volume, w.block(body)...)
+	}
+	return volumes
+}
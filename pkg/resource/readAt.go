@@ -0,0 +1,80 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// ReadAtParts reads at off from the parts laid out after each other as in the index, e.g. for mergers
+// Parts covered by p are read in parallel; Reaching the end of the last part returns io.EOF
+func ReadAtParts(ctx context.Context, part func(i int) io.Reader, index *OffsetIndex, p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, ErrInvalidSeek
+	}
+
+	type partRead struct {
+		part   int
+		buf    []byte
+		offset int64
+		n      int
+		err    error
+	}
+	reads := make([]*partRead, 0, 1)
+
+	// Split p into the sections of the parts it covers
+	covered := 0
+	first, _ := index.Find(off)
+	for i := first; i < index.Len() && covered < len(p); i++ {
+		partEnd := index.Start(i) + index.PartSize(i)
+		pos := off + int64(covered)
+		if pos < partEnd {
+			length := min(int64(len(p)-covered), partEnd-pos)
+			reads = append(reads, &partRead{
+				part:   i,
+				buf:    p[covered : covered+int(length)],
+				offset: pos - index.Start(i),
+			})
+			covered += int(length)
+		}
+	}
+
+	read := func(partRead *partRead) {
+		partRead.n, partRead.err = ReadAtContext(ctx, part(partRead.part), partRead.buf, partRead.offset)
+	}
+	if len(reads) == 1 {
+		read(reads[0])
+	} else {
+		var group errgroup.Group
+		for _, partRead := range reads {
+			group.Go(func() error {
+				read(partRead)
+				return nil
+			})
+		}
+		//nolint:errcheck // Errors are in the reads
+		group.Wait()
+	}
+
+	// Only data up to the first failed part is valid
+	total := 0
+	for _, partRead := range reads {
+		total += partRead.n
+		if partRead.n == len(partRead.buf) {
+			continue
+		}
+		if partRead.err == nil || errors.Is(partRead.err, io.EOF) {
+			// Part ended before its size, sizes are off
+			return total, fmt.Errorf("part %d ended at %d of %d: %w", partRead.part, partRead.offset+int64(partRead.n), index.PartSize(partRead.part), io.ErrUnexpectedEOF)
+		}
+		return total, fmt.Errorf("failed reading part %d at %d: %w", partRead.part, partRead.offset, partRead.err)
+	}
+
+	if covered < len(p) {
+		return total, io.EOF
+	}
+	return total, nil
+}
@@ -3,10 +3,11 @@ package sevenzipfileresource
 import (
 	"errors"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
 	"io/fs"
 
-	"git.ruekov.eu/ruakij/nzbStreamer/pkg/iofsops"
 	"git.ruekov.eu/ruakij/nzbStreamer/pkg/readeratwrapper"
 	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
 	"github.com/bodgit/sevenzip"
@@ -23,6 +24,8 @@ type SevenzipFileResource struct {
 	password string
 	filename string
 	size     int64
+
+	checksumListener func(err error)
 }
 
 func NewSevenzipFileResource(resource resource.ReadSeekCloseableResource, password, filename string) *SevenzipFileResource {
@@ -34,11 +37,30 @@ func NewSevenzipFileResource(resource resource.ReadSeekCloseableResource, passwo
 	}
 }
 
+// NewSevenzipFileResourceWithSize creates a SevenzipFileResource for a file whose uncompressed size is already known,
+// so the archive doesnt have to be opened to get it
+func NewSevenzipFileResourceWithSize(resource resource.ReadSeekCloseableResource, password, filename string, size int64) *SevenzipFileResource {
+	r := NewSevenzipFileResource(resource, password, filename)
+	r.size = size
+	return r
+}
+
+// SetChecksumListener sets the function called when the file was read to its end and its CRC32 was compared
+// Files without a stored CRC32 are never reported, see verifyChecksum
+func (r *SevenzipFileResource) SetChecksumListener(listener func(err error)) {
+	r.checksumListener = listener
+}
+
 type SevenzipFileResourceReader struct {
-	resource       *SevenzipFileResource
-	sevenzipReader *sevenzip.Reader
-	fileReader     io.ReadCloser
-	index          int64
+	resource         *SevenzipFileResource
+	underlyingReader io.ReadSeekCloser
+	sevenzipReader   *sevenzip.Reader
+	fileReader       io.ReadCloser
+	index            int64
+
+	// CRC32 of the data read from the start, the library itself doesnt check it
+	checksum         hash.Hash32
+	expectedChecksum uint32
 }
 
 func (r *SevenzipFileResource) Open() (io.ReadSeekCloser, error) {
@@ -55,6 +77,8 @@ func (r *SevenzipFileResource) Open() (io.ReadSeekCloser, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed opening 7z file: %w", err)
 	}
+	reader.checksum = crc32.NewIEEE()
+	reader.expectedChecksum = file.CRC32
 
 	if file.UncompressedSize > uint64(1<<63-1) {
 		return nil, fmt.Errorf("%w: size %d", ErrFileSizeExceedsMax, file.UncompressedSize)
@@ -83,25 +107,34 @@ func (r *SevenzipFileResource) open() (*SevenzipFileResourceReader, error) {
 		r.password,
 	)
 	if err != nil {
+		reader.Close()
 		return nil, fmt.Errorf("failed creating new 7z reader: %w", err)
 	}
 
 	return &SevenzipFileResourceReader{
-		resource:       r,
-		sevenzipReader: sevenzipReader,
-		index:          0,
+		resource:         r,
+		underlyingReader: reader,
+		sevenzipReader:   sevenzipReader,
+		index:            0,
 	}, nil
 }
 
+// GetFiles lists all files in the archive with their full path.
+// Only the start- and end-header are read, which 7z keeps in front of and behind the packed streams.
 func (r *SevenzipFileResource) GetFiles() (map[string]fs.FileInfo, error) {
 	reader, err := r.open()
 	if err != nil {
 		return nil, err
 	}
+	defer reader.Close()
 
-	fileInfos, err := iofsops.BuildFileList(reader.sevenzipReader, ".")
-	if err != nil {
-		return nil, fmt.Errorf("failed building filelist from 7z: %w", err)
+	fileInfos := make(map[string]fs.FileInfo, len(reader.sevenzipReader.File))
+	for _, file := range reader.sevenzipReader.File {
+		fileInfo := file.FileInfo()
+		if fileInfo.IsDir() {
+			continue
+		}
+		fileInfos[file.Name] = fileInfo
 	}
 	return fileInfos, nil
 }
@@ -120,6 +153,13 @@ func (r *SevenzipFileResource) Size() (int64, error) {
 
 func (r *SevenzipFileResourceReader) Close() error {
 	r.sevenzipReader = nil
+	if r.underlyingReader != nil {
+		err := r.underlyingReader.Close()
+		r.underlyingReader = nil
+		if err != nil {
+			return fmt.Errorf("failed closing underlying reader: %w", err)
+		}
+	}
 	return nil
 }
 
@@ -130,11 +170,38 @@ func (r *SevenzipFileResourceReader) Read(p []byte) (int, error) {
 
 	n, err := r.fileReader.Read(p)
 	r.index += int64(n)
+	r.checksum.Write(p[:n])
 
-	if err != nil {
+	if errors.Is(err, io.EOF) {
+		err = r.verifyChecksum()
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
 		return n, fmt.Errorf("failed to read from 7z file: %w", err)
 	}
-	return n, nil
+	return n, err
+}
+
+// verifyChecksum compares the checksum at the end of the file and informs the listener, returns io.EOF when it matched
+func (r *SevenzipFileResourceReader) verifyChecksum() error {
+	// The library doesnt tell if a CRC32 is stored and reads a missing one as 0
+	// A stored 0 is still verified when the data matches it, otherwise it cant be told apart from a missing one
+	sum := r.checksum.Sum32()
+	if r.expectedChecksum == 0 && sum != 0 {
+		return io.EOF
+	}
+
+	var err error
+	if sum != r.expectedChecksum {
+		err = fmt.Errorf("%w: crc32 is %08x, expected %08x", resource.ErrBadChecksum, sum, r.expectedChecksum)
+	}
+	if r.resource.checksumListener != nil {
+		r.resource.checksumListener(err)
+	}
+
+	if err != nil {
+		return err
+	}
+	return io.EOF
 }
 
 func (r *SevenzipFileResourceReader) Seek(offset int64, whence int) (newIndex int64, err error) {
@@ -172,10 +239,11 @@ func (r *SevenzipFileResourceReader) Seek(offset int64, whence int) (newIndex in
 		}
 
 		r.index = 0
+		r.checksum.Reset()
 	}
 
-	// Skip forwards
-	n, err := io.CopyN(io.Discard, r.fileReader, newIndex-r.index)
+	// Skip forwards, skipped data is still part of the checksum
+	n, err := io.CopyN(r.checksum, r.fileReader, newIndex-r.index)
 	if err != nil {
 		return 0, fmt.Errorf("failed dicarding %d bytes forward: %w", newIndex-r.index, err)
 	}
@@ -0,0 +1,130 @@
+package sevenzipfileresource_test
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io"
+	"testing"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/bytesresource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/sevenzipfileresource"
+)
+
+// readWithListener reads the file to its end, returning the checksum-results reported and the read-error
+func readWithListener(t *testing.T, archive []byte, filename string) ([]error, error) {
+	t.Helper()
+
+	fileResource := sevenzipfileresource.NewSevenzipFileResource(&bytesresource.BytesResource{Content: archive}, "", filename)
+	var reported []error
+	fileResource.SetChecksumListener(func(err error) {
+		reported = append(reported, err)
+	})
+
+	reader, err := fileResource.Open()
+	if err != nil {
+		t.Fatalf("failed opening: %v", err)
+	}
+	defer reader.Close()
+
+	_, err = io.ReadAll(reader)
+	return reported, err
+}
+
+func TestSevenzipFileResourceChecksum(t *testing.T) {
+	t.Parallel()
+
+	zeroCRC := withCRC32([]byte("Hello 7z"), 0)
+	if crc32.ChecksumIEEE(zeroCRC) != 0 {
+		t.Fatalf("expected fixture to have crc32 0")
+	}
+
+	tests := []struct {
+		name    string
+		file    sevenzipTestFile
+		corrupt bool
+		// Listener expected to be called, and with ErrBadChecksum
+		reported bool
+		bad      bool
+	}{
+		{"Valid", sevenzipTestFile{Content: []byte("Hello 7z")}, false, true, false},
+		{"Corrupt", sevenzipTestFile{Content: []byte("Hello 7z")}, true, true, true},
+		{"NoCRC", sevenzipTestFile{Content: []byte("Hello 7z"), NoCRC: true}, true, false, false},
+		{"StoredZero", sevenzipTestFile{Content: zeroCRC}, false, true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			test.file.Name = "file.txt"
+			files := []sevenzipTestFile{{Name: "other.txt", Content: []byte("Other file")}, test.file}
+			archive := buildSevenzip(files)
+			if test.corrupt {
+				index := bytes.Index(archive, test.file.Content)
+				archive[index] ^= 0xff
+			}
+
+			reported, err := readWithListener(t, archive, test.file.Name)
+			if !test.reported {
+				if err != nil || len(reported) != 0 {
+					t.Errorf("expected file without crc32 to be read unchecked, got %v and reports %v", err, reported)
+				}
+				return
+			}
+			if len(reported) != 1 {
+				t.Fatalf("expected checksum to be reported once, got %v", reported)
+			}
+
+			if test.bad {
+				if !errors.Is(err, resource.ErrBadChecksum) {
+					t.Errorf("expected ErrBadChecksum reading, got %v", err)
+				}
+				if !errors.Is(reported[0], resource.ErrBadChecksum) {
+					t.Errorf("expected listener to get ErrBadChecksum, got %v", reported[0])
+				}
+				return
+			}
+			if err != nil || reported[0] != nil {
+				t.Errorf("expected valid checksum, got %v and report %v", err, reported[0])
+			}
+		})
+	}
+}
+
+func TestSevenzipFileResourceSeekBackVerifiesChecksum(t *testing.T) {
+	t.Parallel()
+
+	content := bytes.Repeat([]byte("Hello 7z "), 1000)
+	archive := buildSevenzip([]sevenzipTestFile{{Name: "file.txt", Content: content}})
+
+	fileResource := sevenzipfileresource.NewSevenzipFileResource(&bytesresource.BytesResource{Content: archive}, "", "file.txt")
+	var reported []error
+	fileResource.SetChecksumListener(func(err error) {
+		reported = append(reported, err)
+	})
+
+	reader, err := fileResource.Open()
+	if err != nil {
+		t.Fatalf("failed opening: %v", err)
+	}
+	defer reader.Close()
+
+	if _, err := io.CopyN(io.Discard, reader, 5000); err != nil {
+		t.Fatalf("failed reading: %v", err)
+	}
+	// Skipped and reread data still counts to the checksum
+	if _, err := reader.Seek(100, io.SeekStart); err != nil {
+		t.Fatalf("failed seeking: %v", err)
+	}
+	read, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed reading after seek: %v", err)
+	}
+	if !bytes.Equal(read, content[100:]) {
+		t.Errorf("expected content from offset 100")
+	}
+	if len(reported) != 1 || reported[0] != nil {
+		t.Errorf("expected a single valid checksum, got %v", reported)
+	}
+}
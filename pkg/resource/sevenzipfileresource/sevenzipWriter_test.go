@@ -0,0 +1,156 @@
+package sevenzipfileresource_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"unicode/utf16"
+)
+
+// Minimal writer for 7z-archives with all files stored (copy-coder) in a single folder, to generate fixtures without the 7z-binary.
+
+type sevenzipTestFile struct {
+	Name    string
+	Content []byte
+	// Leaves the CRC32 undefined in the header
+	NoCRC bool
+}
+
+const (
+	sevenzipIDEnd            = 0x00
+	sevenzipIDHeader         = 0x01
+	sevenzipIDMainStreams    = 0x04
+	sevenzipIDFilesInfo      = 0x05
+	sevenzipIDPackInfo       = 0x06
+	sevenzipIDUnpackInfo     = 0x07
+	sevenzipIDSubStreamsInfo = 0x08
+	sevenzipIDSize           = 0x09
+	sevenzipIDCRC            = 0x0A
+	sevenzipIDFolder         = 0x0B
+	sevenzipIDUnpackSize     = 0x0C
+	sevenzipIDNumUnpack      = 0x0D
+	sevenzipIDName           = 0x11
+)
+
+func buildSevenzip(files []sevenzipTestFile) []byte {
+	var packed []byte
+	for _, file := range files {
+		packed = append(packed, file.Content...)
+	}
+
+	var header bytes.Buffer
+	header.WriteByte(sevenzipIDHeader)
+	header.WriteByte(sevenzipIDMainStreams)
+
+	header.WriteByte(sevenzipIDPackInfo)
+	writeSevenzipNumber(&header, 0)
+	writeSevenzipNumber(&header, 1)
+	header.WriteByte(sevenzipIDSize)
+	writeSevenzipNumber(&header, uint64(len(packed)))
+	header.WriteByte(sevenzipIDEnd)
+
+	header.WriteByte(sevenzipIDUnpackInfo)
+	header.WriteByte(sevenzipIDFolder)
+	writeSevenzipNumber(&header, 1)
+	header.WriteByte(0) // Not external
+	writeSevenzipNumber(&header, 1)
+	header.Write([]byte{0x01, 0x00}) // Simple coder with 1-byte id, copy
+	header.WriteByte(sevenzipIDUnpackSize)
+	writeSevenzipNumber(&header, uint64(len(packed)))
+	header.WriteByte(sevenzipIDEnd)
+
+	header.WriteByte(sevenzipIDSubStreamsInfo)
+	header.WriteByte(sevenzipIDNumUnpack)
+	writeSevenzipNumber(&header, uint64(len(files)))
+	header.WriteByte(sevenzipIDSize)
+	for _, file := range files[:len(files)-1] {
+		writeSevenzipNumber(&header, uint64(len(file.Content)))
+	}
+	header.WriteByte(sevenzipIDCRC)
+	header.WriteByte(0) // Not all defined
+	var defined []byte
+	for i, file := range files {
+		if i%8 == 0 {
+			defined = append(defined, 0)
+		}
+		if !file.NoCRC {
+			defined[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	header.Write(defined)
+	for _, file := range files {
+		if !file.NoCRC {
+			binary.Write(&header, binary.LittleEndian, crc32.ChecksumIEEE(file.Content))
+		}
+	}
+	header.WriteByte(sevenzipIDEnd)
+	header.WriteByte(sevenzipIDEnd)
+
+	header.WriteByte(sevenzipIDFilesInfo)
+	writeSevenzipNumber(&header, uint64(len(files)))
+	var names []byte
+	for _, file := range files {
+		for _, char := range utf16.Encode([]rune(file.Name + "\x00")) {
+			names = binary.LittleEndian.AppendUint16(names, char)
+		}
+	}
+	header.WriteByte(sevenzipIDName)
+	writeSevenzipNumber(&header, uint64(len(names)+1))
+	header.WriteByte(0) // Not external
+	header.Write(names)
+	header.WriteByte(sevenzipIDEnd)
+	header.WriteByte(sevenzipIDEnd)
+
+	startHeader := binary.LittleEndian.AppendUint64(nil, uint64(len(packed)))
+	startHeader = binary.LittleEndian.AppendUint64(startHeader, uint64(header.Len()))
+	startHeader = binary.LittleEndian.AppendUint32(startHeader, crc32.ChecksumIEEE(header.Bytes()))
+
+	archive := []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c, 0, 4}
+	archive = binary.LittleEndian.AppendUint32(archive, crc32.ChecksumIEEE(startHeader))
+	archive = append(archive, startHeader...)
+	archive = append(archive, packed...)
+	return append(archive, header.Bytes()...)
+}
+
+// writeSevenzipNumber writes the variable-length number, the leading 1-bits of the first byte count the bytes following
+func writeSevenzipNumber(buffer *bytes.Buffer, value uint64) {
+	extra := 0
+	for extra < 8 && value >= 1<<(7*(extra+1)) {
+		extra++
+	}
+
+	first := byte(0xff << (8 - extra))
+	if extra < 8 {
+		first |= byte(value >> (8 * extra))
+	}
+	buffer.WriteByte(first)
+	for i := range extra {
+		buffer.WriteByte(byte(value >> (8 * i)))
+	}
+}
+
+// withCRC32 appends 4 bytes to data, so the CRC32 of the result is target
+func withCRC32(data []byte, target uint32) []byte {
+	table := crc32.MakeTable(crc32.IEEE)
+
+	// Each table-entry has a unique top byte, which tells the entry used in a step when going backwards from the target
+	var indices [4]byte
+	register := ^target
+	for i := 3; i >= 0; i-- {
+		for index, entry := range table {
+			if entry>>24 == register>>24 {
+				indices[i] = byte(index)
+				register = (register ^ entry) << 8
+				break
+			}
+		}
+	}
+
+	register = ^crc32.ChecksumIEEE(data)
+	result := append([]byte(nil), data...)
+	for _, index := range indices {
+		result = append(result, byte(register)^index)
+		register = register>>8 ^ table[index]
+	}
+	return result
+}
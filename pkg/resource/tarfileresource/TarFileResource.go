@@ -0,0 +1,86 @@
+package tarfileresource
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/offsetresource"
+)
+
+// TarFileResource gives access to the files stored in a tar
+// Tar doesnt compress, so each file is an offset-view into the underlying resource
+type TarFileResource struct {
+	resource resource.ReadSeekCloseableResource
+}
+
+// TarFile is a file stored in the tar, with the position of its data
+type TarFile struct {
+	Name   string
+	Offset int64
+	Size   int64
+}
+
+func NewTarFileResource(resource resource.ReadSeekCloseableResource) *TarFileResource {
+	return &TarFileResource{
+		resource: resource,
+	}
+}
+
+// GetFiles lists all regular files in the tar.
+// Only the headers are read, file-data is skipped by seeking the underlying resource.
+// Sparse files are left out, as their data cannot be mapped directly.
+func (r *TarFileResource) GetFiles() ([]TarFile, error) {
+	reader, err := r.resource.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed opening underlying resource: %w", err)
+	}
+	defer reader.Close()
+
+	var files []TarFile
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed reading tar header: %w", err)
+		}
+
+		if header.Typeflag != tar.TypeReg || isSparse(header) {
+			continue
+		}
+
+		// After the header, the reader is at the start of the file-data
+		offset, err := reader.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, fmt.Errorf("failed getting offset of %s: %w", header.Name, err)
+		}
+
+		files = append(files, TarFile{
+			Name:   header.Name,
+			Offset: offset,
+			Size:   header.Size,
+		})
+	}
+
+	return files, nil
+}
+
+// GetFileResource returns the resource for a file listed by GetFiles
+func (r *TarFileResource) GetFileResource(file TarFile) *offsetresource.OffsetResource {
+	return offsetresource.NewOffsetResource(r.resource, file.Offset, file.Size)
+}
+
+func isSparse(header *tar.Header) bool {
+	for key := range header.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package tarfileresource_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"testing"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/bytesresource"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/resource/tarfileresource"
+)
+
+func TestTarFileResource(t *testing.T) {
+	t.Parallel()
+
+	contents := map[string]string{
+		"a.txt":     "Hello",
+		"dir/b.txt": "World, this is a longer file",
+	}
+
+	buf := new(bytes.Buffer)
+	writer := tar.NewWriter(buf)
+	if err := writer.WriteHeader(&tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0o755}); err != nil {
+		t.Fatalf("failed writing dir header: %v", err)
+	}
+	for _, name := range []string{"a.txt", "dir/b.txt"} {
+		if err := writer.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(contents[name]))}); err != nil {
+			t.Fatalf("failed writing header: %v", err)
+		}
+		if _, err := writer.Write([]byte(contents[name])); err != nil {
+			t.Fatalf("failed writing content: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed closing tar writer: %v", err)
+	}
+
+	tarResource := tarfileresource.NewTarFileResource(&bytesresource.BytesResource{Content: buf.Bytes()})
+	files, err := tarResource.GetFiles()
+	if err != nil {
+		t.Fatalf("failed listing files: %v", err)
+	}
+	if len(files) != len(contents) {
+		t.Fatalf("expected %d files, got %d", len(contents), len(files))
+	}
+
+	for _, file := range files {
+		fileResource := tarResource.GetFileResource(file)
+		reader, err := fileResource.Open()
+		if err != nil {
+			t.Fatalf("failed opening %s: %v", file.Name, err)
+		}
+
+		content, err := io.ReadAll(reader)
+		if err != nil {
+			t.Errorf("failed reading %s: %v", file.Name, err)
+		}
+		if string(content) != contents[file.Name] {
+			t.Errorf("expected content %q for %s, got %q", contents[file.Name], file.Name, content)
+		}
+
+		// Random access within file
+		if _, err = reader.Seek(2, io.SeekStart); err != nil {
+			t.Errorf("failed seeking in %s: %v", file.Name, err)
+		}
+		content, err = io.ReadAll(reader)
+		if err != nil {
+			t.Errorf("failed reading %s after seek: %v", file.Name, err)
+		}
+		if string(content) != contents[file.Name][2:] {
+			t.Errorf("expected content %q for %s after seek, got %q", contents[file.Name][2:], file.Name, content)
+		}
+
+		reader.Close()
+	}
+}
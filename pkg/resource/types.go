@@ -1,12 +1,16 @@
 package resource
 
 import (
+	"context"
 	"errors"
 	"io"
 )
 
 var (
 	ErrInvalidSeek = errors.New("invalid seek position")
+	ErrBadChecksum = errors.New("bad checksum")
+	// Reader cant read at offsets e.g. as it decompresses sequentially
+	ErrReadAtUnsupported = errors.New("reading at offset unsupported")
 )
 
 // Resource is an interface to excapsulate Open and Size actions from data-resources
@@ -30,3 +34,25 @@ type ReadSeekCloseableResource interface {
 type SizeAccurateResource interface {
 	IsSizeAccurate() bool
 }
+
+// ChecksumVerifyingResource is a resource verifying a checksum of its content when read to the end, e.g. an archive-entry
+type ChecksumVerifyingResource interface {
+	// SetChecksumListener sets the function called when the content was read to the end; err is nil when the checksum matched, otherwise it wraps ErrBadChecksum
+	SetChecksumListener(listener func(err error))
+}
+
+// ContextReader is a reader whose reads are aborted when ctx is done e.g. the request reading was cancelled
+type ContextReader interface {
+	ReadContext(ctx context.Context, p []byte) (int, error)
+}
+
+// ContextReaderAt reads at offsets without a shared position, so calls may run concurrently
+// Like io.ReaderAt, reading less than len(p) returns an error; Fails with ErrReadAtUnsupported when an underlying reader cant read at offsets
+type ContextReaderAt interface {
+	ReadAtContext(ctx context.Context, p []byte, off int64) (int, error)
+}
+
+// ContextResource is a resource whose readers stop their background-work when ctx is done
+type ContextResource interface {
+	OpenContext(ctx context.Context) (io.ReadSeekCloser, error)
+}
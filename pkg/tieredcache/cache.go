@@ -0,0 +1,141 @@
+// Package tieredcache layers a fast, small cache (e.g. memory) over a slower, larger one (e.g. disk)
+package tieredcache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache"
+)
+
+var logger = slog.With("Module", "TieredCache")
+
+var (
+	_ cache.ExpiringCache = (*Cache)(nil)
+	_ cache.PinningCache  = (*Cache)(nil)
+)
+
+// Cache writes items to the lower tier and promotes them to the upper tier when read
+type Cache struct {
+	upper cache.Cache
+	lower cache.Cache
+}
+
+func NewCache(upper, lower cache.Cache) *Cache {
+	return &Cache{
+		upper: upper,
+		lower: lower,
+	}
+}
+
+func (c *Cache) SetWithReader(key string, reader io.Reader, options ...cache.SetOption) (int64, error) {
+	// Stale copy in upper tier would shadow the new item
+	if err := c.upper.Remove(key); err != nil && !errors.Is(err, cache.ErrItemNotFound) {
+		return 0, fmt.Errorf("failed removing stale item from upper tier: %w", err)
+	}
+
+	n, err := c.lower.SetWithReader(key, reader, options...)
+	if err != nil {
+		return n, fmt.Errorf("failed setting item in lower tier: %w", err)
+	}
+	return n, nil
+}
+
+func (c *Cache) GetWithReader(key string) (io.ReadSeekCloser, *cache.ItemHeader, error) {
+	reader, header, err := c.upper.GetWithReader(key)
+	if err == nil {
+		return reader, header, nil
+	}
+	if !errors.Is(err, cache.ErrItemNotFound) {
+		logger.Warn("Failed getting item from upper tier, using lower", "key", key, "error", err)
+	}
+
+	reader, header, err = c.lower.GetWithReader(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.promote(key, reader, header)
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		reader.Close()
+		return nil, nil, fmt.Errorf("failed rewinding lower tier reader after promoting: %w", err)
+	}
+
+	return reader, header, nil
+}
+
+// promote copies the item to the upper tier, failing is fine as item might just be too large for it
+func (c *Cache) promote(key string, reader io.Reader, header *cache.ItemHeader) {
+	// The promoted copy must not outlive the item
+	var options []cache.SetOption
+	if !header.ExpiresAt.IsZero() {
+		ttl := time.Until(header.ExpiresAt)
+		if ttl <= 0 {
+			return
+		}
+		options = append(options, cache.WithTTL(ttl))
+	}
+
+	if _, err := c.upper.SetWithReader(key, reader, options...); err != nil {
+		logger.Debug("Didnt promote item to upper tier", "key", key, "error", err)
+	}
+}
+
+func (c *Cache) Exists(key string) (bool, cache.ItemHeader) {
+	if exists, header := c.upper.Exists(key); exists {
+		return exists, header
+	}
+	return c.lower.Exists(key)
+}
+
+func (c *Cache) Remove(key string) error {
+	upperErr := c.upper.Remove(key)
+	if upperErr != nil && !errors.Is(upperErr, cache.ErrItemNotFound) {
+		return fmt.Errorf("failed removing item from upper tier: %w", upperErr)
+	}
+
+	lowerErr := c.lower.Remove(key)
+	if lowerErr != nil && !errors.Is(lowerErr, cache.ErrItemNotFound) {
+		return fmt.Errorf("failed removing item from lower tier: %w", lowerErr)
+	}
+
+	if upperErr != nil && lowerErr != nil {
+		return cache.ErrItemNotFound
+	}
+	return nil
+}
+
+// RemoveExpired removes expired items from tiers supporting it
+func (c *Cache) RemoveExpired() (int, error) {
+	removed := 0
+	for _, tier := range []cache.Cache{c.upper, c.lower} {
+		expiringTier, ok := tier.(cache.ExpiringCache)
+		if !ok {
+			continue
+		}
+
+		n, err := expiringTier.RemoveExpired()
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// UnpinOwner unpins items in tiers supporting it
+func (c *Cache) UnpinOwner(owner string) error {
+	for _, tier := range []cache.Cache{c.upper, c.lower} {
+		pinningTier, ok := tier.(cache.PinningCache)
+		if !ok {
+			continue
+		}
+		if err := pinningTier.UnpinOwner(owner); err != nil {
+			return err
+		}
+	}
+	return nil
+}
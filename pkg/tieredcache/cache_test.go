@@ -0,0 +1,145 @@
+package tieredcache_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/cache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/diskcache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/memorycache"
+	"git.ruekov.eu/ruakij/nzbStreamer/pkg/tieredcache"
+)
+
+func newTieredCache(t *testing.T) (*tieredcache.Cache, *memorycache.Cache, *diskcache.Cache) {
+	t.Helper()
+
+	memoryCache, err := memorycache.NewCache(&memorycache.CacheOptions{MaxSize: 100, ItemMaxSize: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	diskCache, err := diskcache.NewCache(&diskcache.CacheOptions{CacheDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tieredcache.NewCache(memoryCache, diskCache), memoryCache, diskCache
+}
+
+func readItem(t *testing.T, c cache.Cache, key string) []byte {
+	t.Helper()
+	reader, _, err := c.GetWithReader(key)
+	if err != nil {
+		t.Fatalf("failed getting %s: %v", key, err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed reading %s: %v", key, err)
+	}
+	return data
+}
+
+func TestTieredCachePromotesOnRead(t *testing.T) {
+	t.Parallel()
+
+	c, memoryCache, diskCache := newTieredCache(t)
+
+	if _, err := c.SetWithReader("small", bytes.NewReader([]byte("Hello World"))); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := diskCache.Exists("small"); !exists {
+		t.Error("expected item to be written to lower tier")
+	}
+	if exists, _ := memoryCache.Exists("small"); exists {
+		t.Error("expected item not to be in upper tier before reading")
+	}
+
+	if data := readItem(t, c, "small"); string(data) != "Hello World" {
+		t.Errorf("expected 'Hello World', got '%s'", data)
+	}
+	if exists, _ := memoryCache.Exists("small"); !exists {
+		t.Error("expected item to be promoted to upper tier after reading")
+	}
+	if data := readItem(t, c, "small"); string(data) != "Hello World" {
+		t.Errorf("expected 'Hello World' from upper tier, got '%s'", data)
+	}
+}
+
+func TestTieredCacheLargeItemsStayInLowerTier(t *testing.T) {
+	t.Parallel()
+
+	c, memoryCache, _ := newTieredCache(t)
+
+	large := bytes.Repeat([]byte("0123456789"), 5)
+	if _, err := c.SetWithReader("large", bytes.NewReader(large)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Failed promotion must not leave the reader at a wrong position
+	if data := readItem(t, c, "large"); !bytes.Equal(data, large) {
+		t.Errorf("content mismatch reading large item")
+	}
+	if exists, _ := memoryCache.Exists("large"); exists {
+		t.Error("expected too large item not to be promoted")
+	}
+}
+
+func TestTieredCacheOverwriteAndRemove(t *testing.T) {
+	t.Parallel()
+
+	c, memoryCache, diskCache := newTieredCache(t)
+
+	if _, err := c.SetWithReader("a", bytes.NewReader([]byte("old"))); err != nil {
+		t.Fatal(err)
+	}
+	readItem(t, c, "a")
+
+	if _, err := c.SetWithReader("a", bytes.NewReader([]byte("new"))); err != nil {
+		t.Fatal(err)
+	}
+	if data := readItem(t, c, "a"); string(data) != "new" {
+		t.Errorf("expected overwritten item to be read, got '%s'", data)
+	}
+
+	if err := c.Remove("a"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := c.Exists("a"); exists {
+		t.Error("expected item to be removed")
+	}
+	if exists, _ := memoryCache.Exists("a"); exists {
+		t.Error("expected item to be removed from upper tier")
+	}
+	if exists, _ := diskCache.Exists("a"); exists {
+		t.Error("expected item to be removed from lower tier")
+	}
+	if err := c.Remove("a"); !errors.Is(err, cache.ErrItemNotFound) {
+		t.Errorf("expected ErrItemNotFound removing again, got %v", err)
+	}
+}
+
+func TestTieredCachePromotedItemKeepsExpiry(t *testing.T) {
+	t.Parallel()
+
+	c, memoryCache, _ := newTieredCache(t)
+
+	if _, err := c.SetWithReader("a", bytes.NewReader([]byte("Hello")), cache.WithTTL(20*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	readItem(t, c, "a")
+	if exists, _ := memoryCache.Exists("a"); !exists {
+		t.Fatal("expected item to be promoted")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if exists, _ := memoryCache.Exists("a"); exists {
+		t.Error("expected promoted item to expire with the original")
+	}
+	if _, _, err := c.GetWithReader("a"); !errors.Is(err, cache.ErrItemNotFound) {
+		t.Errorf("expected ErrItemNotFound for expired item, got %v", err)
+	}
+}